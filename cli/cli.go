@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/parsers"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Module running the offline maintenance subcommands:
+// gigapi [flags] <command> [command flags] [args]
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"compact": {"compact <db> <table>\n\truns all the merge iterations of the table to completion",
+			compact},
+		"inspect": {"inspect [-files] [-json] <db> [<table>]\n\tprints the tables of the database or the partitions and files of the table",
+			inspect},
+		"verify": {"verify [-min-age 10m] [<db> [<table>...]]\n\treports the inconsistencies between the indexes and the files",
+			func(args []string) error { return check("verify", args, false) }},
+		"repair": {"repair [-min-age 10m] [<db> [<table>...]]\n\tfixes the inconsistencies between the indexes and the files",
+			func(args []string) error { return check("repair", args, true) }},
+		"import": {"import [-time-column <column>] <db> <table> <file.parquet>...\n\timports the parquet files (- for stdin) into the table",
+			importFiles},
+		"rebuild-index": {"rebuild-index <db> <table>\n\tregenerates the metadata.json of every partition from the parquet footers",
+			rebuildIndex},
+	}
+}
+
+// Init runs the subcommand of the command line and exits.
+// It does nothing if no subcommand is provided.
+func Init() {
+	if flag.NArg() == 0 {
+		return
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+	err := cmd.run(flag.Args()[1:])
+	repository.FlushManifests()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "Usage: gigapi [flags] <command> [args]\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+func parseFlags(fs *flag.FlagSet, args []string, minArgs int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() < minArgs {
+		return nil, fmt.Errorf("usage: %s", commands[fs.Name()].usage)
+	}
+	return fs.Args(), nil
+}
+
+func compact(args []string) error {
+	args, err := parseFlags(flag.NewFlagSet("compact", flag.ContinueOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = repository.CompactTable(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	// the merged files are removed right away, no query can read them
+	removed, err := repository.CleanDropQueue(context.Background(), args[0], args[1])
+	if err != nil {
+		return err
+	}
+	manifest, err := repository.GetTableManifest(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	files := int64(0)
+	for _, p := range manifest.Partitions {
+		files += p.Files
+	}
+	fmt.Printf("%s.%s compacted in %v: %d partitions, %d files, %d merged files removed\n",
+		args[0], args[1], time.Since(start).Round(time.Millisecond), len(manifest.Partitions), files,
+		len(removed))
+	return nil
+}
+
+func formatTime(ns int64) string {
+	return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	withFiles := fs.Bool("files", false, "list the files of the partitions")
+	asJSON := fs.Bool("json", false, "print JSON")
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	if len(args) == 1 {
+		manifests, err := repository.ListTableManifests(args[0])
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(manifests)
+		}
+		fmt.Fprintln(w, "TABLE\tPARTITIONS\tROWS\tBYTES\tMIN TIME\tMAX TIME")
+		for _, m := range manifests {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", m.Table, len(m.Partitions), m.RowCount,
+				m.ParquetSizeBytes, formatTime(m.MinTime), formatTime(m.MaxTime))
+		}
+		return nil
+	}
+
+	if *withFiles {
+		partitions, err := repository.ListFiles(args[0], args[1], nil)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(partitions)
+		}
+		fmt.Fprintln(w, "PARTITION\tFILE\tROWS\tBYTES\tMIN TIME\tMAX TIME")
+		for _, part := range partitions {
+			for _, f := range part.Files {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", partitionName(part.Values), filepath.Base(f.Path),
+					f.RowCount, f.SizeBytes, formatTime(f.Min["__timestamp"].(int64)),
+					formatTime(f.Max["__timestamp"].(int64)))
+			}
+		}
+		return nil
+	}
+
+	m, err := repository.GetTableManifest(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(m)
+	}
+	columns := make([]string, 0, len(m.Schema))
+	for name, tp := range m.Schema {
+		columns = append(columns, name+" "+tp)
+	}
+	sort.Strings(columns)
+	fmt.Fprintf(w, "Table:\t%s.%s\n", m.Database, m.Table)
+	fmt.Fprintf(w, "Engine:\t%s\n", m.Engine)
+	fmt.Fprintf(w, "Partition by:\t%s\n", m.PartitionBy)
+	fmt.Fprintf(w, "Order by:\t%s\n", strings.Join(m.OrderBy, ", "))
+	fmt.Fprintf(w, "Schema:\t%s\n", strings.Join(columns, ", "))
+	fmt.Fprintf(w, "Rows:\t%d\n", m.RowCount)
+	fmt.Fprintf(w, "Bytes:\t%d\n", m.ParquetSizeBytes)
+	fmt.Fprintf(w, "Time range:\t%s - %s\n\n", formatTime(m.MinTime), formatTime(m.MaxTime))
+	fmt.Fprintln(w, "PARTITION\tFILES\tROWS\tBYTES\tMIN TIME\tMAX TIME")
+	for _, p := range m.Partitions {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", p.Path, p.Files, p.RowCount, p.ParquetSizeBytes,
+			formatTime(p.MinTime), formatTime(p.MaxTime))
+	}
+	return nil
+}
+
+func partitionName(values [][2]string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = v[0] + "=" + v[1]
+	}
+	return strings.Join(parts, "/")
+}
+
+func check(name string, args []string, repair bool) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	minAge := fs.Duration("min-age", repository.DefaultCheckMinAge(),
+		"the files not referenced by the indexes are only considered after this age")
+	args, err := parseFlags(fs, args, 0)
+	if err != nil {
+		return err
+	}
+	db := ""
+	if len(args) > 0 {
+		db = args[0]
+	}
+	var tables []string
+	if len(args) > 1 {
+		tables = args[1:]
+	}
+	reports, err := repository.CheckTables(context.Background(), db, tables, repository.CheckOptions{
+		Repair:         repair,
+		MinAge:         *minAge,
+		CleanDropQueue: repair,
+	})
+	if err != nil {
+		return err
+	}
+	problems := 0
+	for _, r := range reports {
+		problems += r.Fixes() + len(r.Errors)
+	}
+	err = printJSON(reports)
+	if err != nil {
+		return err
+	}
+	if problems > 0 && !repair {
+		return fmt.Errorf("%d problems found", problems)
+	}
+	return nil
+}
+
+func importFiles(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	timeColumn := fs.String("time-column", "", "the column of the row timestamps")
+	args, err := parseFlags(fs, args, 3)
+	if err != nil {
+		return err
+	}
+	db, table := args[0], args[1]
+	for _, fileName := range args[2:] {
+		rows, err := importFile(db, table, fileName, *timeColumn)
+		var parseErr *repository.ParseError
+		if errors.As(err, &parseErr) {
+			return fmt.Errorf("%s: invalid parquet file: %w", fileName, err)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+		fmt.Printf("%s: %d rows imported into %s.%s\n", fileName, rows, db, table)
+	}
+	return nil
+}
+
+// importFile imports the parquet file, - reads it from stdin
+func importFile(db, table, fileName, timeColumn string) (int64, error) {
+	var r io.ReadSeeker
+	if fileName == "-" {
+		// the file is parsed twice, so stdin is read into memory
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+	parser := &parsers.ParquetParser{Table: table, TimeColumn: timeColumn}
+	return repository.Import(context.Background(), db, parser, r)
+}
+
+func rebuildIndex(args []string) error {
+	args, err := parseFlags(flag.NewFlagSet("rebuild-index", flag.ContinueOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	skipped, err := repository.RebuildIndex(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	for _, f := range skipped {
+		fmt.Printf("skipped the file with an unreadable footer: %s\n", f)
+	}
+	m, err := repository.GetTableManifest(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s.%s: %d partitions, %d rows indexed\n", args[0], args[1], len(m.Partitions), m.RowCount)
+	return nil
+}
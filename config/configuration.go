@@ -1,32 +1,181 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/viper"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// TableConfiguration overrides the settings of a single table
+type TableConfiguration struct {
+	Database    string `json:"database" mapstructure:"database" default:""`
+	Name        string `json:"name" mapstructure:"name" default:""`
+	PartitionBy string `json:"partition_by" mapstructure:"partition_by" default:""`
+}
+
+// Node roles
+const (
+	// RoleAll ingests, saves and compacts the data
+	RoleAll = "all"
+	// RoleWriter ingests the data and saves it as level-1 files
+	RoleWriter = "writer"
+	// RoleCompactor compacts the tables written by the other nodes sharing the data root
+	RoleCompactor = "compactor"
+)
+
+// MergeTierCount is the number of the merge iterations.
+// The files produced by the last one are not merged anymore.
+const MergeTierCount = 4
+
+// MergeTierConfiguration configures a single merge iteration
+type MergeTierConfiguration struct {
+	// TimeoutS is the interval between the merges of the iteration
+	TimeoutS int `json:"timeout_s" mapstructure:"timeout_s"`
+	// MaxSizeMB is the maximum size of a file produced by the iteration
+	MaxSizeMB int64 `json:"max_size_mb" mapstructure:"max_size_mb"`
+}
+
+// DefaultMergeTiers returns the merge iterations derived from merge_timeout_s
+func DefaultMergeTiers(mergeTimeoutS int) []MergeTierConfiguration {
+	return []MergeTierConfiguration{
+		{TimeoutS: mergeTimeoutS, MaxSizeMB: 100},
+		{TimeoutS: mergeTimeoutS * 10, MaxSizeMB: 400},
+		{TimeoutS: mergeTimeoutS * 100, MaxSizeMB: 4000},
+		{TimeoutS: mergeTimeoutS * 420, MaxSizeMB: 4000},
+	}
+}
+
+type MergesConfiguration struct {
+	// IntervalS is the period of the merge planning
+	IntervalS float64 `json:"interval_s" mapstructure:"interval_s" default:"10"`
+	// Concurrency is the number of the merges running at once per table
+	Concurrency int `json:"concurrency" mapstructure:"concurrency" default:"10"`
+	// FirstTierConcurrency is the number of the first iteration merges running at once
+	FirstTierConcurrency int `json:"first_tier_concurrency" mapstructure:"first_tier_concurrency" default:"1" reload:"restart"`
+	// Tiers default to DefaultMergeTiers(merge_timeout_s)
+	Tiers []MergeTierConfiguration `json:"tiers" mapstructure:"tiers"`
+}
+
+// Parquet compression codecs supported both by the writer of the saved files and by DuckDB
+var ParquetCompressions = []string{"uncompressed", "snappy", "gzip", "zstd", "brotli"}
+
+type ParquetConfiguration struct {
+	Compression string `json:"compression" mapstructure:"compression" default:"snappy"`
+	// RowGroupSize is the number of rows per row group of the saved files
+	RowGroupSize int `json:"row_group_size" mapstructure:"row_group_size" default:"8124"`
+	// MergeRowGroupSize is the number of rows per row group of the merged files
+	MergeRowGroupSize int `json:"merge_row_group_size" mapstructure:"merge_row_group_size" default:"122880"`
+}
+
+// S3Configuration holds the defaults of the s3:// URLs missing the endpoint or the credentials
+type S3Configuration struct {
+	Endpoint  string `json:"endpoint" mapstructure:"endpoint" default:""`
+	AccessKey string `json:"access_key" mapstructure:"access_key" default:""`
+	SecretKey string `json:"secret_key" mapstructure:"secret_key" default:"" redact:"true"`
+	Region    string `json:"region" mapstructure:"region" default:""`
+	Insecure  bool   `json:"insecure" mapstructure:"insecure" default:"false"`
+}
+
+type RetentionConfiguration struct {
+	// MergedFilesS is the time the merged files stay on disk for the running queries
+	MergedFilesS float64 `json:"merged_files_s" mapstructure:"merged_files_s" default:"30"`
+	// TmpFilesS is the age after which the unreferenced files are removed by the consistency check
+	TmpFilesS float64 `json:"tmp_files_s" mapstructure:"tmp_files_s" default:"600"`
+	// ExportPinS is the default time the files of an export are protected from the cleanup
+	ExportPinS float64 `json:"export_pin_s" mapstructure:"export_pin_s" default:"3600"`
+}
+
+func (r *RetentionConfiguration) MergedFiles() time.Duration {
+	return time.Duration(r.MergedFilesS * float64(time.Second))
+}
+
+func (r *RetentionConfiguration) TmpFiles() time.Duration {
+	return time.Duration(r.TmpFilesS * float64(time.Second))
+}
+
+func (r *RetentionConfiguration) ExportPin() time.Duration {
+	return time.Duration(r.ExportPinS * float64(time.Second))
+}
+
 type GigapiConfiguration struct {
-	Enabled       bool    `json:"enabled" mapstructure:"enabled" default:"true"`
-	Root          string  `json:"root" mapstructure:"root" default:""`
+	Enabled       bool    `json:"enabled" mapstructure:"enabled" default:"true" reload:"restart"`
+	Root          string  `json:"root" mapstructure:"root" default:"" reload:"restart"`
 	MergeTimeoutS int     `json:"merge_timeout_s" mapstructure:"merge_timeout_s" default:"10"`
-	Secret        string  `json:"secret" mapstructure:"secret" default:""`
+	Secret        string  `json:"secret" mapstructure:"secret" default:"" redact:"true" reload:"restart"`
 	AllowSaveToHD bool    `json:"allow_save_to_hd" mapstructure:"allow_save_to_hd" default:"true"`
 	SaveTimeoutS  float64 `json:"save_timeout_s" mapstructure:"save_timeout_s" default:"1"`
 	NoMerges      bool    `json:"no_merges" mapstructure:"no_merges" default:"false"`
+	NoSortOnSave  bool    `json:"no_sort_on_save" mapstructure:"no_sort_on_save" default:"false"`
+	AckMode       string  `json:"ack_mode" mapstructure:"ack_mode" default:"durable"`
+	PartitionBy   string  `json:"partition_by" mapstructure:"partition_by" default:"hour" reload:"restart"`
+	Role          string  `json:"role" mapstructure:"role" default:"all" reload:"restart"`
+	// NoStartupCheck disables the consistency check of the data root on start
+	NoStartupCheck bool `json:"no_startup_check" mapstructure:"no_startup_check" default:"false" reload:"restart"`
+	// ImportDir is the directory of the local files the import endpoint may read, empty disables them
+	ImportDir string `json:"import_dir" mapstructure:"import_dir" default:""`
+	// BackupDir is the directory of the local exports and restores, empty disables them
+	BackupDir string `json:"backup_dir" mapstructure:"backup_dir" default:""`
+
+	Tables []TableConfiguration `json:"tables" mapstructure:"tables" reload:"restart"`
+
+	FlushRows           int     `json:"flush_rows" mapstructure:"flush_rows" default:"1000000"`
+	MaxBufferRows       int     `json:"max_buffer_rows" mapstructure:"max_buffer_rows" default:"0"`
+	MaxBufferBytes      int     `json:"max_buffer_bytes" mapstructure:"max_buffer_bytes" default:"0"`
+	MaxTableBufferRows  int     `json:"max_table_buffer_rows" mapstructure:"max_table_buffer_rows" default:"0"`
+	MaxTableBufferBytes int     `json:"max_table_buffer_bytes" mapstructure:"max_table_buffer_bytes" default:"0"`
+	MaxBufferWaitS      float64 `json:"max_buffer_wait_s" mapstructure:"max_buffer_wait_s" default:"0"`
+	// BufferPressureRatio is the share of a buffer limit after which the buffered data is flushed early
+	BufferPressureRatio float64 `json:"buffer_pressure_ratio" mapstructure:"buffer_pressure_ratio" default:"0.8"`
+	// MaxDecompressedBytes limits the size of a compressed write request body once it's decompressed
+	MaxDecompressedBytes int `json:"max_decompressed_bytes" mapstructure:"max_decompressed_bytes" default:"1073741824"`
+
+	Merges    MergesConfiguration    `json:"merges" mapstructure:"merges"`
+	Parquet   ParquetConfiguration   `json:"parquet" mapstructure:"parquet"`
+	S3        S3Configuration        `json:"s3" mapstructure:"s3"`
+	Retention RetentionConfiguration `json:"retention" mapstructure:"retention"`
+}
+
+// RunsMerges reports if the node compacts the data
+func (c *GigapiConfiguration) RunsMerges() bool {
+	return !c.NoMerges && c.Role != RoleWriter
+}
+
+// AcceptsWrites reports if the node serves the write endpoints
+func (c *GigapiConfiguration) AcceptsWrites() bool {
+	return c.Role != RoleCompactor
 }
 
 type Configuration struct {
 	Gigapi GigapiConfiguration `json:"gigapi" mapstructure:"gigapi" default:""`
-	Port   int                 `json:"port" mapstructure:"port" default:"7971"`
-	Host   string              `json:"host" mapstructure:"host" default:"0.0.0.0"`
+	Port   int                 `json:"port" mapstructure:"port" default:"7971" reload:"restart"`
+	Host   string              `json:"host" mapstructure:"host" default:"0.0.0.0" reload:"restart"`
+	// FlightPort is the port of the Arrow Flight SQL server, 0 disables it
+	FlightPort int `json:"flight_port" mapstructure:"flight_port" default:"0" reload:"restart"`
 }
 
-var Config *Configuration
+// current is the configuration in use, replaced as a whole on reload
+var current atomic.Pointer[Configuration]
 
-func InitConfig(file string) {
+// Get returns the configuration in use. The returned value is never modified,
+// a reload publishes a new one.
+func Get() *Configuration {
+	return current.Load()
+}
+
+// Set publishes the configuration. It must not be modified afterwards.
+func Set(c *Configuration) {
+	current.Store(c)
+}
+
+// InitConfig loads the configuration from the file, the environment variables
+// and the key=value overrides, in increasing priority. It panics if the result is invalid.
+func InitConfig(file string, overrides ...string) {
 	viper.SetEnvPrefix("")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
@@ -42,16 +191,194 @@ func InitConfig(file string) {
 		fmt.Println("Using environment variables for configuration")
 	}
 
-	Config = &Configuration{}
-	err := viper.Unmarshal(Config)
+	for _, o := range overrides {
+		key, value, err := parseOverride(o)
+		if err != nil {
+			panic(err)
+		}
+		viper.Set(key, value)
+	}
+
+	registerDefaults(reflect.TypeOf(Configuration{}), "")
+	conf := &Configuration{}
+	err := viper.Unmarshal(conf)
 	if err != nil {
 		panic(fmt.Errorf("unable to decode into struct: %s", err))
 	}
-	if Config.Gigapi.SaveTimeoutS == 0 {
-		Config.Gigapi.SaveTimeoutS = 1
+	conf.applyDerivedDefaults()
+	err = conf.Validate()
+	if err != nil {
+		panic(fmt.Errorf("invalid configuration:\n%w", err))
+	}
+	Set(conf)
+	fmt.Printf("Loaded configuration: %+v\n", conf.Redacted())
+}
+
+// ApplyDefaults fills the zero fields of a configuration built in code with their default values.
+// The loaded configurations get the defaults through viper, so their explicit zeros are kept.
+func (c *Configuration) ApplyDefaults() {
+	setDefaults(c)
+	c.applyDerivedDefaults()
+}
+
+// applyDerivedDefaults fills the unset fields whose defaults depend on the other settings
+func (c *Configuration) applyDerivedDefaults() {
+	if len(c.Gigapi.Merges.Tiers) == 0 {
+		c.Gigapi.Merges.Tiers = DefaultMergeTiers(c.Gigapi.MergeTimeoutS)
+	}
+}
+
+// registerDefaults passes the default values of the tagged fields to viper.
+// The keys missing in the config file and the environment get them on unmarshalling.
+func registerDefaults(t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := prefix + f.Tag.Get("mapstructure")
+		if f.Type.Kind() == reflect.Struct {
+			registerDefaults(f.Type, key+".")
+			continue
+		}
+		if value, ok := f.Tag.Lookup("default"); ok {
+			viper.SetDefault(key, value)
+		}
+	}
+}
+
+// parseOverride parses the key=value override of a configuration key,
+// e.g. gigapi.merges.concurrency=4
+func parseOverride(o string) (string, string, error) {
+	key, value, ok := strings.Cut(o, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid override %q: expected key=value", o)
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	kind, ok := configKeys()[key]
+	if !ok {
+		return "", "", fmt.Errorf("invalid override %q: unknown configuration key %q", o, key)
+	}
+	if kind == reflect.Slice {
+		return "", "", fmt.Errorf("invalid override %q: %s can only be set in the config file", o, key)
+	}
+	return key, value, nil
+}
+
+// configKeys returns the kinds of all the configuration keys
+func configKeys() map[string]reflect.Kind {
+	res := map[string]reflect.Kind{}
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := prefix + f.Tag.Get("mapstructure")
+			if f.Type.Kind() == reflect.Struct {
+				walk(f.Type, key+".")
+				continue
+			}
+			res[key] = f.Type.Kind()
+		}
+	}
+	walk(reflect.TypeOf(Configuration{}), "")
+	return res
+}
+
+// Validate checks the configuration and returns all the problems found
+func (c *Configuration) Validate() error {
+	var errs []error
+	check := func(ok bool, key string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+	g := &c.Gigapi
+	check(c.Port > 0 && c.Port < 65536, "port", "%d is not a valid port", c.Port)
+	check(c.FlightPort >= 0 && c.FlightPort < 65536, "flight_port", "%d is not a valid port", c.FlightPort)
+	check(c.FlightPort != c.Port, "flight_port", "%d is already the HTTP port", c.FlightPort)
+	check(g.Role == RoleAll || g.Role == RoleWriter || g.Role == RoleCompactor,
+		"gigapi.role", "invalid role %q: expected %s, %s or %s", g.Role, RoleAll, RoleWriter, RoleCompactor)
+	switch g.AckMode {
+	case "none", "buffered", "durable":
+	case "wal":
+		check(false, "gigapi.ack_mode", "ack mode %q is not supported, there is no write-ahead log yet", g.AckMode)
+	default:
+		check(false, "gigapi.ack_mode", "invalid ack mode %q: expected none, buffered or durable", g.AckMode)
+	}
+	check(g.MergeTimeoutS > 0, "gigapi.merge_timeout_s", "must be positive, got %d", g.MergeTimeoutS)
+	check(g.SaveTimeoutS > 0, "gigapi.save_timeout_s", "must be positive, got %v", g.SaveTimeoutS)
+	check(g.FlushRows > 0, "gigapi.flush_rows", "must be positive, got %d", g.FlushRows)
+	for key, v := range map[string]int{
+		"gigapi.max_buffer_rows":        g.MaxBufferRows,
+		"gigapi.max_buffer_bytes":       g.MaxBufferBytes,
+		"gigapi.max_table_buffer_rows":  g.MaxTableBufferRows,
+		"gigapi.max_table_buffer_bytes": g.MaxTableBufferBytes,
+		"gigapi.max_decompressed_bytes": g.MaxDecompressedBytes,
+	} {
+		check(v >= 0, key, "must be 0 (unlimited) or positive, got %d", v)
+	}
+	check(g.MaxBufferWaitS >= 0, "gigapi.max_buffer_wait_s", "must not be negative, got %v", g.MaxBufferWaitS)
+	check(g.BufferPressureRatio > 0 && g.BufferPressureRatio <= 1, "gigapi.buffer_pressure_ratio",
+		"must be in (0, 1], got %v", g.BufferPressureRatio)
+	for i, t := range g.Tables {
+		check(t.Name != "", fmt.Sprintf("gigapi.tables[%d]", i), "the table name is missing")
+	}
+
+	check(g.Merges.IntervalS > 0, "gigapi.merges.interval_s", "must be positive, got %v", g.Merges.IntervalS)
+	check(g.Merges.Concurrency > 0, "gigapi.merges.concurrency", "must be positive, got %d", g.Merges.Concurrency)
+	check(g.Merges.FirstTierConcurrency > 0, "gigapi.merges.first_tier_concurrency",
+		"must be positive, got %d", g.Merges.FirstTierConcurrency)
+	if len(g.Merges.Tiers) != MergeTierCount {
+		check(false, "gigapi.merges.tiers", "expected %d tiers, got %d", MergeTierCount, len(g.Merges.Tiers))
+	} else {
+		for i, t := range g.Merges.Tiers {
+			key := fmt.Sprintf("gigapi.merges.tiers[%d]", i)
+			check(t.TimeoutS > 0, key+".timeout_s", "must be positive, got %d", t.TimeoutS)
+			check(t.MaxSizeMB > 0, key+".max_size_mb", "must be positive, got %d", t.MaxSizeMB)
+			if i > 0 {
+				check(t.MaxSizeMB >= g.Merges.Tiers[i-1].MaxSizeMB, key+".max_size_mb",
+					"must not be smaller than the one of the previous tier (%d), got %d",
+					g.Merges.Tiers[i-1].MaxSizeMB, t.MaxSizeMB)
+			}
+		}
+	}
+
+	compression := strings.ToLower(g.Parquet.Compression)
+	check(slices.Contains(ParquetCompressions, compression), "gigapi.parquet.compression",
+		"unsupported codec %q: expected one of %s", g.Parquet.Compression, strings.Join(ParquetCompressions, ", "))
+	g.Parquet.Compression = compression
+	check(g.Parquet.RowGroupSize > 0, "gigapi.parquet.row_group_size",
+		"must be positive, got %d", g.Parquet.RowGroupSize)
+	check(g.Parquet.MergeRowGroupSize > 0, "gigapi.parquet.merge_row_group_size",
+		"must be positive, got %d", g.Parquet.MergeRowGroupSize)
+
+	check((g.S3.AccessKey == "") == (g.S3.SecretKey == ""), "gigapi.s3",
+		"access_key and secret_key should be set together")
+
+	check(g.Retention.MergedFilesS >= 0, "gigapi.retention.merged_files_s",
+		"must not be negative, got %v", g.Retention.MergedFilesS)
+	check(g.Retention.TmpFilesS > 0, "gigapi.retention.tmp_files_s",
+		"must be positive, got %v", g.Retention.TmpFilesS)
+	check(g.Retention.ExportPinS > 0, "gigapi.retention.export_pin_s",
+		"must be positive, got %v", g.Retention.ExportPinS)
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with the secrets masked
+func (c *Configuration) Redacted() *Configuration {
+	res := *c
+	redact(reflect.ValueOf(&res).Elem())
+	return &res
+}
+
+func redact(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			redact(field)
+			continue
+		}
+		if v.Type().Field(i).Tag.Get("redact") == "true" && field.String() != "" {
+			field.SetString("******")
+		}
 	}
-	setDefaults(Config)
-	fmt.Printf("Loaded configuration: %+v\n", Config)
 }
 
 func setDefaults(config any) {
@@ -76,9 +403,9 @@ func setDefaults(config any) {
 			switch field.Kind() {
 			case reflect.String:
 				field.SetString(defaultTag)
-			case reflect.Int:
-				if intValue, err := strconv.Atoi(defaultTag); err == nil {
-					field.SetInt(int64(intValue))
+			case reflect.Int, reflect.Int64:
+				if intValue, err := strconv.ParseInt(defaultTag, 10, 64); err == nil {
+					field.SetInt(intValue)
 				}
 			case reflect.Float64:
 				if floatValue, err := strconv.ParseFloat(defaultTag, 64); err == nil {
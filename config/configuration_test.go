@@ -2,10 +2,93 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
 func TestInitConfig(t *testing.T) {
-	InitConfig("config_test.yaml")
-	fmt.Println(Config)
+	InitConfig("config_test.yaml", "gigapi.merges.first_tier_concurrency=2", "port=8080")
+	fmt.Println(Get())
+	if Get().Gigapi.Root != "/tmp/data" || Get().Gigapi.Merges.Concurrency != 4 ||
+		Get().Gigapi.Merges.Tiers[3].TimeoutS != 4200 || Get().Gigapi.Parquet.Compression != "zstd" {
+		t.Fatalf("config file not applied: %+v", Get().Gigapi)
+	}
+	if Get().Gigapi.Merges.FirstTierConcurrency != 2 || Get().Port != 8080 {
+		t.Fatalf("overrides not applied: %+v", Get())
+	}
+	redacted := Get().Redacted()
+	if redacted.Gigapi.Secret != "******" || redacted.Gigapi.S3.SecretKey != "******" ||
+		Get().Gigapi.S3.SecretKey != "secret" {
+		t.Fatalf("secrets not redacted: %+v", redacted.Gigapi)
+	}
+}
+
+func TestInitConfigKeepsExplicitZeros(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte("gigapi:\n  root: /tmp/data\n  retention:\n    merged_files_s: 0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitConfig(file)
+	if Get().Gigapi.Retention.MergedFilesS != 0 {
+		t.Fatalf("the explicit zero is overwritten: %v", Get().Gigapi.Retention.MergedFilesS)
+	}
+	if Get().Gigapi.Retention.TmpFilesS != 600 || Get().Gigapi.SaveTimeoutS != 1 || !Get().Gigapi.Enabled {
+		t.Fatalf("the defaults are not applied: %+v", Get().Gigapi)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := &Configuration{Port: 7971}
+	c.ApplyDefaults()
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	c.Gigapi.Role = "reader"
+	c.Gigapi.Parquet.Compression = "lzo"
+	c.Gigapi.Merges.Tiers = c.Gigapi.Merges.Tiers[:2]
+	c.Gigapi.AckMode = "wal"
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, key := range []string{"gigapi.role", "gigapi.parquet.compression", "gigapi.merges.tiers", "gigapi.ack_mode"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("%s is not reported in %v", key, err)
+		}
+	}
+	if _, _, err := parseOverride("gigapi.nope=1"); err == nil {
+		t.Error("expected an unknown key error")
+	}
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(s string) {
+		if err := os.WriteFile(file, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("gigapi:\n  root: /tmp/a\n  save_timeout_s: 1\n")
+	InitConfig(file)
+	var old *Configuration
+	OnReload(func(o *Configuration) { old = o })
+
+	write("gigapi:\n  root: /tmp/b\n  save_timeout_s: 5\n  no_merges: true\n")
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if old == nil || old.Gigapi.SaveTimeoutS != 1 {
+		t.Fatalf("listener not called with the old configuration: %+v", old)
+	}
+	if Get().Gigapi.SaveTimeoutS != 5 || !Get().Gigapi.NoMerges || Get().Gigapi.Root != "/tmp/a" {
+		t.Fatalf("unexpected reloaded configuration: %+v", Get().Gigapi)
+	}
+
+	write("gigapi:\n  save_timeout_s: -1\n")
+	if err := Reload(); err == nil || Get().Gigapi.SaveTimeoutS != 5 {
+		t.Fatalf("invalid configuration applied: %v", err)
+	}
 }
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// Flags are the command line options of the configuration
+type Flags struct {
+	// File is the path of the YAML, JSON or TOML configuration file
+	File string
+	// Overrides are the key=value pairs overriding the file and the environment variables
+	Overrides []string
+}
+
+// RegisterFlags defines the configuration flags of the command line:
+// -config <file>, -set key=value (repeatable) and the -root, -host, -port and -role shortcuts
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	res := &Flags{}
+	fs.StringVar(&res.File, "config", "", "path to the configuration file")
+	fs.Func("set", "override a configuration key, e.g. -set gigapi.merges.concurrency=4 (repeatable)",
+		func(s string) error {
+			_, _, err := parseOverride(s)
+			if err != nil {
+				return err
+			}
+			res.Overrides = append(res.Overrides, s)
+			return nil
+		})
+	for name, key := range map[string]string{
+		"root": "gigapi.root",
+		"host": "host",
+		"port": "port",
+		"role": "gigapi.role",
+	} {
+		key := key
+		fs.Func(name, "shortcut for -set "+key+"=<value>", func(s string) error {
+			res.Overrides = append(res.Overrides, key+"="+strings.TrimSpace(s))
+			return nil
+		})
+	}
+	return res
+}
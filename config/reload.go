@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+)
+
+// Module reloading the configuration on SIGHUP and on the changes of the config file.
+// The fields tagged reload:"restart" keep their value until the next start.
+
+var (
+	reloadMtx       sync.Mutex
+	reloadListeners []func(old *Configuration)
+)
+
+// OnReload registers a function called after a reload changed the configuration.
+// Get already returns the new values when it runs.
+func OnReload(f func(old *Configuration)) {
+	reloadMtx.Lock()
+	defer reloadMtx.Unlock()
+	reloadListeners = append(reloadListeners, f)
+}
+
+// Watch starts reloading the configuration on SIGHUP and, if a config file is used,
+// on its changes
+func Watch() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			logReload("SIGHUP", Reload())
+		}
+	}()
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		logReload(e.Name+" changed", Reload())
+	})
+	viper.WatchConfig()
+}
+
+func logReload(reason string, err error) {
+	if err != nil {
+		fmt.Printf("config reload (%s) failed, keeping the current configuration: %v\n", reason, err)
+	}
+}
+
+// Reload re-reads the configuration and applies the changes of the reloadable settings.
+// An invalid configuration is rejected as a whole.
+func Reload() error {
+	reloadMtx.Lock()
+	defer reloadMtx.Unlock()
+	if viper.ConfigFileUsed() != "" {
+		err := viper.ReadInConfig()
+		if err != nil {
+			return fmt.Errorf("error reading config file: %w", err)
+		}
+	}
+	next := &Configuration{}
+	err := viper.Unmarshal(next)
+	if err != nil {
+		return fmt.Errorf("unable to decode into struct: %w", err)
+	}
+	next.applyDerivedDefaults()
+	err = next.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	old := Get()
+	changed := 0
+	diffFields(reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem(), "",
+		func(key string, field reflect.StructField, oldValue, newValue reflect.Value) {
+			if field.Tag.Get("reload") == "restart" {
+				fmt.Printf("config reload: %s can't be changed at runtime, restart to apply it\n", key)
+				newValue.Set(oldValue)
+				return
+			}
+			if field.Tag.Get("redact") == "true" {
+				fmt.Printf("config reload: %s changed\n", key)
+			} else {
+				fmt.Printf("config reload: %s changed from %v to %v\n", key, oldValue, newValue)
+			}
+			changed++
+		})
+	if changed == 0 {
+		fmt.Println("config reload: nothing to apply")
+		return nil
+	}
+	Set(next)
+	for _, f := range reloadListeners {
+		f(old)
+	}
+	return nil
+}
+
+// diffFields calls onDiff for every leaf field having different values in a and b
+func diffFields(a, b reflect.Value, prefix string,
+	onDiff func(key string, field reflect.StructField, a, b reflect.Value)) {
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		if field.Type.Kind() == reflect.Struct {
+			diffFields(a.Field(i), b.Field(i), key+".", onDiff)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			onDiff(key, field, a.Field(i), b.Field(i))
+		}
+	}
+}
@@ -46,13 +46,13 @@ func TestE2E(t *testing.T) {
 	stopCPUProfile := startCPUProfile(t)
 	defer stopCPUProfile()
 
-	config.Config = &config.Configuration{
+	config.Set(&config.Configuration{
 		Gigapi: config.GigapiConfiguration{
 			Root:          "_testdata",
 			MergeTimeoutS: 10,
 			Secret:        "XXXXXX",
 		},
-	}
+	})
 	merge.Init()
 
 	var data = map[string]any{
@@ -14,7 +14,7 @@ import (
 func main() {
 	wd, _ := os.Getwd()
 	cwd := path.Join(wd, "_data")
-	config.Config = &config.Configuration{
+	config.Set(&config.Configuration{
 		QuackPipe: config.QuackPipeConfiguration{
 			Enabled:       true,
 			Root:          cwd,
@@ -22,7 +22,7 @@ func main() {
 			SaveTimeoutS:  1,
 			Secret:        "XXXXXX",
 		},
-	}
+	})
 	merge.Init()
 	data := map[string]any{
 		"str":   []string{}, // only []string, []int64, []uint64, []float64 are supported.
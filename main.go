@@ -1,8 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/gigapi/gigapi-querier/module"
+	"github.com/gigapi/gigapi/v2/cli"
 	"github.com/gigapi/gigapi/v2/config"
 	"github.com/gigapi/gigapi/v2/merge"
 	"github.com/gigapi/gigapi/v2/modules"
@@ -24,16 +26,20 @@ func (a api) GetPathParams(r *http.Request) map[string]string {
 
 func initModules() {
 	stdin.Init()
+	cli.Init()
 	merge.Init(&api{})
 	module.Init(&api{})
 }
 
 func main() {
-	config.InitConfig("")
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	config.InitConfig(flags.File, flags.Overrides...)
 	initModules()
+	config.Watch()
 	r := router.NewRouter()
-	fmt.Printf("GigAPI Running: %s:%d\n", config.Config.Host, config.Config.Port)
-	if err := http.ListenAndServe(fmt.Sprintf("%s:%d", config.Config.Host, config.Config.Port), r); err != nil {
+	fmt.Printf("GigAPI Running: %s:%d\n", config.Get().Host, config.Get().Port)
+	if err := http.ListenAndServe(fmt.Sprintf("%s:%d", config.Get().Host, config.Get().Port), r); err != nil {
 		panic(err)
 	}
 }
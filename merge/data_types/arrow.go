@@ -0,0 +1,326 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/decimal128"
+	"github.com/apache/arrow/go/v14/parquet/metadata"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/apache/arrow/go/v14/parquet/schema"
+	"github.com/google/uuid"
+	"slices"
+	"time"
+)
+
+// FromParquetSchema returns the arrow schema of the parquet file.
+// Unlike pqarrow.FromParquet, it keeps the timestamps not adjusted to UTC without a time zone
+// and reads the strings with the JSON logical type as JSON and the UUID logical type as UUID.
+func FromParquetSchema(md *metadata.FileMetaData) (*arrow.Schema, error) {
+	sc, err := pqarrow.FromParquet(md.Schema, nil, md.KeyValueMetadata())
+	if err != nil {
+		return nil, err
+	}
+	root := md.Schema.Root()
+	fields := sc.Fields()
+	changed := false
+	for i, f := range fields {
+		idx := root.FieldIndexByName(f.Name)
+		if idx < 0 {
+			continue
+		}
+		if dt := fixArrowType(root.Field(idx), f.Type); dt != f.Type {
+			fields[i].Type = dt
+			changed = true
+		}
+	}
+	if !changed {
+		return sc, nil
+	}
+	md2 := sc.Metadata()
+	return arrow.NewSchema(fields, &md2), nil
+}
+
+// fixArrowType returns the arrow type of the parquet node converted to dt by pqarrow
+// with the naive timestamps and the JSON strings fixed. dt is returned if nothing is fixed.
+func fixArrowType(node schema.Node, dt arrow.DataType) arrow.DataType {
+	group, ok := node.(*schema.GroupNode)
+	if !ok {
+		switch lt := node.LogicalType().(type) {
+		case *schema.TimestampLogicalType:
+			if ts, ok := dt.(*arrow.TimestampType); ok && !lt.IsAdjustedToUTC() {
+				return &arrow.TimestampType{Unit: ts.Unit, TimeZone: naiveTimeZone}
+			}
+		case schema.JSONLogicalType, *schema.JSONLogicalType:
+			return jsonType
+		case schema.UUIDLogicalType, *schema.UUIDLogicalType:
+			return uuidType
+		}
+		return dt
+	}
+	switch _dt := dt.(type) {
+	case *arrow.StructType:
+		fields := _dt.Fields()
+		changed := false
+		for i := range fields {
+			if i >= group.NumFields() {
+				break
+			}
+			if fixed := fixArrowType(group.Field(i), fields[i].Type); fixed != fields[i].Type {
+				fields[i].Type = fixed
+				changed = true
+			}
+		}
+		if changed {
+			return arrow.StructOf(fields...)
+		}
+	case *arrow.MapType:
+		keyValue, ok := group.Field(0).(*schema.GroupNode)
+		if !ok || keyValue.NumFields() != 2 {
+			return dt
+		}
+		if item := fixArrowType(keyValue.Field(1), _dt.ItemType()); item != _dt.ItemType() {
+			return arrow.MapOf(_dt.KeyType(), item)
+		}
+	case *arrow.ListType:
+		// the repeated group of the 3-level lists or the repeated element of the legacy ones
+		elemNode := group.Field(0)
+		if repeated, ok := elemNode.(*schema.GroupNode); ok && repeated.NumFields() == 1 {
+			elemNode = repeated.Field(0)
+		}
+		elemField := _dt.ElemField()
+		if elem := fixArrowType(elemNode, elemField.Type); elem != elemField.Type {
+			elemField.Type = elem
+			return arrow.ListOfField(elemField)
+		}
+	}
+	return dt
+}
+
+func convertArrow[T any, R any](n int, get func(int) T, conv func(T) R) []R {
+	res := make([]R, n)
+	for i := range res {
+		res[i] = conv(get(i))
+	}
+	return res
+}
+
+func toInt64[T int8 | int16 | int32 | int64](v T) int64 {
+	return int64(v)
+}
+
+func toUint64[T uint8 | uint16 | uint32 | uint64](v T) uint64 {
+	return uint64(v)
+}
+
+// TimeUnitNs returns the nanoseconds in a single unit of the arrow time unit
+func TimeUnitNs(unit arrow.TimeUnit) int64 {
+	switch unit {
+	case arrow.Second:
+		return int64(time.Second)
+	case arrow.Millisecond:
+		return int64(time.Millisecond)
+	case arrow.Microsecond:
+		return int64(time.Microsecond)
+	}
+	return 1
+}
+
+// FromArrowArray converts the arrow array to a slice of one of the column types.
+// The 64-bit numbers are copied as they are, the booleans are returned as []bool.
+// Timestamps, dates and times are converted to nanoseconds, decimals to Decimal values
+// and UUIDs to their text, the dictionaries of strings to DictStrings. The null values are zeroed.
+// The lists, maps and structs are converted to the []any values of the nested columns.
+func FromArrowArray(arr arrow.Array) (any, error) {
+	n := arr.Len()
+	switch a := arr.(type) {
+	case *array.Boolean:
+		return convertArrow(n, a.Value, func(v bool) bool { return v }), nil
+	case *array.Int8:
+		return convertArrow(n, a.Value, toInt64[int8]), nil
+	case *array.Int16:
+		return convertArrow(n, a.Value, toInt64[int16]), nil
+	case *array.Int32:
+		return convertArrow(n, a.Value, toInt64[int32]), nil
+	case *array.Int64:
+		return slices.Clone(a.Int64Values()), nil
+	case *array.Uint8:
+		return convertArrow(n, a.Value, toUint64[uint8]), nil
+	case *array.Uint16:
+		return convertArrow(n, a.Value, toUint64[uint16]), nil
+	case *array.Uint32:
+		return convertArrow(n, a.Value, toUint64[uint32]), nil
+	case *array.Uint64:
+		return slices.Clone(a.Uint64Values()), nil
+	case *array.Float32:
+		return convertArrow(n, a.Value, func(v float32) float64 { return float64(v) }), nil
+	case *array.Float64:
+		return slices.Clone(a.Float64Values()), nil
+	case *array.String:
+		return convertArrow(n, a.Value, func(v string) string { return v }), nil
+	case *array.LargeString:
+		return convertArrow(n, a.Value, func(v string) string { return v }), nil
+	case *array.Binary:
+		return convertArrow(n, a.ValueString, func(v string) string { return v }), nil
+	case *array.Dictionary:
+		dict, ok := a.Dictionary().(*array.String)
+		if !ok {
+			break
+		}
+		res := DictStrings{
+			Dict: convertArrow(dict.Len(), dict.Value, func(v string) string { return v }),
+			Keys: make([]int32, n),
+		}
+		for i := range res.Keys {
+			if a.IsValid(i) {
+				res.Keys[i] = int32(a.GetValueIndex(i))
+			}
+		}
+		return res, nil
+	case *array.Decimal128:
+		dt := a.DataType().(*arrow.Decimal128Type)
+		if dt.Precision > maxDecimalPrecision {
+			break
+		}
+		return convertArrow(n, a.Value, func(v decimal128.Num) Decimal {
+			return Decimal{Value: int64(v.LowBits()), Precision: dt.Precision, Scale: dt.Scale}
+		}), nil
+	case array.ExtensionArray:
+		if IsJSONType(a.DataType()) {
+			return FromArrowArray(a.Storage())
+		}
+		if IsUUIDType(a.DataType()) {
+			storage := a.Storage().(*array.FixedSizeBinary)
+			return convertArrow(n, storage.Value, func(v []byte) string {
+				if len(v) != 16 {
+					return ""
+				}
+				return uuid.UUID(v).String()
+			}), nil
+		}
+	case *array.Map, *array.List, *array.Struct:
+		return arrowToValues(arr)
+	case *array.Timestamp:
+		mul := TimeUnitNs(a.DataType().(*arrow.TimestampType).Unit)
+		res := make([]int64, n)
+		for i, v := range a.TimestampValues() {
+			res[i] = int64(v) * mul
+		}
+		return res, nil
+	case *array.Date32:
+		return convertArrow(n, a.Value, func(v arrow.Date32) int64 { return int64(v) * int64(24*time.Hour) }), nil
+	case *array.Date64:
+		return convertArrow(n, a.Value, func(v arrow.Date64) int64 { return int64(v) * int64(time.Millisecond) }), nil
+	case *array.Time32:
+		mul := TimeUnitNs(a.DataType().(*arrow.Time32Type).Unit)
+		return convertArrow(n, a.Value, func(v arrow.Time32) int64 { return int64(v) * mul }), nil
+	case *array.Time64:
+		mul := TimeUnitNs(a.DataType().(*arrow.Time64Type).Unit)
+		return convertArrow(n, a.Value, func(v arrow.Time64) int64 { return int64(v) * mul }), nil
+	}
+	return nil, fmt.Errorf("unsupported arrow data type: %s", arr.DataType())
+}
+
+func toAnyValues[T any](data []T, arr arrow.Array) []any {
+	res := make([]any, len(data))
+	for i, v := range data {
+		if arr.IsValid(i) {
+			res[i] = v
+		}
+	}
+	return res
+}
+
+// arrowToValues converts the arrow array to the values of the nested columns, nulls are nil
+func arrowToValues(arr arrow.Array) ([]any, error) {
+	res := make([]any, arr.Len())
+	switch a := arr.(type) {
+	case *array.Map:
+		keys, err := arrowToValues(a.Keys())
+		if err != nil {
+			return nil, err
+		}
+		items, err := arrowToValues(a.Items())
+		if err != nil {
+			return nil, err
+		}
+		for i := range res {
+			if a.IsNull(i) {
+				continue
+			}
+			start, end := a.ValueOffsets(i)
+			m := make(map[string]any, end-start)
+			for j := start; j < end; j++ {
+				key, ok := keys[j].(string)
+				if !ok {
+					return nil, fmt.Errorf("unsupported map key type: %s", a.Keys().DataType())
+				}
+				m[key] = items[j]
+			}
+			res[i] = m
+		}
+	case *array.List:
+		values, err := arrowToValues(a.ListValues())
+		if err != nil {
+			return nil, err
+		}
+		for i := range res {
+			if a.IsValid(i) {
+				start, end := a.ValueOffsets(i)
+				res[i] = slices.Clone(values[start:end])
+			}
+		}
+	case *array.Struct:
+		fieldValues := make([][]any, a.NumField())
+		for j := range fieldValues {
+			var err error
+			fieldValues[j], err = arrowToValues(a.Field(j))
+			if err != nil {
+				return nil, err
+			}
+		}
+		fields := a.DataType().(*arrow.StructType).Fields()
+		for i := range res {
+			if a.IsNull(i) {
+				continue
+			}
+			m := make(map[string]any, len(fields))
+			for j, f := range fields {
+				if fieldValues[j][i] != nil {
+					m[f.Name] = fieldValues[j][i]
+				}
+			}
+			res[i] = m
+		}
+	default:
+		data, err := FromArrowArray(arr)
+		if err != nil {
+			return nil, err
+		}
+		if arr.DataType().ID() == arrow.BINARY || IsJSONType(arr.DataType()) {
+			// the JSON text
+			for i, s := range data.([]string) {
+				if arr.IsValid(i) {
+					res[i] = []byte(s)
+				}
+			}
+			return res, nil
+		}
+		switch _data := data.(type) {
+		case []bool:
+			return toAnyValues(_data, arr), nil
+		case []int64:
+			return toAnyValues(_data, arr), nil
+		case []uint64:
+			return toAnyValues(_data, arr), nil
+		case []float64:
+			return toAnyValues(_data, arr), nil
+		case []string:
+			return toAnyValues(_data, arr), nil
+		case []any:
+			return _data, nil
+		}
+		return nil, fmt.Errorf("unsupported arrow data type: %s", arr.DataType())
+	}
+	return res, nil
+}
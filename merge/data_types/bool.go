@@ -0,0 +1,94 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/go-faster/jx"
+	"strconv"
+)
+
+const DATA_TYPE_NAME_BOOLEAN = "BOOLEAN"
+
+// The BOOLEAN columns keep the values as the 0 and 1 bytes, as the columns hold the ordered types.
+
+func boolToByte(v bool) uint8 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func castBool(v any) (uint8, bool) {
+	switch _v := v.(type) {
+	case bool:
+		return boolToByte(_v), true
+	case string:
+		b, err := strconv.ParseBool(_v)
+		return boolToByte(b), err == nil
+	}
+	return 0, false
+}
+
+// boolAppender appends the bytes as booleans to the boolean builder
+type boolAppender struct {
+	builder *array.BooleanBuilder
+}
+
+func (a boolAppender) AppendValues(values []uint8, valid []bool) {
+	res := make([]bool, len(values))
+	for i, v := range values {
+		res[i] = v != 0
+	}
+	a.builder.AppendValues(res, valid)
+}
+
+// newBoolColumn returns the column of the booleans. The booleans have no index statistics.
+func newBoolColumn() *Column[uint8] {
+	return &Column[uint8]{
+		typeName:  DATA_TYPE_NAME_BOOLEAN,
+		arrowType: arrow.FixedWidthTypes.Boolean,
+		getBuilder: func(builder array.Builder) IArrowAppender[uint8] {
+			return boolAppender{builder.(*array.BooleanBuilder)}
+		},
+		parseStr: func(s string) (uint8, error) {
+			res, ok := castBool(s)
+			if !ok {
+				return 0, fmt.Errorf("invalid BOOLEAN value %q", s)
+			}
+			return res, nil
+		},
+		parseJson: func(d *jx.Decoder) (uint8, error) {
+			b, err := d.Bool()
+			return boolToByte(b), err
+		},
+		toValue: func(v uint8) any {
+			return v != 0
+		},
+		cast: func(data any) ([]uint8, error) {
+			switch _data := data.(type) {
+			case []uint8:
+				// the data of another BOOLEAN column
+				return _data, nil
+			case []bool:
+				res := make([]uint8, len(_data))
+				for i, v := range _data {
+					res[i] = boolToByte(v)
+				}
+				return res, nil
+			}
+			values, ok := anyValues(data)
+			if !ok {
+				return nil, fmt.Errorf("invalid data type")
+			}
+			return castSlice(values, castBool, DATA_TYPE_NAME_BOOLEAN)
+		},
+		toStat: func(uint8) any {
+			return nil
+		},
+	}
+}
+
+func boolBuilder(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+	return colBuilder[uint8](newBoolColumn, name, data, sizeAndCap...)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-faster/jx"
 	"golang.org/x/exp/constraints"
 	"slices"
+	"unsafe"
 )
 
 type IArrowAppender[T constraints.Ordered] interface {
@@ -24,6 +25,13 @@ type Column[T constraints.Ordered] struct {
 	getBuilder func(builder array.Builder) IArrowAppender[T]
 	parseStr   func(s string) (T, error)
 	parseJson  func(d *jx.Decoder) (T, error)
+	// toValue converts the stored value to the one returned by GetVal, e.g. nanoseconds to time.Time
+	toValue func(T) any
+	// cast converts the data of the other types, e.g. the []int64 values of an INT2 column,
+	// failing on the values the type can't hold
+	cast func(data any) ([]T, error)
+	// toStat converts the min and max to the index statistics, nil if the column isn't indexed
+	toStat func(T) any
 }
 
 func colBuilder[T constraints.Ordered](createColumn func() *Column[T], name string, data any,
@@ -34,17 +42,39 @@ func colBuilder[T constraints.Ordered](createColumn func() *Column[T], name stri
 		col.InitializeData(sizeAndCap...)
 		return col, nil
 	}
+	data, valid := unwrapNullable(data)
+	if col.cast != nil {
+		var err error
+		if data, err = col.castValid(data, valid); err != nil {
+			return nil, err
+		}
+	}
 	err := col.ValidateData(data)
 	if err != nil {
 		return nil, err
 	}
 	col.data = data.([]T)
-	col.valids = make([]bool, len(col.data))
-	FastFillArray(col.valids, true)
+	col.valids = bitmapToValids(valid, len(col.data))
 	return col, nil
 }
 
+// castValid converts the data skipping the null rows
+func (c *Column[T]) castValid(data any, valid []byte) ([]T, error) {
+	if valid != nil {
+		values, ok := anyValues(data)
+		if !ok {
+			return nil, fmt.Errorf("invalid data type")
+		}
+		data = nullValues(values, valid)
+	}
+	return c.cast(data)
+}
+
+// GetData returns the []T values, wrapped into Nullable if some of them are null
 func (c *Column[T]) GetData() any {
+	if slices.Contains(c.valids, false) {
+		return Nullable{Data: c.data, Valid: validsToBitmap(c.valids)}
+	}
 	return c.data
 }
 
@@ -65,10 +95,75 @@ func (c *Column[T]) InitializeData(sizeAndCap ...int64) {
 }
 
 func (c *Column[T]) GetMinMax() (any, any) {
+	_min, _max := c.getMinMax()
+	if _min == nil || c.toStat == nil {
+		return _min, _max
+	}
+	return c.toStat(_min.(T)), c.toStat(_max.(T))
+}
+
+func (c *Column[T]) getMinMax() (any, any) {
 	if c.GetLength() == 0 {
 		return nil, nil
 	}
-	return slices.Min(c.data), slices.Max(c.data)
+	if !slices.Contains(c.valids, false) {
+		return slices.Min(c.data), slices.Max(c.data)
+	}
+	var (
+		_min, _max T
+		found      bool
+	)
+	for i, v := range c.data {
+		if !c.valids[i] {
+			continue
+		}
+		if !found {
+			_min, _max, found = v, v, true
+			continue
+		}
+		_min = min(_min, v)
+		_max = max(_max, v)
+	}
+	if !found {
+		return nil, nil
+	}
+	return _min, _max
+}
+
+// Copy returns a column with a copy of the data
+func (c *Column[T]) Copy() IColumn {
+	res := *c
+	res.data = slices.Clone(c.data)
+	res.valids = slices.Clone(c.valids)
+	return &res
+}
+
+func (c *Column[T]) IsNull(i int64) bool {
+	return !c.valids[i]
+}
+
+// GetSizeBytes estimates the memory held by the column data
+func (c *Column[T]) GetSizeBytes() int64 {
+	var zero T
+	size := int64(len(c.data)) * (int64(unsafe.Sizeof(zero)) + 1)
+	if strs, ok := any(c.data).([]string); ok {
+		for _, s := range strs {
+			size += int64(len(s))
+		}
+	}
+	return size
+}
+
+// Reorder permutes the column in place so that row i becomes the row idx[i]
+func (c *Column[T]) Reorder(idx IndexType) {
+	data := make([]T, len(idx))
+	valids := make([]bool, len(idx))
+	for i, j := range idx {
+		data[i] = c.data[j]
+		valids[i] = c.valids[j]
+	}
+	c.data = data
+	c.valids = valids
 }
 
 func (c *Column[T]) AppendNulls(size int64) {
@@ -89,6 +184,7 @@ func (c *Column[T]) Less(i int32, j int32) bool {
 }
 
 func (c *Column[T]) ValidateData(data any) error {
+	data, _ = unwrapNullable(data)
 	if _, ok := data.([]T); !ok {
 		return fmt.Errorf("invalid data type")
 	}
@@ -104,14 +200,26 @@ func (c *Column[T]) Append(data any) error {
 	if err != nil {
 		return err
 	}
-	lenBefore := c.GetLength()
+	data, valid := unwrapNullable(data)
 	_data := data.([]T)
 	c.data = append(c.data, _data...)
-	c.valids = append(c.valids, make([]bool, len(_data))...)
-	FastFillArray(c.valids[lenBefore:], true)
+	c.appendValids(valid, 0, len(_data))
 	return nil
 }
 
+// appendValids appends the validity of the rows from:to of the bitmap, nil if all of them are valid
+func (c *Column[T]) appendValids(valid []byte, from, to int) {
+	k := len(c.valids)
+	c.valids = append(c.valids, make([]bool, to-from)...)
+	if valid == nil {
+		FastFillArray(c.valids[k:], true)
+		return
+	}
+	for i := from; i < to; i++ {
+		c.valids[k+i-from] = isValid(valid, i)
+	}
+}
+
 func (c *Column[T]) AppendOne(val any) error {
 	if _, ok := val.(T); ok {
 		c.data = append(c.data, val.(T))
@@ -126,6 +234,7 @@ func (c *Column[T]) AppendByMask(data any, mask []byte) error {
 	if err != nil {
 		return err
 	}
+	data, valid := unwrapNullable(data)
 	_data := data.([]T)
 	if len(mask) != (len(_data)+7)/8 {
 		return fmt.Errorf("invalid mask length")
@@ -144,16 +253,14 @@ func (c *Column[T]) AppendByMask(data any, mask []byte) error {
 			continue
 		}
 		c.data = append(c.data, _data[startIdx:endIdx]...)
-		k := len(c.valids)
-		c.valids = append(c.valids, make([]bool, endIdx-startIdx)...)
-		FastFillArray(c.valids[k:], true)
-		startIdx = endIdx
+		c.appendValids(valid, startIdx, endIdx)
+		// the row i isn't selected
+		startIdx = i + 1
+		endIdx = i + 1
 	}
 	if startIdx != endIdx {
-		c.data = append(c.data, _data[startIdx:]...)
-		k := len(c.valids)
-		c.valids = append(c.valids, make([]bool, len(_data[startIdx:]))...)
-		FastFillArray(c.valids[k:], true)
+		c.data = append(c.data, _data[startIdx:endIdx]...)
+		c.appendValids(valid, startIdx, endIdx)
 	}
 	return nil
 
@@ -277,9 +384,40 @@ func (c *Column[T]) GetTypeName() string {
 }
 
 func (c *Column[T]) GetVal(i int64) any {
+	if c.toValue != nil {
+		return c.toValue(c.data[i])
+	}
 	return c.data[i]
 }
 
+// castOne converts the value to the one stored by the column
+func (c *Column[T]) castOne(v any) (any, error) {
+	if _v, ok := v.(T); ok && c.cast == nil {
+		return _v, nil
+	}
+	if c.cast == nil {
+		return nil, fmt.Errorf("invalid %s value %v (%T)", c.typeName, v, v)
+	}
+	data, err := c.cast([]any{v})
+	if err != nil {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+// appendArrowValue appends the stored value to the arrow builder of the column type
+func (c *Column[T]) appendArrowValue(b array.Builder, v any) {
+	c.getBuilder(b).AppendValues([]T{v.(T)}, nil)
+}
+
+// valueOf returns the value of GetVal for the stored value
+func (c *Column[T]) valueOf(v any) any {
+	if c.toValue != nil {
+		return c.toValue(v.(T))
+	}
+	return v
+}
+
 func (c *Column[T]) ParseFromStr(s string) error {
 	val, err := c.parseStr(s)
 	if err != nil {
@@ -9,18 +9,76 @@ import (
 
 type IndexType []int32
 
+// TypedData holds the values of a column of a type not derived from the Go type of the data,
+// e.g. the []int64 nanoseconds of a TIMESTAMP_MS column
+type TypedData struct {
+	Type string
+	Data any
+}
+
 func WrapToColumn(name string, data any) (IColumn, error) {
-	switch data.(type) {
-	case []int64:
-		return int64Builder(name, data)
-	case []uint64:
-		return uint64Builder(name, data)
-	case []float64:
-		return float64Builder(name, data)
-	case []string:
-		return strBuilder(name, data)
+	var valid []byte
+	if nullable, ok := data.(Nullable); ok {
+		data, valid = nullable.Data, nullable.Valid
+	}
+	typeName := ""
+	if typed, ok := data.(TypedData); ok {
+		typeName, data = typed.Type, typed.Data
+	}
+	if values, ok := data.([]any); ok {
+		// the null values of []any are nil
+		if valid != nil {
+			values = nullValues(values, valid)
+		}
+		if typeName == "" {
+			typeName = InferTypeName(values)
+		}
+		return valuesToColumn(name, typeName, values)
+	}
+	var builder ColumnBuilder
+	if typeName != "" {
+		var err error
+		if builder, err = GetColumnBuilder(typeName); err != nil {
+			return nil, err
+		}
+	} else {
+		switch data.(type) {
+		case []int64:
+			builder = int64Builder
+		case []uint64:
+			builder = uint64Builder
+		case []float64:
+			builder = float64Builder
+		case []string:
+			builder = strBuilder
+		default:
+			return nil, fmt.Errorf("unsupported data type: %T", data)
+		}
 	}
-	return nil, fmt.Errorf("unsupported data type: %T", data)
+	if valid != nil {
+		data = Nullable{Data: data, Valid: valid}
+	}
+	return builder(name, data)
+}
+
+// CastColumn converts the column to the type, e.g. the INT8 values of a parser to the buffered
+// INT2 column. The values the type can't hold fail the conversion.
+func CastColumn(col IColumn, typeName string) (IColumn, error) {
+	if col.GetTypeName() == typeName {
+		return col, nil
+	}
+	values := make([]any, col.GetLength())
+	for i := range values {
+		if !col.IsNull(int64(i)) {
+			values[i] = col.GetVal(int64(i))
+		}
+	}
+	res, err := valuesToColumn(col.GetName(), typeName, values)
+	if err != nil {
+		return nil, fmt.Errorf("column `%s` type mismatch: expected %s, got %s: %w",
+			col.GetName(), typeName, col.GetTypeName(), err)
+	}
+	return res, nil
 }
 
 const DATA_TYPE_NAME_INT64 = "INT8"
@@ -49,47 +107,63 @@ var DataTypes = map[string]ColumnBuilder{
 	"BPCHAR":  strBuilder,
 	"TEXT":    strBuilder,
 
+	"LowCardinality(VARCHAR)": lowCardinalityBuilder,
+	"LowCardinality(String)":  lowCardinalityBuilder,
+
+	"TIMESTAMP_S":              timestampColumnBuilder(arrow.Second, false),
+	"TIMESTAMP_MS":             timestampColumnBuilder(arrow.Millisecond, false),
+	"TIMESTAMP":                timestampColumnBuilder(arrow.Microsecond, false),
+	"TIMESTAMP_US":             timestampColumnBuilder(arrow.Microsecond, false),
+	"DATETIME":                 timestampColumnBuilder(arrow.Microsecond, false),
+	"TIMESTAMP_NS":             timestampColumnBuilder(arrow.Nanosecond, false),
+	"TIMESTAMPTZ_S":            timestampColumnBuilder(arrow.Second, true),
+	"TIMESTAMPTZ_MS":           timestampColumnBuilder(arrow.Millisecond, true),
+	"TIMESTAMPTZ":              timestampColumnBuilder(arrow.Microsecond, true),
+	"TIMESTAMP WITH TIME ZONE": timestampColumnBuilder(arrow.Microsecond, true),
+	"TIMESTAMPTZ_NS":           timestampColumnBuilder(arrow.Nanosecond, true),
+	"DATE":                     dateBuilder,
+	"TIME":                     timeBuilder,
+
+	"JSON": jsonBuilder,
+
+	"TINYINT":  int8Builder,
+	"INT1":     int8Builder,
+	"SMALLINT": int16Builder,
+	"INT2":     int16Builder,
+	"SHORT":    int16Builder,
+	"INTEGER":  int32Builder,
+	"INT4":     int32Builder,
+	"INT":      int32Builder,
+	"SIGNED":   int32Builder,
+
+	"UTINYINT":  uint8Builder,
+	"USMALLINT": uint16Builder,
+	"UINTEGER":  uint32Builder,
+
+	"FLOAT":  float32Builder,
+	"FLOAT4": float32Builder,
+	"REAL":   float32Builder,
+
+	"DECIMAL": decimalBuilder(18, 3),
+	"NUMERIC": decimalBuilder(18, 3),
+
+	"UUID": uuidBuilder,
+
+	"BLOB":      blobBuilder,
+	"BYTEA":     blobBuilder,
+	"BINARY":    blobBuilder,
+	"VARBINARY": blobBuilder,
+
+	"BOOLEAN": boolBuilder,
+	"BOOL":    boolBuilder,
+	"LOGICAL": boolBuilder,
+
 	/*"UHUGEINT":  UInt64{},
-	"UINTEGER":  UInt64{},
-	"USMALLINT": UInt64{},
-	"UTINYINT":  UInt64{},
-
-
-		"INTEGER":  Int64{},
-		"INT4":     Int64{},
-		"INT":      Int64{},
-		"SIGNED":   Int64{},
-		"SMALLINT": Int64{},
-		"INT2":     Int64{},
-		"SHORT":    Int64{},
-		"TINYINT":  Int64{},
-		"INT1":     Int64{},
-		"HUGEINT":  Int64{},
-
-	"FLOAT":  Float64{},
-	"FLOAT4": Float64{},
-	"REAL":   Float64{},
+	"HUGEINT":  Int64{},
 
 	"BIT":                      Bit{},
 	"BITSTRING":                Bit{},
-	"BLOB":                     Blob{},
-	"BYTEA":                    Blob{},
-	"BINARY":                   Blob{},
-	"VARBINARY":                Blob{},
-	"BOOLEAN":                  Boolean{},
-	"BOOL":                     Boolean{},
-	"LOGICAL":                  Boolean{},
-	"DATE":                     Date{},
-	"DECIMAL":                  Decimal{},
-	"NUMERIC":                  Decimal{},
-	"INTERVAL":                 Interval{},
-	"JSON":                     Json{},
-	"TIME":                     Time{},
-	"TIMESTAMP WITH TIME ZONE": TimestampWithTimeZone{},
-	"TIMESTAMPTZ":              TimestampWithTimeZone{},
-	"TIMESTAMP":                Timestamp{},
-	"DATETIME":                 Timestamp{},
-	"UUID":                     Uuid{},*/
+	"INTERVAL":                 Interval{},*/
 }
 
 type IColumn interface {
@@ -109,6 +183,121 @@ type IColumn interface {
 	ParseFromStr(s string) error
 	GetData() any
 	GetMinMax() (any, any)
+	Reorder(idx IndexType)
+	GetSizeBytes() int64
+	Copy() IColumn
+	IsNull(i int64) bool
 }
 
 type ColumnBuilder func(name string, data any, sizeAndCap ...int64) (IColumn, error)
+
+// GetColumnBuilder returns the builder of the columns of the type.
+// The builders of the DECIMAL, LIST, MAP and STRUCT types are made from their names.
+func GetColumnBuilder(typeName string) (ColumnBuilder, error) {
+	if builder, ok := DataTypes[typeName]; ok {
+		return builder, nil
+	}
+	tp, err := parseValueType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	if tp.kind == kindScalar {
+		return scalarBuilder(tp.name)
+	}
+	return nestedBuilder(tp), nil
+}
+
+// scalarBuilder returns the builder of the type registered in DataTypes or of a DECIMAL type
+func scalarBuilder(typeName string) (ColumnBuilder, error) {
+	if builder, ok := DataTypes[typeName]; ok {
+		return builder, nil
+	}
+	precision, scale, ok, err := parseDecimalType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported data type: %s", typeName)
+	}
+	return decimalBuilder(precision, scale), nil
+}
+
+// TypeNameFromArrow returns the name of the column type stored as the arrow data type
+func TypeNameFromArrow(dt arrow.DataType) string {
+	switch dt.ID() {
+	case arrow.BOOL:
+		return DATA_TYPE_NAME_BOOLEAN
+	case arrow.INT8:
+		return DATA_TYPE_NAME_INT8
+	case arrow.INT16:
+		return DATA_TYPE_NAME_INT16
+	case arrow.INT32:
+		return DATA_TYPE_NAME_INT32
+	case arrow.INT64:
+		return DATA_TYPE_NAME_INT64
+	case arrow.UINT8:
+		return DATA_TYPE_NAME_UINT8
+	case arrow.UINT16:
+		return DATA_TYPE_NAME_UINT16
+	case arrow.UINT32:
+		return DATA_TYPE_NAME_UINT32
+	case arrow.UINT64:
+		return DATA_TYPE_NAME_UINT64
+	case arrow.FLOAT32:
+		return DATA_TYPE_NAME_FLOAT32
+	case arrow.FLOAT64:
+		return DATA_TYPE_NAME_FLOAT64
+	case arrow.DECIMAL128:
+		if dt := dt.(*arrow.Decimal128Type); dt.Precision <= maxDecimalPrecision {
+			return DecimalTypeName(dt.Precision, dt.Scale)
+		}
+	case arrow.STRING, arrow.LARGE_STRING:
+		return DATA_TYPE_NAME_STRING
+	case arrow.BINARY:
+		return DATA_TYPE_NAME_BLOB
+	case arrow.DICTIONARY:
+		if dt.(*arrow.DictionaryType).ValueType.ID() == arrow.STRING {
+			return DATA_TYPE_NAME_LOW_CARDINALITY
+		}
+	case arrow.TIMESTAMP:
+		ts := dt.(*arrow.TimestampType)
+		return TimestampTypeName(ts.Unit, ts.TimeZone != "" && ts.TimeZone != naiveTimeZone)
+	case arrow.DATE32, arrow.DATE64:
+		return DATA_TYPE_NAME_DATE
+	case arrow.TIME32, arrow.TIME64:
+		return DATA_TYPE_NAME_TIME
+	case arrow.EXTENSION:
+		if IsJSONType(dt) {
+			return DATA_TYPE_NAME_JSON
+		}
+		if IsUUIDType(dt) {
+			return DATA_TYPE_NAME_UUID
+		}
+	case arrow.LIST:
+		if elem := TypeNameFromArrow(dt.(*arrow.ListType).Elem()); elem != DATA_TYPE_NAME_UNKNOWN {
+			return ListTypeName(elem)
+		}
+	case arrow.MAP:
+		mt := dt.(*arrow.MapType)
+		if mt.KeyType().ID() != arrow.STRING {
+			return DATA_TYPE_NAME_UNKNOWN
+		}
+		if elem := TypeNameFromArrow(mt.ItemType()); elem != DATA_TYPE_NAME_UNKNOWN {
+			return MapTypeName(elem)
+		}
+	case arrow.STRUCT:
+		st := dt.(*arrow.StructType)
+		names := make([]string, len(st.Fields()))
+		types := make([]string, len(st.Fields()))
+		for i, f := range st.Fields() {
+			names[i], types[i] = f.Name, TypeNameFromArrow(f.Type)
+			if types[i] == DATA_TYPE_NAME_UNKNOWN {
+				return DATA_TYPE_NAME_UNKNOWN
+			}
+		}
+		if len(names) > 0 {
+			return StructTypeName(names, types)
+		}
+	}
+	return DATA_TYPE_NAME_UNKNOWN
+}
@@ -0,0 +1,158 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/decimal128"
+	"github.com/go-faster/jx"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The DECIMAL(precision, scale) columns hold the unscaled int64 values, so the precision is
+// limited to 18 digits. They are written as parquet integers with the decimal logical type.
+
+const DATA_TYPE_NAME_DECIMAL = "DECIMAL"
+
+const maxDecimalPrecision = 18
+
+// Decimal is a value of a DECIMAL column: Value / 10^Scale
+type Decimal struct {
+	Value     int64
+	Precision int32
+	Scale     int32
+}
+
+func (d Decimal) String() string {
+	return decimal128.FromI64(d.Value).ToString(d.Scale)
+}
+
+func (d Decimal) Float64() float64 {
+	return float64(d.Value) / math.Pow10(int(d.Scale))
+}
+
+// DecimalTypeName returns the name of the DECIMAL column type
+func DecimalTypeName(precision, scale int32) string {
+	return fmt.Sprintf("%s(%d,%d)", DATA_TYPE_NAME_DECIMAL, precision, scale)
+}
+
+// parseDecimalType parses DECIMAL(p), DECIMAL(p, s) and the NUMERIC aliases
+func parseDecimalType(typeName string) (int32, int32, bool, error) {
+	keyword, args, ok := splitTypeArgs(typeName)
+	if !ok || (keyword != DATA_TYPE_NAME_DECIMAL && keyword != "NUMERIC") {
+		return 0, 0, false, nil
+	}
+	if len(args) > 2 {
+		return 0, 0, true, fmt.Errorf("invalid DECIMAL type %q", typeName)
+	}
+	params := []int32{0, 0}
+	for i, arg := range args {
+		v, err := strconv.ParseInt(arg, 10, 32)
+		if err != nil {
+			return 0, 0, true, fmt.Errorf("invalid DECIMAL type %q", typeName)
+		}
+		params[i] = int32(v)
+	}
+	precision, scale := params[0], params[1]
+	if precision < 1 || precision > maxDecimalPrecision || scale < 0 || scale > precision {
+		return 0, 0, true, fmt.Errorf("unsupported DECIMAL type %q: the precision should be 1 to %d, "+
+			"the scale 0 to the precision", typeName, maxDecimalPrecision)
+	}
+	return precision, scale, true, nil
+}
+
+// castDecimal converts the number, the number string or the Decimal to the unscaled value
+func castDecimal(v any, precision, scale int32) (int64, bool) {
+	var (
+		n   decimal128.Num
+		err error
+	)
+	switch _v := v.(type) {
+	case Decimal:
+		n, err = decimal128.FromI64(_v.Value).Rescale(_v.Scale, scale)
+	case string:
+		n, err = decimal128.FromString(strings.TrimSpace(_v), precision, scale)
+	case float64:
+		n, err = decimal128.FromFloat64(_v, precision, scale)
+	case float32:
+		n, err = decimal128.FromFloat64(float64(_v), precision, scale)
+	case uint64:
+		n = decimal128.FromU64(_v).IncreaseScaleBy(scale)
+	default:
+		i, ok := castNumber[int64](v)
+		if !ok {
+			return 0, false
+		}
+		n = decimal128.FromI64(i).IncreaseScaleBy(scale)
+	}
+	if err != nil || !n.FitsInPrecision(precision) {
+		return 0, false
+	}
+	return int64(n.LowBits()), true
+}
+
+// decimalAppender appends the unscaled values to the Decimal128 builder
+type decimalAppender struct {
+	builder *array.Decimal128Builder
+}
+
+func (a decimalAppender) AppendValues(values []int64, valid []bool) {
+	res := make([]decimal128.Num, len(values))
+	for i, v := range values {
+		res[i] = decimal128.FromI64(v)
+	}
+	a.builder.AppendValues(res, valid)
+}
+
+func newDecimalColumn(precision, scale int32) *Column[int64] {
+	typeName := DecimalTypeName(precision, scale)
+	parse := func(v any) (int64, error) {
+		res, ok := castDecimal(v, precision, scale)
+		if !ok {
+			return 0, fmt.Errorf("invalid %s value %v", typeName, v)
+		}
+		return res, nil
+	}
+	return &Column[int64]{
+		typeName:  typeName,
+		arrowType: &arrow.Decimal128Type{Precision: precision, Scale: scale},
+		getBuilder: func(builder array.Builder) IArrowAppender[int64] {
+			return decimalAppender{builder.(*array.Decimal128Builder)}
+		},
+		parseStr: func(s string) (int64, error) {
+			return parse(s)
+		},
+		parseJson: func(d *jx.Decoder) (int64, error) {
+			n, err := d.Num()
+			if err != nil {
+				return 0, err
+			}
+			return parse(n.String())
+		},
+		toValue: func(v int64) any {
+			return Decimal{Value: v, Precision: precision, Scale: scale}
+		},
+		cast: func(data any) ([]int64, error) {
+			values, ok := anyValues(data)
+			if !ok {
+				return nil, fmt.Errorf("invalid data type")
+			}
+			return castSlice(values, func(v any) (int64, bool) {
+				return castDecimal(v, precision, scale)
+			}, typeName)
+		},
+		toStat: func(v int64) any {
+			return Decimal{Value: v, Scale: scale}.Float64()
+		},
+	}
+}
+
+func decimalBuilder(precision, scale int32) ColumnBuilder {
+	return func(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+		return colBuilder[int64](func() *Column[int64] {
+			return newDecimalColumn(precision, scale)
+		}, name, data, sizeAndCap...)
+	}
+}
@@ -0,0 +1,89 @@
+package data_types
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/go-faster/jx"
+	"reflect"
+)
+
+const DATA_TYPE_NAME_JSON = "JSON"
+
+// JSONType is the arrow type of the JSON columns. It's stored as a string,
+// the parquet writer of the service marks it with the JSON logical type.
+type JSONType struct {
+	arrow.ExtensionBase
+}
+
+// JSONArray is the arrow array of the JSON values
+type JSONArray struct {
+	array.ExtensionArrayBase
+}
+
+var jsonType = &JSONType{ExtensionBase: arrow.ExtensionBase{Storage: arrow.BinaryTypes.String}}
+
+func init() {
+	arrow.RegisterExtensionType(jsonType)
+}
+
+func (*JSONType) ArrayType() reflect.Type { return reflect.TypeOf(JSONArray{}) }
+func (*JSONType) ExtensionName() string   { return "arrow.json" }
+func (*JSONType) Serialize() string       { return "" }
+func (t *JSONType) String() string        { return "extension<arrow.json>" }
+
+func (t *JSONType) ExtensionEquals(other arrow.ExtensionType) bool {
+	return other.ExtensionName() == t.ExtensionName()
+}
+
+func (*JSONType) Deserialize(storage arrow.DataType, _ string) (arrow.ExtensionType, error) {
+	if storage.ID() != arrow.STRING {
+		return nil, fmt.Errorf("invalid storage type for arrow.json: %s", storage)
+	}
+	return jsonType, nil
+}
+
+// IsJSONType reports if the arrow data type is the one of the JSON columns
+func IsJSONType(dt arrow.DataType) bool {
+	ext, ok := dt.(arrow.ExtensionType)
+	return ok && ext.ExtensionName() == jsonType.ExtensionName()
+}
+
+// toJSON returns the JSON text of the value. []byte and json.RawMessage hold the JSON text already.
+func toJSON(v any) (string, error) {
+	switch _v := v.(type) {
+	case []byte:
+		return validJSON(string(_v))
+	case json.RawMessage:
+		return validJSON(string(_v))
+	}
+	res, err := json.Marshal(v)
+	return string(res), err
+}
+
+func validJSON(s string) (string, error) {
+	if !json.Valid([]byte(s)) {
+		return "", fmt.Errorf("invalid JSON %q", s)
+	}
+	return s, nil
+}
+
+func newJSONColumn() *Column[string] {
+	return &Column[string]{
+		typeName:  DATA_TYPE_NAME_JSON,
+		arrowType: jsonType,
+		getBuilder: func(builder array.Builder) IArrowAppender[string] {
+			return builder.(*array.ExtensionBuilder).Builder.(*array.StringBuilder)
+		},
+		parseStr: validJSON,
+		parseJson: func(d *jx.Decoder) (string, error) {
+			raw, err := d.Raw()
+			return raw.String(), err
+		},
+	}
+}
+
+func jsonBuilder(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+	return colBuilder[string](newJSONColumn, name, data, sizeAndCap...)
+}
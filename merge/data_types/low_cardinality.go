@@ -0,0 +1,298 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/go-faster/jx"
+	"maps"
+	"slices"
+	"unsafe"
+)
+
+// The LowCardinality(VARCHAR) columns keep every distinct string once and the rows as the indexes
+// of their values, e.g. the tags of the line protocol. They are written as arrow dictionary arrays,
+// so parquet stores them as dictionary encoded VARCHAR.
+
+const DATA_TYPE_NAME_LOW_CARDINALITY = "LowCardinality(VARCHAR)"
+
+var lowCardinalityType = &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+
+// DictStrings is the data of a LowCardinality(VARCHAR) column: the distinct values
+// and the index of the value of each row
+type DictStrings struct {
+	Dict []string
+	Keys []int32
+}
+
+type lowCardinalityColumn struct {
+	name   string
+	dict   []string
+	index  map[string]int32
+	keys   []int32
+	valids []bool
+}
+
+var _ IColumn = &lowCardinalityColumn{}
+
+func lowCardinalityBuilder(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+	col := &lowCardinalityColumn{name: name, index: make(map[string]int32)}
+	if data == nil {
+		col.InitializeData(sizeAndCap...)
+		return col, nil
+	}
+	if err := col.Append(data); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+func (c *lowCardinalityColumn) InitializeData(sizeAndCap ...int64) {
+	var size int64 = 1000
+	if len(sizeAndCap) > 0 {
+		size = sizeAndCap[0]
+	}
+	cap := size * 2
+	if len(sizeAndCap) > 1 {
+		cap = sizeAndCap[1]
+	}
+	if cap < size {
+		cap = size
+	}
+	c.keys = make([]int32, size, cap)
+	c.valids = make([]bool, size, cap)
+}
+
+// intern returns the index of the value adding it to the dictionary if needed
+func (c *lowCardinalityColumn) intern(s string) int32 {
+	k, ok := c.index[s]
+	if !ok {
+		k = int32(len(c.dict))
+		c.dict = append(c.dict, s)
+		c.index[s] = k
+	}
+	return k
+}
+
+// appendRows appends the rows of the []string or DictStrings data selected by the mask (all if nil).
+// The data can be Nullable, the values of the null rows aren't interned.
+func (c *lowCardinalityColumn) appendRows(data any, mask []byte) error {
+	data, valid := unwrapNullable(data)
+	var n int
+	switch _data := data.(type) {
+	case []string:
+		n = len(_data)
+	case DictStrings:
+		n = len(_data.Keys)
+	default:
+		return fmt.Errorf("invalid data type")
+	}
+	if mask != nil && len(mask) != (n+7)/8 {
+		return fmt.Errorf("invalid mask length")
+	}
+	selected := func(i int) bool {
+		return mask == nil || mask[i/8]&(1<<(i%8)) != 0
+	}
+	lenBefore := len(c.keys)
+	switch _data := data.(type) {
+	case []string:
+		for i, s := range _data {
+			switch {
+			case !selected(i):
+			case valid != nil && !isValid(valid, i):
+				c.keys = append(c.keys, 0)
+			default:
+				c.keys = append(c.keys, c.intern(s))
+			}
+		}
+	case DictStrings:
+		// only the values of the selected rows are interned
+		remap := make([]int32, len(_data.Dict))
+		for i := range remap {
+			remap[i] = -1
+		}
+		for i, k := range _data.Keys {
+			if !selected(i) {
+				continue
+			}
+			if valid != nil && !isValid(valid, i) {
+				c.keys = append(c.keys, 0)
+				continue
+			}
+			if remap[k] < 0 {
+				remap[k] = c.intern(_data.Dict[k])
+			}
+			c.keys = append(c.keys, remap[k])
+		}
+	}
+	c.valids = append(c.valids, make([]bool, len(c.keys)-lenBefore)...)
+	if valid == nil {
+		FastFillArray(c.valids[lenBefore:], true)
+		return nil
+	}
+	k := lenBefore
+	for i := 0; i < n; i++ {
+		if selected(i) {
+			c.valids[k] = isValid(valid, i)
+			k++
+		}
+	}
+	return nil
+}
+
+func (c *lowCardinalityColumn) AppendNulls(size int64) {
+	c.keys = append(c.keys, make([]int32, size)...)
+	c.valids = append(c.valids, make([]bool, size)...)
+}
+
+func (c *lowCardinalityColumn) GetLength() int64 {
+	return int64(len(c.keys))
+}
+
+func (c *lowCardinalityColumn) AppendFromJson(dec *jx.Decoder) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (c *lowCardinalityColumn) Less(i int32, j int32) bool {
+	return (!c.valids[i] && c.valids[j]) ||
+		(c.valids[i] && c.valids[j] && c.dict[c.keys[i]] <= c.dict[c.keys[j]])
+}
+
+func (c *lowCardinalityColumn) ValidateData(data any) error {
+	data, _ = unwrapNullable(data)
+	switch data.(type) {
+	case []string, DictStrings:
+		return nil
+	}
+	return fmt.Errorf("invalid data type")
+}
+
+func (c *lowCardinalityColumn) ArrowDataType() arrow.DataType {
+	return lowCardinalityType
+}
+
+func (c *lowCardinalityColumn) Append(data any) error {
+	return c.appendRows(data, nil)
+}
+
+func (c *lowCardinalityColumn) AppendOne(val any) error {
+	s, ok := val.(string)
+	if !ok {
+		return fmt.Errorf("invalid data type")
+	}
+	c.keys = append(c.keys, c.intern(s))
+	c.valids = append(c.valids, true)
+	return nil
+}
+
+func (c *lowCardinalityColumn) AppendByMask(data any, mask []byte) error {
+	return c.appendRows(data, mask)
+}
+
+// WriteToBatch writes the dictionary and the indexes. The builder is reset first,
+// so the dictionary of the previous record isn't written again.
+func (c *lowCardinalityColumn) WriteToBatch(batch array.Builder) error {
+	builder := batch.(*array.BinaryDictionaryBuilder)
+	builder.ResetFull()
+	dictBuilder := array.NewStringBuilder(memory.DefaultAllocator)
+	defer dictBuilder.Release()
+	dictBuilder.AppendValues(c.dict, nil)
+	dict := dictBuilder.NewStringArray()
+	defer dict.Release()
+	if err := builder.InsertStringDictValues(dict); err != nil {
+		return err
+	}
+	indices := make([]int, len(c.keys))
+	for i, k := range c.keys {
+		indices[i] = int(k)
+	}
+	builder.AppendIndices(indices, c.valids)
+	return nil
+}
+
+func (c *lowCardinalityColumn) GetName() string {
+	return c.name
+}
+
+func (c *lowCardinalityColumn) GetTypeName() string {
+	return DATA_TYPE_NAME_LOW_CARDINALITY
+}
+
+func (c *lowCardinalityColumn) GetVal(i int64) any {
+	if !c.valids[i] {
+		return ""
+	}
+	return c.dict[c.keys[i]]
+}
+
+func (c *lowCardinalityColumn) ParseFromStr(s string) error {
+	return c.AppendOne(s)
+}
+
+// GetData returns DictStrings, wrapped into Nullable if some of the rows are null
+func (c *lowCardinalityColumn) GetData() any {
+	data := DictStrings{Dict: c.dict, Keys: c.keys}
+	if slices.Contains(c.valids, false) {
+		return Nullable{Data: data, Valid: validsToBitmap(c.valids)}
+	}
+	return data
+}
+
+// GetMinMax returns the min and max of the dictionary: a value is only added with a row
+func (c *lowCardinalityColumn) GetMinMax() (any, any) {
+	if len(c.dict) == 0 {
+		return nil, nil
+	}
+	return slices.Min(c.dict), slices.Max(c.dict)
+}
+
+func (c *lowCardinalityColumn) Reorder(idx IndexType) {
+	keys := make([]int32, len(idx))
+	valids := make([]bool, len(idx))
+	for i, j := range idx {
+		keys[i] = c.keys[j]
+		valids[i] = c.valids[j]
+	}
+	c.keys = keys
+	c.valids = valids
+}
+
+// GetSizeBytes estimates the memory held by the column: the indexes and the dictionary with its map
+func (c *lowCardinalityColumn) GetSizeBytes() int64 {
+	size := int64(len(c.keys)) * 5
+	for _, s := range c.dict {
+		size += int64(len(s)) + 2*int64(unsafe.Sizeof(s)) + 4
+	}
+	return size
+}
+
+func (c *lowCardinalityColumn) Copy() IColumn {
+	return &lowCardinalityColumn{
+		name:   c.name,
+		dict:   slices.Clone(c.dict),
+		index:  maps.Clone(c.index),
+		keys:   slices.Clone(c.keys),
+		valids: slices.Clone(c.valids),
+	}
+}
+
+func (c *lowCardinalityColumn) IsNull(i int64) bool {
+	return !c.valids[i]
+}
+
+func (c *lowCardinalityColumn) castOne(v any) (any, error) {
+	if s, ok := castBlob(v); ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("invalid %s value %v (%T)", DATA_TYPE_NAME_LOW_CARDINALITY, v, v)
+}
+
+// appendArrowValue appends the value of a nested column, which isn't dictionary encoded
+func (c *lowCardinalityColumn) appendArrowValue(b array.Builder, v any) {
+	b.(*array.StringBuilder).Append(v.(string))
+}
+
+func (c *lowCardinalityColumn) valueOf(v any) any {
+	return v
+}
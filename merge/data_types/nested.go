@@ -0,0 +1,828 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/go-faster/jx"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The LIST, MAP and STRUCT columns hold their values as []any, map[string]any and map[string]any
+// of the values stored by the columns of their element types, e.g. int64, float64, string,
+// the JSON text, the nanoseconds of the time types and the unscaled decimals. A nil value is a null.
+// The type names follow DuckDB: INT8[], MAP(VARCHAR, INT8) and STRUCT("a" INT8, "b" VARCHAR).
+
+const (
+	kindScalar = iota
+	kindList
+	kindMap
+	kindStruct
+)
+
+type structField struct {
+	name string
+	tp   *valueType
+}
+
+// valueType describes the values of a column or of the elements of a nested column
+type valueType struct {
+	kind      int
+	name      string
+	arrowType arrow.DataType
+	// the elements of a LIST and the values of a MAP
+	elem   *valueType
+	fields []structField
+	// column converts and writes the scalar values
+	column scalarColumn
+	// parse parses the strings of the time types
+	parse func(string) (int64, error)
+}
+
+// scalarColumn is implemented by the Column of every scalar type
+type scalarColumn interface {
+	castOne(v any) (any, error)
+	appendArrowValue(b array.Builder, v any)
+	valueOf(v any) any
+}
+
+// ListTypeName returns the name of the LIST of the elements of the type
+func ListTypeName(elem string) string {
+	return elem + "[]"
+}
+
+// MapTypeName returns the name of the MAP of VARCHAR keys to the values of the type
+func MapTypeName(value string) string {
+	return "MAP(VARCHAR, " + value + ")"
+}
+
+// StructTypeName returns the name of the STRUCT of the fields of the types
+func StructTypeName(names []string, types []string) string {
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = `"` + strings.ReplaceAll(name, `"`, `""`) + `" ` + types[i]
+	}
+	return "STRUCT(" + strings.Join(fields, ", ") + ")"
+}
+
+func newListType(elem *valueType) *valueType {
+	return &valueType{kind: kindList, name: ListTypeName(elem.name), arrowType: arrow.ListOf(elem.arrowType), elem: elem}
+}
+
+func newMapType(elem *valueType) *valueType {
+	return &valueType{kind: kindMap, name: MapTypeName(elem.name),
+		arrowType: arrow.MapOf(arrow.BinaryTypes.String, elem.arrowType), elem: elem}
+}
+
+func newStructType(fields []structField) (*valueType, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("STRUCT should have fields")
+	}
+	names := make([]string, len(fields))
+	types := make([]string, len(fields))
+	arrowFields := make([]arrow.Field, len(fields))
+	for i, f := range fields {
+		if slices.Contains(names[:i], f.name) {
+			return nil, fmt.Errorf("duplicate STRUCT field %q", f.name)
+		}
+		names[i], types[i] = f.name, f.tp.name
+		arrowFields[i] = arrow.Field{Name: f.name, Type: f.tp.arrowType, Nullable: true}
+	}
+	return &valueType{kind: kindStruct, name: StructTypeName(names, types),
+		arrowType: arrow.StructOf(arrowFields...), fields: fields}, nil
+}
+
+func newScalarType(typeName string) (*valueType, error) {
+	builder, err := scalarBuilder(typeName)
+	if err != nil {
+		return nil, err
+	}
+	col, err := builder("", nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	arrowType := col.ArrowDataType()
+	// the values of the nested columns aren't dictionary encoded
+	if dict, ok := arrowType.(*arrow.DictionaryType); ok {
+		arrowType = dict.ValueType
+	}
+	res := &valueType{kind: kindScalar, name: col.GetTypeName(), arrowType: arrowType,
+		column: col.(scalarColumn)}
+	if timeCol, ok := col.(*Column[int64]); ok && timeCol.toValue != nil {
+		res.parse = timeCol.parseStr
+	}
+	return res, nil
+}
+
+// parseValueType parses the type name. LIST(T), LIST<T>, MAP<K, V> and STRUCT<...>
+// are accepted along with the DuckDB syntax.
+func parseValueType(typeName string) (*valueType, error) {
+	s := strings.TrimSpace(typeName)
+	if strings.HasSuffix(s, "[]") {
+		elem, err := parseValueType(s[:len(s)-2])
+		if err != nil {
+			return nil, err
+		}
+		return newListType(elem), nil
+	}
+	keyword, args, ok := splitTypeArgs(s)
+	if !ok {
+		return newScalarType(s)
+	}
+	switch keyword {
+	case "LIST":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("invalid LIST type %q", typeName)
+		}
+		elem, err := parseValueType(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return newListType(elem), nil
+	case "MAP":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid MAP type %q", typeName)
+		}
+		key, err := parseValueType(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if key.name != DATA_TYPE_NAME_STRING {
+			return nil, fmt.Errorf("MAP keys should be VARCHAR, got %s", key.name)
+		}
+		elem, err := parseValueType(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return newMapType(elem), nil
+	case "STRUCT":
+		fields := make([]structField, len(args))
+		for i, arg := range args {
+			name, fieldType, err := splitStructField(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid STRUCT type %q: %w", typeName, err)
+			}
+			fields[i].name = name
+			fields[i].tp, err = parseValueType(fieldType)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return newStructType(fields)
+	}
+	return newScalarType(s)
+}
+
+// splitTypeArgs splits KEYWORD(arg, ...) or KEYWORD<arg, ...> into the upper-case keyword
+// and the arguments
+func splitTypeArgs(s string) (string, []string, bool) {
+	open := strings.IndexAny(s, "(<")
+	if open <= 0 || (s[len(s)-1] != ')' && s[len(s)-1] != '>') {
+		return "", nil, false
+	}
+	keyword := strings.ToUpper(strings.TrimSpace(s[:open]))
+	var (
+		args   []string
+		depth  int
+		quoted bool
+		start  = open + 1
+	)
+	for i := start; i < len(s)-1; i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '<':
+			depth++
+		case c == ')' || c == '>':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	args = append(args, strings.TrimSpace(s[start:len(s)-1]))
+	return keyword, args, true
+}
+
+// splitStructField splits `name TYPE` or `"quoted name" TYPE`
+func splitStructField(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		name, fieldType, ok := strings.Cut(s, " ")
+		if !ok {
+			return "", "", fmt.Errorf("field %q has no type", s)
+		}
+		return name, strings.TrimSpace(fieldType), nil
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] != '"' {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '"' {
+			i++
+			continue
+		}
+		return strings.ReplaceAll(s[1:i], `""`, `"`), strings.TrimSpace(s[i+1:]), nil
+	}
+	return "", "", fmt.Errorf("unterminated field name %q", s)
+}
+
+// normalize converts the value to the representation of the type
+func (t *valueType) normalize(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch t.kind {
+	case kindList:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("expected a list, got %T", v)
+		}
+		res := make([]any, rv.Len())
+		for i := range res {
+			var err error
+			res[i], err = t.elem.normalize(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case kindMap, kindStruct:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("expected an object, got %T", v)
+		}
+		res := make(map[string]any, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			key := it.Key().String()
+			elem := t.elem
+			if t.kind == kindStruct {
+				idx := slices.IndexFunc(t.fields, func(f structField) bool { return f.name == key })
+				if idx < 0 {
+					return nil, fmt.Errorf("unknown field %q of %s", key, t.name)
+				}
+				elem = t.fields[idx].tp
+			}
+			val, err := elem.normalize(it.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			res[key] = val
+		}
+		return res, nil
+	}
+	return t.normalizeScalar(v)
+}
+
+func (t *valueType) normalizeScalar(v any) (any, error) {
+	switch t.arrowType.ID() {
+	case arrow.INT64:
+		switch _v := v.(type) {
+		case int64:
+			return _v, nil
+		case int:
+			return int64(_v), nil
+		case uint64:
+			if _v <= math.MaxInt64 {
+				return int64(_v), nil
+			}
+		case float64:
+			if _v == math.Trunc(_v) && math.Abs(_v) <= 1<<53 {
+				return int64(_v), nil
+			}
+		}
+	case arrow.UINT64:
+		switch _v := v.(type) {
+		case uint64:
+			return _v, nil
+		case int64:
+			if _v >= 0 {
+				return uint64(_v), nil
+			}
+		case int:
+			if _v >= 0 {
+				return uint64(_v), nil
+			}
+		case float64:
+			if _v == math.Trunc(_v) && _v >= 0 && _v <= 1<<53 {
+				return uint64(_v), nil
+			}
+		}
+	case arrow.FLOAT64:
+		switch _v := v.(type) {
+		case float64:
+			return _v, nil
+		case int64:
+			return float64(_v), nil
+		case int:
+			return float64(_v), nil
+		case uint64:
+			return float64(_v), nil
+		}
+	case arrow.STRING:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case arrow.EXTENSION:
+		if IsJSONType(t.arrowType) {
+			return toJSON(v)
+		}
+	case arrow.TIMESTAMP, arrow.DATE32, arrow.TIME64:
+		switch _v := v.(type) {
+		case int64:
+			return _v, nil
+		case string:
+			return t.parse(_v)
+		case time.Time:
+			if t.name == DATA_TYPE_NAME_TIME {
+				return int64(_v.Sub(_v.Truncate(24 * time.Hour))), nil
+			}
+			return _v.UnixNano(), nil
+		}
+	}
+	return t.column.castOne(v)
+}
+
+// appendArrow appends the value of the type to the arrow builder
+func (t *valueType) appendArrow(b array.Builder, v any) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+	switch t.kind {
+	case kindList:
+		lb := b.(*array.ListBuilder)
+		lb.Append(true)
+		for _, e := range v.([]any) {
+			t.elem.appendArrow(lb.ValueBuilder(), e)
+		}
+		return
+	case kindMap:
+		mb := b.(*array.MapBuilder)
+		mb.Append(true)
+		m := v.(map[string]any)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			mb.KeyBuilder().(*array.StringBuilder).Append(k)
+			t.elem.appendArrow(mb.ItemBuilder(), m[k])
+		}
+		return
+	case kindStruct:
+		sb := b.(*array.StructBuilder)
+		sb.Append(true)
+		m := v.(map[string]any)
+		for i, f := range t.fields {
+			f.tp.appendArrow(sb.FieldBuilder(i), m[f.name])
+		}
+		return
+	}
+	t.column.appendArrowValue(b, v)
+}
+
+// toValue converts the value to the one returned by GetVal: the time types become time.Time
+// and the MAPs become map[any]any
+func (t *valueType) toValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	switch t.kind {
+	case kindList:
+		list := v.([]any)
+		res := make([]any, len(list))
+		for i, e := range list {
+			res[i] = t.elem.toValue(e)
+		}
+		return res
+	case kindMap:
+		res := make(map[any]any, len(v.(map[string]any)))
+		for k, e := range v.(map[string]any) {
+			res[k] = t.elem.toValue(e)
+		}
+		return res
+	case kindStruct:
+		m := v.(map[string]any)
+		res := make(map[string]any, len(t.fields))
+		for _, f := range t.fields {
+			res[f.name] = f.tp.toValue(m[f.name])
+		}
+		return res
+	}
+	return t.column.valueOf(v)
+}
+
+// decodeJson decodes the JSON value of the type
+func (t *valueType) decodeJson(d *jx.Decoder) (any, error) {
+	if t.kind == kindScalar && IsJSONType(t.arrowType) {
+		if d.Next() == jx.Null {
+			return nil, d.Null()
+		}
+		raw, err := d.Raw()
+		return raw.String(), err
+	}
+	v, err := DecodeJSONValue(d)
+	if err != nil {
+		return nil, err
+	}
+	return t.normalize(v)
+}
+
+// DecodeJSONValue decodes a JSON value into nil, bool, int64, uint64, float64, string,
+// []any or map[string]any
+func DecodeJSONValue(d *jx.Decoder) (any, error) {
+	switch d.Next() {
+	case jx.Null:
+		return nil, d.Null()
+	case jx.Bool:
+		return d.Bool()
+	case jx.Number:
+		num, err := d.Num()
+		if err != nil {
+			return nil, err
+		}
+		if num.IsInt() {
+			if v, err := num.Int64(); err == nil {
+				return v, nil
+			}
+			if v, err := num.Uint64(); err == nil {
+				return v, nil
+			}
+		}
+		return num.Float64()
+	case jx.String:
+		return d.Str()
+	case jx.Array:
+		res := []any{}
+		err := d.Arr(func(d *jx.Decoder) error {
+			v, err := DecodeJSONValue(d)
+			res = append(res, v)
+			return err
+		})
+		return res, err
+	case jx.Object:
+		res := map[string]any{}
+		err := d.Obj(func(d *jx.Decoder, key string) error {
+			v, err := DecodeJSONValue(d)
+			res[key] = v
+			return err
+		})
+		return res, err
+	}
+	return nil, fmt.Errorf("unexpected JSON value %s", d.Next())
+}
+
+func estimateSize(v any) int64 {
+	switch _v := v.(type) {
+	case string:
+		return 16 + int64(len(_v))
+	case []any:
+		res := int64(24)
+		for _, e := range _v {
+			res += estimateSize(e)
+		}
+		return res
+	case map[string]any:
+		res := int64(48)
+		for k, e := range _v {
+			res += 16 + int64(len(k)) + estimateSize(e)
+		}
+		return res
+	}
+	return 16
+}
+
+// nestedColumn is the column of the LIST, MAP and STRUCT values
+type nestedColumn struct {
+	data []any
+	name string
+	tp   *valueType
+}
+
+var _ IColumn = &nestedColumn{}
+
+func nestedBuilder(tp *valueType) ColumnBuilder {
+	return func(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+		col := &nestedColumn{name: name, tp: tp}
+		if data == nil {
+			col.InitializeData(sizeAndCap...)
+			return col, nil
+		}
+		err := col.ValidateData(data)
+		if err != nil {
+			return nil, err
+		}
+		values := nestedValues(data)
+		col.data = make([]any, len(values))
+		for i, v := range values {
+			col.data[i], err = tp.normalize(v)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", name, err)
+			}
+		}
+		return col, nil
+	}
+}
+
+func (c *nestedColumn) InitializeData(sizeAndCap ...int64) {
+	var size int64 = 1000
+	if len(sizeAndCap) > 0 {
+		size = sizeAndCap[0]
+	}
+	cap := size * 2
+	if len(sizeAndCap) > 1 {
+		cap = sizeAndCap[1]
+	}
+	c.data = make([]any, size, max(size, cap))
+}
+
+func (c *nestedColumn) AppendNulls(size int64) {
+	c.data = append(c.data, make([]any, size)...)
+}
+
+func (c *nestedColumn) GetLength() int64 {
+	return int64(len(c.data))
+}
+
+func (c *nestedColumn) AppendFromJson(dec *jx.Decoder) error {
+	v, err := c.tp.decodeJson(dec)
+	if err != nil {
+		return err
+	}
+	c.data = append(c.data, v)
+	return nil
+}
+
+// Less only orders the nulls first, the nested values aren't comparable
+func (c *nestedColumn) Less(i int32, j int32) bool {
+	return c.data[j] != nil
+}
+
+func (c *nestedColumn) ValidateData(data any) error {
+	data, _ = unwrapNullable(data)
+	if _, ok := data.([]any); !ok {
+		return fmt.Errorf("invalid data type")
+	}
+	return nil
+}
+
+func (c *nestedColumn) ArrowDataType() arrow.DataType {
+	return c.tp.arrowType
+}
+
+func (c *nestedColumn) Append(data any) error {
+	err := c.ValidateData(data)
+	if err != nil {
+		return err
+	}
+	c.data = append(c.data, nestedValues(data)...)
+	return nil
+}
+
+// nestedValues returns the []any values of the data, the null rows of Nullable are nil
+func nestedValues(data any) []any {
+	data, valid := unwrapNullable(data)
+	if valid != nil {
+		return nullValues(data.([]any), valid)
+	}
+	return data.([]any)
+}
+
+func (c *nestedColumn) AppendOne(val any) error {
+	v, err := c.tp.normalize(val)
+	if err != nil {
+		return err
+	}
+	c.data = append(c.data, v)
+	return nil
+}
+
+func (c *nestedColumn) AppendByMask(data any, mask []byte) error {
+	err := c.ValidateData(data)
+	if err != nil {
+		return err
+	}
+	_data := nestedValues(data)
+	if len(mask) != (len(_data)+7)/8 {
+		return fmt.Errorf("invalid mask length")
+	}
+	for i, v := range _data {
+		if mask[i/8]&(1<<(i%8)) != 0 {
+			c.data = append(c.data, v)
+		}
+	}
+	return nil
+}
+
+func (c *nestedColumn) WriteToBatch(batch array.Builder) error {
+	for _, v := range c.data {
+		c.tp.appendArrow(batch, v)
+	}
+	return nil
+}
+
+func (c *nestedColumn) GetName() string {
+	return c.name
+}
+
+func (c *nestedColumn) GetTypeName() string {
+	return c.tp.name
+}
+
+func (c *nestedColumn) GetVal(i int64) any {
+	return c.tp.toValue(c.data[i])
+}
+
+func (c *nestedColumn) ParseFromStr(s string) error {
+	return c.AppendFromJson(jx.DecodeStr(s))
+}
+
+func (c *nestedColumn) GetData() any {
+	return c.data
+}
+
+// GetMinMax returns nil, the nested columns have no statistics
+func (c *nestedColumn) GetMinMax() (any, any) {
+	return nil, nil
+}
+
+func (c *nestedColumn) Reorder(idx IndexType) {
+	data := make([]any, len(idx))
+	for i, j := range idx {
+		data[i] = c.data[j]
+	}
+	c.data = data
+}
+
+func (c *nestedColumn) GetSizeBytes() int64 {
+	var res int64
+	for _, v := range c.data {
+		res += estimateSize(v)
+	}
+	return res
+}
+
+// Copy returns a column sharing the values, they are never modified in place
+func (c *nestedColumn) Copy() IColumn {
+	res := *c
+	res.data = slices.Clone(c.data)
+	return &res
+}
+
+func (c *nestedColumn) IsNull(i int64) bool {
+	return c.data[i] == nil
+}
+
+// typeInference collects the types of the values decoded from JSON
+type typeInference struct {
+	kind   int
+	name   string
+	elem   *typeInference
+	fields map[string]*typeInference
+}
+
+func (t *typeInference) add(v any) {
+	if v == nil || t.name == DATA_TYPE_NAME_JSON {
+		return
+	}
+	kind, name := kindScalar, ""
+	switch v.(type) {
+	case []any:
+		kind = kindList
+	case map[string]any:
+		kind = kindStruct
+	case int64, int:
+		name = DATA_TYPE_NAME_INT64
+	case uint64:
+		name = DATA_TYPE_NAME_UINT64
+	case float64:
+		name = DATA_TYPE_NAME_FLOAT64
+	case string:
+		name = DATA_TYPE_NAME_STRING
+	default:
+		name = DATA_TYPE_NAME_JSON
+	}
+	switch {
+	case t.kind == kindScalar && t.name == "":
+		t.kind, t.name = kind, name
+		if kind == kindList {
+			t.elem = &typeInference{}
+		}
+		if kind == kindStruct {
+			t.fields = map[string]*typeInference{}
+		}
+	case t.kind != kind:
+		t.setJSON()
+		return
+	case kind == kindScalar && t.name != name:
+		// the integers are stored as FLOAT8 along with the floats
+		numeric := []string{DATA_TYPE_NAME_INT64, DATA_TYPE_NAME_UINT64, DATA_TYPE_NAME_FLOAT64}
+		if slices.Contains(numeric, t.name) && slices.Contains(numeric, name) {
+			t.name = DATA_TYPE_NAME_FLOAT64
+			return
+		}
+		t.setJSON()
+		return
+	}
+	switch _v := v.(type) {
+	case []any:
+		for _, e := range _v {
+			t.elem.add(e)
+		}
+	case map[string]any:
+		for k, e := range _v {
+			if t.fields[k] == nil {
+				t.fields[k] = &typeInference{}
+			}
+			t.fields[k].add(e)
+		}
+	}
+}
+
+func (t *typeInference) setJSON() {
+	t.kind, t.name, t.elem, t.fields = kindScalar, DATA_TYPE_NAME_JSON, nil, nil
+}
+
+func (t *typeInference) typeName() string {
+	switch t.kind {
+	case kindList:
+		elem := t.elem.typeName()
+		if elem == "" {
+			return DATA_TYPE_NAME_JSON
+		}
+		return ListTypeName(elem)
+	case kindStruct:
+		if len(t.fields) == 0 {
+			return DATA_TYPE_NAME_JSON
+		}
+		names := make([]string, 0, len(t.fields))
+		for k := range t.fields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		types := make([]string, len(names))
+		for i, name := range names {
+			types[i] = t.fields[name].typeName()
+			if types[i] == "" {
+				types[i] = DATA_TYPE_NAME_JSON
+			}
+		}
+		return StructTypeName(names, types)
+	}
+	return t.name
+}
+
+// InferTypeName returns the type of the column of the values decoded by DecodeJSONValue.
+// The arrays are LISTs and the objects are STRUCTs of the union of their fields.
+// The integers mixed with floats are FLOAT8, the other mixed types, the booleans
+// and the values of unknown types are stored as JSON.
+func InferTypeName(values []any) string {
+	t := &typeInference{}
+	for _, v := range values {
+		t.add(v)
+	}
+	if res := t.typeName(); res != "" {
+		return res
+	}
+	return DATA_TYPE_NAME_JSON
+}
+
+// valuesToColumn builds the column of the type from the values of any type convertible to it
+func valuesToColumn(name string, typeName string, values []any) (IColumn, error) {
+	tp, err := parseValueType(typeName)
+	if err != nil {
+		return nil, err
+	}
+	if tp.kind != kindScalar {
+		return nestedBuilder(tp)(name, values)
+	}
+	builder, err := scalarBuilder(tp.name)
+	if err != nil {
+		return nil, err
+	}
+	col, err := builder(name, nil, 0, int64(len(values)))
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if v == nil {
+			col.AppendNulls(1)
+			continue
+		}
+		v, err = tp.normalize(v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		if err = col.AppendOne(v); err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+	}
+	return col, nil
+}
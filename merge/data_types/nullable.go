@@ -0,0 +1,76 @@
+package data_types
+
+// Nullable holds the data of a column having null rows, e.g. the fields missing from some points
+// of a line protocol batch. The row i is null unless the bit i%8 of Valid[i/8] is set,
+// the values of the null rows are ignored. The data can be TypedData.
+type Nullable struct {
+	Data  any
+	Valid []byte
+}
+
+// IsValid reports if the row i isn't null
+func (n Nullable) IsValid(i int) bool {
+	return isValid(n.Valid, i)
+}
+
+// SetValid marks the row i of the validity bitmap as not null, growing the bitmap if needed
+func SetValid(valid []byte, i int) []byte {
+	for len(valid) <= i/8 {
+		valid = append(valid, 0)
+	}
+	valid[i/8] |= 1 << (i % 8)
+	return valid
+}
+
+func isValid(valid []byte, i int) bool {
+	return i/8 < len(valid) && valid[i/8]&(1<<(i%8)) != 0
+}
+
+// unwrapNullable returns the data and the validity bitmap of the rows, nil if all of them are valid
+func unwrapNullable(data any) (any, []byte) {
+	if n, ok := data.(Nullable); ok {
+		return n.Data, n.Valid
+	}
+	return data, nil
+}
+
+// bitmapToValids converts the validity bitmap of n rows, nil means all of them are valid
+func bitmapToValids(valid []byte, n int) []bool {
+	res := make([]bool, n)
+	if valid == nil {
+		FastFillArray(res, true)
+		return res
+	}
+	for i := range res {
+		res[i] = isValid(valid, i)
+	}
+	return res
+}
+
+// validsToBitmap returns the validity bitmap of the rows, nil if all of them are valid
+func validsToBitmap(valids []bool) []byte {
+	var res []byte
+	for i, v := range valids {
+		if !v && res == nil {
+			res = make([]byte, (len(valids)+7)/8)
+			for j := 0; j < i; j++ {
+				res[j/8] |= 1 << (j % 8)
+			}
+		}
+		if v && res != nil {
+			res[i/8] |= 1 << (i % 8)
+		}
+	}
+	return res
+}
+
+// nullValues returns a copy of the values with the null rows set to nil
+func nullValues(values []any, valid []byte) []any {
+	res := make([]any, len(values))
+	for i, v := range values {
+		if isValid(valid, i) {
+			res[i] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,211 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/go-faster/jx"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// The narrow integer and float columns. The parsers emit int64, uint64 and float64 values,
+// they are converted to the type of the column failing on the overflows.
+
+const DATA_TYPE_NAME_INT8 = "INT1"
+const DATA_TYPE_NAME_INT16 = "INT2"
+const DATA_TYPE_NAME_INT32 = "INT4"
+const DATA_TYPE_NAME_UINT8 = "UTINYINT"
+const DATA_TYPE_NAME_UINT16 = "USMALLINT"
+const DATA_TYPE_NAME_UINT32 = "UINTEGER"
+const DATA_TYPE_NAME_FLOAT32 = "FLOAT4"
+
+type number interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
+}
+
+func isFloat[T number]() bool {
+	half := 0.5
+	return T(half) != 0
+}
+
+func isSigned[T number]() bool {
+	var zero T
+	return zero-1 < zero
+}
+
+// checkedCast converts the number to T. ok is false if T can't hold it
+// or, for the integer types, if it has a fraction.
+func checkedCast[T number, S int64 | uint64 | float64](v S) (T, bool) {
+	res := T(v)
+	if isFloat[T]() {
+		return res, !math.IsInf(float64(res), 0) || math.IsInf(float64(v), 0)
+	}
+	return res, S(res) == v && (res < 0) == (v < 0)
+}
+
+// castNumber converts a numeric value or a number string to T
+func castNumber[T number](v any) (T, bool) {
+	switch _v := v.(type) {
+	case T:
+		return _v, true
+	case int64:
+		return checkedCast[T](_v)
+	case uint64:
+		return checkedCast[T](_v)
+	case float64:
+		return checkedCast[T](_v)
+	case int:
+		return checkedCast[T](int64(_v))
+	case int8:
+		return checkedCast[T](int64(_v))
+	case int16:
+		return checkedCast[T](int64(_v))
+	case int32:
+		return checkedCast[T](int64(_v))
+	case uint8:
+		return checkedCast[T](uint64(_v))
+	case uint16:
+		return checkedCast[T](uint64(_v))
+	case uint32:
+		return checkedCast[T](uint64(_v))
+	case float32:
+		return checkedCast[T](float64(_v))
+	case Decimal:
+		return checkedCast[T](_v.Float64())
+	case string:
+		if i, err := strconv.ParseInt(_v, 10, 64); err == nil {
+			return checkedCast[T](i)
+		}
+		if u, err := strconv.ParseUint(_v, 10, 64); err == nil {
+			return checkedCast[T](u)
+		}
+		if f, err := strconv.ParseFloat(_v, 64); err == nil {
+			return checkedCast[T](f)
+		}
+	}
+	return 0, false
+}
+
+func castSlice[S any, T any](values []S, cast func(S) (T, bool), typeName string) ([]T, error) {
+	res := make([]T, len(values))
+	for i, v := range values {
+		// the null rows are nil
+		if any(v) == nil {
+			continue
+		}
+		var ok bool
+		if res[i], ok = cast(v); !ok {
+			return nil, fmt.Errorf("invalid %s value %v", typeName, v)
+		}
+	}
+	return res, nil
+}
+
+// anyValues returns the elements of the slice of any type
+func anyValues(data any) ([]any, bool) {
+	if values, ok := data.([]any); ok {
+		return values, true
+	}
+	rv := reflect.ValueOf(data)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	res := make([]any, rv.Len())
+	for i := range res {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res, true
+}
+
+// castNumbers returns the cast function of the numeric columns
+func castNumbers[T number](typeName string) func(data any) ([]T, error) {
+	return func(data any) ([]T, error) {
+		switch _data := data.(type) {
+		case []T:
+			return _data, nil
+		case []int64:
+			return castSlice(_data, checkedCast[T, int64], typeName)
+		case []uint64:
+			return castSlice(_data, checkedCast[T, uint64], typeName)
+		case []float64:
+			return castSlice(_data, checkedCast[T, float64], typeName)
+		}
+		values, ok := anyValues(data)
+		if !ok {
+			return nil, fmt.Errorf("invalid data type")
+		}
+		return castSlice(values, castNumber[T], typeName)
+	}
+}
+
+// numberToStat widens the number to the int64, uint64 or float64 of the index statistics
+func numberToStat[T number](v T) any {
+	switch {
+	case isFloat[T]():
+		return float64(v)
+	case isSigned[T]():
+		return int64(v)
+	}
+	return uint64(v)
+}
+
+func newNumberColumn[T number](typeName string, arrowType arrow.DataType,
+	getBuilder func(builder array.Builder) IArrowAppender[T]) *Column[T] {
+	return &Column[T]{
+		typeName:   typeName,
+		arrowType:  arrowType,
+		getBuilder: getBuilder,
+		parseStr: func(s string) (T, error) {
+			res, ok := castNumber[T](s)
+			if !ok {
+				return 0, fmt.Errorf("invalid %s value %q", typeName, s)
+			}
+			return res, nil
+		},
+		parseJson: func(d *jx.Decoder) (T, error) {
+			n, err := d.Num()
+			if err != nil {
+				return 0, err
+			}
+			res, ok := castNumber[T](n.String())
+			if !ok {
+				return 0, fmt.Errorf("invalid %s value %s", typeName, n)
+			}
+			return res, nil
+		},
+		cast:   castNumbers[T](typeName),
+		toStat: numberToStat[T],
+	}
+}
+
+func numberBuilder[T number](typeName string, arrowType arrow.DataType,
+	getBuilder func(builder array.Builder) IArrowAppender[T]) ColumnBuilder {
+	return func(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+		return colBuilder[T](func() *Column[T] {
+			return newNumberColumn[T](typeName, arrowType, getBuilder)
+		}, name, data, sizeAndCap...)
+	}
+}
+
+var int8Builder = numberBuilder[int8](DATA_TYPE_NAME_INT8, arrow.PrimitiveTypes.Int8,
+	func(builder array.Builder) IArrowAppender[int8] { return builder.(*array.Int8Builder) })
+
+var int16Builder = numberBuilder[int16](DATA_TYPE_NAME_INT16, arrow.PrimitiveTypes.Int16,
+	func(builder array.Builder) IArrowAppender[int16] { return builder.(*array.Int16Builder) })
+
+var int32Builder = numberBuilder[int32](DATA_TYPE_NAME_INT32, arrow.PrimitiveTypes.Int32,
+	func(builder array.Builder) IArrowAppender[int32] { return builder.(*array.Int32Builder) })
+
+var uint8Builder = numberBuilder[uint8](DATA_TYPE_NAME_UINT8, arrow.PrimitiveTypes.Uint8,
+	func(builder array.Builder) IArrowAppender[uint8] { return builder.(*array.Uint8Builder) })
+
+var uint16Builder = numberBuilder[uint16](DATA_TYPE_NAME_UINT16, arrow.PrimitiveTypes.Uint16,
+	func(builder array.Builder) IArrowAppender[uint16] { return builder.(*array.Uint16Builder) })
+
+var uint32Builder = numberBuilder[uint32](DATA_TYPE_NAME_UINT32, arrow.PrimitiveTypes.Uint32,
+	func(builder array.Builder) IArrowAppender[uint32] { return builder.(*array.Uint32Builder) })
+
+var float32Builder = numberBuilder[float32](DATA_TYPE_NAME_FLOAT32, arrow.PrimitiveTypes.Float32,
+	func(builder array.Builder) IArrowAppender[float32] { return builder.(*array.Float32Builder) })
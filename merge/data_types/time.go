@@ -0,0 +1,233 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/go-faster/jx"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// The values of the timestamp, date and time columns are held as int64 nanoseconds
+// (since the epoch, since midnight for TIME) and converted to the units of the type when written.
+// Parquet only records if a timestamp is adjusted to UTC, so a time zone is always stored as UTC.
+// Parquet has no second timestamps, TIMESTAMP_S is written in milliseconds.
+
+// naiveTimeZone is the time zone of the arrow timestamps without a time zone.
+// The parquet writer marks the timestamps with an empty or UTC zone as adjusted to UTC,
+// which DuckDB reads as microsecond TIMESTAMPTZ, dropping the nanoseconds of __timestamp.
+const naiveTimeZone = "+00:00"
+
+const DATA_TYPE_NAME_TIMESTAMP_S = "TIMESTAMP_S"
+const DATA_TYPE_NAME_TIMESTAMP_MS = "TIMESTAMP_MS"
+const DATA_TYPE_NAME_TIMESTAMP_US = "TIMESTAMP"
+const DATA_TYPE_NAME_TIMESTAMP_NS = "TIMESTAMP_NS"
+const DATA_TYPE_NAME_TIMESTAMPTZ_S = "TIMESTAMPTZ_S"
+const DATA_TYPE_NAME_TIMESTAMPTZ_MS = "TIMESTAMPTZ_MS"
+const DATA_TYPE_NAME_TIMESTAMPTZ_US = "TIMESTAMPTZ"
+const DATA_TYPE_NAME_TIMESTAMPTZ_NS = "TIMESTAMPTZ_NS"
+const DATA_TYPE_NAME_DATE = "DATE"
+const DATA_TYPE_NAME_TIME = "TIME"
+
+var timestampUnitSuffixes = map[arrow.TimeUnit]string{
+	arrow.Second:      "_S",
+	arrow.Millisecond: "_MS",
+	arrow.Microsecond: "",
+	arrow.Nanosecond:  "_NS",
+}
+
+// TimestampTypeName returns the name of the timestamp column type of the unit
+func TimestampTypeName(unit arrow.TimeUnit, withTZ bool) string {
+	if withTZ {
+		return "TIMESTAMPTZ" + timestampUnitSuffixes[unit]
+	}
+	return "TIMESTAMP" + timestampUnitSuffixes[unit]
+}
+
+// IsTimestampType reports if the column type holds timestamps
+func IsTimestampType(typeName string) bool {
+	return strings.HasPrefix(typeName, "TIMESTAMP")
+}
+
+// WithoutNaiveTimeZone returns the timestamp type without the time zone of the naive timestamps,
+// the other types are returned as is. Use it to hand the columns over to DuckDB directly.
+func WithoutNaiveTimeZone(dt arrow.DataType) arrow.DataType {
+	if ts, ok := dt.(*arrow.TimestampType); ok && ts.TimeZone == naiveTimeZone {
+		return &arrow.TimestampType{Unit: ts.Unit}
+	}
+	return dt
+}
+
+// SQLTypeName returns the DuckDB type of the column type.
+// DuckDB only has microsecond timestamps with a time zone, the dictionary strings are VARCHAR.
+func SQLTypeName(typeName string) string {
+	if strings.HasPrefix(typeName, DATA_TYPE_NAME_TIMESTAMPTZ_US) {
+		return DATA_TYPE_NAME_TIMESTAMPTZ_US
+	}
+	if typeName == DATA_TYPE_NAME_LOW_CARDINALITY {
+		return DATA_TYPE_NAME_STRING
+	}
+	return typeName
+}
+
+// scaledAppender appends the nanoseconds truncated to stepNs in the units of the arrow builder
+type scaledAppender[R ~int32 | ~int64] struct {
+	appendValues func([]R, []bool)
+	unitNs       int64
+	stepNs       int64
+}
+
+func (a scaledAppender[R]) AppendValues(values []int64, valid []bool) {
+	if a.stepNs == 1 && unsafe.Sizeof(R(0)) == 8 {
+		a.appendValues(unsafe.Slice((*R)(unsafe.Pointer(unsafe.SliceData(values))), len(values)), valid)
+		return
+	}
+	mul := a.stepNs / a.unitNs
+	res := make([]R, len(values))
+	for i, v := range values {
+		res[i] = R(floorDiv(v, a.stepNs) * mul)
+	}
+	a.appendValues(res, valid)
+}
+
+func floorDiv(a, b int64) int64 {
+	res := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		res--
+	}
+	return res
+}
+
+// parseTimestamp parses the nanoseconds since the epoch or a string in one of the layouts
+func parseTimestamp(s string, layouts ...string) (int64, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, nil
+	}
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t.UnixNano(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// parseTimeOfDay parses the nanoseconds since midnight or a hh:mm:ss[.fraction] string
+func parseTimeOfDay(s string) (int64, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, nil
+	}
+	t, err := time.Parse("15:04:05.999999999", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return int64(t.Hour())*int64(time.Hour) + int64(t.Minute())*int64(time.Minute) +
+		int64(t.Second())*int64(time.Second) + int64(t.Nanosecond()), nil
+}
+
+func parseTimeJson(d *jx.Decoder, parse func(string) (int64, error)) (int64, error) {
+	if d.Next() == jx.String {
+		s, err := d.Str()
+		if err != nil {
+			return 0, err
+		}
+		return parse(s)
+	}
+	return d.Int64()
+}
+
+func newTimeColumn(typeName string, arrowType arrow.DataType,
+	getBuilder func(builder array.Builder) IArrowAppender[int64],
+	parse func(string) (int64, error), toValue func(int64) any) *Column[int64] {
+	return &Column[int64]{
+		typeName:   typeName,
+		arrowType:  arrowType,
+		getBuilder: getBuilder,
+		parseStr:   parse,
+		parseJson: func(d *jx.Decoder) (int64, error) {
+			return parseTimeJson(d, parse)
+		},
+		toValue: toValue,
+	}
+}
+
+// timeColumnBuilder truncates the nanoseconds to the precision of the type, so the statistics
+// of the buffered data match the ones of the saved files
+func timeColumnBuilder(create func() *Column[int64], stepNs int64) ColumnBuilder {
+	return func(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+		if values, ok := data.([]int64); ok && stepNs > 1 {
+			res := make([]int64, len(values))
+			for i, v := range values {
+				res[i] = floorDiv(v, stepNs) * stepNs
+			}
+			data = res
+		}
+		return colBuilder[int64](create, name, data, sizeAndCap...)
+	}
+}
+
+func truncateParse(parse func(string) (int64, error), stepNs int64) func(string) (int64, error) {
+	return func(s string) (int64, error) {
+		v, err := parse(s)
+		return floorDiv(v, stepNs) * stepNs, err
+	}
+}
+
+func timestampColumnBuilder(unit arrow.TimeUnit, withTZ bool) ColumnBuilder {
+	stepNs := TimeUnitNs(unit)
+	arrowType := &arrow.TimestampType{Unit: unit, TimeZone: naiveTimeZone}
+	if unit == arrow.Second {
+		arrowType.Unit = arrow.Millisecond
+	}
+	if withTZ {
+		arrowType.TimeZone = "UTC"
+	}
+	unitNs := TimeUnitNs(arrowType.Unit)
+	parse := truncateParse(func(s string) (int64, error) {
+		return parseTimestamp(s, time.RFC3339Nano, "2006-01-02 15:04:05.999999999", time.DateOnly)
+	}, stepNs)
+	return timeColumnBuilder(func() *Column[int64] {
+		return newTimeColumn(TimestampTypeName(unit, withTZ), arrowType,
+			func(builder array.Builder) IArrowAppender[int64] {
+				return scaledAppender[arrow.Timestamp]{builder.(*array.TimestampBuilder).AppendValues, unitNs, stepNs}
+			},
+			parse,
+			func(v int64) any {
+				return time.Unix(0, v).UTC()
+			})
+	}, stepNs)
+}
+
+const dayNs = int64(24 * time.Hour)
+
+func newDateColumn() *Column[int64] {
+	return newTimeColumn(DATA_TYPE_NAME_DATE, arrow.FixedWidthTypes.Date32,
+		func(builder array.Builder) IArrowAppender[int64] {
+			return scaledAppender[arrow.Date32]{builder.(*array.Date32Builder).AppendValues, dayNs, dayNs}
+		},
+		truncateParse(func(s string) (int64, error) {
+			return parseTimestamp(s, time.DateOnly, time.RFC3339Nano)
+		}, dayNs),
+		func(v int64) any {
+			return time.Unix(0, v).UTC()
+		})
+}
+
+var dateBuilder = timeColumnBuilder(newDateColumn, dayNs)
+
+func newTimeOfDayColumn() *Column[int64] {
+	const usNs = int64(time.Microsecond)
+	return newTimeColumn(DATA_TYPE_NAME_TIME, arrow.FixedWidthTypes.Time64us,
+		func(builder array.Builder) IArrowAppender[int64] {
+			return scaledAppender[arrow.Time64]{builder.(*array.Time64Builder).AppendValues, usNs, usNs}
+		},
+		truncateParse(parseTimeOfDay, usNs),
+		func(v int64) any {
+			return time.Unix(0, v).UTC()
+		})
+}
+
+var timeBuilder = timeColumnBuilder(newTimeOfDayColumn, int64(time.Microsecond))
@@ -10,7 +10,7 @@ import (
 func newUint64Column() *Column[uint64] {
 	return &Column[uint64]{
 		typeName:  DATA_TYPE_NAME_UINT64,
-		arrowType: arrow.PrimitiveTypes.Int64,
+		arrowType: arrow.PrimitiveTypes.Uint64,
 		getBuilder: func(builder array.Builder) IArrowAppender[uint64] {
 			return builder.(*array.Uint64Builder)
 		},
@@ -0,0 +1,184 @@
+package data_types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/go-faster/jx"
+	"github.com/google/uuid"
+	"reflect"
+)
+
+const DATA_TYPE_NAME_UUID = "UUID"
+const DATA_TYPE_NAME_BLOB = "BLOB"
+
+// UUIDType is the arrow type of the UUID columns. It's stored as 16 bytes,
+// the parquet writer of the service marks it with the UUID logical type.
+type UUIDType struct {
+	arrow.ExtensionBase
+}
+
+// UUIDArray is the arrow array of the UUID values
+type UUIDArray struct {
+	array.ExtensionArrayBase
+}
+
+var uuidType = &UUIDType{ExtensionBase: arrow.ExtensionBase{Storage: &arrow.FixedSizeBinaryType{ByteWidth: 16}}}
+
+func init() {
+	arrow.RegisterExtensionType(uuidType)
+}
+
+func (*UUIDType) ArrayType() reflect.Type { return reflect.TypeOf(UUIDArray{}) }
+func (*UUIDType) ExtensionName() string   { return "gigapi.uuid" }
+func (*UUIDType) Serialize() string       { return "" }
+func (t *UUIDType) String() string        { return "extension<gigapi.uuid>" }
+
+func (t *UUIDType) ExtensionEquals(other arrow.ExtensionType) bool {
+	return other.ExtensionName() == t.ExtensionName()
+}
+
+func (*UUIDType) Deserialize(storage arrow.DataType, _ string) (arrow.ExtensionType, error) {
+	if fsb, ok := storage.(*arrow.FixedSizeBinaryType); !ok || fsb.ByteWidth != 16 {
+		return nil, fmt.Errorf("invalid storage type for gigapi.uuid: %s", storage)
+	}
+	return uuidType, nil
+}
+
+// IsUUIDType reports if the arrow data type is the one of the UUID columns
+func IsUUIDType(dt arrow.DataType) bool {
+	ext, ok := dt.(arrow.ExtensionType)
+	return ok && ext.ExtensionName() == uuidType.ExtensionName()
+}
+
+// castUUID returns the canonical text of the UUID string, bytes or uuid.UUID
+func castUUID(v any) (string, bool) {
+	switch _v := v.(type) {
+	case string:
+		u, err := uuid.Parse(_v)
+		return u.String(), err == nil
+	case []byte:
+		u, err := uuid.FromBytes(_v)
+		return u.String(), err == nil
+	case [16]byte:
+		return uuid.UUID(_v).String(), true
+	case uuid.UUID:
+		return _v.String(), true
+	}
+	return "", false
+}
+
+// uuidAppender appends the UUID texts to the 16 bytes builder
+type uuidAppender struct {
+	builder *array.FixedSizeBinaryBuilder
+}
+
+func (a uuidAppender) AppendValues(values []string, valid []bool) {
+	res := make([][]byte, len(values))
+	for i, v := range values {
+		if valid == nil || valid[i] {
+			u := uuid.MustParse(v)
+			res[i] = u[:]
+		}
+	}
+	a.builder.AppendValues(res, valid)
+}
+
+// newUUIDColumn returns the column of the UUIDs kept as the canonical text,
+// the order of which is the order of the bytes
+func newUUIDColumn() *Column[string] {
+	return &Column[string]{
+		typeName:  DATA_TYPE_NAME_UUID,
+		arrowType: uuidType,
+		getBuilder: func(builder array.Builder) IArrowAppender[string] {
+			return uuidAppender{builder.(*array.ExtensionBuilder).Builder.(*array.FixedSizeBinaryBuilder)}
+		},
+		parseStr: func(s string) (string, error) {
+			res, ok := castUUID(s)
+			if !ok {
+				return "", fmt.Errorf("invalid UUID value %q", s)
+			}
+			return res, nil
+		},
+		parseJson: func(d *jx.Decoder) (string, error) {
+			s, err := d.Str()
+			if err != nil {
+				return "", err
+			}
+			res, ok := castUUID(s)
+			if !ok {
+				return "", fmt.Errorf("invalid UUID value %q", s)
+			}
+			return res, nil
+		},
+		toValue: func(v string) any {
+			return uuid.MustParse(v)
+		},
+		cast: func(data any) ([]string, error) {
+			values, ok := anyValues(data)
+			if !ok {
+				return nil, fmt.Errorf("invalid data type")
+			}
+			return castSlice(values, castUUID, DATA_TYPE_NAME_UUID)
+		},
+	}
+}
+
+func uuidBuilder(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+	return colBuilder[string](newUUIDColumn, name, data, sizeAndCap...)
+}
+
+// blobAppender appends the bytes held as strings to the binary builder
+type blobAppender struct {
+	builder *array.BinaryBuilder
+}
+
+func (a blobAppender) AppendValues(values []string, valid []bool) {
+	a.builder.AppendStringValues(values, valid)
+}
+
+func castBlob(v any) (string, bool) {
+	switch _v := v.(type) {
+	case string:
+		return _v, true
+	case []byte:
+		return string(_v), true
+	}
+	return "", false
+}
+
+// newBlobColumn returns the column of the bytes kept as strings. The bytes aren't valid
+// JSON strings, so the BLOB columns have no index statistics.
+func newBlobColumn() *Column[string] {
+	return &Column[string]{
+		typeName:  DATA_TYPE_NAME_BLOB,
+		arrowType: arrow.BinaryTypes.Binary,
+		getBuilder: func(builder array.Builder) IArrowAppender[string] {
+			return blobAppender{builder.(*array.BinaryBuilder)}
+		},
+		parseStr: func(s string) (string, error) {
+			return s, nil
+		},
+		parseJson: func(d *jx.Decoder) (string, error) {
+			b, err := d.Base64()
+			return string(b), err
+		},
+		cast: func(data any) ([]string, error) {
+			if values, ok := data.([]string); ok {
+				return values, nil
+			}
+			values, ok := anyValues(data)
+			if !ok {
+				return nil, fmt.Errorf("invalid data type")
+			}
+			return castSlice(values, castBlob, DATA_TYPE_NAME_BLOB)
+		},
+		toStat: func(string) any {
+			return nil
+		},
+	}
+}
+
+func blobBuilder(name string, data any, sizeAndCap ...int64) (IColumn, error) {
+	return colBuilder[string](newBlobColumn, name, data, sizeAndCap...)
+}
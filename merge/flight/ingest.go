@@ -0,0 +1,181 @@
+package flight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	aflight "github.com/apache/arrow/go/v14/arrow/flight"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/parsers"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/gigapi/gigapi/v2/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+)
+
+// peekedPutStream replays the first message of the DoPut stream
+type peekedPutStream struct {
+	aflight.FlightService_DoPutServer
+	first *aflight.FlightData
+}
+
+func (s *peekedPutStream) Recv() (*aflight.FlightData, error) {
+	if s.first != nil {
+		res := s.first
+		s.first = nil
+		return res, nil
+	}
+	return s.FlightService_DoPutServer.Recv()
+}
+
+// DoPut ingests the streams of the path descriptors, the other ones are the Flight SQL commands
+func (s *flightService) DoPut(stream aflight.FlightService_DoPutServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	peeked := &peekedPutStream{FlightService_DoPutServer: stream, first: first}
+	desc := first.GetFlightDescriptor()
+	if desc.GetType() != aflight.DescriptorPATH {
+		return s.FlightServer.DoPut(peeked)
+	}
+	if !config.Get().Gigapi.AcceptsWrites() {
+		return status.Error(codes.PermissionDenied, "the node doesn't accept writes")
+	}
+	return ingest(peeked, desc.GetPath())
+}
+
+// ingest stores the record batches of the stream in the table of the path: `[db, table]`,
+// or `[table]` of the database of the `database` header. The rows are timestamped with the
+// column of the `time_column` header, or the `__timestamp` or `time` column. The stream
+// is acknowledged according to the `ack` header as the writes of the HTTP endpoints.
+func ingest(stream aflight.FlightService_DoPutServer, path []string) error {
+	ctx := stream.Context()
+	var table string
+	switch len(path) {
+	case 1:
+		table = getDatabase(ctx) + "." + path[0]
+	case 2:
+		table = path[0] + "." + path[1]
+	default:
+		return status.Errorf(codes.InvalidArgument, "invalid path %q, expected [db, table] or [table]", path)
+	}
+	ack := getHeader(ctx, "ack")
+	if ack == "" {
+		ack = config.Get().Gigapi.AckMode
+	}
+	switch ack {
+	case "none", "buffered", "durable":
+	case "wal":
+		return status.Errorf(codes.InvalidArgument,
+			"ack mode %q is not supported, there is no write-ahead log yet", ack)
+	default:
+		return status.Errorf(codes.InvalidArgument,
+			"invalid ack mode %q, expected one of: none, buffered, durable", ack)
+	}
+
+	rdr, err := aflight.NewRecordReader(stream)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid Arrow stream: %v", err)
+	}
+	ctx = context.WithValue(ctx, "table", table)
+	if timeColumn := getHeader(ctx, "time_column"); timeColumn != "" {
+		ctx = context.WithValue(ctx, "time_column", timeColumn)
+	}
+	if ack == "none" {
+		read, err := readRecords(rdr)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid Arrow stream: %v", err)
+		}
+		go storeUnacknowledged(context.WithoutCancel(ctx), table, read)
+		return nil
+	}
+	promises, err := storeRecords(ctx, rdr)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	for _, p := range promises {
+		if ack == "buffered" {
+			_, _, err = p.Peek()
+		} else {
+			_, err = p.Get()
+		}
+		if err != nil {
+			return storeError(err)
+		}
+	}
+	return nil
+}
+
+// storeRecords parses the records of the reader and puts them into the table's buffers.
+// The reader is released.
+func storeRecords(ctx context.Context, rdr array.RecordReader) ([]utils.Promise[int32], error) {
+	res, err := (&parsers.ArrowStreamParser{}).ParseRecords(ctx, rdr)
+	if err != nil {
+		return nil, err
+	}
+	var promises []utils.Promise[int32]
+	for _res := range res {
+		if _res.Error != nil {
+			go func() {
+				for range res {
+				}
+			}()
+			return nil, _res.Error
+		}
+		promises = append(promises, repository.Store(_res.Database, _res.Table, _res.Data))
+	}
+	return promises, nil
+}
+
+// readRecords reads the whole stream, so it can be stored after the response.
+// The reader is released.
+func readRecords(rdr *aflight.Reader) (array.RecordReader, error) {
+	defer rdr.Release()
+	var recs []arrow.Record
+	defer func() {
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}()
+	for rdr.Next() {
+		rec := rdr.Record()
+		rec.Retain()
+		recs = append(recs, rec)
+	}
+	if err := rdr.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return array.NewRecordReader(rdr.Schema(), recs)
+}
+
+// storeUnacknowledged stores the records of a stream already responded to, the errors are logged
+func storeUnacknowledged(ctx context.Context, table string, rdr array.RecordReader) {
+	promises, err := storeRecords(ctx, rdr)
+	for _, p := range promises {
+		if err != nil {
+			break
+		}
+		_, err = p.Get()
+	}
+	if err != nil {
+		fmt.Printf("unacknowledged write to table %q failed: %v\n", table, err)
+	}
+}
+
+// storeError returns the status of the error of a write, ResourceExhausted or Unavailable
+// if the ingestion buffer is full
+func storeError(err error) error {
+	var bufErr *service.BufferFullError
+	if !errors.As(err, &bufErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if bufErr.Global {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.ResourceExhausted, err.Error())
+}
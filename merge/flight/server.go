@@ -0,0 +1,386 @@
+package flight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	aflight "github.com/apache/arrow/go/v14/arrow/flight"
+	"github.com/apache/arrow/go/v14/arrow/flight/flightsql"
+	"github.com/apache/arrow/go/v14/arrow/flight/flightsql/schema_ref"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/query"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Start serves Arrow Flight SQL on the address in the background.
+// The queries and the writes run as the ones of the HTTP endpoints:
+//   - the Flight SQL statements are run by query.QueryRecords over the database of the
+//     `database` header (`default` if missing). The `from`, `to` and `where` headers
+//     prune the files as the parameters of /gigapi/files do.
+//   - DoPut with a path descriptor `[db, table]` or `[table]` stores the record batches
+//     in the table (see ingest).
+func Start(addr string) (aflight.Server, error) {
+	srv := NewServer()
+	if err := srv.Init(addr); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := srv.Serve(); err != nil {
+			fmt.Println("Flight server stopped:", err)
+		}
+	}()
+	return srv, nil
+}
+
+// NewServer returns the Flight server, not listening yet
+func NewServer() aflight.Server {
+	sqlSrv := &sqlServer{}
+	sqlSrv.Alloc = memory.DefaultAllocator
+	for id, v := range map[flightsql.SqlInfo]any{
+		flightsql.SqlInfoFlightSqlServerName:         "GigAPI",
+		flightsql.SqlInfoFlightSqlServerVersion:      "2",
+		flightsql.SqlInfoFlightSqlServerArrowVersion: "14.0.2",
+		flightsql.SqlInfoFlightSqlServerReadOnly:     true,
+		flightsql.SqlInfoFlightSqlServerSql:          true,
+		flightsql.SqlInfoFlightSqlServerSubstrait:    false,
+		flightsql.SqlInfoFlightSqlServerTransaction:  int32(flightsql.SqlTransactionNone),
+		flightsql.SqlInfoFlightSqlServerCancel:       false,
+	} {
+		if err := sqlSrv.RegisterSqlInfo(id, v); err != nil {
+			panic(err)
+		}
+	}
+	srv := aflight.NewServerWithMiddleware(nil)
+	srv.RegisterFlightService(&flightService{FlightServer: flightsql.NewFlightServer(sqlSrv)})
+	return srv
+}
+
+// flightService is the Flight SQL service which DoPut ingests the streams of the path descriptors
+type flightService struct {
+	aflight.FlightServer
+}
+
+// sqlServer runs the Flight SQL statements and lists the databases and the tables
+type sqlServer struct {
+	flightsql.BaseServer
+}
+
+// statementHandle is the handle of the tickets of the statements
+type statementHandle struct {
+	Database string   `json:"database"`
+	Query    string   `json:"query"`
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Where    []string `json:"where,omitempty"`
+}
+
+// getHeader returns the first value of the request metadata key
+func getHeader(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+var databaseNameCheck = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+func getDatabase(ctx context.Context) string {
+	if db := getHeader(ctx, "database"); db != "" {
+		return db
+	}
+	return "default"
+}
+
+func (s *sqlServer) GetFlightInfoStatement(ctx context.Context, cmd flightsql.StatementQuery,
+	desc *aflight.FlightDescriptor) (*aflight.FlightInfo, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	handle := statementHandle{
+		Database: getDatabase(ctx),
+		Query:    cmd.GetQuery(),
+		From:     getHeader(ctx, "from"),
+		To:       getHeader(ctx, "to"),
+		Where:    md.Get("where"),
+	}
+	if !databaseNameCheck.MatchString(handle.Database) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid database name: %q", handle.Database)
+	}
+	if _, err := shared.ParseIndexQuery(handle.From, handle.To, handle.Where); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	rawHandle, err := json.Marshal(handle)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := flightsql.CreateStatementQueryTicket(rawHandle)
+	if err != nil {
+		return nil, err
+	}
+	// the schema is unknown until the statement runs, it's sent with the stream
+	return &aflight.FlightInfo{
+		FlightDescriptor: desc,
+		Endpoint:         []*aflight.FlightEndpoint{{Ticket: &aflight.Ticket{Ticket: ticket}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}, nil
+}
+
+func (s *sqlServer) DoGetStatement(ctx context.Context,
+	ticket flightsql.StatementQueryTicket) (*arrow.Schema, <-chan aflight.StreamChunk, error) {
+	var handle statementHandle
+	if err := json.Unmarshal(ticket.GetStatementHandle(), &handle); err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, "invalid statement handle")
+	}
+	q, err := shared.ParseIndexQuery(handle.From, handle.To, handle.Where)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	rdr, err := query.QueryRecords(ctx, handle.Database, handle.Query, q)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return rdr.Schema(), streamRecords(ctx, rdr), nil
+}
+
+// streamRecords sends the records of the reader until it's done or the request is canceled.
+// The reader is released.
+func streamRecords(ctx context.Context, rdr array.RecordReader) <-chan aflight.StreamChunk {
+	res := make(chan aflight.StreamChunk)
+	go func() {
+		defer close(res)
+		defer rdr.Release()
+		for rdr.Next() {
+			rec := rdr.Record()
+			rec.Retain()
+			select {
+			case res <- aflight.StreamChunk{Data: rec}:
+			case <-ctx.Done():
+				rec.Release()
+				return
+			}
+		}
+		if err := rdr.Err(); err != nil {
+			select {
+			case res <- aflight.StreamChunk{Err: status.Error(codes.Internal, err.Error())}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return res
+}
+
+// commandInfo returns the flight info of the metadata command served by DoGet
+func commandInfo(desc *aflight.FlightDescriptor, schema *arrow.Schema) *aflight.FlightInfo {
+	return &aflight.FlightInfo{
+		FlightDescriptor: desc,
+		Endpoint:         []*aflight.FlightEndpoint{{Ticket: &aflight.Ticket{Ticket: desc.Cmd}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+		Schema:           aflight.SerializeSchema(schema, memory.DefaultAllocator),
+	}
+}
+
+// streamRecord sends the record built by fill
+func streamRecord(schema *arrow.Schema, fill func(b *array.RecordBuilder)) <-chan aflight.StreamChunk {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	fill(b)
+	res := make(chan aflight.StreamChunk, 1)
+	res <- aflight.StreamChunk{Data: b.NewRecord()}
+	close(res)
+	return res
+}
+
+// likePattern returns the regexp of the SQL LIKE pattern of the metadata commands, nil matches all
+func likePattern(pattern *string) (*regexp.Regexp, error) {
+	if pattern == nil {
+		return nil, nil
+	}
+	var re strings.Builder
+	re.WriteString("^")
+	escaped := false
+	for _, c := range *pattern {
+		switch {
+		case escaped:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '%':
+			re.WriteString(".*")
+		case c == '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	res, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return res, nil
+}
+
+// listDatabases returns the databases matching the pattern. There are no catalogs,
+// so a catalog filter other than the empty one matches nothing.
+func listDatabases(catalog *string, pattern *string) ([]string, error) {
+	if catalog != nil && *catalog != "" {
+		return nil, nil
+	}
+	re, err := likePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	databases, err := repository.ListDatabases()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, db := range databases {
+		if re == nil || re.MatchString(db) {
+			res = append(res, db)
+		}
+	}
+	return res, nil
+}
+
+func (s *sqlServer) GetFlightInfoCatalogs(_ context.Context,
+	desc *aflight.FlightDescriptor) (*aflight.FlightInfo, error) {
+	return commandInfo(desc, schema_ref.Catalogs), nil
+}
+
+func (s *sqlServer) DoGetCatalogs(context.Context) (*arrow.Schema, <-chan aflight.StreamChunk, error) {
+	return schema_ref.Catalogs, streamRecord(schema_ref.Catalogs, func(*array.RecordBuilder) {}), nil
+}
+
+func (s *sqlServer) GetFlightInfoSchemas(_ context.Context, _ flightsql.GetDBSchemas,
+	desc *aflight.FlightDescriptor) (*aflight.FlightInfo, error) {
+	return commandInfo(desc, schema_ref.DBSchemas), nil
+}
+
+func (s *sqlServer) DoGetDBSchemas(_ context.Context,
+	cmd flightsql.GetDBSchemas) (*arrow.Schema, <-chan aflight.StreamChunk, error) {
+	databases, err := listDatabases(cmd.GetCatalog(), cmd.GetDBSchemaFilterPattern())
+	if err != nil {
+		return nil, nil, err
+	}
+	return schema_ref.DBSchemas, streamRecord(schema_ref.DBSchemas, func(b *array.RecordBuilder) {
+		for _, db := range databases {
+			b.Field(0).AppendNull()
+			b.Field(1).(*array.StringBuilder).Append(db)
+		}
+	}), nil
+}
+
+func (s *sqlServer) GetFlightInfoTables(_ context.Context, cmd flightsql.GetTables,
+	desc *aflight.FlightDescriptor) (*aflight.FlightInfo, error) {
+	if cmd.GetIncludeSchema() {
+		return commandInfo(desc, schema_ref.TablesWithIncludedSchema), nil
+	}
+	return commandInfo(desc, schema_ref.Tables), nil
+}
+
+func (s *sqlServer) DoGetTables(_ context.Context,
+	cmd flightsql.GetTables) (*arrow.Schema, <-chan aflight.StreamChunk, error) {
+	schema := schema_ref.Tables
+	if cmd.GetIncludeSchema() {
+		schema = schema_ref.TablesWithIncludedSchema
+	}
+	if len(cmd.GetTableTypes()) > 0 && !containsFold(cmd.GetTableTypes(), "TABLE") {
+		return schema, streamRecord(schema, func(*array.RecordBuilder) {}), nil
+	}
+	databases, err := listDatabases(cmd.GetCatalog(), cmd.GetDBSchemaFilterPattern())
+	if err != nil {
+		return nil, nil, err
+	}
+	re, err := likePattern(cmd.GetTableNameFilterPattern())
+	if err != nil {
+		return nil, nil, err
+	}
+	var tables []*shared.TableManifest
+	for _, db := range databases {
+		manifests, err := repository.ListTableManifests(db)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, m := range manifests {
+			if re == nil || re.MatchString(m.Table) {
+				tables = append(tables, m)
+			}
+		}
+	}
+	var schemas [][]byte
+	if cmd.GetIncludeSchema() {
+		for _, m := range tables {
+			tableSchema, err := manifestSchema(m)
+			if err != nil {
+				return nil, nil, err
+			}
+			schemas = append(schemas, aflight.SerializeSchema(tableSchema, memory.DefaultAllocator))
+		}
+	}
+	return schema, streamRecord(schema, func(b *array.RecordBuilder) {
+		for i, m := range tables {
+			b.Field(0).AppendNull()
+			b.Field(1).(*array.StringBuilder).Append(m.Database)
+			b.Field(2).(*array.StringBuilder).Append(m.Table)
+			b.Field(3).(*array.StringBuilder).Append("TABLE")
+			if schemas != nil {
+				b.Field(4).(*array.BinaryBuilder).Append(schemas[i])
+			}
+		}
+	}), nil
+}
+
+// manifestSchema returns the arrow schema of the columns of the table, sorted by name
+func manifestSchema(m *shared.TableManifest) (*arrow.Schema, error) {
+	names := make([]string, 0, len(m.Schema))
+	for name := range m.Schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]arrow.Field, len(names))
+	for i, name := range names {
+		builder, err := data_types.GetColumnBuilder(m.Schema[name])
+		if err != nil {
+			return nil, fmt.Errorf("table %s: column %s: %w", m.Table, name, err)
+		}
+		col, err := builder(name, nil, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = arrow.Field{Name: name, Type: col.ArrowDataType(), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+func containsFold(values []string, v string) bool {
+	for _, _v := range values {
+		if strings.EqualFold(_v, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sqlServer) GetFlightInfoTableTypes(_ context.Context,
+	desc *aflight.FlightDescriptor) (*aflight.FlightInfo, error) {
+	return commandInfo(desc, schema_ref.TableTypes), nil
+}
+
+func (s *sqlServer) DoGetTableTypes(context.Context) (*arrow.Schema, <-chan aflight.StreamChunk, error) {
+	return schema_ref.TableTypes, streamRecord(schema_ref.TableTypes, func(b *array.RecordBuilder) {
+		b.Field(0).(*array.StringBuilder).Append("TABLE")
+	}), nil
+}
@@ -0,0 +1,180 @@
+package flight
+
+import (
+	"context"
+	"errors"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	aflight "github.com/apache/arrow/go/v14/arrow/flight"
+	"github.com/apache/arrow/go/v14/arrow/flight/flightsql"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/gigapi/gigapi/v2/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"testing"
+	"time"
+)
+
+func putRecord(t *testing.T, client *flightsql.Client, path []string, host string, ts []int64) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+		{Name: "host", Type: arrow.BinaryTypes.String},
+		{Name: "usage", Type: arrow.PrimitiveTypes.Float64},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for i, v := range ts {
+		b.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(v))
+		b.Field(1).(*array.StringBuilder).Append(host)
+		b.Field(2).(*array.Float64Builder).Append(float64(i))
+	}
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	stream, err := client.Client.DoPut(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := aflight.NewRecordWriter(stream, ipc.WithSchema(schema))
+	w.SetFlightDescriptor(&aflight.FlightDescriptor{Type: aflight.DescriptorPATH, Path: path})
+	if err = w.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	stream.CloseSend()
+	for {
+		if _, err = stream.Recv(); errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readAll returns the records of the first endpoint of the flight info
+func readAll(t *testing.T, ctx context.Context, client *flightsql.Client, info *aflight.FlightInfo) arrow.Table {
+	rdr, err := client.DoGet(ctx, info.Endpoint[0].Ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Release()
+	var recs []arrow.Record
+	for rdr.Next() {
+		rdr.Record().Retain()
+		recs = append(recs, rdr.Record())
+	}
+	if rdr.Err() != nil && !errors.Is(rdr.Err(), io.EOF) {
+		t.Fatal(rdr.Err())
+	}
+	return array.NewTableFromRecords(rdr.Schema(), recs)
+}
+
+func TestFlightServer(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  0.1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	srv := NewServer()
+	if err := srv.Init("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Shutdown()
+	client, err := flightsql.NewClient(srv.Addr().String(), nil, nil,
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	now := time.Now().UnixNano()
+	putRecord(t, client, []string{"mydb", "cpu"}, "a", []int64{now, now + 1, now + 2})
+	// the database of the `database` header, `default` if missing
+	putRecord(t, client, []string{"cpu"}, "b", []int64{now + 3, now + 4})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "database", "mydb")
+	info, err := client.Execute(ctx, "SELECT host, count(*) AS c, sum(usage) AS s FROM cpu GROUP BY host ORDER BY host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := readAll(t, ctx, client, info)
+	if tbl.NumRows() != 1 {
+		t.Fatalf("unexpected rows: %d", tbl.NumRows())
+	}
+	tbl.Release()
+
+	info, err = client.Execute(metadata.AppendToOutgoingContext(context.Background(), "database", "default"),
+		"SELECT count(*) AS c FROM cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl = readAll(t, ctx, client, info)
+	if c := tbl.Column(0).Data().Chunk(0).(*array.Int64).Value(0); c != 2 {
+		t.Fatalf("unexpected count: %d", c)
+	}
+	tbl.Release()
+
+	_, err = client.Execute(metadata.AppendToOutgoingContext(context.Background(), "database", "../mydb"),
+		"SELECT count(*) AS c FROM cpu")
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unexpected result of an invalid database: %v", err)
+	}
+
+	// the files without the host are pruned
+	putRecord(t, client, []string{"mydb", "cpu"}, "c", []int64{now + 5})
+	for _, where := range []string{"host=a", "host=c"} {
+		info, err = client.Execute(metadata.AppendToOutgoingContext(ctx, "where", where),
+			"SELECT host, count(*) AS c, sum(usage) AS s FROM cpu GROUP BY host ORDER BY host")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl = readAll(t, ctx, client, info)
+		hosts := tbl.Column(0).Data().Chunk(0).(*array.String)
+		if tbl.NumRows() != 1 || hosts.Value(0) != where[5:] {
+			t.Fatalf("%s: unexpected result: %v", where, tbl.Column(0).Data().Chunk(0))
+		}
+		if where == "host=a" {
+			c := tbl.Column(1).Data().Chunk(0).(*array.Int64).Value(0)
+			s := tbl.Column(2).Data().Chunk(0).(*array.Float64).Value(0)
+			if c != 3 || s != 3 {
+				t.Fatalf("unexpected result: %d %v", c, s)
+			}
+		}
+		tbl.Release()
+	}
+
+	info, err = client.GetTables(ctx, &flightsql.GetTablesOpts{IncludeSchema: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl = readAll(t, ctx, client, info)
+	defer tbl.Release()
+	if tbl.NumRows() != 2 {
+		t.Fatalf("unexpected tables: %d", tbl.NumRows())
+	}
+	dbs := tbl.Column(1).Data().Chunk(0).(*array.String)
+	schemas := tbl.Column(4).Data().Chunk(0).(*array.Binary)
+	if dbs.Value(0) != "default" || dbs.Value(1) != "mydb" {
+		t.Fatalf("unexpected databases: %v", dbs)
+	}
+	schema, err := aflight.DeserializeSchema(schemas.Value(1), memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx := schema.FieldIndices("usage"); len(idx) != 1 || schema.Field(idx[0]).Type.ID() != arrow.FLOAT64 {
+		t.Fatalf("unexpected schema: %v", schema)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// backupLocation returns the S3 prefix or the local directory under the backup directory
+// of the `target` or `source` parameter
+func backupLocation(location string) (string, error) {
+	if strings.HasPrefix(location, "s3://") {
+		return location, nil
+	}
+	return confinedPath(config.Get().Gigapi.BackupDir, location, "gigapi.backup_dir")
+}
+
+// ExportHandler exports a snapshot of the tables of the database (`table` parameters,
+// all the tables by default) into the `target` S3 prefix or directory under the backup directory.
+// The snapshot is streamed as a tar archive if no target is provided.
+func ExportHandler(w http.ResponseWriter, r *http.Request) error {
+	vars := API.GetPathParams(r)
+	ttl := repository.DefaultExportTTL()
+	if _ttl := r.URL.Query().Get("ttl"); _ttl != "" {
+		var err error
+		ttl, err = time.ParseDuration(_ttl)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("invalid ttl: %v", err)))
+			return nil
+		}
+	}
+	tables := r.URL.Query()["table"]
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%d.tar", vars["db"], time.Now().Unix())))
+		archive := repository.NewTarArchiveWriter(w)
+		_, err := repository.Export(r.Context(), vars["db"], tables, archive, ttl)
+		if err == nil {
+			err = archive.Close()
+		}
+		if err != nil {
+			// the response is already started: the connection is aborted,
+			// so the client doesn't take the truncated archive for a complete one
+			fmt.Printf("failed to export %s: %v\n", vars["db"], err)
+			panic(http.ErrAbortHandler)
+		}
+		return nil
+	}
+
+	target, err := backupLocation(target)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	archive, err := repository.NewArchiveWriter(r.Context(), target)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	defer archive.Close()
+	stats, err := repository.Export(r.Context(), vars["db"], tables, archive, ttl)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, stats)
+}
+
+// RestoreHandler restores the tables exported to the `source` S3 prefix or directory under
+// the backup directory, or uploaded as a tar archive. The `db` parameter overrides the database of the tables.
+func RestoreHandler(w http.ResponseWriter, r *http.Request) error {
+	var archive repository.ArchiveReader = repository.NewTarArchiveReader(r.Body)
+	if source := r.URL.Query().Get("source"); source != "" {
+		source, err := backupLocation(source)
+		if err == nil {
+			archive, err = repository.NewArchiveReader(r.Context(), source)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return nil
+		}
+	}
+	defer archive.Close()
+	stats, err := repository.Restore(r.Context(), archive, r.URL.Query().Get("db"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, stats)
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"net/http"
+)
+
+func BufferStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	res, err := json.Marshal(service.GetBufferStats())
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+	return nil
+}
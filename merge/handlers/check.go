@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CheckHandler checks the consistency of the files and the indexes of the tables of the database
+// (`table` parameters, all the tables by default). The problems are fixed if `repair` is true.
+// The files not referenced by the indexes are only considered if they are older than `min_age`.
+func CheckHandler(w http.ResponseWriter, r *http.Request) error {
+	vars := API.GetPathParams(r)
+	opts := repository.CheckOptions{MinAge: repository.DefaultCheckMinAge()}
+	var err error
+	if repair := r.URL.Query().Get("repair"); repair != "" {
+		if opts.Repair, err = strconv.ParseBool(repair); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("invalid repair: %v", err)))
+			return nil
+		}
+	}
+	if minAge := r.URL.Query().Get("min_age"); minAge != "" {
+		if opts.MinAge, err = time.ParseDuration(minAge); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("invalid min_age: %v", err)))
+			return nil
+		}
+	}
+	reports, err := repository.CheckTables(r.Context(), vars["db"], r.URL.Query()["table"], opts)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, map[string]any{"tables": reports})
+}
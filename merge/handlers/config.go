@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gigapi/gigapi/v2/config"
+	"net/http"
+)
+
+// ConfigHandler returns the effective configuration with the secrets redacted
+func ConfigHandler(w http.ResponseWriter, r *http.Request) error {
+	res, err := json.Marshal(config.Get().Redacted())
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+	return nil
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
 	"github.com/gigapi/gigapi/v2/merge/repository"
 	"github.com/gigapi/gigapi/v2/merge/shared"
 
@@ -19,6 +21,7 @@ type TimestampField struct {
 
 type CreateTableRequest struct {
 	CreateTable string            `json:"create_table" yaml:"create_table"`
+	Database    string            `json:"database" yaml:"database"`
 	Fields      map[string]string `json:"fields" yaml:"fields"`
 	Engine      string            `json:"engine" yaml:"engine"`
 	OrderBy     []string          `json:"order_by" yaml:"order_by"`
@@ -41,6 +44,9 @@ func CreateTableHandler(w http.ResponseWriter, r *http.Request) error {
 
 	var fields [][2]string
 	for field, fieldType := range req.Fields {
+		if _, err := data_types.GetColumnBuilder(fieldType); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
 		fields = append(fields, [2]string{field, fieldType})
 	}
 
@@ -54,7 +60,12 @@ func CreateTableHandler(w http.ResponseWriter, r *http.Request) error {
 		return fmt.Errorf("field %s does not exist", req.Timestamp.Field)
 	}
 
-	if !config.Config.Gigapi.AllowSaveToHD {
+	// the HiveMerge tables are always stored locally
+	if req.Engine == "HiveMerge" {
+		return createHiveTable(w, &req)
+	}
+
+	if !config.Get().Gigapi.AllowSaveToHD {
 		if req.S3Url == "" {
 			return fmt.Errorf("s3_url is required")
 		}
@@ -65,6 +76,7 @@ func CreateTableHandler(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	table := shared.Table{
+		Database:    req.Database,
 		Name:        req.CreateTable,
 		Engine:      req.Engine,
 		OrderBy:     req.OrderBy,
@@ -79,3 +91,57 @@ func CreateTableHandler(w http.ResponseWriter, r *http.Request) error {
 	w.Write([]byte("Ok"))
 	return nil
 }
+
+// createHiveTable registers the HiveMerge table of the request.
+// The engine stores the tables locally and partitions them by __timestamp in nanoseconds,
+// the requests asking for something else are rejected.
+func createHiveTable(w http.ResponseWriter, req *CreateTableRequest) error {
+	badRequest := func(err error) error {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	if req.S3Url != "" {
+		return badRequest(fmt.Errorf("s3_url is not supported by the HiveMerge engine"))
+	}
+	if req.Timestamp.Field != "__timestamp" {
+		return badRequest(fmt.Errorf("the timestamp field of the HiveMerge engine must be __timestamp"))
+	}
+	if req.Timestamp.Precision != "" && req.Timestamp.Precision != "ns" {
+		return badRequest(fmt.Errorf("the timestamp precision of the HiveMerge engine must be ns"))
+	}
+	// without partition_by an existing table keeps its scheme and a new one gets the configured scheme
+	var scheme *shared.PartitionScheme
+	if req.PartitionBy != "" {
+		var err error
+		scheme, err = shared.ParsePartitionScheme(req.PartitionBy)
+		if err != nil {
+			return badRequest(err)
+		}
+	}
+	// the manifest records the canonical type names of the columns
+	schema := make(map[string]string, len(req.Fields))
+	for field, fieldType := range req.Fields {
+		builder, err := data_types.GetColumnBuilder(fieldType)
+		if err != nil {
+			return badRequest(fmt.Errorf("field %s: %w", field, err))
+		}
+		col, err := builder(field, nil, 0, 0)
+		if err != nil {
+			return badRequest(fmt.Errorf("field %s: %w", field, err))
+		}
+		schema[field] = col.GetTypeName()
+	}
+	err := repository.CreateHiveTable(req.Database, req.CreateTable, scheme, req.OrderBy, schema)
+	if errors.Is(err, repository.ErrTableConflict) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	if err != nil {
+		return badRequest(err)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Ok"))
+	return nil
+}
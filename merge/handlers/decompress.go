@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Decoder decompresses the body of a write request. The limit is the max decompressed size,
+// 0 if unlimited, for the decoders reading the whole body at once.
+type Decoder func(r io.Reader, limit int64) (io.ReadCloser, error)
+
+var decoders = make(map[string]Decoder)
+
+// RegisterDecoder registers the decoder of a Content-Encoding
+func RegisterDecoder(encoding string, decoder Decoder) {
+	decoders[strings.ToLower(encoding)] = decoder
+}
+
+// UnsupportedEncodingError is returned for the Content-Encoding without a decoder
+type UnsupportedEncodingError struct {
+	Encoding string
+}
+
+func (e *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding %q", e.Encoding)
+}
+
+// DecodeError is returned if the body can't be decompressed
+type DecodeError struct {
+	Encoding string
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid %s body: %v", e.Encoding, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeErrReader marks the errors of a decoder as DecodeError
+type decodeErrReader struct {
+	encoding string
+	r        io.ReadCloser
+}
+
+func (d *decodeErrReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	var maxErr *http.MaxBytesError
+	if err != nil && err != io.EOF && !errors.As(err, &maxErr) && !errors.As(err, new(*DecodeError)) {
+		err = &DecodeError{Encoding: d.encoding, Err: err}
+	}
+	return n, err
+}
+
+func (d *decodeErrReader) Close() error {
+	return d.r.Close()
+}
+
+// requestBody returns the body of the write request decompressed according to its Content-Encoding.
+// The encodings are undone in the reverse order of the header, the decompressed body is limited
+// to gigapi.max_decompressed_bytes: reading more fails with *http.MaxBytesError.
+func requestBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	var encodings []string
+	for _, header := range r.Header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(header, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding != "" && encoding != "identity" {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+	limit := int64(config.Get().Gigapi.MaxDecompressedBytes)
+	body := r.Body
+	closers := []io.Closer{r.Body}
+	closeAll := func() error {
+		var errs []error
+		for i := len(closers) - 1; i >= 0; i-- {
+			errs = append(errs, closers[i].Close())
+		}
+		return errors.Join(errs...)
+	}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoder, ok := decoders[encodings[i]]
+		if !ok {
+			closeAll()
+			return nil, &UnsupportedEncodingError{Encoding: encodings[i]}
+		}
+		decoded, err := decoder(body, limit)
+		if err != nil {
+			closeAll()
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) || errors.As(err, new(*DecodeError)) {
+				return nil, err
+			}
+			return nil, &DecodeError{Encoding: encodings[i], Err: err}
+		}
+		body = &decodeErrReader{encoding: encodings[i], r: decoded}
+		closers = append(closers, decoded)
+	}
+	if limit > 0 && len(encodings) > 0 {
+		body = http.MaxBytesReader(w, body, limit)
+	}
+	return readCloser{Reader: body, close: closeAll}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+// writeBodyError responds with 415, 413 or 400 if the request body can't be read
+func writeBodyError(w http.ResponseWriter, err error) bool {
+	var (
+		encodingErr *UnsupportedEncodingError
+		maxErr      *http.MaxBytesError
+		decodeErr   *DecodeError
+		status      int
+	)
+	switch {
+	case errors.As(err, &encodingErr):
+		status = http.StatusUnsupportedMediaType
+	case errors.As(err, &maxErr):
+		status = http.StatusRequestEntityTooLarge
+		err = fmt.Errorf("the request body exceeds %d bytes", maxErr.Limit)
+	case errors.As(err, &decodeErr):
+		status = http.StatusBadRequest
+	default:
+		return false
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
+	return true
+}
+
+// snappyStreamHeader starts the snappy framing format, otherwise the body is a snappy block
+// as the one of Prometheus remote write
+var snappyStreamHeader = []byte("\xff\x06\x00\x00sNaPpY")
+
+func decodeSnappy(r io.Reader, limit int64) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if header, _ := br.Peek(len(snappyStreamHeader)); bytes.Equal(header, snappyStreamHeader) {
+		return io.NopCloser(snappy.NewReader(br)), nil
+	}
+	// the block is read whole, its decompressed size is checked before it's decoded
+	src := io.Reader(br)
+	if limit > 0 {
+		src = io.LimitReader(br, limit+1)
+	}
+	block, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	size, err := snappy.DecodedLen(block)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && (int64(size) > limit || int64(len(block)) > limit) {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	data, err := snappy.Decode(nil, block)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// decodeDeflate reads the zlib stream of the deflate encoding or the raw deflate some clients send
+func decodeDeflate(r io.Reader, _ int64) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func init() {
+	gzipDecoder := func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}
+	RegisterDecoder("gzip", gzipDecoder)
+	RegisterDecoder("x-gzip", gzipDecoder)
+	RegisterDecoder("deflate", decodeDeflate)
+	RegisterDecoder("zstd", func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	})
+	RegisterDecoder("snappy", decodeSnappy)
+	RegisterDecoder("x-snappy-framed", func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return io.NopCloser(snappy.NewReader(r)), nil
+	})
+	RegisterDecoder("lz4", func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return io.NopCloser(lz4.NewReader(r)), nil
+	})
+	RegisterDecoder("br", func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	})
+}
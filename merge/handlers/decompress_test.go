@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "zstd":
+		w, _ = zstd.NewWriter(&buf)
+	case "snappy":
+		return snappy.Encode(nil, data)
+	case "x-snappy-framed":
+		w = snappy.NewBufferedWriter(&buf)
+	case "lz4":
+		w = lz4.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readBody(encoding string, body []byte) ([]byte, error) {
+	r := httptest.NewRequest("POST", "/write", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", encoding)
+	reader, err := requestBody(httptest.NewRecorder(), r)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func TestRequestBody(t *testing.T) {
+	config.Set(&config.Configuration{Gigapi: config.GigapiConfiguration{MaxDecompressedBytes: 1 << 20}})
+	data := bytes.Repeat([]byte("cpu,host=a usage=1 1\n"), 1000)
+	for _, encoding := range []string{"gzip", "deflate", "zstd", "snappy", "x-snappy-framed", "lz4", "br"} {
+		res, err := readBody(encoding, compress(t, encoding, data))
+		if err != nil || !bytes.Equal(res, data) {
+			t.Fatalf("%s: unexpected body of %d bytes: %v", encoding, len(res), err)
+		}
+	}
+
+	// the encodings are applied in the order of the header
+	res, err := readBody("gzip, zstd", compress(t, "zstd", compress(t, "gzip", data)))
+	if err != nil || !bytes.Equal(res, data) {
+		t.Fatalf("unexpected body of %d bytes: %v", len(res), err)
+	}
+
+	bomb := make([]byte, 2<<20)
+	var maxErr *http.MaxBytesError
+	for _, encoding := range []string{"gzip", "snappy", "zstd"} {
+		if _, err = readBody(encoding, compress(t, encoding, bomb)); !errors.As(err, &maxErr) {
+			t.Fatalf("%s: expected the size error, got %v", encoding, err)
+		}
+	}
+
+	var encodingErr *UnsupportedEncodingError
+	if _, err = readBody("compress", data); !errors.As(err, &encodingErr) {
+		t.Fatalf("expected the encoding error, got %v", err)
+	}
+	var decodeErr *DecodeError
+	if _, err = readBody("gzip", data); !errors.As(err, &decodeErr) {
+		t.Fatalf("expected the decode error, got %v", err)
+	}
+	if _, err = readBody("zstd", data); !errors.As(err, &decodeErr) {
+		t.Fatalf("expected the decode error, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"net/http"
+)
+
+type fileDesc struct {
+	Path      string         `json:"path"`
+	Partition string         `json:"partition"`
+	SizeBytes int64          `json:"size_bytes"`
+	RowCount  int64          `json:"row_count"`
+	MinTime   int64          `json:"min_time"`
+	MaxTime   int64          `json:"max_time"`
+	Min       map[string]any `json:"min,omitempty"`
+	Max       map[string]any `json:"max,omitempty"`
+}
+
+type filesResponse struct {
+	Files          []fileDesc `json:"files"`
+	TotalSizeBytes int64      `json:"total_size_bytes"`
+	TotalRows      int64      `json:"total_rows"`
+}
+
+func parseIndexQuery(r *http.Request) (*shared.IndexQuery, error) {
+	return shared.ParseIndexQuery(r.URL.Query().Get("from"), r.URL.Query().Get("to"), r.URL.Query()["where"])
+}
+
+// ListFilesHandler returns the live parquet files of a table which may contain the rows
+// of the requested time range (from, to) matching the `where` predicates
+func ListFilesHandler(w http.ResponseWriter, r *http.Request) error {
+	vars := API.GetPathParams(r)
+	q, err := parseIndexQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	partitions, err := repository.ListFiles(vars["db"], vars["table"], q)
+	if err != nil {
+		return err
+	}
+	res := filesResponse{Files: []fileDesc{}}
+	for _, part := range partitions {
+		for _, e := range part.Files {
+			minTime, okMin := e.Min["__timestamp"].(int64)
+			maxTime, okMax := e.Max["__timestamp"].(int64)
+			if !okMin || !okMax {
+				return fmt.Errorf("%s: no __timestamp statistics", e.Path)
+			}
+			desc := fileDesc{
+				Path:      e.Path,
+				Partition: part.Path,
+				SizeBytes: e.SizeBytes,
+				RowCount:  e.RowCount,
+				MinTime:   minTime,
+				MaxTime:   maxTime,
+			}
+			if e.ColumnStats {
+				desc.Min, desc.Max = e.Min, e.Max
+			}
+			res.Files = append(res.Files, desc)
+			res.TotalSizeBytes += e.SizeBytes
+			res.TotalRows += e.RowCount
+		}
+	}
+	out, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+	return nil
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/parsers"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type importResponse struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Rows     int64  `json:"rows"`
+	Error    string `json:"error,omitempty"`
+}
+
+// confinedPath returns the path resolved against the directory, relative paths being relative to it.
+// The paths escaping the directory are rejected, all of them if the directory is not set.
+func confinedPath(dir string, path string, setting string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("local paths are disabled, %s is not set", setting)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside of %s", path, setting)
+	}
+	return path, nil
+}
+
+// openImportFile returns the parquet file to import: the S3 object or the local file under
+// the import directory of the `path` parameter, or the uploaded request body
+func openImportFile(w http.ResponseWriter, r *http.Request) (*os.File, func(), error) {
+	src := r.URL.Query().Get("path")
+	if src != "" && !strings.HasPrefix(src, "s3://") {
+		src, err := confinedPath(config.Get().Gigapi.ImportDir, src, "gigapi.import_dir")
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, func() { f.Close() }, nil
+	}
+	f, err := os.CreateTemp("", "gigapi-import-*.parquet")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if src != "" {
+		err = service.DownloadFromS3(r.Context(), src, f.Name())
+	} else {
+		var body io.ReadCloser
+		if body, err = requestBody(w, r); err == nil {
+			_, err = io.Copy(f, body)
+			body.Close()
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return f, cleanup, nil
+}
+
+// ImportHandler imports a parquet file into the table. The rows are partitioned
+// as the table's ones and saved as level-1 files merged later as usual.
+func ImportHandler(w http.ResponseWriter, r *http.Request) error {
+	vars := API.GetPathParams(r)
+	database, table := vars["db"], vars["table"]
+	f, cleanup, err := openImportFile(w, r)
+	if err != nil {
+		if writeBodyError(w, err) {
+			return nil
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+	defer cleanup()
+
+	parser := &parsers.ParquetParser{
+		Table:      table,
+		TimeColumn: r.URL.Query().Get("time_column"),
+	}
+	rows, err := repository.Import(r.Context(), database, parser, f)
+	var parseErr *repository.ParseError
+	if errors.As(err, &parseErr) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("invalid parquet file: %v", err)))
+		return nil
+	}
+	var importErr *repository.ImportError
+	if errors.As(err, &importErr) {
+		// the client resumes the import after the saved rows
+		out, err := json.Marshal(importResponse{
+			Database: database, Table: table, Rows: importErr.Rows, Error: importErr.Err.Error()})
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(out)
+		return nil
+	}
+	if err != nil {
+		return writeStoreError(w, err)
+	}
+	return writeJSON(w, importResponse{Database: database, Table: table, Rows: rows})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestConfinedPath(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := confinedPath("", "weather.parquet", "gigapi.import_dir"); err == nil {
+		t.Fatal("local paths accepted without the import directory")
+	}
+	for _, c := range []struct {
+		path string
+		res  string
+	}{
+		{path: "weather.parquet", res: filepath.Join(dir, "weather.parquet")},
+		{path: "a/../b/weather.parquet", res: filepath.Join(dir, "b", "weather.parquet")},
+		{path: filepath.Join(dir, "weather.parquet"), res: filepath.Join(dir, "weather.parquet")},
+		{path: "../weather.parquet"},
+		{path: "a/../../weather.parquet"},
+		{path: "/etc/passwd"},
+		{path: dir + "-other/weather.parquet"},
+	} {
+		res, err := confinedPath(dir, c.path, "gigapi.import_dir")
+		if c.res == "" {
+			if err == nil {
+				t.Errorf("%s: accepted as %s", c.path, res)
+			}
+			continue
+		}
+		if err != nil || res != c.res {
+			t.Errorf("%s: unexpected result %q, %v", c.path, res, err)
+		}
+	}
+}
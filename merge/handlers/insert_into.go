@@ -1,14 +1,21 @@
 package handlers
 
 import (
-	"compress/gzip"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
 	"github.com/gigapi/gigapi/v2/merge/parsers"
 	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/service"
 	"github.com/gigapi/gigapi/v2/modules"
 	"github.com/gigapi/gigapi/v2/utils"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 var API modules.Api
@@ -24,9 +31,89 @@ func getDatabase(r *http.Request) string {
 	return ""
 }
 
+// Write acknowledgement modes
+const (
+	// respond as soon as the request is read, the data is parsed and buffered afterwards
+	// and the errors are only logged
+	AckNone = "none"
+	// respond when the data is parsed and put into the in-memory buffer
+	AckBuffered = "buffered"
+	// reserved for the write-ahead log, rejected until there is one
+	AckWAL = "wal"
+	// respond when the data is saved to parquet and the index is flushed
+	AckDurable = "durable"
+)
+
+func getAckMode(r *http.Request) (string, error) {
+	ack := r.URL.Query().Get("ack")
+	if ack == "" {
+		ack = config.Get().Gigapi.AckMode
+	}
+	switch ack {
+	case AckNone, AckBuffered, AckDurable:
+		return ack, nil
+	case AckWAL:
+		return "", fmt.Errorf("ack mode %q is not supported, there is no write-ahead log yet", ack)
+	}
+	return "", fmt.Errorf("invalid ack mode %q, expected one of: none, buffered, durable", ack)
+}
+
+// typeHints parses the `types` parameter: the comma separated name:TYPE pairs of the columns,
+// e.g. `host:LowCardinality(VARCHAR),price:DECIMAL(10,2)`. The commas inside the parentheses
+// are parts of the types.
+func typeHints(param string) ([]string, []string, error) {
+	var (
+		names, types []string
+		depth, start int
+	)
+	for i := 0; i <= len(param); i++ {
+		if i < len(param) {
+			switch param[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if param[i] != ',' || depth > 0 {
+				continue
+			}
+		}
+		pair := strings.TrimSpace(param[start:i])
+		start = i + 1
+		if pair == "" {
+			continue
+		}
+		name, typeName, ok := strings.Cut(pair, ":")
+		name, typeName = strings.TrimSpace(name), strings.TrimSpace(typeName)
+		if !ok || name == "" || typeName == "" {
+			return nil, nil, fmt.Errorf("invalid type hint %q, expected name:TYPE", pair)
+		}
+		if _, err := data_types.GetColumnBuilder(typeName); err != nil {
+			return nil, nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		names = append(names, name)
+		types = append(types, typeName)
+	}
+	return names, types, nil
+}
+
 func InsertIntoHandler(w http.ResponseWriter, r *http.Request) error {
+	ack, err := getAckMode(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+
+	fieldNames, fieldTypes, err := typeHints(r.URL.Query().Get("types"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return nil
+	}
+
 	contentType := r.Header.Get("Content-Type")
-	parser, err := parsers.GetParser(contentType, nil, nil)
+	parser, err := parsers.GetParser(contentType, fieldNames, fieldTypes)
 
 	database := getDatabase(r)
 
@@ -35,26 +122,71 @@ func InsertIntoHandler(w http.ResponseWriter, r *http.Request) error {
 	if precision != "" {
 		ctx = context.WithValue(ctx, "precision", precision)
 	}
+	if table := r.URL.Query().Get("table"); table != "" {
+		ctx = context.WithValue(ctx, "table", table)
+	}
+	if timeColumn := r.URL.Query().Get("time_column"); timeColumn != "" {
+		ctx = context.WithValue(ctx, "time_column", timeColumn)
+	}
+	if timeFormat := r.URL.Query().Get("time_format"); timeFormat != "" {
+		ctx = context.WithValue(ctx, "time_format", timeFormat)
+	}
+
+	if err != nil {
+		return err
+	}
 
+	reader, err := requestBody(w, r)
 	if err != nil {
+		if writeBodyError(w, err) {
+			return nil
+		}
 		return err
 	}
+	defer reader.Close()
 
-	// Handle gzip compression
-	var reader io.Reader = r.Body
-	if r.Header.Get("Content-Encoding") == "gzip" {
-		gzipReader, err := gzip.NewReader(r.Body)
+	if ack == AckNone {
+		body, err := io.ReadAll(reader)
 		if err != nil {
+			if writeBodyError(w, err) {
+				return nil
+			}
 			return err
 		}
-		defer gzipReader.Close()
-		reader = gzipReader
+		go storeUnacknowledged(context.WithoutCancel(ctx), parser, body, database)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
 	}
 
-	res, err := parser.ParseReader(ctx, reader)
+	promises, err := store(ctx, parser, reader, database)
 	if err != nil {
+		if writeBodyError(w, err) {
+			return nil
+		}
 		return err
 	}
+	for _, p := range promises {
+		// the buffer is reserved synchronously by Store, so Peek reports the backpressure errors
+		if ack == AckBuffered {
+			_, _, err = p.Peek()
+		} else {
+			_, err = p.Get()
+		}
+		if err != nil {
+			return writeStoreError(w, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// store parses the request and puts the data into the tables' buffers
+func store(ctx context.Context, parser parsers.IParser, reader io.Reader,
+	database string) ([]utils.Promise[int32], error) {
+	res, err := parser.ParseReader(ctx, reader)
+	if err != nil {
+		return nil, err
+	}
 	var promises []utils.Promise[int32]
 	for _res := range res {
 		if _res.Error != nil {
@@ -62,20 +194,43 @@ func InsertIntoHandler(w http.ResponseWriter, r *http.Request) error {
 				for range res {
 				}
 			}()
-			return _res.Error
+			return nil, _res.Error
 		}
 		_database := database
 		if _database == "" {
-			database = _res.Database
+			_database = _res.Database
 		}
 		promises = append(promises, repository.Store(_database, _res.Table, _res.Data))
 	}
+	return promises, nil
+}
+
+// storeUnacknowledged stores the body of a write already responded to, the errors are logged
+func storeUnacknowledged(ctx context.Context, parser parsers.IParser, body []byte, database string) {
+	promises, err := store(ctx, parser, bytes.NewReader(body), database)
 	for _, p := range promises {
-		_, err = p.Get()
 		if err != nil {
-			return err
+			break
 		}
+		_, err = p.Get()
 	}
-	w.WriteHeader(http.StatusNoContent)
+	if err != nil {
+		fmt.Printf("unacknowledged write to database %q failed: %v\n", database, err)
+	}
+}
+
+// writeStoreError responds with 429 or 503 and Retry-After if the ingestion buffer is full
+func writeStoreError(w http.ResponseWriter, err error) error {
+	var bufErr *service.BufferFullError
+	if !errors.As(err, &bufErr) {
+		return err
+	}
+	status := http.StatusTooManyRequests
+	if bufErr.Global {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(max(bufErr.RetryAfter.Seconds(), 1))))
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
 	return nil
 }
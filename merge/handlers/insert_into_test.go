@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func initInsertTestConfig(t *testing.T, saveTimeoutS float64) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:               t.TempDir(),
+			MergeTimeoutS:      10,
+			SaveTimeoutS:       saveTimeoutS,
+			PartitionBy:        "hour",
+			FlushRows:          1000000,
+			MaxTableBufferRows: 2,
+			// the full table buffer is not flushed early
+			BufferPressureRatio: 1,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+}
+
+func insert(db, ack, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", fmt.Sprintf("/write?db=%s&ack=%s", db, ack), strings.NewReader(body))
+	w := httptest.NewRecorder()
+	if err := InsertIntoHandler(w, r); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+	}
+	return w
+}
+
+// bufferedRows returns the number of the not yet saved rows of the table
+func bufferedRows(db, table string) int64 {
+	for _, usage := range service.GetBufferStats().Tables {
+		if usage.Database == db && usage.Table == table {
+			return usage.Rows
+		}
+	}
+	return 0
+}
+
+func TestInsertAckModes(t *testing.T) {
+	ts := time.Now().UnixNano()
+	body := fmt.Sprintf("cpu,host=a usage=1 %d\ncpu,host=b usage=2 %d\n", ts, ts+1)
+	for _, c := range []struct {
+		ack   string
+		saved bool
+	}{
+		{ack: AckBuffered},
+		{ack: AckDurable, saved: true},
+	} {
+		t.Run(c.ack, func(t *testing.T) {
+			saveTimeoutS := 3600.
+			if c.saved {
+				saveTimeoutS = 0.1
+			}
+			initInsertTestConfig(t, saveTimeoutS)
+			db := fmt.Sprintf("ack_%s_%d", c.ack, time.Now().UnixNano())
+			if w := insert(db, c.ack, body); w.Code != http.StatusNoContent {
+				t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+			}
+			if c.saved {
+				parts, err := repository.ListFiles(db, "cpu", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var rows int64
+				for _, p := range parts {
+					for _, f := range p.Files {
+						rows += f.RowCount
+					}
+				}
+				if rows != 2 {
+					t.Fatalf("expected 2 saved rows, got %d", rows)
+				}
+				return
+			}
+			if rows := bufferedRows(db, "cpu"); rows != 2 {
+				t.Fatalf("expected 2 buffered rows, got %d", rows)
+			}
+			// the table buffer is full and isn't flushed before the save timeout
+			w := insert(db, c.ack, body)
+			if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+				t.Fatalf("expected 429 with Retry-After, got %d: %s", w.Code, w.Body.String())
+			}
+			if rows := bufferedRows(db, "cpu"); rows != 2 {
+				t.Fatalf("rejected rows are buffered: %d", rows)
+			}
+		})
+	}
+}
+
+func TestInsertAckNone(t *testing.T) {
+	initInsertTestConfig(t, 3600)
+	ts := time.Now().UnixNano()
+	body := fmt.Sprintf("cpu,host=a usage=1 %d\ncpu,host=b usage=2 %d\n", ts, ts+1)
+	db := fmt.Sprintf("ack_none_%d", ts)
+	if w := insert(db, AckNone, body); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	// the rows are buffered after the response
+	deadline := time.Now().Add(time.Second * 5)
+	for bufferedRows(db, "cpu") != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if rows := bufferedRows(db, "cpu"); rows != 2 {
+		t.Fatalf("expected 2 buffered rows, got %d", rows)
+	}
+	// the backpressure isn't reported, the rows are dropped
+	if w := insert(db, AckNone, body); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	time.Sleep(time.Millisecond * 100)
+	if rows := bufferedRows(db, "cpu"); rows != 2 {
+		t.Fatalf("rejected rows are buffered: %d", rows)
+	}
+}
+
+func TestInsertInvalidAckMode(t *testing.T) {
+	initInsertTestConfig(t, 0.1)
+	for _, ack := range []string{"sometimes", AckWAL} {
+		if w := insert("ack_invalid", ack, "cpu usage=1 1\n"); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: unexpected response %d: %s", ack, w.Code, w.Body.String())
+		}
+	}
+}
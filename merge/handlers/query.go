@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/query"
+	"io"
+	"net/http"
+)
+
+type QueryRequest struct {
+	Query string `json:"query"`
+}
+
+// QueryHandler runs SQL over the saved and the buffered data of the database
+func QueryHandler(w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	var req QueryRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return fmt.Errorf("invalid query request: %w", err)
+	}
+	if req.Query == "" {
+		return fmt.Errorf("query is required")
+	}
+	res, err := query.Query(r.Context(), getDatabase(r), req.Query)
+	if err != nil {
+		return err
+	}
+	out, err := json.Marshal(map[string]any{"results": res})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+	return nil
+}
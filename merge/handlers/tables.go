@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"net/http"
+)
+
+// ListTablesHandler returns the manifests of all the tables of the database
+func ListTablesHandler(w http.ResponseWriter, r *http.Request) error {
+	vars := API.GetPathParams(r)
+	manifests, err := repository.ListTableManifests(vars["db"])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, map[string]any{"tables": manifests})
+}
+
+// DescribeTableHandler returns the manifest of the table: schema, totals and partitions
+func DescribeTableHandler(w http.ResponseWriter, r *http.Request) error {
+	vars := API.GetPathParams(r)
+	manifest, err := repository.GetTableManifest(vars["db"], vars["table"])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, manifest)
+}
+
+func writeJSON(w http.ResponseWriter, res any) error {
+	out, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+	return nil
+}
@@ -1,38 +1,99 @@
 package index
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gigapi/gigapi/v2/merge/shared"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
 	"github.com/gigapi/gigapi/v2/utils"
 	jsoniter "github.com/json-iterator/go"
+	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
 
 type jsonIndexEntry struct {
-	Id          uint32 `json:"id"`
-	Path        string `json:"path"`
-	SizeBytes   int64  `json:"size_bytes"`
-	RowCount    int64  `json:"row_count"`
-	ChunkTime   int64  `json:"chunk_time"`
-	MinTime     int64  `json:"min_time"`
-	MaxTime     int64  `json:"max_time"`
-	Range       string `json:"range"`
-	Type        string `json:"type"`
-	_marshalled string `json:"-"`
+	Id          uint32         `json:"id"`
+	Path        string         `json:"path"`
+	SizeBytes   int64          `json:"size_bytes"`
+	RowCount    int64          `json:"row_count"`
+	ChunkTime   int64          `json:"chunk_time"`
+	MinTime     int64          `json:"min_time"`
+	MaxTime     int64          `json:"max_time"`
+	Range       string         `json:"range"`
+	Type        string         `json:"type"`
+	Min         map[string]any `json:"min,omitempty"`
+	Max         map[string]any `json:"max,omitempty"`
+	ColumnStats bool           `json:"column_stats,omitempty"`
+	_marshalled string         `json:"-"`
+}
+
+// UseNumber keeps the int64 statistics precise
+var jsonConfig = jsoniter.Config{UseNumber: true}.Froze()
+
+// normalizeStats converts the json numbers of the statistics back to int64, uint64 or float64
+func normalizeStats(stats map[string]any) {
+	for k, v := range stats {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			stats[k] = i
+		} else if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			stats[k] = u
+		} else if f, err := n.Float64(); err == nil {
+			stats[k] = f
+		}
+	}
+}
+
+// indexChanges are the local changes not flushed to metadata.json yet
+type indexChanges struct {
+	add     []*jsonIndexEntry
+	rm      []string
+	dropAdd []string
+	dropRm  []string
+}
+
+// merge returns the changes followed by the newer ones
+func (c indexChanges) merge(newer indexChanges) indexChanges {
+	removed := make(map[string]bool, len(newer.rm))
+	for _, p := range newer.rm {
+		removed[p] = true
+	}
+	res := indexChanges{
+		rm:      append(append([]string{}, c.rm...), newer.rm...),
+		dropAdd: append(append([]string{}, c.dropAdd...), newer.dropAdd...),
+		dropRm:  append(append([]string{}, c.dropRm...), newer.dropRm...),
+	}
+	for _, e := range c.add {
+		if !removed[e.Path] {
+			res.add = append(res.add, e)
+		}
+	}
+	res.add = append(res.add, newer.add...)
+	return res
 }
 
 type JSONIndex struct {
 	t       *shared.Table
 	idxPath string
+	// partition path relative to the table root
+	partPath string
 
+	// entries and dropQueue are replaced on refresh, they are read under m
 	entries   *sync.Map
 	promises  []utils.Promise[int32]
-	m         sync.Mutex
+	m         sync.RWMutex
 	updateCtx context.Context
 	doUpdate  context.CancelFunc
 	workCtx   context.Context
@@ -40,6 +101,7 @@ type JSONIndex struct {
 	lastId    uint32
 
 	dropQueue        []string
+	changes          indexChanges
 	parquetSizeBytes int64
 	rowCount         int64
 	minTime          int64
@@ -65,9 +127,10 @@ func NewJSONIndexForPartition(t *shared.Table, values [][2]string) (shared.Index
 		folders[i+1] = fmt.Sprintf("%s=%s", value[0], value[1])
 	}
 	res := &JSONIndex{
-		t:       t,
-		idxPath: path.Join(folders...),
-		entries: &sync.Map{},
+		t:        t,
+		idxPath:  path.Join(folders...),
+		partPath: path.Join(folders[1:]...),
+		entries:  &sync.Map{},
 	}
 	err := res.populate()
 	res.updateCtx, res.doUpdate = context.WithCancel(context.Background())
@@ -75,11 +138,31 @@ func NewJSONIndexForPartition(t *shared.Table, values [][2]string) (shared.Index
 	return res, err
 }
 
+// ReadPartitionFiles reads the entries of the metadata.json of a partition folder
+// without creating a running index
+func ReadPartitionFiles(idxPath string) ([]*shared.IndexEntry, error) {
+	idx := &JSONIndex{
+		idxPath: idxPath,
+		entries: &sync.Map{},
+	}
+	err := idx.populate()
+	if err != nil {
+		return nil, err
+	}
+	var res []*shared.IndexEntry
+	idx.entries.Range(func(key, value any) bool {
+		res = append(res, idx.Get(key.(string)))
+		return true
+	})
+	return res, nil
+}
+
 func (J *JSONIndex) AddToDropQueue(files []string) utils.Promise[int32] {
 	J.m.Lock()
 	defer J.m.Unlock()
 
 	J.dropQueue = append(J.dropQueue, files...)
+	J.changes.dropAdd = append(J.changes.dropAdd, files...)
 	p := utils.New[int32]()
 	J.promises = append(J.promises, p)
 	J.doUpdate()
@@ -106,6 +189,7 @@ func (J *JSONIndex) RmFromDropQueue(files []string) utils.Promise[int32] {
 	if !updated {
 		return utils.Fulfilled[int32](nil, 0)
 	}
+	J.changes.dropRm = append(J.changes.dropRm, files...)
 
 	p := utils.New[int32]()
 	J.promises = append(J.promises, p)
@@ -113,8 +197,11 @@ func (J *JSONIndex) RmFromDropQueue(files []string) utils.Promise[int32] {
 	return p
 }
 
+// GetDropQueue returns a copy of the drop queue
 func (J *JSONIndex) GetDropQueue() []string {
-	return J.dropQueue
+	J.m.RLock()
+	defer J.m.RUnlock()
+	return append([]string(nil), J.dropQueue...)
 }
 
 func (J *JSONIndex) populate() error {
@@ -127,8 +214,12 @@ func (J *JSONIndex) populate() error {
 		return err
 	}
 	defer f.Close()
+	return J.populateFrom(f)
+}
 
-	iter := jsoniter.Parse(jsoniter.ConfigDefault, f, 4096)
+func (J *JSONIndex) populateFrom(r io.Reader) error {
+	var err error
+	iter := jsoniter.Parse(jsonConfig, r, 4096)
 	iter.ReadMapCB(func(iterator *jsoniter.Iterator, s string) bool {
 		switch s {
 		case "drop_queue":
@@ -169,6 +260,8 @@ func (J *JSONIndex) populateFiles(iter *jsoniter.Iterator) error {
 	for iter.ReadArray() {
 		e := &jsonIndexEntry{}
 		iter.ReadVal(e)
+		normalizeStats(e.Min)
+		normalizeStats(e.Max)
 		_marshalled, err := json.Marshal(e)
 		if err != nil {
 			return err
@@ -194,12 +287,38 @@ func (J *JSONIndex) Batch(add []*shared.IndexEntry, rm []string) utils.Promise[i
 	if len(_add) == 0 && !removed {
 		return utils.Fulfilled(nil, int32(0))
 	}
+	J.changes = J.changes.merge(indexChanges{add: _add, rm: rm})
 	p := utils.New[int32]()
 	J.promises = append(J.promises, p)
 	J.doUpdate()
 	return p
 }
 
+func (J *JSONIndex) CommitMerge(merged *shared.IndexEntry, sources []string,
+	dropped []string) utils.Promise[int32] {
+	_add, err := J.entry2JEntry([]*shared.IndexEntry{merged})
+	if err != nil {
+		return utils.Fulfilled[int32](err, 0)
+	}
+	J.m.Lock()
+	defer J.m.Unlock()
+	J.add(_add)
+	J.rm(sources)
+	J.dropQueue = append(J.dropQueue, dropped...)
+	J.changes = J.changes.merge(indexChanges{add: _add, rm: sources, dropAdd: dropped})
+	p := utils.New[int32]()
+	J.promises = append(J.promises, p)
+	J.doUpdate()
+	return p
+}
+
+func (J *JSONIndex) partitionRange() string {
+	if J.t.Partitioning == nil {
+		return "1h"
+	}
+	return J.t.Partitioning.Range()
+}
+
 func (J *JSONIndex) entry2JEntry(entries []*shared.IndexEntry) ([]*jsonIndexEntry, error) {
 	res := make([]*jsonIndexEntry, len(entries))
 	for i, entry := range entries {
@@ -207,11 +326,15 @@ func (J *JSONIndex) entry2JEntry(entries []*shared.IndexEntry) ([]*jsonIndexEntr
 		var (
 			minTime, maxTime int64
 		)
-		if _, ok := entry.Min["__timestamp"]; ok {
-			minTime = entry.Min["__timestamp"].(int64)
+		if v, ok := entry.Min["__timestamp"]; ok {
+			if minTime, ok = v.(int64); !ok {
+				return nil, fmt.Errorf("%s: unexpected __timestamp statistics %v (%T)", entry.Path, v, v)
+			}
 		}
-		if _, ok := entry.Max["__timestamp"]; ok {
-			maxTime = entry.Max["__timestamp"].(int64)
+		if v, ok := entry.Max["__timestamp"]; ok {
+			if maxTime, ok = v.(int64); !ok {
+				return nil, fmt.Errorf("%s: unexpected __timestamp statistics %v (%T)", entry.Path, v, v)
+			}
 		}
 		_entry := &jsonIndexEntry{
 			Id:        id,
@@ -221,9 +344,14 @@ func (J *JSONIndex) entry2JEntry(entries []*shared.IndexEntry) ([]*jsonIndexEntr
 			ChunkTime: entry.ChunkTime,
 			MinTime:   minTime,
 			MaxTime:   maxTime,
-			Range:     "1h",
+			Range:     J.partitionRange(),
 			Type:      "compacted",
 		}
+		if entry.ColumnStats {
+			_entry.Min = entry.Min
+			_entry.Max = entry.Max
+			_entry.ColumnStats = true
+		}
 		_marshalled, err := json.Marshal(_entry)
 		if err != nil {
 			return nil, err
@@ -312,34 +440,189 @@ func (J *JSONIndex) rm(path []string) bool {
 func (J *JSONIndex) flush() {
 	J.m.Lock()
 	J.updateCtx, J.doUpdate = context.WithCancel(context.Background())
-	var entries []string
-	dropQueue := J.dropQueue
-	parquetSizeBytes := J.parquetSizeBytes
 	promises := J.promises
 	J.promises = nil
-	rowCount := J.rowCount
-	minTime := J.minTime
-	maxTime := J.maxTime
-	J.entries.Range(func(key, value any) bool {
-		entries = append(entries, value.(*jsonIndexEntry)._marshalled)
-		return true
-	})
+	changes := J.changes
+	J.changes = indexChanges{}
 	J.m.Unlock()
 
 	onErr := func(err error) {
+		if err != nil {
+			J.m.Lock()
+			J.changes = changes.merge(J.changes)
+			J.m.Unlock()
+		}
 		for _, p := range promises {
 			p.Done(0, err)
 		}
 	}
 
-	f, err := os.Create(path.Join(J.idxPath, "metadata.json.bak"))
+	// metadata.json can be updated by other processes writing to the same partition,
+	// so the changes are applied to its latest version under the lock
+	lock, err := mergeUtils.LockFile(path.Join(J.idxPath, "metadata.json.lock"))
+	if err != nil {
+		onErr(err)
+		return
+	}
+	defer lock.Unlock()
+	latest := &JSONIndex{t: J.t, idxPath: J.idxPath, entries: &sync.Map{}}
+	err = latest.populate()
 	if err != nil {
 		onErr(err)
 		return
 	}
+	err = latest.apply(changes)
+	if err != nil {
+		onErr(err)
+		return
+	}
+	err = latest.write()
+	if err != nil {
+		onErr(err)
+		return
+	}
+
+	J.m.Lock()
+	err = J.reset(latest)
+	summary, _ := J.summary(J.partPath)
+	J.m.Unlock()
+	if err != nil {
+		onErr(err)
+		return
+	}
+	if J.t.Manifest != nil && J.partPath != "" {
+		J.t.Manifest.UpdatePartition(summary)
+	}
+	onErr(nil)
+}
+
+// Refresh reloads the index written by the other processes keeping the local changes not flushed yet
+func (J *JSONIndex) Refresh() error {
+	lock, err := mergeUtils.LockFile(path.Join(J.idxPath, "metadata.json.lock"))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	latest := &JSONIndex{t: J.t, idxPath: J.idxPath, entries: &sync.Map{}}
+	err = latest.populate()
+	if err != nil {
+		return err
+	}
+	J.m.Lock()
+	defer J.m.Unlock()
+	return J.reset(latest)
+}
+
+// reset replaces the state of the index with the latest one and applies the changes not flushed yet
+func (J *JSONIndex) reset(latest *JSONIndex) error {
+	state := &JSONIndex{
+		t:         J.t,
+		idxPath:   J.idxPath,
+		entries:   &sync.Map{},
+		dropQueue: append([]string{}, latest.dropQueue...),
+		lastId:    latest.lastId,
+	}
+	latest.entries.Range(func(key, value any) bool {
+		state.entries.Store(key, value)
+		return true
+	})
+	err := state.apply(J.changes)
+	if err != nil {
+		return err
+	}
+	J.entries = state.entries
+	J.dropQueue = state.dropQueue
+	J.recalcTotals()
+	J.lastId = max(J.lastId, state.lastId)
+	return nil
+}
+
+// apply applies the changes of another JSONIndex instance giving new ids to the added entries
+func (J *JSONIndex) apply(changes indexChanges) error {
+	for _, p := range changes.rm {
+		J.entries.Delete(p)
+	}
+	for _, e := range changes.add {
+		if _, ok := J.entries.Load(e.Path); ok {
+			continue
+		}
+		J.lastId++
+		_e := *e
+		_e.Id = J.lastId
+		_marshalled, err := json.Marshal(&_e)
+		if err != nil {
+			return err
+		}
+		_e._marshalled = string(_marshalled)
+		J.entries.Store(_e.Path, &_e)
+	}
+	dropped := make(map[string]bool, len(changes.dropRm))
+	for _, d := range changes.dropRm {
+		dropped[d] = true
+	}
+	dropQueue := J.dropQueue[:0]
+	for _, d := range J.dropQueue {
+		if !dropped[d] {
+			dropQueue = append(dropQueue, d)
+		}
+	}
+	queued := make(map[string]bool, len(dropQueue))
+	for _, d := range dropQueue {
+		queued[d] = true
+	}
+	for _, d := range changes.dropAdd {
+		if !queued[d] && !dropped[d] {
+			dropQueue = append(dropQueue, d)
+			queued[d] = true
+		}
+	}
+	J.dropQueue = dropQueue
+	J.recalcTotals()
+	return nil
+}
+
+func (J *JSONIndex) recalcTotals() {
+	J.rowCount, J.parquetSizeBytes, J.minTime, J.maxTime = 0, 0, 0, 0
+	first := true
+	J.entries.Range(func(key, value any) bool {
+		e := value.(*jsonIndexEntry)
+		J.rowCount += e.RowCount
+		J.parquetSizeBytes += e.SizeBytes
+		if first {
+			J.minTime, J.maxTime = e.MinTime, e.MaxTime
+			first = false
+			return true
+		}
+		J.minTime = min(J.minTime, e.MinTime)
+		J.maxTime = max(J.maxTime, e.MaxTime)
+		return true
+	})
+}
+
+func (J *JSONIndex) write() error {
+	f, err := os.Create(path.Join(J.idxPath, "metadata.json.bak"))
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
-	stream := jsoniter.NewStream(jsoniter.ConfigDefault, f, 4096)
+	err = J.writeTo(f)
+	if err != nil {
+		return err
+	}
+
+	// Rename the backup file to the actual metadata file
+	return os.Rename(path.Join(J.idxPath, "metadata.json.bak"), path.Join(J.idxPath, "metadata.json"))
+}
+
+func (J *JSONIndex) writeTo(w io.Writer) error {
+	var entries []string
+	J.entries.Range(func(key, value any) bool {
+		entries = append(entries, value.(*jsonIndexEntry)._marshalled)
+		return true
+	})
+
+	stream := jsoniter.NewStream(jsoniter.ConfigDefault, w, 4096)
 
 	// Start encoding the JSON structure
 	stream.WriteObjectStart()
@@ -349,19 +632,19 @@ func (J *JSONIndex) flush() {
 
 	stream.WriteMore()
 	stream.WriteObjectField("parquet_size_bytes")
-	stream.WriteInt64(parquetSizeBytes)
+	stream.WriteInt64(J.parquetSizeBytes)
 
 	stream.WriteMore()
 	stream.WriteObjectField("row_count")
-	stream.WriteInt64(rowCount)
+	stream.WriteInt64(J.rowCount)
 
 	stream.WriteMore()
 	stream.WriteObjectField("min_time")
-	stream.WriteInt64(minTime)
+	stream.WriteInt64(J.minTime)
 
 	stream.WriteMore()
 	stream.WriteObjectField("max_time")
-	stream.WriteInt64(maxTime)
+	stream.WriteInt64(J.maxTime)
 
 	stream.WriteMore()
 	stream.WriteObjectField("wal_sequence")
@@ -370,7 +653,7 @@ func (J *JSONIndex) flush() {
 	stream.WriteMore()
 	stream.WriteObjectField("drop_queue")
 	stream.WriteArrayStart()
-	for i, d := range dropQueue {
+	for i, d := range J.dropQueue {
 		if i > 0 {
 			stream.WriteMore()
 		}
@@ -395,24 +678,140 @@ func (J *JSONIndex) flush() {
 	stream.WriteObjectEnd()
 
 	if stream.Error != nil {
-		onErr(stream.Error)
-		return
+		return stream.Error
 	}
 
-	err = stream.Flush()
+	return stream.Flush()
+}
+
+// UnmarshalPartitionFiles reads the entries of the metadata.json of a partition
+func UnmarshalPartitionFiles(data []byte) ([]*shared.IndexEntry, error) {
+	idx := &JSONIndex{entries: &sync.Map{}}
+	err := idx.populateFrom(bytes.NewReader(data))
 	if err != nil {
-		onErr(err)
-		return
+		return nil, err
 	}
+	var res []*shared.IndexEntry
+	idx.entries.Range(func(key, value any) bool {
+		res = append(res, value.(*jsonIndexEntry).toIndexEntry())
+		return true
+	})
+	return res, nil
+}
 
-	// Rename the backup file to the actual metadata file
-	err = os.Rename(path.Join(J.idxPath, "metadata.json.bak"), path.Join(J.idxPath, "metadata.json"))
+// MarshalPartitionFiles returns the metadata.json of a partition with the entries
+func MarshalPartitionFiles(t *shared.Table, entries []*shared.IndexEntry) ([]byte, error) {
+	idx := &JSONIndex{t: t, entries: &sync.Map{}}
+	_entries, err := idx.entry2JEntry(entries)
 	if err != nil {
-		onErr(err)
-		return
+		return nil, err
 	}
+	idx.add(_entries)
+	idx.recalcTotals()
+	var buf bytes.Buffer
+	err = idx.writeTo(&buf)
+	return buf.Bytes(), err
+}
 
-	onErr(nil)
+// RebuildPartitionIndex regenerates the metadata.json of the partition from the footers
+// of its parquet files. The drop queue of the current index is kept if it's readable,
+// and its files are not indexed. The files with an unreadable footer are skipped and returned.
+func RebuildPartitionIndex(t *shared.Table, values [][2]string) ([]string, error) {
+	folders := make([]string, len(values)+1)
+	folders[0] = t.Path
+	for i, value := range values {
+		folders[i+1] = fmt.Sprintf("%s=%s", value[0], value[1])
+	}
+	idx := &JSONIndex{
+		t:        t,
+		idxPath:  path.Join(folders...),
+		partPath: path.Join(folders[1:]...),
+		entries:  &sync.Map{},
+	}
+	lock, err := mergeUtils.LockFile(path.Join(idx.idxPath, "metadata.json.lock"))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	current := &JSONIndex{idxPath: idx.idxPath, entries: &sync.Map{}}
+	if err := current.populate(); err != nil {
+		fmt.Printf("failed to read %s, the drop queue is lost: %v\n", path.Join(idx.idxPath, "metadata.json"), err)
+	} else {
+		idx.dropQueue = current.dropQueue
+	}
+	dropped := make(map[string]bool, len(idx.dropQueue))
+	for _, file := range idx.dropQueue {
+		if abs, err := filepath.Abs(file); err == nil {
+			dropped[abs] = true
+		}
+	}
+
+	files, err := os.ReadDir(idx.idxPath)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		entries []*shared.IndexEntry
+		skipped []string
+	)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".parquet") {
+			continue
+		}
+		abs, err := filepath.Abs(path.Join(idx.idxPath, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if dropped[abs] {
+			continue
+		}
+		entry, err := ReadParquetEntry(abs)
+		if err != nil {
+			skipped = append(skipped, abs)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	_entries, err := idx.entry2JEntry(entries)
+	if err != nil {
+		return nil, err
+	}
+	idx.add(_entries)
+	idx.recalcTotals()
+	err = idx.write()
+	if err != nil {
+		return nil, err
+	}
+	if t.Manifest != nil {
+		summary, _ := idx.summary(idx.partPath)
+		t.Manifest.UpdatePartition(summary)
+	}
+	return skipped, nil
+}
+
+// summary returns the aggregated index of the partition and the latest file of it
+func (J *JSONIndex) summary(partPath string) (shared.PartitionSummary, string) {
+	res := shared.PartitionSummary{
+		Path:             partPath,
+		ParquetSizeBytes: J.parquetSizeBytes,
+		RowCount:         J.rowCount,
+		MinTime:          J.minTime,
+		MaxTime:          J.maxTime,
+	}
+	var (
+		latest     string
+		latestTime int64
+	)
+	J.entries.Range(func(key, value any) bool {
+		e := value.(*jsonIndexEntry)
+		res.Files++
+		if latest == "" || e.ChunkTime > latestTime {
+			latest, latestTime = e.Path, e.ChunkTime
+		}
+		return true
+	})
+	return res, latest
 }
 
 func (J *JSONIndex) Run() {
@@ -434,17 +833,64 @@ func (J *JSONIndex) Stop() {
 }
 
 func (J *JSONIndex) Get(path string) *shared.IndexEntry {
-	e, _ := J.entries.Load(path)
+	J.m.RLock()
+	entries := J.entries
+	J.m.RUnlock()
+	e, _ := entries.Load(path)
 	if e == nil {
 		return nil
 	}
-	_e := e.(*jsonIndexEntry)
-	return &shared.IndexEntry{
-		Path:      _e.Path,
-		SizeBytes: _e.SizeBytes,
-		RowCount:  _e.RowCount,
-		ChunkTime: _e.ChunkTime,
-		Min:       map[string]any{"__timestamp": _e.MinTime},
-		Max:       map[string]any{"__timestamp": _e.MaxTime},
+	return e.(*jsonIndexEntry).toIndexEntry()
+}
+
+func (e *jsonIndexEntry) toIndexEntry() *shared.IndexEntry {
+	res := &shared.IndexEntry{
+		Path:        e.Path,
+		SizeBytes:   e.SizeBytes,
+		RowCount:    e.RowCount,
+		ChunkTime:   e.ChunkTime,
+		Min:         map[string]any{},
+		Max:         map[string]any{},
+		ColumnStats: e.ColumnStats,
 	}
+	if e.ColumnStats {
+		for k, v := range e.Min {
+			res.Min[k] = v
+		}
+		for k, v := range e.Max {
+			res.Max[k] = v
+		}
+	}
+	res.Min["__timestamp"] = e.MinTime
+	res.Max["__timestamp"] = e.MaxTime
+	return res
+}
+
+func (J *JSONIndex) Query(q *shared.IndexQuery) []*shared.IndexEntry {
+	J.m.RLock()
+	entries := J.entries
+	dropped := make(map[string]bool, len(J.dropQueue))
+	for _, file := range J.dropQueue {
+		dropped[file] = true
+		if abs, err := filepath.Abs(file); err == nil {
+			dropped[abs] = true
+		}
+	}
+	J.m.RUnlock()
+	var res []*shared.IndexEntry
+	entries.Range(func(key, value any) bool {
+		e := value.(*jsonIndexEntry)
+		if dropped[e.Path] {
+			return true
+		}
+		entry := e.toIndexEntry()
+		if q.Matches(entry) {
+			res = append(res, entry)
+		}
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Min["__timestamp"].(int64) < res[j].Min["__timestamp"].(int64)
+	})
+	return res
 }
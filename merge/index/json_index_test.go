@@ -0,0 +1,178 @@
+package index
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const (
+	testWriters        = 4
+	testFilesPerWriter = 20
+)
+
+var testPartition = [][2]string{{"date", "2025-04-10"}, {"hour", "14"}}
+
+// runIndexWriter is run by the child processes of TestJSONIndexMultiProcess
+func runIndexWriter(root string, writer string) error {
+	idx, err := NewJSONIndexForPartition(&shared.Table{Name: "t", Path: root}, testPartition)
+	if err != nil {
+		return err
+	}
+	idx.Run()
+	defer idx.Stop()
+	for i := 0; i < testFilesPerWriter; i++ {
+		_, err = idx.Batch([]*shared.IndexEntry{{
+			Path:     fmt.Sprintf("/%s-%d.1.parquet", writer, i),
+			RowCount: 1,
+			Min:      map[string]any{"__timestamp": int64(i)},
+			Max:      map[string]any{"__timestamp": int64(i)},
+		}}, nil).Get()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestJSONIndexMultiProcess(t *testing.T) {
+	if root := os.Getenv("GIGAPI_TEST_INDEX_ROOT"); root != "" {
+		err := runIndexWriter(root, os.Getenv("GIGAPI_TEST_INDEX_WRITER"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	root := t.TempDir()
+	partPath := filepath.Join(root, "date=2025-04-10", "hour=14")
+	if err := os.MkdirAll(partPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmds := make([]*exec.Cmd, testWriters)
+	for i := range cmds {
+		cmds[i] = exec.Command(os.Args[0], "-test.run=^TestJSONIndexMultiProcess$")
+		cmds[i].Env = append(os.Environ(),
+			"GIGAPI_TEST_INDEX_ROOT="+root,
+			"GIGAPI_TEST_INDEX_WRITER=w"+strconv.Itoa(i))
+		if err := cmds[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ReadPartitionFiles(partPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != testWriters*testFilesPerWriter {
+		t.Fatalf("expected %d files, got %d", testWriters*testFilesPerWriter, len(files))
+	}
+	idx, err := NewJSONIndexForPartition(&shared.Table{Name: "t", Path: root}, testPartition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[uint32]bool)
+	idx.(*JSONIndex).entries.Range(func(key, value any) bool {
+		ids[value.(*jsonIndexEntry).Id] = true
+		return true
+	})
+	if len(ids) != len(files) || idx.(*JSONIndex).rowCount != int64(len(files)) {
+		t.Fatalf("inconsistent index: %d ids, %d rows", len(ids), idx.(*JSONIndex).rowCount)
+	}
+}
+
+func TestCommitMergeIsFlushedAtOnce(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "date=2025-04-10", "hour=14"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_idx, err := NewJSONIndexForPartition(&shared.Table{Name: "t", Path: root}, testPartition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := _idx.(*JSONIndex)
+	entry := func(name string, rows int64) *shared.IndexEntry {
+		return &shared.IndexEntry{
+			Path:     "/" + name,
+			RowCount: rows,
+			Min:      map[string]any{"__timestamp": int64(1)},
+			Max:      map[string]any{"__timestamp": int64(2)},
+		}
+	}
+	idx.Batch([]*shared.IndexEntry{entry("a.1.parquet", 1), entry("b.1.parquet", 1)}, nil)
+	idx.flush()
+	sources := []string{"/a.1.parquet", "/b.1.parquet"}
+	prom := idx.CommitMerge(entry("c.2.parquet", 2), sources, sources)
+	idx.flush()
+	if _, err = prom.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := NewJSONIndexForPartition(&shared.Table{Name: "t", Path: root}, testPartition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Get("/c.2.parquet") == nil || latest.Get("/a.1.parquet") != nil || latest.Get("/b.1.parquet") != nil {
+		t.Fatal("the merge result and its sources are not flushed together")
+	}
+	if q := latest.GetDropQueue(); len(q) != 2 {
+		t.Fatalf("unexpected drop queue: %v", q)
+	}
+}
+
+func TestBatchRejectsInvalidTimestampStats(t *testing.T) {
+	idx, err := NewJSONIndexForPartition(&shared.Table{Name: "t", Path: t.TempDir()}, testPartition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = idx.Batch([]*shared.IndexEntry{{
+		Path:     "/a.1.parquet",
+		RowCount: 1,
+		Min:      map[string]any{"__timestamp": nil},
+		Max:      map[string]any{"__timestamp": float64(1)},
+	}}, nil).Get()
+	if err == nil || idx.Get("/a.1.parquet") != nil {
+		t.Fatalf("unexpected result: %v", err)
+	}
+}
+
+func TestMergeLockMultiProcess(t *testing.T) {
+	if lockFile := os.Getenv("GIGAPI_TEST_LOCK_FILE"); lockFile != "" {
+		lock, ok, err := mergeUtils.TryLockFile(lockFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			lock.Unlock()
+			t.Fatal("the lock held by another process was acquired")
+		}
+		return
+	}
+
+	lockFile := filepath.Join(t.TempDir(), "merge.lock")
+	lock, ok, err := mergeUtils.TryLockFile(lockFile)
+	if err != nil || !ok {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMergeLockMultiProcess$")
+	cmd.Env = append(os.Environ(), "GIGAPI_TEST_LOCK_FILE="+lockFile)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	lock.Unlock()
+	lock, ok, err = mergeUtils.TryLockFile(lockFile)
+	if err != nil || !ok {
+		t.Fatalf("the released lock is not acquired: %v", err)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,252 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/metadata"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/apache/arrow/go/v14/parquet/schema"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ValidateParquetFile checks that the footer of the parquet file is readable
+func ValidateParquetFile(fileName string) error {
+	rdr, err := file.OpenParquetFile(fileName, false)
+	if err != nil {
+		return err
+	}
+	return rdr.Close()
+}
+
+// ReadParquetEntry validates the footer of the parquet file and returns its index entry
+// with the min/max statistics of the row groups. ColumnStats is only set if the statistics
+// of all the columns are present, otherwise only the __timestamp range is filled.
+func ReadParquetEntry(fileName string) (*shared.IndexEntry, error) {
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	rdr, err := file.OpenParquetFile(abs, false)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	res := &shared.IndexEntry{
+		Path:        abs,
+		SizeBytes:   stat.Size(),
+		RowCount:    rdr.NumRows(),
+		ChunkTime:   stat.ModTime().UnixNano(),
+		Min:         map[string]any{},
+		Max:         map[string]any{},
+		ColumnStats: true,
+	}
+	fileSchema := rdr.MetaData().Schema
+	for i := 0; i < fileSchema.NumColumns(); i++ {
+		if fileSchema.Column(i).SchemaNode().Parent() != fileSchema.Root() {
+			// the leaves of the LIST, MAP and STRUCT columns aren't indexed
+			continue
+		}
+		name := fileSchema.Column(i).Path()
+		_min, _max, ok, err := readColumnStats(rdr, i)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", abs, err)
+		}
+		if !ok {
+			res.ColumnStats = false
+			continue
+		}
+		if _min != nil {
+			res.Min[name], res.Max[name] = _min, _max
+		}
+	}
+	if _, ok := res.Min["__timestamp"].(int64); !ok {
+		minTime, maxTime, err := readTimeColumn(rdr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", abs, err)
+		}
+		res.Min["__timestamp"], res.Max["__timestamp"] = minTime, maxTime
+	}
+	if !res.ColumnStats {
+		res.Min = map[string]any{"__timestamp": res.Min["__timestamp"]}
+		res.Max = map[string]any{"__timestamp": res.Max["__timestamp"]}
+	}
+	return res, nil
+}
+
+// readColumnStats merges the statistics of the column of all the row groups.
+// ok is false if the statistics are missing or of an unsupported type,
+// the nil min and max mean the column has no values.
+func readColumnStats(rdr *file.Reader, colIdx int) (_min any, _max any, ok bool, err error) {
+	col := rdr.MetaData().Schema.Column(colIdx)
+	unsigned := false
+	if lt, isInt := col.LogicalType().(*schema.IntLogicalType); isInt && !lt.IsSigned() {
+		unsigned = true
+	}
+	// the timestamps, dates and times are indexed in nanoseconds like their column values
+	unitNs := int64(0)
+	switch lt := col.LogicalType().(type) {
+	case interface{ TimeUnit() schema.TimeUnitType }:
+		unitNs = timeUnitNs(lt.TimeUnit())
+	case schema.DateLogicalType, *schema.DateLogicalType:
+		unitNs = int64(24 * time.Hour)
+	}
+	// the decimals are indexed as floats like the DECIMAL column statistics
+	decimal, _ := col.LogicalType().(*schema.DecimalLogicalType)
+	for i := 0; i < rdr.NumRowGroups(); i++ {
+		chunk, err := rdr.MetaData().RowGroup(i).ColumnChunk(colIdx)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if set, err := chunk.StatsSet(); err != nil || !set {
+			return nil, nil, false, err
+		}
+		stats, err := chunk.Statistics()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if !stats.HasMinMax() {
+			if stats.HasNullCount() && stats.NullCount() == chunk.NumValues() {
+				// only nulls in the row group
+				continue
+			}
+			return nil, nil, false, nil
+		}
+		var rgMin, rgMax any
+		switch s := stats.(type) {
+		case *metadata.Int64Statistics:
+			rgMin, rgMax = s.Min(), s.Max()
+			if decimal != nil {
+				rgMin, rgMax = decimalStat(int64(s.Min()), decimal), decimalStat(int64(s.Max()), decimal)
+			} else if unsigned {
+				rgMin, rgMax = uint64(s.Min()), uint64(s.Max())
+			} else if unitNs > 0 {
+				rgMin, rgMax = s.Min()*unitNs, s.Max()*unitNs
+			}
+		case *metadata.Int32Statistics:
+			switch {
+			case unitNs > 0:
+				rgMin, rgMax = int64(s.Min())*unitNs, int64(s.Max())*unitNs
+			case decimal != nil:
+				rgMin, rgMax = decimalStat(int64(s.Min()), decimal), decimalStat(int64(s.Max()), decimal)
+			case unsigned:
+				rgMin, rgMax = uint64(uint32(s.Min())), uint64(uint32(s.Max()))
+			default:
+				rgMin, rgMax = int64(s.Min()), int64(s.Max())
+			}
+		case *metadata.Float32Statistics:
+			rgMin, rgMax = float64(s.Min()), float64(s.Max())
+		case *metadata.Float64Statistics:
+			rgMin, rgMax = s.Min(), s.Max()
+		case *metadata.BooleanStatistics:
+			// the BOOLEAN columns aren't indexed
+			return nil, nil, true, nil
+		case *metadata.ByteArrayStatistics:
+			switch col.LogicalType().(type) {
+			case schema.StringLogicalType, schema.JSONLogicalType:
+			case schema.NoLogicalType:
+				// the BLOB columns aren't indexed
+				return nil, nil, true, nil
+			default:
+				return nil, nil, false, nil
+			}
+			rgMin, rgMax = string(s.Min()), string(s.Max())
+		case *metadata.FixedLenByteArrayStatistics:
+			if _, ok := col.LogicalType().(schema.UUIDLogicalType); !ok {
+				return nil, nil, false, nil
+			}
+			minUUID, err := uuid.FromBytes(s.Min())
+			if err != nil {
+				return nil, nil, false, nil
+			}
+			maxUUID, err := uuid.FromBytes(s.Max())
+			if err != nil {
+				return nil, nil, false, nil
+			}
+			rgMin, rgMax = minUUID.String(), maxUUID.String()
+		default:
+			return nil, nil, false, nil
+		}
+		if _min == nil {
+			_min, _max = rgMin, rgMax
+			continue
+		}
+		if c, _ := shared.CompareStats(rgMin, _min); c < 0 {
+			_min = rgMin
+		}
+		if c, _ := shared.CompareStats(rgMax, _max); c > 0 {
+			_max = rgMax
+		}
+	}
+	return _min, _max, true, nil
+}
+
+func decimalStat(v int64, decimal *schema.DecimalLogicalType) float64 {
+	return data_types.Decimal{Value: v, Scale: decimal.Scale()}.Float64()
+}
+
+func timeUnitNs(unit schema.TimeUnitType) int64 {
+	switch unit {
+	case schema.TimeUnitMillis:
+		return int64(time.Millisecond)
+	case schema.TimeUnitMicros:
+		return int64(time.Microsecond)
+	}
+	return 1
+}
+
+func readTimeColumn(rdr *file.Reader) (int64, int64, error) {
+	fr, err := pqarrow.NewFileReader(rdr, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		return 0, 0, err
+	}
+	schema, err := fr.Schema()
+	if err != nil {
+		return 0, 0, err
+	}
+	fieldIdx := schema.FieldIndices("__timestamp")
+	if len(fieldIdx) == 0 {
+		return 0, 0, fmt.Errorf("no __timestamp column")
+	}
+	col, err := fr.GetColumn(context.Background(), fieldIdx[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	chunked, err := col.NextBatch(rdr.NumRows())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer chunked.Release()
+	var (
+		minTime, maxTime int64
+		found            bool
+	)
+	for _, chunk := range chunked.Chunks() {
+		values, err := data_types.FromArrowArray(chunk)
+		if err != nil {
+			return 0, 0, err
+		}
+		ts, ok := values.([]int64)
+		if !ok {
+			return 0, 0, fmt.Errorf("unsupported __timestamp type %s", chunk.DataType())
+		}
+		for _, t := range ts {
+			if !found {
+				minTime, maxTime, found = t, t, true
+				continue
+			}
+			minTime, maxTime = min(minTime, t), max(maxTime, t)
+		}
+	}
+	return minTime, maxTime, nil
+}
@@ -0,0 +1,340 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestFileName is the name of the table level manifest stored in the table root
+const ManifestFileName = "manifest.json"
+
+// JSONTableManifest aggregates the partition indexes of a table into the manifest.json
+// of the table root. It's updated by the partition indexes after every flush.
+type JSONTableManifest struct {
+	t *shared.Table
+
+	m          sync.Mutex
+	partitions map[string]shared.PartitionSummary
+	// partitions updated since the last flush
+	dirty     map[string]bool
+	schema    map[string]string
+	updatedAt int64
+
+	updateCtx context.Context
+	doUpdate  context.CancelFunc
+	workCtx   context.Context
+	stop      context.CancelFunc
+}
+
+// NewJSONTableManifest loads the manifest of the table.
+// A missing manifest is rebuilt once from the partition indexes.
+func NewJSONTableManifest(t *shared.Table) (*JSONTableManifest, error) {
+	res := &JSONTableManifest{
+		t:          t,
+		partitions: make(map[string]shared.PartitionSummary),
+		dirty:      make(map[string]bool),
+		schema:     make(map[string]string),
+	}
+	res.updateCtx, res.doUpdate = context.WithCancel(context.Background())
+	res.workCtx, res.stop = context.WithCancel(context.Background())
+
+	manifest, err := ReadTableManifest(t.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		manifest, err = RebuildTableManifest(t)
+		if err == nil && len(manifest.Partitions) > 0 {
+			// the table was written before the manifest was introduced
+			for _, p := range manifest.Partitions {
+				res.dirty[p.Path] = true
+			}
+			res.doUpdate()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range manifest.Partitions {
+		res.partitions[p.Path] = p
+	}
+	for k, v := range manifest.Schema {
+		res.schema[k] = v
+	}
+	res.updatedAt = manifest.UpdatedAt
+	return res, nil
+}
+
+func (M *JSONTableManifest) UpdatePartition(summary shared.PartitionSummary) {
+	M.m.Lock()
+	defer M.m.Unlock()
+	M.dirty[summary.Path] = true
+	if summary.Files == 0 {
+		if _, ok := M.partitions[summary.Path]; !ok {
+			return
+		}
+		delete(M.partitions, summary.Path)
+	} else {
+		M.partitions[summary.Path] = summary
+	}
+	M.updatedAt = time.Now().UnixNano()
+	M.doUpdate()
+}
+
+func (M *JSONTableManifest) UpdateSchema(schema map[string]string) {
+	M.m.Lock()
+	defer M.m.Unlock()
+	updated := false
+	for k, v := range schema {
+		if M.schema[k] != v {
+			M.schema[k] = v
+			updated = true
+		}
+	}
+	if updated {
+		M.updatedAt = time.Now().UnixNano()
+		M.doUpdate()
+	}
+}
+
+func (M *JSONTableManifest) Get() *shared.TableManifest {
+	M.m.Lock()
+	defer M.m.Unlock()
+	partitions := make([]shared.PartitionSummary, 0, len(M.partitions))
+	for _, p := range M.partitions {
+		partitions = append(partitions, p)
+	}
+	schema := make(map[string]string, len(M.schema))
+	for k, v := range M.schema {
+		schema[k] = v
+	}
+	return NewTableManifest(M.t, partitions, schema, M.updatedAt)
+}
+
+// NewTableManifest builds the manifest of the table from the summaries of its partitions
+func NewTableManifest(t *shared.Table, partitions []shared.PartitionSummary,
+	schema map[string]string, updatedAt int64) *shared.TableManifest {
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Path < partitions[j].Path
+	})
+	res := &shared.TableManifest{
+		Database:   t.Database,
+		Table:      t.Name,
+		Engine:     t.Engine,
+		OrderBy:    t.OrderBy,
+		Schema:     schema,
+		Partitions: partitions,
+		UpdatedAt:  updatedAt,
+	}
+	if t.Partitioning != nil {
+		res.PartitionBy = t.Partitioning.String()
+	}
+	for i, p := range partitions {
+		res.ParquetSizeBytes += p.ParquetSizeBytes
+		res.RowCount += p.RowCount
+		if i == 0 {
+			res.MinTime, res.MaxTime = p.MinTime, p.MaxTime
+			continue
+		}
+		res.MinTime = min(res.MinTime, p.MinTime)
+		res.MaxTime = max(res.MaxTime, p.MaxTime)
+	}
+	return res
+}
+
+// Flush writes the partitions updated since the last flush to the manifest.json
+func (M *JSONTableManifest) Flush() {
+	M.m.Lock()
+	M.updateCtx, M.doUpdate = context.WithCancel(context.Background())
+	dirty := M.dirty
+	M.dirty = make(map[string]bool)
+	M.m.Unlock()
+	err := M.write(dirty)
+	if err != nil {
+		M.m.Lock()
+		for p := range dirty {
+			M.dirty[p] = true
+		}
+		M.m.Unlock()
+		fmt.Printf("failed to write the manifest of table %s.%s: %v\n", M.t.Database, M.t.Name, err)
+	}
+}
+
+// write updates the partitions changed by this process in the latest manifest,
+// as the other processes writing to the table update it as well
+func (M *JSONTableManifest) write(dirty map[string]bool) error {
+	lock, err := mergeUtils.LockFile(path.Join(M.t.Path, ManifestFileName+".lock"))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	latest, err := ReadTableManifest(M.t.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		latest, err = &shared.TableManifest{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	M.m.Lock()
+	partitions := make(map[string]shared.PartitionSummary, len(latest.Partitions))
+	for _, p := range latest.Partitions {
+		partitions[p.Path] = p
+	}
+	for p := range dirty {
+		delete(partitions, p)
+		if summary, ok := M.partitions[p]; ok {
+			partitions[p] = summary
+		}
+	}
+	schema := make(map[string]string, len(latest.Schema))
+	for k, v := range latest.Schema {
+		schema[k] = v
+	}
+	for k, v := range M.schema {
+		schema[k] = v
+	}
+	// the partitions changed after the flush started stay in the local version
+	for p := range M.dirty {
+		if summary, ok := M.partitions[p]; ok {
+			partitions[p] = summary
+		} else {
+			delete(partitions, p)
+		}
+	}
+	M.partitions = partitions
+	M.schema = schema
+	M.updatedAt = max(M.updatedAt, latest.UpdatedAt)
+	M.m.Unlock()
+
+	return writeTableManifest(M.t.Path, M.Get())
+}
+
+func (M *JSONTableManifest) Run() {
+	go func() {
+		for {
+			// Flush is called outside of the loop as well and replaces the context
+			M.m.Lock()
+			updated := M.updateCtx.Done()
+			M.m.Unlock()
+			select {
+			case <-updated:
+				M.Flush()
+			case <-M.workCtx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (M *JSONTableManifest) Stop() {
+	M.stop()
+}
+
+func writeTableManifest(tablePath string, manifest *shared.TableManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path.Join(tablePath, ManifestFileName+".bak"), data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path.Join(tablePath, ManifestFileName+".bak"), path.Join(tablePath, ManifestFileName))
+}
+
+// ReadTableManifest reads the manifest.json of the table folder
+func ReadTableManifest(tablePath string) (*shared.TableManifest, error) {
+	data, err := os.ReadFile(path.Join(tablePath, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	res := &shared.TableManifest{}
+	err = json.Unmarshal(data, res)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path.Join(tablePath, ManifestFileName), err)
+	}
+	return res, nil
+}
+
+// RebuildTableManifest builds the manifest of the table by walking its partition indexes.
+// The schema is read from the footer of the latest file of every partition.
+func RebuildTableManifest(t *shared.Table) (*shared.TableManifest, error) {
+	var partitions []shared.PartitionSummary
+	schema := make(map[string]string)
+	err := filepath.WalkDir(t.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == t.Path {
+			return nil
+		}
+		rel, err := filepath.Rel(t.Path, p)
+		if err != nil {
+			return err
+		}
+		if _, err := shared.ParsePartitionPath(rel); err != nil {
+			// tmp, data and other service folders
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(path.Join(p, "metadata.json")); err != nil {
+			return nil
+		}
+		idx := &JSONIndex{t: t, idxPath: p, entries: &sync.Map{}}
+		err = idx.populate()
+		if err != nil {
+			return err
+		}
+		summary, latest := idx.summary(filepath.ToSlash(rel))
+		if summary.Files == 0 {
+			return nil
+		}
+		partitions = append(partitions, summary)
+		if latest == "" {
+			return nil
+		}
+		fileSchema, err := readParquetSchema(latest)
+		if err != nil {
+			fmt.Printf("failed to read the schema of %s: %v\n", latest, err)
+			return nil
+		}
+		for k, v := range fileSchema {
+			schema[k] = v
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewTableManifest(t, partitions, schema, time.Now().UnixNano()), nil
+}
+
+func readParquetSchema(fileName string) (map[string]string, error) {
+	rdr, err := file.OpenParquetFile(fileName, false)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	schema, err := data_types.FromParquetSchema(rdr.MetaData())
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(schema.Fields()))
+	for _, f := range schema.Fields() {
+		res[f.Name] = data_types.TypeNameFromArrow(f.Type)
+	}
+	return res, nil
+}
@@ -1,9 +1,12 @@
 package merge
 
 import (
+	"fmt"
 	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/flight"
 	"github.com/gigapi/gigapi/v2/merge/handlers"
 	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/shared"
 	"github.com/gigapi/gigapi/v2/merge/utils"
 	"github.com/gigapi/gigapi/v2/modules"
 	"net/http"
@@ -11,11 +14,15 @@ import (
 )
 
 func Init(api modules.Api) {
-	err := os.MkdirAll(config.Config.Gigapi.Root, 0750)
+	err := validatePartitionSchemes()
 	if err != nil {
 		panic(err)
 	}
-	conn, cancel, err := utils.ConnectDuckDB(config.Config.Gigapi.Root + "/ddb.db")
+	err = os.MkdirAll(config.Get().Gigapi.Root, 0750)
+	if err != nil {
+		panic(err)
+	}
+	conn, cancel, err := utils.ConnectDuckDB(config.Get().Gigapi.Root + "/ddb.db")
 	if err != nil {
 		panic(err)
 	}
@@ -31,16 +38,116 @@ func Init(api modules.Api) {
 		panic(err)
 	}
 
+	if !config.Get().Gigapi.NoStartupCheck {
+		err = repository.CheckOnStart()
+		if err != nil {
+			fmt.Println("startup check failed:", err)
+		}
+	}
+
 	err = repository.InitRegistry(conn)
 	if err != nil {
 		panic(err)
 	}
 
 	InitHandlers(api)
+
+	if config.Get().FlightPort != 0 {
+		addr := fmt.Sprintf("%s:%d", config.Get().Host, config.Get().FlightPort)
+		if _, err = flight.Start(addr); err != nil {
+			panic(err)
+		}
+		fmt.Printf("GigAPI Flight SQL Running: %s\n", addr)
+	}
+}
+
+// validatePartitionSchemes checks the partition schemes of the configuration
+func validatePartitionSchemes() error {
+	_, err := shared.ParsePartitionScheme(config.Get().Gigapi.PartitionBy)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: gigapi.partition_by: %w", err)
+	}
+	for i, t := range config.Get().Gigapi.Tables {
+		if t.PartitionBy == "" {
+			continue
+		}
+		_, err = shared.ParsePartitionScheme(t.PartitionBy)
+		if err != nil {
+			return fmt.Errorf("invalid configuration: gigapi.tables[%d].partition_by: %w", i, err)
+		}
+	}
+	return nil
 }
 
 func InitHandlers(api modules.Api) {
 	handlers.API = api
+	if config.Get().Gigapi.AcceptsWrites() {
+		initWriteHandlers(api)
+	}
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/query",
+		Methods: []string{"POST"},
+		Handler: handlers.QueryHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/files/{db}/{table}",
+		Methods: []string{"GET"},
+		Handler: handlers.ListFilesHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/tables/{db}",
+		Methods: []string{"GET"},
+		Handler: handlers.ListTablesHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/tables/{db}/{table}",
+		Methods: []string{"GET"},
+		Handler: handlers.DescribeTableHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/export/{db}",
+		Methods: []string{"POST"},
+		Handler: handlers.ExportHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/check/{db}",
+		Methods: []string{"POST"},
+		Handler: handlers.CheckHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/buffers",
+		Methods: []string{"GET"},
+		Handler: handlers.BufferStatsHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/config",
+		Methods: []string{"GET"},
+		Handler: handlers.ConfigHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/health",
+		Methods: []string{"GET"},
+		Handler: func(w http.ResponseWriter, r *http.Request) error {
+			response := `{"checks": [], "commit": "null-commit", "message": "Service is healthy", "name": "GigAPI", "status": "pass", "version": "0.0.0"}`
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(response + "\n"))
+			return nil
+		},
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/ping",
+		Methods: []string{"GET"},
+		Handler: func(w http.ResponseWriter, r *http.Request) error {
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		},
+	})
+
+}
+
+// initWriteHandlers registers the endpoints creating tables and ingesting data
+func initWriteHandlers(api modules.Api) {
 	api.RegisterRoute(&modules.Route{
 		Path:    "/gigapi/create",
 		Methods: []string{"POST"},
@@ -63,6 +170,17 @@ func InitHandlers(api modules.Api) {
 		Handler: handlers.InsertIntoHandler,
 	})
 
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/import/{db}/{table}",
+		Methods: []string{"POST"},
+		Handler: handlers.ImportHandler,
+	})
+	api.RegisterRoute(&modules.Route{
+		Path:    "/gigapi/restore",
+		Methods: []string{"POST"},
+		Handler: handlers.RestoreHandler,
+	})
+
 	// InfluxDB 2+3 compatibility endpoints
 	api.RegisterRoute(&modules.Route{
 		Path:    "/write",
@@ -79,24 +197,4 @@ func InitHandlers(api modules.Api) {
 		Methods: []string{"POST"},
 		Handler: handlers.InsertIntoHandler,
 	})
-	api.RegisterRoute(&modules.Route{
-		Path:    "/health",
-		Methods: []string{"GET"},
-		Handler: func(w http.ResponseWriter, r *http.Request) error {
-			response := `{"checks": [], "commit": "null-commit", "message": "Service is healthy", "name": "GigAPI", "status": "pass", "version": "0.0.0"}`
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(response + "\n"))
-			return nil
-		},
-	})
-	api.RegisterRoute(&modules.Route{
-		Path:    "/ping",
-		Methods: []string{"GET"},
-		Handler: func(w http.ResponseWriter, r *http.Request) error {
-			w.WriteHeader(http.StatusNoContent)
-			return nil
-		},
-	})
-
 }
@@ -14,14 +14,14 @@ func TestMerge(t *testing.T) {
 	cwd, _ := os.Getwd()
 	cwd = path.Join(cwd, "..", "_data")
 
-	config.Config = &config.Configuration{
+	config.Set(&config.Configuration{
 		Gigapi: config.GigapiConfiguration{
 			Root:          cwd,
 			MergeTimeoutS: 10,
 			SaveTimeoutS:  1,
 			Secret:        "XXXXXX",
 		},
-	}
+	})
 	Init()
 
 	var p [2]utils.Promise[int32]
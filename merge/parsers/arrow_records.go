@@ -0,0 +1,152 @@
+package parsers
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+)
+
+// recordToData converts the arrow record into the column data of the rows.
+// The columns having nulls are data_types.Nullable. The rows with a null timestamp are split
+// into a separate batch without __timestamp.
+// The timeColumn (if not empty) is copied to the __timestamp column.
+// The timestamp, date, time, JSON and nested columns keep their types as data_types.TypedData,
+// the types are taken from the schema if it's not nil.
+func recordToData(rec arrow.Record, schema *arrow.Schema, timeColumn string) ([]map[string]any, error) {
+	if schema == nil {
+		schema = rec.Schema()
+	}
+	n := int(rec.NumRows())
+	if n == 0 {
+		return nil, nil
+	}
+	res := make(map[string]any, rec.NumCols()+1)
+	arrs := rec.Columns()
+	var tsArr arrow.Array
+	for i, field := range schema.Fields() {
+		data, err := data_types.FromArrowArray(arrs[i])
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", field.Name, err)
+		}
+		if typeName := data_types.TypeNameFromArrow(field.Type); field.Name != "__timestamp" && isTypedColumn(typeName) {
+			data = data_types.TypedData{Type: typeName, Data: data}
+		}
+		if arrs[i].NullN() > 0 {
+			data = data_types.Nullable{Data: data, Valid: validityBitmap(arrs[i])}
+		}
+		if field.Name == "__timestamp" {
+			tsArr = arrs[i]
+		}
+		res[field.Name] = data
+	}
+	if timeColumn != "" && timeColumn != "__timestamp" {
+		idx := rec.Schema().FieldIndices(timeColumn)
+		if len(idx) == 0 {
+			return nil, fmt.Errorf("time column %q not found", timeColumn)
+		}
+		ts := res[timeColumn]
+		if nullable, ok := ts.(data_types.Nullable); ok {
+			ts = nullable.Data
+		}
+		if typed, ok := ts.(data_types.TypedData); ok && data_types.IsTimestampType(typed.Type) {
+			ts = typed.Data
+		}
+		if _, ok := ts.([]int64); !ok {
+			return nil, fmt.Errorf("time column %q should be an integer or a timestamp", timeColumn)
+		}
+		tsArr = arrs[idx[0]]
+		res["__timestamp"] = ts
+	}
+	if tsArr == nil || tsArr.NullN() == 0 {
+		return []map[string]any{res}, nil
+	}
+
+	var timed, untimed []int
+	for row := 0; row < n; row++ {
+		if tsArr.IsValid(row) {
+			timed = append(timed, row)
+		} else {
+			untimed = append(untimed, row)
+		}
+	}
+	var batches []map[string]any
+	for _, rows := range [][]int{timed, untimed} {
+		if len(rows) == 0 {
+			continue
+		}
+		data := make(map[string]any, len(res))
+		for name, column := range res {
+			data[name] = selectRows(column, rows)
+		}
+		if !tsArr.IsValid(rows[0]) {
+			delete(data, "__timestamp")
+		}
+		batches = append(batches, data)
+	}
+	return batches, nil
+}
+
+// validityBitmap returns the validity bitmap of the rows of the array
+func validityBitmap(arr arrow.Array) []byte {
+	var res []byte
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsValid(i) {
+			res = data_types.SetValid(res, i)
+		}
+	}
+	return append(res, make([]byte, (arr.Len()+7)/8-len(res))...)
+}
+
+// isTypedColumn reports if the column type can't be told from its Go values.
+// The narrow integers and floats are widened to INT8, UBIGINT and FLOAT8.
+// The columns of the unknown types, e.g. the lists of 128-bit decimals, are typed after their values.
+func isTypedColumn(typeName string) bool {
+	switch typeName {
+	case data_types.DATA_TYPE_NAME_INT64, data_types.DATA_TYPE_NAME_UINT64, data_types.DATA_TYPE_NAME_FLOAT64,
+		data_types.DATA_TYPE_NAME_STRING, data_types.DATA_TYPE_NAME_UNKNOWN,
+		data_types.DATA_TYPE_NAME_INT8, data_types.DATA_TYPE_NAME_INT16, data_types.DATA_TYPE_NAME_INT32,
+		data_types.DATA_TYPE_NAME_UINT8, data_types.DATA_TYPE_NAME_UINT16, data_types.DATA_TYPE_NAME_UINT32,
+		data_types.DATA_TYPE_NAME_FLOAT32:
+		return false
+	}
+	return true
+}
+
+func selectRowsOf[T any](data []T, rows []int) []T {
+	res := make([]T, len(rows))
+	for i, row := range rows {
+		res[i] = data[row]
+	}
+	return res
+}
+
+func selectRows(data any, rows []int) any {
+	switch _data := data.(type) {
+	case data_types.TypedData:
+		return data_types.TypedData{Type: _data.Type, Data: selectRows(_data.Data, rows)}
+	case data_types.Nullable:
+		var valid []byte
+		for i, row := range rows {
+			if _data.IsValid(row) {
+				valid = data_types.SetValid(valid, i)
+			}
+		}
+		valid = append(valid, make([]byte, (len(rows)+7)/8-len(valid))...)
+		return data_types.Nullable{Data: selectRows(_data.Data, rows), Valid: valid}
+	case []int64:
+		return selectRowsOf(_data, rows)
+	case []uint64:
+		return selectRowsOf(_data, rows)
+	case []float64:
+		return selectRowsOf(_data, rows)
+	case []string:
+		return selectRowsOf(_data, rows)
+	case []any:
+		return selectRowsOf(_data, rows)
+	case []data_types.Decimal:
+		return selectRowsOf(_data, rows)
+	case data_types.DictStrings:
+		return data_types.DictStrings{Dict: _data.Dict, Keys: selectRowsOf(_data.Keys, rows)}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package parsers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"io"
+	"strings"
+)
+
+// ArrowStreamParser reads the record batches of an Arrow IPC stream into the table of the "table"
+// context value (`db.table` or `table`). Each record batch is a batch of the table, its columns keep
+// the types of the schema. The rows are timestamped with the column of the "time_column" context value,
+// or with the `__timestamp` or `time` column. Integer timestamps are nanoseconds.
+type ArrowStreamParser struct {
+}
+
+func (a *ArrowStreamParser) Parse(data []byte) (chan *ParserResponse, error) {
+	return a.ParseReader(nil, bytes.NewReader(data))
+}
+
+func (a *ArrowStreamParser) ParseReader(ctx context.Context, r io.Reader) (chan *ParserResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	table, _ := ctx.Value("table").(string)
+	if table == "" {
+		return nil, fmt.Errorf("the table of the Arrow stream is not set")
+	}
+	database := ""
+	if strings.Contains(table, ".") {
+		database, table, _ = strings.Cut(table, ".")
+	}
+
+	rdr, err := ipc.NewReader(r, ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Arrow stream: %w", err)
+	}
+	return a.parseRecords(ctx, database, table, rdr), nil
+}
+
+// ParseRecords reads the records of the reader into the table of the "table" context value
+// as ParseReader does, e.g. the records of an Arrow Flight stream. The reader is released.
+func (a *ArrowStreamParser) ParseRecords(ctx context.Context, rdr array.RecordReader) (chan *ParserResponse, error) {
+	table, _ := ctx.Value("table").(string)
+	if table == "" {
+		rdr.Release()
+		return nil, fmt.Errorf("the table of the Arrow stream is not set")
+	}
+	database := ""
+	if strings.Contains(table, ".") {
+		database, table, _ = strings.Cut(table, ".")
+	}
+	return a.parseRecords(ctx, database, table, rdr), nil
+}
+
+func (a *ArrowStreamParser) parseRecords(ctx context.Context, database string, table string,
+	rdr array.RecordReader) chan *ParserResponse {
+	timeColumn, _ := ctx.Value("time_column").(string)
+	if timeColumn == "" {
+		for _, name := range []string{"__timestamp", "time"} {
+			if len(rdr.Schema().FieldIndices(name)) > 0 {
+				timeColumn = name
+				break
+			}
+		}
+	}
+
+	res := make(chan *ParserResponse)
+	go func() {
+		defer close(res)
+		defer rdr.Release()
+		for rdr.Next() {
+			batches, err := recordToData(rdr.Record(), nil, timeColumn)
+			if err != nil {
+				res <- &ParserResponse{Error: err}
+				return
+			}
+			for _, data := range batches {
+				res <- &ParserResponse{Database: database, Table: table, Data: data}
+			}
+		}
+		if err := rdr.Err(); err != nil && err != io.EOF {
+			res <- &ParserResponse{Error: fmt.Errorf("invalid Arrow stream: %w", err)}
+		}
+	}()
+	return res
+}
+
+func init() {
+	RegisterParser("application/vnd.apache.arrow.stream", func(fieldNames []string, fieldTypes []string) IParser {
+		return &ArrowStreamParser{}
+	})
+}
@@ -0,0 +1,83 @@
+package parsers
+
+import (
+	"bytes"
+	"context"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"testing"
+)
+
+func TestArrowStreamParser(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Millisecond}},
+		{Name: "host", Type: &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int8, ValueType: arrow.BinaryTypes.String}},
+		{Name: "usage", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "count", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for batch := 0; batch < 2; batch++ {
+		b.Field(0).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1000, 2000}, nil)
+		host := b.Field(1).(*array.BinaryDictionaryBuilder)
+		host.AppendString("a")
+		host.AppendString("b")
+		b.Field(2).(*array.Float64Builder).AppendValues([]float64{0.5, 0}, []bool{true, false})
+		b.Field(3).(*array.Int64Builder).AppendValues([]int64{int64(batch), 7}, nil)
+		rec := b.NewRecord()
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		rec.Release()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), "table", "mydb.metrics")
+	res, err := (&ArrowStreamParser{}).ParseReader(ctx, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batches []map[string]any
+	for r := range res {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		if r.Database != "mydb" || r.Table != "metrics" {
+			t.Fatalf("unexpected table %q.%q", r.Database, r.Table)
+		}
+		batches = append(batches, r.Data)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("expected a batch per record, got %v", batches)
+	}
+	data := batches[1]
+	if ts := data["__timestamp"].([]int64); len(ts) != 2 || ts[1] != 2000000000 {
+		t.Fatalf("unexpected __timestamp %v", ts)
+	}
+	host := data["host"].(data_types.TypedData)
+	if dict := host.Data.(data_types.DictStrings); host.Type != data_types.DATA_TYPE_NAME_LOW_CARDINALITY ||
+		dict.Dict[dict.Keys[1]] != "b" {
+		t.Fatalf("unexpected host %v", host)
+	}
+	usage := data["usage"].(data_types.Nullable)
+	if values := usage.Data.([]float64); values[0] != 0.5 || !usage.IsValid(0) || usage.IsValid(1) {
+		t.Fatalf("unexpected usage %v", usage)
+	}
+	if count := data["count"].([]int64); count[0] != 1 || count[1] != 7 {
+		t.Fatalf("unexpected count %v", count)
+	}
+
+	if _, err = (&ArrowStreamParser{}).Parse([]byte("not arrow")); err == nil {
+		t.Fatal("expected an error without the table")
+	}
+	if _, err = (&ArrowStreamParser{}).ParseReader(ctx, bytes.NewReader([]byte("not arrow"))); err == nil {
+		t.Fatal("expected an error for an invalid stream")
+	}
+}
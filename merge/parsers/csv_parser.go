@@ -0,0 +1,261 @@
+package parsers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVParser reads the rows of a CSV file, or TSV if the Comma is a tab, into the table
+// of the "table" context value (`db.table` or `table`). The first row names the columns.
+// The columns are typed by the fields of the parser, the other ones are INT8, FLOAT8 or VARCHAR
+// after the values of the first batch. Empty values are nulls.
+// The rows are timestamped with the column of the "time_column" context value, or the `__timestamp`
+// or `time` column: integers are scaled by the "precision", the other values are parsed
+// with the "time_format" layout (RFC3339 by default).
+type CSVParser struct {
+	Comma  rune
+	fields map[string]string
+}
+
+const csvBatchBytes = 10 * 1024 * 1024
+
+func (c *CSVParser) Parse(data []byte) (chan *ParserResponse, error) {
+	return c.ParseReader(nil, bytes.NewReader(data))
+}
+
+func (c *CSVParser) ParseReader(ctx context.Context, r io.Reader) (chan *ParserResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	table, _ := ctx.Value("table").(string)
+	if table == "" {
+		return nil, fmt.Errorf("the table of the CSV rows is not set")
+	}
+	database := ""
+	if strings.Contains(table, ".") {
+		database, table, _ = strings.Cut(table, ".")
+	}
+
+	reader := csv.NewReader(r)
+	if c.Comma != 0 {
+		reader.Comma = c.Comma
+	}
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("the header row is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		if name == "" {
+			return nil, fmt.Errorf("the name of the column %d is empty", i+1)
+		}
+	}
+
+	timeColumn, _ := ctx.Value("time_column").(string)
+	timeIdx := slices.Index(header, timeColumn)
+	if timeColumn != "" && timeIdx < 0 {
+		return nil, fmt.Errorf("time column %q not found", timeColumn)
+	}
+	if timeColumn == "" {
+		if timeIdx = slices.Index(header, "__timestamp"); timeIdx < 0 {
+			timeIdx = slices.Index(header, "time")
+		}
+	}
+	precision, _ := ctx.Value("precision").(string)
+	timeFormat, _ := ctx.Value("time_format").(string)
+	if timeFormat == "" {
+		timeFormat = time.RFC3339Nano
+	}
+	batch := &csvBatch{
+		header:     header,
+		timeIdx:    timeIdx,
+		scale:      precisionNs(precision),
+		timeFormat: timeFormat,
+	}
+
+	res := make(chan *ParserResponse)
+	go func() {
+		defer close(res)
+		var bytesParsed int
+		send := func() error {
+			data, err := batch.data(c.fields)
+			if err != nil {
+				return err
+			}
+			res <- &ParserResponse{Database: database, Table: table, Data: data}
+			batch.rows, batch.lines, bytesParsed = nil, nil, 0
+			return nil
+		}
+		for {
+			row, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				res <- &ParserResponse{Error: err}
+				return
+			}
+			line, _ := reader.FieldPos(0)
+			batch.rows = append(batch.rows, row)
+			batch.lines = append(batch.lines, line)
+			for _, v := range row {
+				bytesParsed += len(v) + 1
+			}
+			if bytesParsed >= csvBatchBytes {
+				if err = send(); err != nil {
+					res <- &ParserResponse{Error: err}
+					return
+				}
+			}
+		}
+		if len(batch.rows) > 0 {
+			if err := send(); err != nil {
+				res <- &ParserResponse{Error: err}
+			}
+		}
+	}()
+	return res, nil
+}
+
+// csvBatch collects the rows of a batch, the types of the columns are kept for the next batches
+type csvBatch struct {
+	header     []string
+	types      []string
+	timeIdx    int
+	scale      int64
+	timeFormat string
+	rows       [][]string
+	// the line numbers of the rows for the errors
+	lines []int
+}
+
+// inferCSVType returns INT8 or FLOAT8 if all the values are numbers, VARCHAR otherwise
+func inferCSVType(values []string) string {
+	res := data_types.DATA_TYPE_NAME_INT64
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		if res == data_types.DATA_TYPE_NAME_INT64 {
+			if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+				continue
+			}
+			res = data_types.DATA_TYPE_NAME_FLOAT64
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return data_types.DATA_TYPE_NAME_STRING
+		}
+	}
+	return res
+}
+
+// parseCSVTimestamp parses the integer timestamp scaled by the precision or the time of the layout
+func parseCSVTimestamp(v string, scale int64, layout string) (int64, error) {
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ts * scale, nil
+	}
+	t, err := time.Parse(layout, v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q", v)
+	}
+	return t.UnixNano(), nil
+}
+
+// data returns the columns of the batch. The values are parsed by the columns of their types,
+// the columns having only nulls are skipped.
+func (b *csvBatch) data(fields map[string]string) (map[string]any, error) {
+	if b.types == nil {
+		b.types = make([]string, len(b.header))
+		values := make([]string, len(b.rows))
+		for j, name := range b.header {
+			if b.types[j] = fields[name]; b.types[j] != "" {
+				continue
+			}
+			for i, row := range b.rows {
+				values[i] = row[j]
+			}
+			b.types[j] = inferCSVType(values)
+		}
+	}
+	res := make(map[string]any, len(b.header)+1)
+	for j, name := range b.header {
+		builder, err := data_types.GetColumnBuilder(b.types[j])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		col, err := builder(name, nil, 0, int64(len(b.rows)))
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for i, row := range b.rows {
+			if row[j] == "" {
+				col.AppendNulls(1)
+				continue
+			}
+			if err = col.ParseFromStr(row[j]); err != nil {
+				return nil, fmt.Errorf("line %d: column %s: %w", b.lines[i], name, err)
+			}
+			found = true
+		}
+		if !found {
+			continue
+		}
+		var data any
+		switch b.types[j] {
+		case data_types.DATA_TYPE_NAME_INT64, data_types.DATA_TYPE_NAME_FLOAT64, data_types.DATA_TYPE_NAME_STRING:
+			data = col.GetData()
+		default:
+			// the values of the other types, e.g. the scaled decimals, are converted back as CastColumn does
+			values := make([]any, col.GetLength())
+			for i := range values {
+				if !col.IsNull(int64(i)) {
+					values[i] = col.GetVal(int64(i))
+				}
+			}
+			data = data_types.TypedData{Type: b.types[j], Data: values}
+		}
+		res[name] = data
+	}
+	if b.timeIdx >= 0 {
+		ts := make([]int64, len(b.rows))
+		for i, row := range b.rows {
+			v := row[b.timeIdx]
+			if v == "" {
+				return nil, fmt.Errorf("line %d: the timestamp is empty", b.lines[i])
+			}
+			var err error
+			if ts[i], err = parseCSVTimestamp(v, b.scale, b.timeFormat); err != nil {
+				return nil, fmt.Errorf("line %d: %w", b.lines[i], err)
+			}
+		}
+		res["__timestamp"] = ts
+	}
+	return res, nil
+}
+
+func init() {
+	factory := func(comma rune) ParserFactory {
+		return func(fieldNames []string, fieldTypes []string) IParser {
+			fields := make(map[string]string)
+			for i, name := range fieldNames {
+				fields[name] = fieldTypes[i]
+			}
+			return &CSVParser{Comma: comma, fields: fields}
+		}
+	}
+	RegisterParser("text/csv", factory(','))
+	RegisterParser("text/tab-separated-values", factory('\t'))
+	RegisterParser("text/tsv", factory('\t'))
+}
@@ -0,0 +1,84 @@
+package parsers
+
+import (
+	"context"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"strings"
+	"testing"
+)
+
+func parseCSV(t *testing.T, parser IParser, ctx context.Context, data string) []*ParserResponse {
+	res, err := parser.ParseReader(ctx, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batches []*ParserResponse
+	for r := range res {
+		batches = append(batches, r)
+	}
+	return batches
+}
+
+func TestCSVParser(t *testing.T) {
+	parser, err := GetParser("text/csv; charset=utf-8", []string{"price", "host"},
+		[]string{"DECIMAL(10,2)", data_types.DATA_TYPE_NAME_LOW_CARDINALITY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), "table", "mydb.sales")
+	ctx = context.WithValue(ctx, "time_column", "day")
+	ctx = context.WithValue(ctx, "time_format", "2006-01-02")
+	batches := parseCSV(t, parser, ctx, `day,host,price,qty,ratio,note
+2024-01-01,a,1.5,3,0.5,"quoted, with ""quotes"""
+2024-01-02,b,2,,1,"two
+lines"
+`)
+	if len(batches) != 1 || batches[0].Error != nil {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+	if batches[0].Database != "mydb" || batches[0].Table != "sales" {
+		t.Fatalf("unexpected table %q.%q", batches[0].Database, batches[0].Table)
+	}
+	data := batches[0].Data
+	if ts := data["__timestamp"].([]int64); ts[1] != 1704153600000000000 {
+		t.Fatalf("unexpected __timestamp %v", ts)
+	}
+	if host := data["host"].(data_types.TypedData); host.Type != data_types.DATA_TYPE_NAME_LOW_CARDINALITY {
+		t.Fatalf("unexpected host %v", host)
+	}
+	if price := data["price"].(data_types.TypedData); price.Type != "DECIMAL(10,2)" ||
+		price.Data.([]any)[0].(data_types.Decimal).Value != 150 {
+		t.Fatalf("unexpected price %v", price)
+	}
+	qty := data["qty"].(data_types.Nullable)
+	if qty.Data.([]int64)[0] != 3 || qty.IsValid(1) {
+		t.Fatalf("unexpected qty %v", qty)
+	}
+	if ratio := data["ratio"].([]float64); ratio[1] != 1 {
+		t.Fatalf("unexpected ratio %v", ratio)
+	}
+	if note := data["note"].([]string); note[0] != `quoted, with "quotes"` || note[1] != "two\nlines" {
+		t.Fatalf("unexpected note %q", note)
+	}
+
+	tsv, err := GetParser("text/tab-separated-values", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = context.WithValue(context.WithValue(context.Background(), "table", "events"), "precision", "s")
+	batches = parseCSV(t, tsv, ctx, "time\tmsg\n1700000000\thello, world\n1700000001\tbye\n")
+	if len(batches) != 1 || batches[0].Error != nil {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+	if ts := batches[0].Data["__timestamp"].([]int64); ts[1] != 1700000001000000000 {
+		t.Fatalf("unexpected __timestamp %v", ts)
+	}
+	if msg := batches[0].Data["msg"].([]string); msg[0] != "hello, world" {
+		t.Fatalf("unexpected msg %q", msg)
+	}
+
+	batches = parseCSV(t, tsv, ctx, "time\tn\n1\t1\n2\t2\t3\n")
+	if len(batches) != 1 || batches[0].Error == nil {
+		t.Fatalf("expected an error for the extra field, got %v", batches)
+	}
+}
@@ -4,16 +4,24 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/go-faster/city"
-	_ "github.com/go-faster/city"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
 	"io"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unsafe"
+)
+
+// The line protocol is parsed by lines straight into the typed columns of the batch.
+// A line is only copied if it doesn't fit into the read buffer, the keys and tag values
+// are looked up without allocations, so only the new columns, tag values and the string fields allocate.
 
-	"github.com/influxdata/influxdb/models"
+const (
+	lineProtoBufferSize = 64 * 1024
+	// the batch is sent once it has that many rows, so long streams are stored while they are read
+	lineProtoBatchRows = 64 * 1024
 )
 
 type LineProtoParser struct {
@@ -24,81 +32,485 @@ func (l *LineProtoParser) Parse(data []byte) (chan *ParserResponse, error) {
 }
 
 func (l *LineProtoParser) ParseReader(ctx context.Context, r io.Reader) (chan *ParserResponse, error) {
-	scanner := bufio.NewScanner(r)
-
 	precision := "ns"
 	if ctx != nil && ctx.Value("precision") != nil {
 		precision = ctx.Value("precision").(string)
 	}
+	multiplier, err := precisionMultiplier(precision)
+	if err != nil {
+		return nil, err
+	}
 
 	res := make(chan *ParserResponse)
 
-	go l.parse(scanner, res, precision)
+	go l.parse(newLineReader(r), res, multiplier)
 	return res, nil
 }
 
-func getSchemaId(fields models.Fields, tags models.Tags) uint64 {
-	determs := []uint64{0, 0, 1}
-	for _, t := range tags {
-		hash := city.CH64(append(t.Key, 1))
-		determs[0] = determs[0] + hash
-		determs[1] = determs[1] ^ hash
-		determs[2] = determs[2] * (1779033703 + 2*hash)
+func precisionMultiplier(precision string) (int64, error) {
+	switch precision {
+	case "", "n", "ns":
+		return int64(time.Nanosecond), nil
+	case "u", "us", "µs":
+		return int64(time.Microsecond), nil
+	case "ms":
+		return int64(time.Millisecond), nil
+	case "s":
+		return int64(time.Second), nil
+	case "m":
+		return int64(time.Minute), nil
+	case "h":
+		return int64(time.Hour), nil
+	}
+	return 0, fmt.Errorf("invalid precision %q", precision)
+}
+
+// lineReader reads the lines of any length
+type lineReader struct {
+	r *bufio.Reader
+	// the line longer than the buffer of the reader
+	long []byte
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, lineProtoBufferSize)}
+}
+
+// next returns the line without the line ending. It is valid until the next call.
+func (l *lineReader) next() ([]byte, error) {
+	line, err := l.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		l.long = append(l.long[:0], line...)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			line, err = l.r.ReadSlice('\n')
+			l.long = append(l.long, line...)
+		}
+		line = l.long
+	}
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	return bytes.TrimSuffix(line, []byte{'\r'}), nil
+}
+
+// The kinds of the line protocol values
+const (
+	lineProtoFloat = iota
+	lineProtoInt
+	lineProtoUint
+	lineProtoString
+	lineProtoBool
+	lineProtoTag
+)
+
+// lineProtoPair is a tag or a field of a point. The key and the string value
+// refer to the line or to the scratch of the point if they had escapes.
+type lineProtoPair struct {
+	key  []byte
+	kind byte
+	str  []byte
+	i    int64
+	u    uint64
+	f    float64
+	b    bool
+}
+
+// lineProtoPoint is the parsed line, it is reused for the next lines
+type lineProtoPoint struct {
+	measurement []byte
+	tags        []lineProtoPair
+	fields      []lineProtoPair
+	ts          int64
+	hasTs       bool
+	// the unescaped keys and values, it is large enough not to be reallocated while the line is parsed
+	scratch []byte
+}
+
+// byteSet is the set of the bytes ending a token or escaped by a backslash
+type byteSet [256]bool
+
+func newByteSet(chars string) *byteSet {
+	var res byteSet
+	for i := 0; i < len(chars); i++ {
+		res[chars[i]] = true
 	}
-	for k, v := range fields {
-		var tp byte
-		switch v.(type) {
-		case string:
-			tp = 1
-		case int64:
-			tp = 2
-		case float64:
-			tp = 3
+	return &res
+}
+
+var (
+	// the measurement and the tag and field values end at a comma or a space
+	valueEnd = newByteSet(", ")
+	// the keys end at an equal sign too, a backslash escapes all of them in the keys and values
+	keyEnd = newByteSet(",= ")
+	// the string fields only escape the quotes and backslashes
+	stringEscapes = newByteSet(`"\`)
+)
+
+// unescape returns the token without the backslashes escaping the special characters
+func (p *lineProtoPoint) unescape(token []byte, escaped bool, special *byteSet) []byte {
+	if !escaped {
+		return token
+	}
+	start := len(p.scratch)
+	for i := 0; i < len(token); i++ {
+		if token[i] == '\\' && i+1 < len(token) && special[token[i+1]] {
+			i++
+		}
+		p.scratch = append(p.scratch, token[i])
+	}
+	return p.scratch[start:len(p.scratch):len(p.scratch)]
+}
+
+// scanToken returns the end of the token starting at i: the position of the first
+// not escaped stop byte or the end of the line, and if the token has escapes.
+func scanToken(line []byte, i int, stop *byteSet) (int, bool) {
+	escaped := false
+	for ; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) {
+			escaped = true
+			i++
+			continue
+		}
+		if stop[line[i]] {
+			break
 		}
-		hash := city.CH64(append([]byte(k), tp))
-		determs[0] = determs[0] + hash
-		determs[1] = determs[1] ^ hash
-		determs[2] = determs[2] * (1779033703 + 2*hash)
 	}
-	return city.CH64(unsafe.Slice((*byte)(unsafe.Pointer(&determs[0])), 24))
+	return i, escaped
 }
 
-func appendData(data *map[string]any, k string, v any) {
-	_, ok := (*data)[k]
+func skipSpaces(line []byte, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// b2s returns the string sharing the memory of the bytes, for the lookups and the number parsing only
+func b2s(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// parse parses the line into the point: measurement[,tag=value...] field=value[,field=value...] [timestamp]
+func (p *lineProtoPoint) parse(line []byte) error {
+	p.tags = p.tags[:0]
+	p.fields = p.fields[:0]
+	p.hasTs = false
+	if cap(p.scratch) < len(line) {
+		p.scratch = make([]byte, 0, len(line))
+	}
+	p.scratch = p.scratch[:0]
+
+	i, escaped := scanToken(line, 0, valueEnd)
+	p.measurement = p.unescape(line[:i], escaped, valueEnd)
+	if len(p.measurement) == 0 {
+		return fmt.Errorf("missing measurement")
+	}
+	for i < len(line) && line[i] == ',' {
+		start := i + 1
+		i, escaped = scanToken(line, start, keyEnd)
+		if i == start || i >= len(line) || line[i] != '=' {
+			return fmt.Errorf("invalid tag at %d", start)
+		}
+		key := p.unescape(line[start:i], escaped, keyEnd)
+		start = i + 1
+		i, escaped = scanToken(line, start, valueEnd)
+		if i == start {
+			return fmt.Errorf("missing value of tag %q", key)
+		}
+		p.tags = append(p.tags, lineProtoPair{key: key, kind: lineProtoTag, str: p.unescape(line[start:i], escaped, keyEnd)})
+	}
+
+	i = skipSpaces(line, i)
+	for {
+		start := i
+		i, escaped = scanToken(line, start, keyEnd)
+		if i == start || i >= len(line) || line[i] != '=' {
+			return fmt.Errorf("invalid field at %d", start)
+		}
+		field := lineProtoPair{key: p.unescape(line[start:i], escaped, keyEnd)}
+		var err error
+		if i, err = p.parseValue(line, i+1, &field); err != nil {
+			return err
+		}
+		p.fields = append(p.fields, field)
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+		i++
+	}
+
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		end := bytes.IndexByte(line[i:], ' ')
+		if end < 0 {
+			end = len(line) - i
+		}
+		if skipSpaces(line, i+end) < len(line) {
+			return fmt.Errorf("unexpected data at %d", i+end)
+		}
+		ts, err := strconv.ParseInt(b2s(line[i:i+end]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", line[i:i+end])
+		}
+		p.ts = ts
+		p.hasTs = true
+	}
+	return nil
+}
+
+// parseValue parses the field value starting at i and returns its end
+func (p *lineProtoPoint) parseValue(line []byte, i int, field *lineProtoPair) (int, error) {
+	if i < len(line) && line[i] == '"' {
+		start := i + 1
+		escaped := false
+		for i = start; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				escaped = true
+				i++
+			}
+		}
+		if i >= len(line) {
+			return i, fmt.Errorf("unterminated string of field %q", field.key)
+		}
+		field.kind = lineProtoString
+		field.str = p.unescape(line[start:i], escaped, stringEscapes)
+		return i + 1, nil
+	}
+	start := i
+	i, _ = scanToken(line, start, valueEnd)
+	value := line[start:i]
+	if len(value) == 0 {
+		return i, fmt.Errorf("missing value of field %q", field.key)
+	}
+	var err error
+	switch b2s(value) {
+	case "t", "T", "true", "True", "TRUE":
+		field.kind, field.b = lineProtoBool, true
+		return i, nil
+	case "f", "F", "false", "False", "FALSE":
+		field.kind, field.b = lineProtoBool, false
+		return i, nil
+	}
+	switch value[len(value)-1] {
+	case 'i':
+		field.kind = lineProtoInt
+		field.i, err = strconv.ParseInt(b2s(value[:len(value)-1]), 10, 64)
+	case 'u':
+		field.kind = lineProtoUint
+		field.u, err = strconv.ParseUint(b2s(value[:len(value)-1]), 10, 64)
+	default:
+		field.kind = lineProtoFloat
+		// inf and nan aren't numbers of the line protocol
+		if c := value[0]; c != '-' && c != '+' && c != '.' && (c < '0' || c > '9') {
+			return i, fmt.Errorf("invalid value %q of field %q", value, field.key)
+		}
+		field.f, err = strconv.ParseFloat(b2s(value), 64)
+	}
+	if err != nil {
+		return i, fmt.Errorf("invalid value %q of field %q", value, field.key)
+	}
+	return i, nil
+}
+
+// lineProtoValues are the values of a column of the batch padded with zeros for the null rows
+type lineProtoValues interface {
+	// get returns the values of the size rows
+	get(size int) any
+}
+
+type typedValues[T int32 | int64 | uint64 | float64 | string | bool] struct {
+	data []T
+}
+
+func (t *typedValues[T]) set(i int, v T) {
+	if len(t.data) < i {
+		t.data = append(t.data, make([]T, i-len(t.data))...)
+	}
+	if len(t.data) > i {
+		t.data[i] = v
+	} else {
+		t.data = append(t.data, v)
+	}
+}
+
+func (t *typedValues[T]) get(size int) any {
+	if len(t.data) < size {
+		t.data = append(t.data, make([]T, size-len(t.data))...)
+	}
+	return t.data
+}
+
+// dictValues are the values of a tag column: the distinct values and the index of the value of each row
+type dictValues struct {
+	dict  []string
+	index map[string]int32
+	keys  typedValues[int32]
+}
+
+func (d *dictValues) set(i int, v []byte) {
+	k, ok := d.index[b2s(v)]
 	if !ok {
-		switch v.(type) {
-		case string:
-			(*data)[k] = []string{v.(string)}
-		case int64:
-			(*data)[k] = []int64{v.(int64)}
-		case float64:
-			(*data)[k] = []float64{v.(float64)}
-		case bool:
-			(*data)[k] = []bool{v.(bool)}
+		k = int32(len(d.dict))
+		d.dict = append(d.dict, string(v))
+		d.index[d.dict[k]] = k
+	}
+	d.keys.set(i, k)
+}
+
+func (d *dictValues) get(size int) any {
+	d.keys.get(size)
+	return data_types.DictStrings{Dict: d.dict, Keys: d.keys.data}
+}
+
+// lineProtoColumn is a column of the batch with the validity bitmap of its rows
+type lineProtoColumn struct {
+	name   string
+	kind   byte
+	values lineProtoValues
+	valid  []byte
+	valids int
+	// the number of the rows up to the last one set
+	rows int
+}
+
+// lineProtoBatch collects the points of a measurement. The fields and tags missing
+// from a point are nulls, so the points of different field sets share the batch.
+type lineProtoBatch struct {
+	size    int
+	columns map[string]*lineProtoColumn
+	// the columns of the fields and tags of the last point by their position,
+	// the next points usually have the same keys in the same order
+	last []*lineProtoColumn
+	time typedValues[int64]
+}
+
+func newLineProtoBatch() *lineProtoBatch {
+	return &lineProtoBatch{columns: make(map[string]*lineProtoColumn)}
+}
+
+// lookup returns the column of the key at the position pos of the point, nil if there is none
+func (b *lineProtoBatch) lookup(pos int, key []byte) *lineProtoColumn {
+	if pos < len(b.last) && b.last[pos] != nil && b.last[pos].name == b2s(key) {
+		return b.last[pos]
+	}
+	col := b.columns[b2s(key)]
+	if col != nil {
+		for len(b.last) <= pos {
+			b.last = append(b.last, nil)
+		}
+		b.last[pos] = col
+	}
+	return col
+}
+
+// fits reports if the fields and tags of the point have the kinds of the batch columns
+func (b *lineProtoBatch) fits(p *lineProtoPoint) bool {
+	for i := range p.fields {
+		if col := b.lookup(i, p.fields[i].key); col != nil && col.kind != p.fields[i].kind {
+			return false
+		}
+	}
+	for i := range p.tags {
+		if col := b.lookup(len(p.fields)+i, p.tags[i].key); col != nil && col.kind != p.tags[i].kind {
+			return false
 		}
+	}
+	return true
+}
+
+func (b *lineProtoBatch) column(pos int, key []byte, kind byte) *lineProtoColumn {
+	if col := b.lookup(pos, key); col != nil {
+		return col
+	}
+	col := &lineProtoColumn{name: string(key), kind: kind}
+	switch kind {
+	case lineProtoFloat:
+		col.values = &typedValues[float64]{}
+	case lineProtoInt:
+		col.values = &typedValues[int64]{}
+	case lineProtoUint:
+		col.values = &typedValues[uint64]{}
+	case lineProtoString:
+		col.values = &typedValues[string]{}
+	case lineProtoBool:
+		col.values = &typedValues[bool]{}
+	case lineProtoTag:
+		col.values = &dictValues{index: make(map[string]int32)}
+	}
+	b.columns[col.name] = col
+	return b.lookup(pos, key)
+}
+
+// set sets the value of the key at the position pos of the point to the current row of the column.
+// The point must fit the batch. A repeated key keeps the last value,
+// the tag having the name of a field of another type is skipped.
+func (b *lineProtoBatch) set(pos int, pair *lineProtoPair) {
+	col := b.column(pos, pair.key, pair.kind)
+	if col.kind != pair.kind {
 		return
 	}
-	switch v.(type) {
-	case string:
-		(*data)[k] = append((*data)[k].([]string), v.(string))
-	case int64:
-		(*data)[k] = append((*data)[k].([]int64), v.(int64))
-	case float64:
-		(*data)[k] = append((*data)[k].([]float64), v.(float64))
-	case bool:
-		(*data)[k] = append((*data)[k].([]bool), v.(bool))
+	switch values := col.values.(type) {
+	case *typedValues[float64]:
+		values.set(b.size, pair.f)
+	case *typedValues[int64]:
+		values.set(b.size, pair.i)
+	case *typedValues[uint64]:
+		values.set(b.size, pair.u)
+	case *typedValues[string]:
+		values.set(b.size, string(pair.str))
+	case *typedValues[bool]:
+		values.set(b.size, pair.b)
+	case *dictValues:
+		values.set(b.size, pair.str)
+	}
+	if col.rows <= b.size {
+		col.valid = data_types.SetValid(col.valid, b.size)
+		col.valids++
+		col.rows = b.size + 1
 	}
 }
 
-var re = regexp.MustCompile(`^[^.,]+\.`)
+func (b *lineProtoBatch) appendPoint(p *lineProtoPoint, ts int64) {
+	for i := range p.fields {
+		b.set(i, &p.fields[i])
+	}
+	for i := range p.tags {
+		b.set(len(p.fields)+i, &p.tags[i])
+	}
+	b.time.set(b.size, ts)
+	b.size++
+}
+
+// data returns the columns of the batch: the ones having null rows are data_types.Nullable,
+// the tags have few distinct values, so they are kept in the dictionary columns.
+func (b *lineProtoBatch) data() map[string]any {
+	res := make(map[string]any, len(b.columns)+1)
+	for k, col := range b.columns {
+		data := col.values.get(b.size)
+		switch col.kind {
+		case lineProtoTag:
+			data = data_types.TypedData{Type: data_types.DATA_TYPE_NAME_LOW_CARDINALITY, Data: data}
+		case lineProtoBool:
+			data = data_types.TypedData{Type: data_types.DATA_TYPE_NAME_BOOLEAN, Data: data}
+		}
+		if col.valids < b.size {
+			data = data_types.Nullable{Data: data, Valid: col.valid}
+		}
+		res[k] = data
+	}
+	// a field or a tag named time is replaced by the timestamp
+	res["time"] = b.time.get(b.size)
+	return res
+}
 
-func (l *LineProtoParser) parse(scanner *bufio.Scanner, res chan *ParserResponse, precision string) {
+func (l *LineProtoParser) parse(lines *lineReader, res chan *ParserResponse, multiplier int64) {
 	defer close(res)
 
 	var (
-		table    string
-		schemaId uint64
-		data     map[string]any = make(map[string]any)
+		table string
+		batch = newLineProtoBatch()
+		point lineProtoPoint
 	)
 	send := func() {
 		database := ""
@@ -107,68 +519,50 @@ func (l *LineProtoParser) parse(scanner *bufio.Scanner, res chan *ParserResponse
 			database = databaseTable[0]
 			table = databaseTable[1]
 		}
-		res <- &ParserResponse{Database: database, Table: table, Data: data}
-		data = make(map[string]any)
+		res <- &ParserResponse{Database: database, Table: table, Data: batch.data()}
+		batch = newLineProtoBatch()
 		table = ""
-		schemaId = 0
 	}
 
 	onErr := func(err error) {
 		res <- &ParserResponse{Error: err}
 	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Parse the line as InfluxDB line protocol
-		point, err := models.ParsePointsWithPrecision([]byte(line), time.Now().UTC(), precision)
+	for n := 1; ; n++ {
+		line, err := lines.next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			onErr(fmt.Errorf("error parsing line: %w", err))
+			onErr(err)
 			return
 		}
+		line = line[skipSpaces(line, 0):]
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
 
-		for _, p := range point {
-			_table := p.Name()
-			__table := string(_table)
-			if table != __table && table != "" {
-				send()
-			}
-			table = __table
-			fields, err := p.Fields()
-			if err != nil {
-				onErr(fmt.Errorf("error getting fields: %w", err))
-				return
-			}
-			_schemaId := getSchemaId(fields, p.Tags())
-			if _schemaId != schemaId && schemaId != 0 {
-				send()
-			}
-			schemaId = _schemaId
-			for k, v := range fields {
-				appendData(&data, k, v)
-			}
-			for _, t := range p.Tags() {
-				appendData(&data, string(t.Key), string(t.Value))
-			}
-			if _, ok := data["time"]; !ok {
-				data["time"] = []int64{}
-			}
-			data["time"] = append(data["time"].([]int64), p.Time().UnixNano())
+		if err := point.parse(line); err != nil {
+			onErr(fmt.Errorf("error parsing line %d: %w", n, err))
+			return
+		}
+		ts := point.ts * multiplier
+		if !point.hasTs {
+			ts = time.Now().UnixNano()
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		onErr(err)
-		return
+		// the points of other field sets go to the same batch with nulls,
+		// a new batch is only started if a field changes its type
+		if table != "" && (table != b2s(point.measurement) || batch.size >= lineProtoBatchRows || !batch.fits(&point)) {
+			send()
+		}
+		if table == "" {
+			table = string(point.measurement)
+		}
+		batch.appendPoint(&point, ts)
 	}
+
 	if table != "" {
 		send()
 	}
 }
-
-var _ = func() int {
-	RegisterParser("", func(fieldNames []string, fieldTypes []string) IParser {
-		return &LineProtoParser{}
-	})
-	return 0
-}
@@ -1,54 +1,221 @@
 package parsers
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
 	"github.com/influxdata/influxdb/models"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestGetSchemaId(t *testing.T) {
-	fields := models.Fields{
-		"temperature": 1.2,
-		"humidity":    "asd",
+func TestLineProtoParserNulls(t *testing.T) {
+	parser := &LineProtoParser{}
+	res, err := parser.Parse([]byte(`cpu,host=a usage=1 1
+cpu,host=b,region=eu idle=2i 2
+cpu,host=a usage=3 3
+cpu usage="high" 4
+`))
+	if err != nil {
+		t.Fatal(err)
 	}
-	tags := models.Tags{
-		{Key: []byte("location"), Value: []byte("New York")},
+	var batches []map[string]any
+	for r := range res {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		batches = append(batches, r.Data)
 	}
-	id1 := getSchemaId(fields, tags)
+	// the points of other field sets share the batch, the string usage starts a new one
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %v", batches)
+	}
+	data := batches[0]
+	if ts := data["time"].([]int64); len(ts) != 3 || ts[2] != 3 {
+		t.Fatalf("unexpected time %v", ts)
+	}
+	usage := data["usage"].(data_types.Nullable)
+	if values := usage.Data.([]float64); len(values) != 3 || values[2] != 3 ||
+		!usage.IsValid(0) || usage.IsValid(1) || !usage.IsValid(2) {
+		t.Fatalf("unexpected usage %v", usage)
+	}
+	idle := data["idle"].(data_types.Nullable)
+	if values := idle.Data.([]int64); len(values) != 3 || values[1] != 2 || idle.IsValid(0) || idle.IsValid(2) {
+		t.Fatalf("unexpected idle %v", idle)
+	}
+	if host := data["host"].(data_types.TypedData); host.Type != data_types.DATA_TYPE_NAME_LOW_CARDINALITY ||
+		len(host.Data.(data_types.DictStrings).Keys) != 3 || len(host.Data.(data_types.DictStrings).Dict) != 2 {
+		t.Fatalf("unexpected host %v", host)
+	}
+	region := data["region"].(data_types.Nullable)
+	if !region.IsValid(1) || region.IsValid(2) {
+		t.Fatalf("unexpected region %v", region)
+	}
+	if usage := batches[1]["usage"].([]string); usage[0] != "high" {
+		t.Fatalf("unexpected usage %v", usage)
+	}
+}
+
+func parseLineProto(t testing.TB, ctx context.Context, data []byte) []*ParserResponse {
+	res, err := (&LineProtoParser{}).ParseReader(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batches []*ParserResponse
+	for r := range res {
+		batches = append(batches, r)
+	}
+	return batches
+}
 
-	fields = models.Fields{
-		"temperature": "asd",
-		"humidity":    "asd",
+// lineProtoValue returns the value of the row of a batch column
+func lineProtoValue(data any, row int) any {
+	if n, ok := data.(data_types.Nullable); ok {
+		if !n.IsValid(row) {
+			return nil
+		}
+		data = n.Data
 	}
-	tags = models.Tags{
-		{Key: []byte("location"), Value: []byte("New York")},
+	if typed, ok := data.(data_types.TypedData); ok {
+		data = typed.Data
 	}
-	id2 := getSchemaId(fields, tags)
-	if id2 == id1 {
-		t.Fatalf(
-			"Expected different schema IDs for different field types, got %d and %d", id1, id2)
+	if dict, ok := data.(data_types.DictStrings); ok {
+		return dict.Dict[dict.Keys[row]]
 	}
+	return reflect.ValueOf(data).Index(row).Interface()
+}
 
-	fields = models.Fields{
-		"temperature": 1.2,
+func TestLineProtoParserEscapes(t *testing.T) {
+	lines := []string{
+		`cpu\,1,host\ name=a\,b\=c usage=1.5,count=3i,ok=t,msg="say \"hi\" \\ ok" 1000`,
+		`weather,city=New\ York temp=-3.5e2,up=FALSE,note="a,b c=d" 1`,
+		`m,a=1 n=.5,yes=True 2`,
+		`esc\ aped f\=1\,2=1i    3`,
 	}
-	tags = models.Tags{
-		{Key: []byte("location"), Value: []byte("New York")},
-		{[]byte("humidity"), []byte("asd")},
+	for _, line := range lines {
+		points, err := models.ParsePointsWithPrecision([]byte(line), time.Now(), "ns")
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches := parseLineProto(t, nil, []byte(line))
+		if len(batches) != 1 || batches[0].Error != nil {
+			t.Fatalf("%s: unexpected batches %v", line, batches)
+		}
+		data := batches[0].Data
+		if batches[0].Table != string(points[0].Name()) {
+			t.Fatalf("%s: expected table %q, got %q", line, points[0].Name(), batches[0].Table)
+		}
+		fields, err := points[0].Fields()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range fields {
+			if got := lineProtoValue(data[k], 0); fmt.Sprint(got) != fmt.Sprint(v) {
+				t.Fatalf("%s: expected field %q = %v, got %v", line, k, v, got)
+			}
+			if _, isBool := v.(bool); isBool && data[k].(data_types.TypedData).Type != data_types.DATA_TYPE_NAME_BOOLEAN {
+				t.Fatalf("%s: field %q is not BOOLEAN: %v", line, k, data[k])
+			}
+		}
+		for _, tag := range points[0].Tags() {
+			if got := lineProtoValue(data[string(tag.Key)], 0); got != string(tag.Value) {
+				t.Fatalf("%s: expected tag %q = %q, got %v", line, tag.Key, tag.Value, got)
+			}
+		}
+		if len(data) != len(fields)+len(points[0].Tags())+1 {
+			t.Fatalf("%s: unexpected columns %v", line, data)
+		}
+		if ts := data["time"].([]int64)[0]; ts != points[0].UnixNano() {
+			t.Fatalf("%s: expected time %d, got %d", line, points[0].UnixNano(), ts)
+		}
 	}
-	if getSchemaId(fields, tags) != id1 {
-		t.Fatalf("Expected same schema ID for different fields + tag order, got %d and %d",
-			id1, getSchemaId(fields, tags))
+}
+
+func TestLineProtoParserLongLines(t *testing.T) {
+	long := strings.Repeat("x", 3*lineProtoBufferSize)
+	data := "# comment\r\n" +
+		"logs,host=a msg=\"" + long + "\",size=1u 1\r\n" +
+		"\n" +
+		"logs,host=b msg=\"short\",size=2u 2"
+	ctx := context.WithValue(context.Background(), "precision", "ms")
+	batches := parseLineProto(t, ctx, []byte(data))
+	if len(batches) != 1 || batches[0].Error != nil {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+	msg := batches[0].Data["msg"].([]string)
+	if len(msg) != 2 || msg[0] != long || msg[1] != "short" {
+		t.Fatalf("unexpected msg of %d rows", len(msg))
+	}
+	if size := batches[0].Data["size"].([]uint64); size[1] != 2 {
+		t.Fatalf("unexpected size %v", size)
+	}
+	if ts := batches[0].Data["time"].([]int64); ts[0] != 1e6 || ts[1] != 2e6 {
+		t.Fatalf("unexpected time %v", ts)
+	}
+
+	for _, line := range []string{
+		"cpu",
+		"cpu usage",
+		"cpu,host usage=1",
+		"cpu usage=abc",
+		"cpu usage=1 abc",
+		`cpu msg="open`,
+		"cpu usage=1i 1 2",
+	} {
+		batches := parseLineProto(t, nil, []byte("ok v=1\n"+line+"\n"))
+		if len(batches) != 1 || batches[0].Error == nil {
+			t.Fatalf("%q: expected an error, got %v", line, batches)
+		}
 	}
+}
 
-	fields = models.Fields{
-		"temperature": 1.2,
+func lineProtoBenchData(rows int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&buf, "cpu,host=server%d,region=eu-%d usage_user=%f,usage_system=%f,count=%di,status=\"ok\" %d\n",
+			i%100, i%3, float64(i)/7, float64(i)/11, i, 1700000000000000000+int64(i))
 	}
-	tags = models.Tags{
-		{[]byte("humidity"), []byte("asd")},
-		{Key: []byte("location"), Value: []byte("New York")},
+	return buf.Bytes()
+}
+
+func BenchmarkLineProtoParser(b *testing.B) {
+	data := lineProtoBenchData(100000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range parseLineProto(b, nil, data) {
+			if r.Error != nil {
+				b.Fatal(r.Error)
+			}
+		}
 	}
-	if getSchemaId(fields, tags) != id1 {
-		t.Fatalf("Expected same schema ID for different fields + tag order, got %d and %d",
-			id1, getSchemaId(fields, tags))
+}
+
+// BenchmarkLineProtoModels is the line by line parsing of the previous parser, without building the columns
+func BenchmarkLineProtoModels(b *testing.B) {
+	data := lineProtoBenchData(100000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			points, err := models.ParsePointsWithPrecision([]byte(scanner.Text()), time.Now().UTC(), "ns")
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, p := range points {
+				if _, err := p.Fields(); err != nil {
+					b.Fatal(err)
+				}
+				p.Tags()
+				p.Time()
+			}
+		}
 	}
 }
@@ -1,90 +1,219 @@
 package parsers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/go-faster/jx"
 	"io"
+	"strings"
+	"time"
 )
 
+// NDJSONParser parses newline delimited JSON objects into the rows of the table
+// set by the "table" context value (a `db.table` name sets the database as well).
+// The column types are set by fields or inferred from the values: the arrays are LISTs,
+// the objects are STRUCTs and the values of mixed types are stored as JSON.
+// The rows are timestamped with the `__timestamp` or `time` field: the integers are scaled
+// by the "precision" context value, the strings are parsed as RFC3339.
 type NDJSONParser struct {
 	fields map[string]string
-	lines  map[string]any
 }
 
-var notImplementedErr = fmt.Errorf("not implemented")
+const ndjsonBatchBytes = 10 * 1024 * 1024
 
 func (N *NDJSONParser) Parse(data []byte) (chan *ParserResponse, error) {
 	return N.ParseReader(nil, bytes.NewReader(data))
 }
 
 func (N *NDJSONParser) ParseReader(ctx context.Context, r io.Reader) (chan *ParserResponse, error) {
-	return nil, notImplementedErr
-	//TODO
-	/*scanner := bufio.NewScanner(r)
-	scanner.Split(bufio.ScanLines)
-	N.resetLines()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	table, _ := ctx.Value("table").(string)
+	if table == "" {
+		return nil, fmt.Errorf("the table of the NDJSON rows is not set")
+	}
+	database := ""
+	if strings.Contains(table, ".") {
+		database, table, _ = strings.Cut(table, ".")
+	}
+	precision, _ := ctx.Value("precision").(string)
+	scale := precisionNs(precision)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), ndjsonBatchBytes)
 	res := make(chan *ParserResponse)
 	go func() {
 		defer close(res)
-		bytesParsed := 0
-		linesLen := 0
+		var (
+			rows        []map[string]any
+			bytesParsed int
+			lineNum     int
+		)
+		send := func() error {
+			batches, err := N.rowsToData(rows, scale)
+			if err != nil {
+				return err
+			}
+			for _, data := range batches {
+				res <- &ParserResponse{Database: database, Table: table, Data: data}
+			}
+			rows, bytesParsed = nil, 0
+			return nil
+		}
 		for scanner.Scan() {
-			err := N.parseLine(scanner.Bytes())
+			lineNum++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			row, err := parseNDJSONLine(line)
 			if err != nil {
-				res <- &ParserResponse{Error: err}
+				res <- &ParserResponse{Error: fmt.Errorf("line %d: %w", lineNum, err)}
 				return
 			}
-			bytesParsed += len(scanner.Bytes())
-			linesLen++
-			if bytesParsed >= 10*1024*1024 {
-				res <- &ParserResponse{Data: N.lines}
-				N.resetLines()
-				bytesParsed = 0
-				linesLen = 0
+			rows = append(rows, row)
+			bytesParsed += len(line)
+			if bytesParsed >= ndjsonBatchBytes {
+				if err = send(); err != nil {
+					res <- &ParserResponse{Error: err}
+					return
+				}
 			}
 		}
-		if linesLen > 0 {
-			res <- &ParserResponse{Data: N.lines}
-			N.resetLines()
+		if err := scanner.Err(); err != nil {
+			res <- &ParserResponse{Error: err}
+			return
+		}
+		if len(rows) > 0 {
+			if err := send(); err != nil {
+				res <- &ParserResponse{Error: err}
+			}
 		}
 	}()
-	return res, nil*/
+	return res, nil
+}
+
+// parseNDJSONLine decodes the JSON object skipping the null fields
+func parseNDJSONLine(line []byte) (map[string]any, error) {
+	row := map[string]any{}
+	err := jx.DecodeBytes(line).Obj(func(d *jx.Decoder, key string) error {
+		v, err := data_types.DecodeJSONValue(d)
+		if v != nil {
+			row[key] = v
+		}
+		return err
+	})
+	return row, err
 }
 
-func (N *NDJSONParser) resetLines() {
-	// TODO
-	/*N.lines = make(map[string]any)
-	for k, v := range N.fields {
-		N.lines[k] = data_types.DataTypes[v].MakeStore()
-	}*/
+func precisionNs(precision string) int64 {
+	switch precision {
+	case "s":
+		return int64(time.Second)
+	case "ms":
+		return int64(time.Millisecond)
+	case "us", "u":
+		return int64(time.Microsecond)
+	}
+	return 1
 }
 
-func (N *NDJSONParser) parseLine(line []byte) error {
-	// TODO
-	/*d := jx.DecodeBytes(line)
-	return d.Obj(func(d *jx.Decoder, key string) error {
-		tp, ok := N.fields[key]
-		if !ok {
-			return fmt.Errorf("field %s not found", key)
+func toTimestamp(v any, scale int64) (int64, error) {
+	switch _v := v.(type) {
+	case int64:
+		return _v * scale, nil
+	case float64:
+		return int64(_v * float64(scale)), nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, _v)
+		return t.UnixNano(), err
+	}
+	return 0, fmt.Errorf("invalid timestamp %v", v)
+}
+
+// rowsToData converts the rows into the column data, the fields missing from a row are nulls.
+// The rows without a time field go to a separate batch, as __timestamp can't be null.
+// The types of the fields are inferred from all the rows, so the batches don't conflict.
+func (N *NDJSONParser) rowsToData(rows []map[string]any, scale int64) ([]map[string]any, error) {
+	values := map[string][]any{}
+	for _, row := range rows {
+		for k, v := range row {
+			values[k] = append(values[k], v)
 		}
-		var err error
-		N.lines[key], err = data_types.DataTypes[tp].ParseJson(d, N.lines[key])
-		if err != nil {
-			return fmt.Errorf("invalid data for field %s: %w", key, err)
+	}
+	types := make(map[string]string, len(values))
+	for k, v := range values {
+		types[k] = N.fields[k]
+		if types[k] == "" {
+			types[k] = data_types.InferTypeName(v)
+		}
+	}
+
+	var timed, untimed []map[string]any
+	for _, row := range rows {
+		if ndjsonTimeField(row) != "" {
+			timed = append(timed, row)
+		} else {
+			untimed = append(untimed, row)
 		}
-		return nil
-	})*/
-	return notImplementedErr
+	}
+	var res []map[string]any
+	for _, group := range [][]map[string]any{timed, untimed} {
+		if len(group) == 0 {
+			continue
+		}
+		data := map[string]any{}
+		for k := range values {
+			column := make([]any, len(group))
+			found := false
+			for i, row := range group {
+				column[i] = row[k]
+				found = found || column[i] != nil
+			}
+			if found {
+				data[k] = data_types.TypedData{Type: types[k], Data: column}
+			}
+		}
+		if ndjsonTimeField(group[0]) != "" {
+			ts := make([]int64, len(group))
+			for i, row := range group {
+				var err error
+				timeField := ndjsonTimeField(row)
+				ts[i], err = toTimestamp(row[timeField], scale)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", timeField, err)
+				}
+			}
+			data["__timestamp"] = ts
+		}
+		res = append(res, data)
+	}
+	return res, nil
 }
 
-var _ = func() int {
-	/*RegisterParser("application/x-ndjson", func(fieldNames []string, fieldTypes []string) IParser {
+// ndjsonTimeField returns the field timestamping the row: `__timestamp` or `time`, empty if none
+func ndjsonTimeField(row map[string]any) string {
+	if _, ok := row["__timestamp"]; ok {
+		return "__timestamp"
+	}
+	if _, ok := row["time"]; ok {
+		return "time"
+	}
+	return ""
+}
+
+func init() {
+	factory := func(fieldNames []string, fieldTypes []string) IParser {
 		fields := make(map[string]string)
 		for i, name := range fieldNames {
 			fields[name] = fieldTypes[i]
 		}
 		return &NDJSONParser{fields: fields}
-	})*/
-	return 0
-}()
+	}
+	RegisterParser("application/x-ndjson", factory)
+	RegisterParser("application/ndjson", factory)
+}
@@ -0,0 +1,51 @@
+package parsers
+
+import (
+	"context"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"strings"
+	"testing"
+)
+
+func TestNDJSONParser(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "table", "db.events")
+	ctx = context.WithValue(ctx, "precision", "s")
+	parser := &NDJSONParser{}
+	res, err := parser.ParseReader(ctx, strings.NewReader(`{"time": 1700000000, "tags": ["a", "b"], "attrs": {"k": 1}, "payload": {"x": 1}}
+{"time": "2023-11-14T22:13:21Z", "tags": [], "attrs": {"k": 2.5, "s": "x"}, "payload": "text"}
+{"time": 1700000002, "n": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batches []map[string]any
+	for r := range res {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		if r.Database != "db" || r.Table != "events" {
+			t.Fatalf("unexpected table %s.%s", r.Database, r.Table)
+		}
+		batches = append(batches, r.Data)
+	}
+	if len(batches) != 1 {
+		t.Fatalf("expected 1 batch, got %d", len(batches))
+	}
+	ts := batches[0]["__timestamp"].([]int64)
+	if len(ts) != 3 || ts[0] != 1700000000000000000 || ts[1] != 1700000001000000000 {
+		t.Fatalf("unexpected timestamps %v", ts)
+	}
+	for name, typeName := range map[string]string{
+		"tags":    "VARCHAR[]",
+		"attrs":   `STRUCT("k" FLOAT8, "s" VARCHAR)`,
+		"payload": data_types.DATA_TYPE_NAME_JSON,
+	} {
+		if tp := batches[0][name].(data_types.TypedData).Type; tp != typeName {
+			t.Fatalf("%s: expected %s, got %s", name, typeName, tp)
+		}
+	}
+	// the fields missing from the rows are nulls
+	n := batches[0]["n"].(data_types.TypedData)
+	if values := n.Data.([]any); n.Type != "INT8" || values[0] != nil || values[2] != int64(1) {
+		t.Fatalf("n: unexpected column %v", n)
+	}
+}
@@ -0,0 +1,98 @@
+package parsers
+
+import (
+	"bytes"
+	"context"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"io"
+)
+
+// ParquetParser reads the rows of a parquet file into a single table.
+// The rows are timestamped with the TimeColumn, or with the `__timestamp` or `time`
+// columns of the file if it's not set.
+type ParquetParser struct {
+	Table      string
+	TimeColumn string
+	BatchSize  int64
+}
+
+func (p *ParquetParser) Parse(data []byte) (chan *ParserResponse, error) {
+	return p.ParseReader(nil, bytes.NewReader(data))
+}
+
+// ParseReader parses the parquet file. The reader should implement io.ReaderAt and io.Seeker
+// (e.g. *os.File), otherwise it's read into memory.
+func (p *ParquetParser) ParseReader(ctx context.Context, r io.Reader) (chan *ParserResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rdr, ok := r.(parquet.ReaderAtSeeker)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		rdr = bytes.NewReader(data)
+	}
+	pqReader, err := file.NewParquetReader(rdr)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := p.BatchSize
+	if batchSize <= 0 {
+		batchSize = 65536
+	}
+	reader, err := pqarrow.NewFileReader(pqReader, pqarrow.ArrowReadProperties{BatchSize: batchSize},
+		memory.DefaultAllocator)
+	if err != nil {
+		pqReader.Close()
+		return nil, err
+	}
+	recReader, err := reader.GetRecordReader(ctx, nil, nil)
+	if err != nil {
+		pqReader.Close()
+		return nil, err
+	}
+
+	schema, err := data_types.FromParquetSchema(pqReader.MetaData())
+	if err != nil {
+		pqReader.Close()
+		recReader.Release()
+		return nil, err
+	}
+
+	timeColumn := p.TimeColumn
+	if timeColumn == "" {
+		for _, name := range []string{"__timestamp", "time"} {
+			if len(recReader.Schema().FieldIndices(name)) > 0 {
+				timeColumn = name
+				break
+			}
+		}
+	}
+
+	res := make(chan *ParserResponse)
+	go func() {
+		defer close(res)
+		defer pqReader.Close()
+		defer recReader.Release()
+		for recReader.Next() {
+			batches, err := recordToData(recReader.Record(), schema, timeColumn)
+			if err != nil {
+				res <- &ParserResponse{Error: err}
+				return
+			}
+			for _, data := range batches {
+				res <- &ParserResponse{Table: p.Table, Data: data}
+			}
+		}
+		if err := recReader.Err(); err != nil && err != io.EOF {
+			res <- &ParserResponse{Error: err}
+		}
+	}()
+	return res, nil
+}
@@ -0,0 +1,74 @@
+package parsers
+
+import (
+	"bytes"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"testing"
+)
+
+func TestParquetParser(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Millisecond}},
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "cpu", Type: arrow.PrimitiveTypes.Float32},
+		{Name: "cores", Type: arrow.PrimitiveTypes.Uint8},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	b.Field(0).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1000, 2000, 3000}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "", "c"}, []bool{true, false, true})
+	b.Field(2).(*array.Float32Builder).AppendValues([]float32{0.5, 1, 1.5}, nil)
+	b.Field(3).(*array.Uint8Builder).AppendValues([]uint8{2, 4, 8}, nil)
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	w, err := pqarrow.NewFileWriter(schema, &buf, nil, pqarrow.DefaultWriterProps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := &ParquetParser{Table: "metrics", TimeColumn: "ts"}
+	res, err := parser.Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batches []map[string]any
+	for r := range res {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		if r.Table != "metrics" {
+			t.Fatalf("unexpected table %q", r.Table)
+		}
+		batches = append(batches, r.Data)
+	}
+	if len(batches) != 1 {
+		t.Fatalf("expected the rows with and without host in one batch, got %v", batches)
+	}
+	data := batches[0]
+	if ts := data["__timestamp"].([]int64); len(ts) != 3 || ts[0] != 1000000000 || ts[2] != 3000000000 {
+		t.Fatalf("unexpected timestamps %v", ts)
+	}
+	hosts := data["host"].(data_types.Nullable)
+	if values := hosts.Data.([]string); values[0] != "a" || values[2] != "c" ||
+		!hosts.IsValid(0) || hosts.IsValid(1) || !hosts.IsValid(2) {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	if cores := data["cores"].([]uint64); len(cores) != 3 || cores[1] != 4 {
+		t.Fatalf("unexpected cores %v", cores)
+	}
+	if cpu := data["cpu"].([]float64); cpu[1] != 1 {
+		t.Fatalf("unexpected cpu %v", cpu)
+	}
+}
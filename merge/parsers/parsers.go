@@ -29,7 +29,7 @@ func RegisterParser(name string, parser ParserFactory) {
 
 func GetParser(name string, fieldNames []string, fieldTypes []string) (IParser, error) {
 	for _name, parser := range registry {
-		if strings.HasPrefix(name, _name) {
+		if _name != "" && strings.HasPrefix(name, _name) {
 			return parser(fieldNames, fieldTypes), nil
 		}
 	}
@@ -0,0 +1,26 @@
+package query
+
+import (
+	"context"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+)
+
+// QueryRecords runs the SQL request as Query does and returns the result as arrow records.
+// Only the files which may match q are read, nil reads all of them.
+// The builds with the duckdb_arrow tag return the Arrow batches of DuckDB as they are,
+// the others scan the rows and return the DuckDB types without an arrow counterpart
+// (nested types, intervals, huge integers) as their JSON text. The reader has to be released.
+func QueryRecords(ctx context.Context, database string, request string,
+	q *shared.IndexQuery) (array.RecordReader, error) {
+	conn, closeConn, err := connect(ctx, database, request, q)
+	if err != nil {
+		return nil, err
+	}
+	res, err := queryRecords(ctx, conn, request, closeConn)
+	if err != nil {
+		closeConn()
+		return nil, err
+	}
+	return res, nil
+}
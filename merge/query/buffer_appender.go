@@ -0,0 +1,79 @@
+//go:build !duckdb_arrow
+
+package query
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/google/uuid"
+	"github.com/marcboeker/go-duckdb/v2"
+	"math/big"
+)
+
+// appendBuffer copies the buffered rows of the snapshot into the table value by value.
+// The builds with the duckdb_arrow tag scan the buffers through the Arrow interface instead.
+func appendBuffer(ctx context.Context, conn *sql.Conn, name string, columns []string,
+	snapshot *service.BufferSnapshot) error {
+	return conn.Raw(func(driverConn any) error {
+		appender, err := duckdb.NewAppender(driverConn.(driver.Conn), "", "", name)
+		if err != nil {
+			return err
+		}
+		row := make([]driver.Value, len(columns))
+		for _, store := range snapshot.Stores {
+			var size int64
+			for _, col := range store {
+				size = col.GetLength()
+				break
+			}
+			for i := int64(0); i < size; i++ {
+				for j, name := range columns {
+					col, ok := store[name]
+					if !ok || col.IsNull(i) {
+						row[j] = nil
+						continue
+					}
+					row[j] = toDuckDBValue(col.GetVal(i))
+				}
+				err = appender.AppendRow(row...)
+				if err != nil {
+					appender.Close()
+					return err
+				}
+			}
+		}
+		return appender.Close()
+	})
+}
+
+// toDuckDBValue converts the MAP, DECIMAL and UUID values of the columns to the duckdb types
+func toDuckDBValue(v any) any {
+	switch _v := v.(type) {
+	case data_types.Decimal:
+		return duckdb.Decimal{Width: uint8(_v.Precision), Scale: uint8(_v.Scale), Value: big.NewInt(_v.Value)}
+	case uuid.UUID:
+		return duckdb.UUID(_v)
+	case []any:
+		res := make([]any, len(_v))
+		for i, e := range _v {
+			res[i] = toDuckDBValue(e)
+		}
+		return res
+	case map[string]any:
+		res := make(map[string]any, len(_v))
+		for k, e := range _v {
+			res[k] = toDuckDBValue(e)
+		}
+		return res
+	case map[any]any:
+		res := make(duckdb.Map, len(_v))
+		for k, e := range _v {
+			res[k] = toDuckDBValue(e)
+		}
+		return res
+	}
+	return v
+}
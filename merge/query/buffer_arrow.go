@@ -0,0 +1,123 @@
+//go:build duckdb_arrow
+
+package query
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	array18 "github.com/apache/arrow-go/v18/arrow/array"
+	ipc18 "github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/marcboeker/go-duckdb/v2"
+	"sort"
+	"strings"
+)
+
+// appendBuffer inserts the buffered rows of the snapshot into the table.
+// Every store is written into an arrow record and scanned by DuckDB through its Arrow interface,
+// the values are not converted one by one.
+func appendBuffer(ctx context.Context, conn *sql.Conn, name string, columns []string,
+	snapshot *service.BufferSnapshot) error {
+	for i, store := range snapshot.Stores {
+		rec, err := storeToRecord(store)
+		if err != nil {
+			return err
+		}
+		err = insertRecord(ctx, conn, name, fmt.Sprintf("%s_arrow_%d", name, i), rec)
+		rec.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeToRecord writes the columns of the store into an arrow record
+func storeToRecord(store map[string]data_types.IColumn) (arrow.Record, error) {
+	names := make([]string, 0, len(store))
+	for name := range store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]arrow.Field, len(names))
+	for i, name := range names {
+		fields[i] = arrow.Field{
+			Name:     name,
+			Type:     data_types.WithoutNaiveTimeZone(store[name].ArrowDataType()),
+			Nullable: true,
+		}
+	}
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(fields, nil))
+	defer builder.Release()
+	for i, name := range names {
+		err := store[name].WriteToBatch(builder.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+	}
+	return builder.NewRecord(), nil
+}
+
+// insertRecord registers the record as the view and inserts its rows into the table
+func insertRecord(ctx context.Context, conn *sql.Conn, table string, view string, rec arrow.Record) error {
+	imported, err := toDuckDBArrow(rec)
+	if err != nil {
+		return err
+	}
+	defer imported.Release()
+
+	var release func()
+	err = conn.Raw(func(driverConn any) error {
+		ar, err := duckdb.NewArrowFromConn(driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		release, err = ar.RegisterView(imported, view)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer conn.ExecContext(context.WithoutCancel(ctx), "DROP VIEW IF EXISTS "+quoteIdent(view))
+
+	projection := make([]string, len(rec.Schema().Fields()))
+	for i, field := range rec.Schema().Fields() {
+		projection[i] = fromArrowColumn(field)
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s BY NAME SELECT %s FROM %s",
+		quoteIdent(table), strings.Join(projection, ", "), quoteIdent(view)))
+	return err
+}
+
+// toDuckDBArrow passes the record over to the arrow version of go-duckdb. Both versions can't
+// share the C data interface in one binary, so the buffers are copied through an IPC stream.
+func toDuckDBArrow(rec arrow.Record) (array18.RecordReader, error) {
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(rec.Schema()))
+	err := w.Write(rec)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ipc18.NewReader(&buf)
+}
+
+// fromArrowColumn returns the expression of the column of the scanned record.
+// DuckDB doesn't know the UUID extension type and reads its values as BLOBs.
+func fromArrowColumn(field arrow.Field) string {
+	if data_types.IsUUIDType(field.Type) {
+		return fmt.Sprintf("CAST(hex(%[1]s) AS UUID) AS %[1]s", quoteIdent(field.Name))
+	}
+	return quoteIdent(field.Name)
+}
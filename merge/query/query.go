@@ -0,0 +1,364 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"github.com/google/uuid"
+	"github.com/marcboeker/go-duckdb/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	tableNameCheck = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	requestWord    = regexp.MustCompile(`[a-zA-Z0-9_]+`)
+
+	// queryDBs are the DuckDB instances of the queries by the directory of the database,
+	// their files are kept in queryDBsDir
+	queryDBs    = map[string]*sql.DB{}
+	queryDBsDir string
+	queryDBsMtx sync.Mutex
+)
+
+// Query runs the SQL request with DuckDB over the parquet files of the database
+// and the rows which are still buffered in memory.
+// Every table mentioned in the request is exposed as a view with the same name.
+func Query(ctx context.Context, database string, request string) ([]map[string]any, error) {
+	conn, closeConn, err := connect(ctx, database, request, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+	rows, err := conn.QueryContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRows(rows)
+}
+
+// connect returns a DuckDB connection exposing the tables mentioned in the request as views.
+// Only the files of the tables which may match q are read, nil reads all of them.
+// The returned function closes the connection.
+func connect(ctx context.Context, database string, request string,
+	q *shared.IndexQuery) (*sql.Conn, func(), error) {
+	if database == "" {
+		database = "default"
+	}
+	if !tableNameCheck.MatchString(database) {
+		return nil, nil, fmt.Errorf("invalid database name: %q", database)
+	}
+	tables, err := getRequestTables(database, request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := getQueryDB(ctx, database)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the views and the buffer tables are temporary, they go away with the connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeConn := func() {
+		conn.Close()
+	}
+
+	for _, table := range tables {
+		err = registerTable(ctx, conn, database, table, q)
+		if err != nil {
+			closeConn()
+			return nil, nil, fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+	err = checkReadOnly(conn, request)
+	if err != nil {
+		closeConn()
+		return nil, nil, err
+	}
+	return conn, closeConn, nil
+}
+
+// getQueryDB returns the DuckDB instance of the queries of the database, it's opened once
+// and locked down to the directory of the database. go-duckdb shares a single in-memory
+// instance with the merges and can't open a named one, so every instance gets its own file
+// in a temporary directory. The queries create only temporary objects, the files stay empty.
+func getQueryDB(ctx context.Context, database string) (*sql.DB, error) {
+	dir := filepath.Join(config.Get().Gigapi.Root, database)
+	queryDBsMtx.Lock()
+	defer queryDBsMtx.Unlock()
+	if db, ok := queryDBs[dir]; ok {
+		return db, nil
+	}
+	if queryDBsDir == "" {
+		tmp, err := os.MkdirTemp("", "gigapi_query")
+		if err != nil {
+			return nil, err
+		}
+		queryDBsDir = tmp
+	}
+	connector, err := duckdb.NewConnector(
+		filepath.Join(queryDBsDir, fmt.Sprintf("%d.duckdb", len(queryDBs))), nil)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+	// the idle connections would keep the temporary views of the previous queries
+	db.SetMaxIdleConns(0)
+	err = lockDown(ctx, db, dir)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	queryDBs[dir] = db
+	return db, nil
+}
+
+// lockDown restricts the instance to the files of the directory, so the requests can't access
+// anything else and can't lift the restriction.
+func lockDown(ctx context.Context, db *sql.DB, dir string) error {
+	for _, stmt := range []string{
+		fmt.Sprintf("SET allowed_directories = [%s]", quoteFiles([]string{dir + string(filepath.Separator)})),
+		"SET enable_external_access = false",
+		"SET lock_configuration = true",
+	} {
+		_, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// checkReadOnly rejects the requests other than a single SELECT statement,
+// as the files of the database could still be overwritten by COPY and the like.
+func checkReadOnly(conn *sql.Conn, request string) error {
+	return conn.Raw(func(driverConn any) error {
+		// Prepare doesn't run anything and fails on multiple statements
+		stmt, err := driverConn.(*duckdb.Conn).Prepare(request)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		stmtType, err := stmt.(*duckdb.Stmt).StatementType()
+		if err != nil {
+			return err
+		}
+		if stmtType != duckdb.STATEMENT_TYPE_SELECT {
+			return errors.New("only SELECT statements are allowed")
+		}
+		return nil
+	})
+}
+
+// getRequestTables returns the tables of the database which names are mentioned in the request
+func getRequestTables(database string, request string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(config.Get().Gigapi.Root, database))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	words := map[string]bool{}
+	for _, word := range requestWord.FindAllString(request, -1) {
+		words[strings.ToLower(word)] = true
+	}
+	var res []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !tableNameCheck.MatchString(entry.Name()) {
+			continue
+		}
+		if words[strings.ToLower(entry.Name())] {
+			res = append(res, entry.Name())
+		}
+	}
+	return res, nil
+}
+
+// registerTable creates the view of the table
+func registerTable(ctx context.Context, conn *sql.Conn, database string, table string,
+	q *shared.IndexQuery) error {
+	snapshot := &service.BufferSnapshot{}
+	if svc, err := repository.GetTable(database, table); err == nil {
+		if snapshotter, ok := svc.(service.Snapshotter); ok {
+			snapshot = snapshotter.Snapshot()
+		}
+	}
+	// The files are listed after the snapshot is taken, so the rows saved meanwhile are
+	// present in both and the files have to be skipped.
+	files, err := listTableFiles(database, table, snapshot.SavedFiles(), q)
+	if err != nil {
+		return err
+	}
+
+	// DuckDB can't read the INT64 __timestamp of the legacy files and the TIMESTAMP_NS one
+	// of the newer files as a single column, the legacy ones are converted on read
+	var current, legacy []string
+	for _, f := range files {
+		isLegacy, err := service.IsLegacyTimestampFile(f)
+		if err != nil {
+			return err
+		}
+		if isLegacy {
+			legacy = append(legacy, f)
+		} else {
+			current = append(current, f)
+		}
+	}
+	var selects []string
+	if len(current) > 0 {
+		selects = append(selects, fmt.Sprintf(
+			"SELECT * FROM read_parquet([%s], hive_partitioning = false, union_by_name = true)",
+			quoteFiles(current)))
+	}
+	if len(legacy) > 0 {
+		selects = append(selects, fmt.Sprintf(
+			"SELECT %s FROM read_parquet([%s], hive_partitioning = false, union_by_name = true)",
+			service.LegacyTimestampProjection, quoteFiles(legacy)))
+	}
+	bufferTable := "__buffer_" + table
+	hasBuffer, err := createBufferTable(ctx, conn, bufferTable, snapshot)
+	if err != nil {
+		return err
+	}
+	if hasBuffer {
+		selects = append(selects, "SELECT * FROM "+quoteIdent(bufferTable))
+	}
+	if len(selects) == 0 {
+		return nil
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TEMP VIEW %s AS %s",
+		quoteIdent(table), strings.Join(selects, " UNION ALL BY NAME ")))
+	return err
+}
+
+// listTableFiles returns the indexed parquet files of the partitions of the table matching q
+func listTableFiles(database string, table string, skip map[string]bool,
+	q *shared.IndexQuery) ([]string, error) {
+	partitions, err := repository.ListFiles(database, table, q)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, part := range partitions {
+		for _, e := range part.Files {
+			if !skip[e.Path] {
+				res = append(res, e.Path)
+			}
+		}
+	}
+	return res, nil
+}
+
+// quoteFiles returns the list of the SQL string literals of the paths
+func quoteFiles(files []string) string {
+	res := make([]string, len(files))
+	for i, f := range files {
+		res[i] = "'" + strings.ReplaceAll(f, "'", "''") + "'"
+	}
+	return strings.Join(res, ", ")
+}
+
+// createBufferTable creates the table of the buffered rows of the snapshot, it reports false
+// if nothing is buffered
+func createBufferTable(ctx context.Context, conn *sql.Conn, name string,
+	snapshot *service.BufferSnapshot) (bool, error) {
+	schema := snapshot.Schema()
+	if len(schema) == 0 {
+		return false, nil
+	}
+	columns := make([]string, 0, len(schema))
+	for col := range schema {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	colDefs := make([]string, len(columns))
+	for i, col := range columns {
+		colDefs[i] = quoteIdent(col) + " " + data_types.SQLTypeName(schema[col])
+	}
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TEMP TABLE %s (%s)",
+		quoteIdent(name), strings.Join(colDefs, ", ")))
+	if err != nil {
+		return false, err
+	}
+
+	err = appendBuffer(ctx, conn, name, columns, snapshot)
+	return err == nil, err
+}
+
+// fromDuckDBValue converts the duckdb.Map values of the result to JSON encodable maps
+// and the decimals to floats
+func fromDuckDBValue(v any) any {
+	switch _v := v.(type) {
+	case duckdb.Decimal:
+		return _v.Float64()
+	case []any:
+		for i, e := range _v {
+			_v[i] = fromDuckDBValue(e)
+		}
+	case map[string]any:
+		for k, e := range _v {
+			_v[k] = fromDuckDBValue(e)
+		}
+	case duckdb.Map:
+		res := make(map[string]any, len(_v))
+		for k, e := range _v {
+			res[fmt.Sprint(k)] = fromDuckDBValue(e)
+		}
+		return res
+	}
+	return v
+}
+
+func scanRows(rows *sql.Rows) ([]map[string]any, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := []map[string]any{}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]any, len(columns))
+		for i, col := range columns {
+			row[col] = fromDuckDBValue(values[i])
+			if b, ok := values[i].([]byte); ok && types[i].DatabaseTypeName() == "UUID" {
+				// the UUIDs are scanned as bytes
+				if u, err := uuid.FromBytes(b); err == nil {
+					row[col] = u.String()
+				}
+			}
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
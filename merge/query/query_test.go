@@ -0,0 +1,460 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/decimal128"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/repository"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
+	"github.com/gigapi/gigapi/v2/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryReadsBufferedRows(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	p := repository.Store("db", "weather", map[string]any{
+		"temp": []float64{1, 2, 3},
+		"loc":  []string{"a", "b", "c"},
+	})
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	repository.Store("db", "weather", map[string]any{"temp": []float64{4}})
+
+	check := func() {
+		res, err := Query(context.Background(), "db",
+			"SELECT count(*) AS c, sum(temp) AS s, count(loc) AS l FROM weather")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || res[0]["c"] != int64(4) || res[0]["s"] != float64(10) || res[0]["l"] != int64(3) {
+			t.Fatalf("unexpected result: %v", res)
+		}
+	}
+	check()
+	time.Sleep(time.Second * 2)
+	check()
+}
+
+func TestQueryTimestampTypes(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	ts := time.Now().UnixNano()/1000*1000 + 789
+	p := repository.Store("db", "events", map[string]any{
+		"__timestamp": []int64{ts},
+		"day":         data_types.TypedData{Type: data_types.DATA_TYPE_NAME_DATE, Data: []int64{ts}},
+	})
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		res, err := Query(context.Background(), "db",
+			"SELECT typeof(__timestamp) AS t, epoch_ns(__timestamp) AS ns, typeof(day) AS d, "+
+				"day = __timestamp::DATE AS same_day FROM events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || res[0]["t"] != "TIMESTAMP_NS" || res[0]["ns"] != ts ||
+			res[0]["d"] != "DATE" || res[0]["same_day"] != true {
+			t.Fatalf("unexpected result: %v", res)
+		}
+	}
+	check()
+	time.Sleep(time.Second * 2)
+	check()
+}
+
+func TestQueryNestedTypes(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	p := repository.Store("db", "logs", map[string]any{
+		"n":    []int64{1, 2},
+		"tags": data_types.TypedData{Type: "VARCHAR[]", Data: []any{[]any{"a", "b"}, nil}},
+		"attrs": data_types.TypedData{Type: `STRUCT("k" FLOAT8, "s" VARCHAR)`,
+			Data: []any{map[string]any{"k": 1, "s": "x"}, map[string]any{"k": 2.5}}},
+		"labels":  data_types.TypedData{Type: "MAP(VARCHAR, INT8)", Data: []any{map[string]any{"a": 1}, nil}},
+		"payload": data_types.TypedData{Type: "JSON", Data: []any{map[string]any{"any": []any{1, "x"}}, true}},
+	})
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		res, err := Query(context.Background(), "db",
+			"SELECT typeof(tags) AS t, typeof(attrs) AS a, typeof(labels) AS l, typeof(payload) AS p, "+
+				"len(tags) AS tl, attrs.s AS s, labels['a'] AS la, payload->>'$.any[1]' AS pa FROM logs ORDER BY n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 2 || res[0]["t"] != "VARCHAR[]" || res[0]["a"] != "STRUCT(k DOUBLE, s VARCHAR)" ||
+			res[0]["l"] != "MAP(VARCHAR, BIGINT)" || res[0]["p"] != "JSON" ||
+			res[0]["tl"] != int64(2) || res[0]["s"] != "x" || res[0]["la"] != int64(1) || res[0]["pa"] != "x" ||
+			res[1]["tl"] != nil || res[1]["s"] != nil || res[1]["la"] != nil {
+			t.Fatalf("unexpected result: %v", res)
+		}
+	}
+	check()
+	time.Sleep(time.Second * 2)
+	check()
+}
+
+func TestQueryNarrowTypes(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	p1 := repository.Store("db", "readings", map[string]any{
+		"n":      []int64{1},
+		"small":  data_types.TypedData{Type: "SMALLINT", Data: []int64{-300}},
+		"count":  data_types.TypedData{Type: "UINTEGER", Data: []uint64{4000000000}},
+		"ratio":  data_types.TypedData{Type: "FLOAT4", Data: []float64{0.5}},
+		"price":  data_types.TypedData{Type: "DECIMAL(10,2)", Data: []string{"12.345"}},
+		"id":     data_types.TypedData{Type: "UUID", Data: []string{strings.ToUpper(id)}},
+		"digest": data_types.TypedData{Type: "BLOB", Data: []string{"\x00\xff"}},
+		"ok":     data_types.TypedData{Type: "BOOLEAN", Data: []bool{true}},
+	})
+	// the values of the parsers are converted to the buffered types
+	p2 := repository.Store("db", "readings", map[string]any{
+		"n":     []int64{2},
+		"small": []int64{300},
+		"price": []float64{0.1},
+		"ok":    data_types.TypedData{Type: "BOOLEAN", Data: []bool{false}},
+	})
+	p3 := repository.Store("db", "readings", map[string]any{"n": []int64{3}, "small": []int64{40000}})
+	if _, err := p3.Get(); err == nil {
+		t.Fatal("SMALLINT overflow is stored")
+	}
+	for _, p := range []utils.Promise[int32]{p1, p2} {
+		if _, err := p.Get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func() {
+		res, err := Query(context.Background(), "db",
+			"SELECT typeof(small) AS ts, typeof(count) AS tc, typeof(ratio) AS tr, typeof(price) AS tp, "+
+				"typeof(id) AS ti, typeof(digest) AS td, typeof(ok) AS tb, small, count, ratio, price, id, "+
+				"octet_length(digest) AS dl, ok "+
+				"FROM readings ORDER BY n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 2 || res[0]["ts"] != "SMALLINT" || res[0]["tc"] != "UINTEGER" || res[0]["tr"] != "FLOAT" ||
+			res[0]["tp"] != "DECIMAL(10,2)" || res[0]["ti"] != "UUID" || res[0]["td"] != "BLOB" || res[0]["tb"] != "BOOLEAN" ||
+			res[0]["small"] != int16(-300) || res[0]["count"] != uint32(4000000000) || res[0]["ratio"] != float32(0.5) ||
+			res[0]["price"] != 12.35 || res[0]["id"] != id || res[0]["dl"] != int64(2) ||
+			res[0]["ok"] != true || res[1]["small"] != int16(300) || res[1]["price"] != 0.1 || res[1]["ok"] != false {
+			t.Fatalf("unexpected result: %v", res)
+		}
+	}
+	check()
+	time.Sleep(time.Second * 2)
+	check()
+}
+
+func TestQueryRecordsTypes(t *testing.T) {
+	conf := &config.Configuration{Gigapi: config.GigapiConfiguration{Root: t.TempDir()}}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	rdr, err := QueryRecords(context.Background(), "db",
+		"SELECT 12.5::DECIMAL(6,2) AS d, TIMESTAMP_NS '2024-01-02 03:04:05.000000006' AS ts, DATE '2024-01-02' AS dt, "+
+			"[1, 2] AS l, NULL::VARCHAR AS s, 7::UTINYINT AS u FROM range(3)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Release()
+	if !rdr.Next() {
+		t.Fatal(rdr.Err())
+	}
+	rec := rdr.Record()
+	if rec.NumRows() != 3 {
+		t.Fatalf("unexpected rows: %d", rec.NumRows())
+	}
+	d := rec.Column(0).(*array.Decimal128)
+	ts := rec.Column(1).(*array.Timestamp)
+	dt := rec.Column(2).(*array.Date32)
+	if d.Value(0) != decimal128.FromI64(1250) || ts.Value(0) != arrow.Timestamp(1704164645000000006) ||
+		dt.Value(0).ToTime().Format(time.DateOnly) != "2024-01-02" ||
+		listText(rec.Column(3), 0) != "[1,2]" || !rec.Column(4).IsNull(0) ||
+		rec.Column(5).(*array.Uint8).Value(0) != 7 {
+		t.Fatalf("unexpected record: %v", rec)
+	}
+	if rdr.Next() {
+		t.Fatal("unexpected record")
+	}
+}
+
+// listText returns the list value of the row as JSON text, the builds without
+// the duckdb_arrow tag return it as text already
+func listText(arr arrow.Array, i int) string {
+	if l, ok := arr.(*array.List); ok {
+		start, end := l.ValueOffsets(i)
+		values := array.NewSlice(l.ListValues(), start, end)
+		defer values.Release()
+		text, _ := json.Marshal(values)
+		return string(text)
+	}
+	return arr.(*array.String).Value(i)
+}
+
+func TestQueryIsConfinedToTheDatabase(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  0.1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	p := repository.Store("confined", "weather", map[string]any{"temp": []float64{1, 2}})
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	repository.Store("confined", "weather", map[string]any{"temp": []float64{3}})
+	res, err := Query(context.Background(), "confined", "SELECT count(*) AS c FROM weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0]["c"] != int64(3) {
+		t.Fatalf("unexpected result: %v", res)
+	}
+
+	outside := filepath.Join(t.TempDir(), "out.csv")
+	for _, request := range []string{
+		"SELECT * FROM read_csv('/etc/passwd')",
+		"COPY (SELECT * FROM weather) TO '" + outside + "'",
+		"SET enable_external_access = true",
+		"SET lock_configuration = false",
+		"ATTACH '" + outside + ".db' AS x",
+	} {
+		if _, err = Query(context.Background(), "confined", request); err == nil {
+			t.Fatalf("%s: no error", request)
+		}
+	}
+	if _, err = os.Stat(outside); err == nil {
+		t.Fatal("the request wrote outside of the data root")
+	}
+	for _, database := range []string{"../confined", "..", "a/b"} {
+		if _, err = Query(context.Background(), database, "SELECT 1 FROM weather"); err == nil ||
+			!strings.Contains(err.Error(), "invalid database name") {
+			t.Fatalf("%s: unexpected result: %v", database, err)
+		}
+	}
+}
+
+func TestQueryIsReadOnly(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  0.1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	p := repository.Store("readonly", "weather", map[string]any{"temp": []float64{1, 2}})
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	parts, err := repository.ListFiles("readonly", "weather", nil)
+	if err != nil || len(parts) != 1 || len(parts[0].Files) != 1 {
+		t.Fatalf("unexpected partitions: %v, %v", parts, err)
+	}
+	saved := parts[0].Files[0].Path
+	inRoot := filepath.Join(conf.Gigapi.Root, "readonly", "weather", "copy.parquet")
+	for _, request := range []string{
+		"COPY (SELECT * FROM weather) TO '" + inRoot + "'",
+		"COPY (SELECT 1 AS temp) TO '" + saved + "' (USE_TMP_FILE false)",
+		"ATTACH '" + filepath.Join(conf.Gigapi.Root, "readonly.db") + "' AS x",
+		"SELECT * FROM read_parquet('" + saved + "'); COPY weather TO '" + inRoot + "'",
+		"INSTALL httpfs",
+		"EXPORT DATABASE '" + filepath.Join(conf.Gigapi.Root, "export") + "'",
+	} {
+		if _, err = Query(context.Background(), "readonly", request); err == nil {
+			t.Fatalf("%s: no error", request)
+		}
+	}
+	for _, f := range []string{inRoot, filepath.Join(conf.Gigapi.Root, "readonly.db"),
+		filepath.Join(conf.Gigapi.Root, "export")} {
+		if _, err = os.Stat(f); err == nil {
+			t.Fatalf("the request wrote %s", f)
+		}
+	}
+	res, err := Query(context.Background(), "readonly", "SELECT sum(temp) AS s FROM weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0]["s"] != float64(3) {
+		t.Fatalf("unexpected result: %v", res)
+	}
+}
+
+func TestQueryMixedLegacyTimestampFiles(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  0.1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	ts := time.Now().UnixNano()
+	p := repository.Store("legacy", "weather", map[string]any{
+		"__timestamp": []int64{ts, ts + 1},
+		"temp":        []float64{1, 2},
+	})
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	parts, err := repository.ListFiles("legacy", "weather", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 {
+		t.Fatalf("unexpected partitions: %+v", parts)
+	}
+
+	// a file written before __timestamp became a parquet timestamp, in the same partition
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(fmt.Sprintf("COPY (SELECT %d::BIGINT AS __timestamp, 3::DOUBLE AS temp) TO '%s' (FORMAT PARQUET)",
+		ts+2, filepath.Join(parts[0].Path, "legacy.1.parquet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repository.RebuildIndex("legacy", "weather"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Query(context.Background(), "legacy",
+		"SELECT count(*) AS c, sum(temp) AS s, epoch_ns(max(__timestamp)) AS m, "+
+			"any_value(typeof(__timestamp)) AS t FROM weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0]["c"] != int64(3) || res[0]["s"] != float64(6) || res[0]["m"] != ts+2 ||
+		res[0]["t"] != "TIMESTAMP_NS" {
+		t.Fatalf("unexpected result: %v", res)
+	}
+}
+
+func TestQueryInstancesAreIsolated(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  0.1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	for _, database := range []string{"isolated_a", "isolated_b"} {
+		p := repository.Store(database, "weather", map[string]any{"temp": []float64{1, 2}})
+		if _, err := p.Get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the reader keeps its connection open while the other queries and the merges run
+	rdr, err := QueryRecords(context.Background(), "isolated_a", "SELECT * FROM weather", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Release()
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			res, err := Query(context.Background(), "isolated_a", "SELECT sum(temp) AS s FROM weather")
+			if err == nil && (len(res) != 1 || res[0]["s"] != float64(3)) {
+				err = fmt.Errorf("unexpected result: %v", res)
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err = <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, cancel, err := mergeUtils.ConnectDuckDB("?allow_unsigned_extensions=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	out := filepath.Join(t.TempDir(), "out.parquet")
+	if _, err = db.Exec("COPY (SELECT 1 AS temp) TO '" + out + "' (FORMAT PARQUET)"); err != nil {
+		t.Fatalf("the merge connection is locked down: %v", err)
+	}
+
+	parts, err := repository.ListFiles("isolated_b", "weather", nil)
+	if err != nil || len(parts) != 1 || len(parts[0].Files) != 1 {
+		t.Fatalf("unexpected partitions: %v, %v", parts, err)
+	}
+	_, err = Query(context.Background(), "isolated_a",
+		"SELECT * FROM read_parquet('"+parts[0].Files[0].Path+"')")
+	if err == nil {
+		t.Fatal("the query read the files of another database")
+	}
+}
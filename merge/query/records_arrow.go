@@ -0,0 +1,96 @@
+//go:build duckdb_arrow
+
+package query
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	array18 "github.com/apache/arrow-go/v18/arrow/array"
+	ipc18 "github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/marcboeker/go-duckdb/v2"
+	"io"
+	"sync/atomic"
+)
+
+// queryRecords runs the request through the Arrow interface of DuckDB and returns its batches,
+// closeConn is called on release. The values are not converted, the nested types, intervals
+// and huge integers keep their arrow types.
+func queryRecords(ctx context.Context, conn *sql.Conn, request string,
+	closeConn func()) (array.RecordReader, error) {
+	var res array18.RecordReader
+	err := conn.Raw(func(driverConn any) error {
+		ar, err := duckdb.NewArrowFromConn(driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		res, err = ar.QueryContext(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromDuckDBArrow(res, closeConn)
+}
+
+// arrowReader reads the batches of the arrow version of go-duckdb
+type arrowReader struct {
+	*ipc.Reader
+	refs      int64
+	pipe      *io.PipeReader
+	done      chan struct{}
+	closeConn func()
+}
+
+// fromDuckDBArrow passes the batches of the reader over from the arrow version of go-duckdb
+// through an IPC stream, as toDuckDBArrow does the other way. The batches are copied one at a time
+// while they're read.
+func fromDuckDBArrow(rdr array18.RecordReader, closeConn func()) (*arrowReader, error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer rdr.Release()
+		w := ipc18.NewWriter(pw, ipc18.WithSchema(rdr.Schema()))
+		var err error
+		for err == nil && rdr.Next() {
+			err = w.Write(rdr.Record())
+		}
+		if err == nil {
+			err = rdr.Err()
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	res, err := ipc.NewReader(pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		<-done
+		return nil, err
+	}
+	return &arrowReader{
+		Reader:    res,
+		refs:      1,
+		pipe:      pr,
+		done:      done,
+		closeConn: closeConn,
+	}, nil
+}
+
+func (r *arrowReader) Retain() {
+	atomic.AddInt64(&r.refs, 1)
+}
+
+func (r *arrowReader) Release() {
+	if atomic.AddInt64(&r.refs, -1) != 0 {
+		return
+	}
+	r.Reader.Release()
+	r.pipe.CloseWithError(io.ErrClosedPipe)
+	<-r.done
+	r.closeConn()
+}
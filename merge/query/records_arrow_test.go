@@ -0,0 +1,46 @@
+//go:build duckdb_arrow
+
+package query
+
+import (
+	"context"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/decimal128"
+	"github.com/gigapi/gigapi/v2/config"
+	"math"
+	"testing"
+)
+
+func TestQueryRecordsKeepsArrowTypes(t *testing.T) {
+	conf := &config.Configuration{Gigapi: config.GigapiConfiguration{Root: t.TempDir()}}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	rdr, err := QueryRecords(context.Background(), "db",
+		"SELECT 170141183460469231731687303715884105727::HUGEINT AS h, INTERVAL 1 MONTH + INTERVAL 2 DAY AS i, "+
+			"{'a': 1, 'b': 'x'} AS s FROM range(2)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Release()
+	rows := 0
+	for rdr.Next() {
+		rec := rdr.Record()
+		rows += int(rec.NumRows())
+		h, ok := rec.Column(0).(*array.Decimal128)
+		if !ok || h.Value(0) != decimal128.New(math.MaxInt64, math.MaxUint64) {
+			t.Fatalf("unexpected huge integer: %v", rec.Column(0))
+		}
+		i, ok := rec.Column(1).(*array.MonthDayNanoInterval)
+		if !ok || i.Value(0) != (arrow.MonthDayNanoInterval{Months: 1, Days: 2}) {
+			t.Fatalf("unexpected interval: %v", rec.Column(1))
+		}
+		s, ok := rec.Column(2).(*array.Struct)
+		if !ok || s.Field(0).(*array.Int32).Value(0) != 1 || s.Field(1).(*array.String).Value(0) != "x" {
+			t.Fatalf("unexpected struct: %v", rec.Column(2))
+		}
+	}
+	if rdr.Err() != nil || rows != 2 {
+		t.Fatalf("unexpected result: %d rows, %v", rows, rdr.Err())
+	}
+}
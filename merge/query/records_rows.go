@@ -0,0 +1,244 @@
+//go:build !duckdb_arrow
+
+package query
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/decimal128"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/google/uuid"
+	"github.com/marcboeker/go-duckdb/v2"
+	"math/big"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// recordRows is the max number of rows of the records of QueryRecords
+const recordRows = 64 * 1024
+
+// queryRecords scans the rows of the request into arrow records, closeConn is called on release.
+// The builds with the duckdb_arrow tag read the Arrow batches of DuckDB instead.
+func queryRecords(ctx context.Context, conn *sql.Conn, request string,
+	closeConn func()) (array.RecordReader, error) {
+	rows, err := conn.QueryContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	res, err := newRowsReader(rows, closeConn)
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// rowsReader reads the SQL rows into records of up to recordRows rows
+type rowsReader struct {
+	refs      int64
+	rows      *sql.Rows
+	closeConn func()
+	schema    *arrow.Schema
+	appenders []valueAppender
+	builder   *array.RecordBuilder
+	values    []any
+	rec       arrow.Record
+	err       error
+}
+
+// valueAppender appends the scanned value, not nil, to the builder
+type valueAppender func(b array.Builder, v any) error
+
+func newRowsReader(rows *sql.Rows, closeConn func()) (*rowsReader, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]arrow.Field, len(types))
+	appenders := make([]valueAppender, len(types))
+	for i, t := range types {
+		fields[i] = arrow.Field{Name: t.Name(), Nullable: true}
+		fields[i].Type, appenders[i] = arrowType(t.DatabaseTypeName())
+	}
+	schema := arrow.NewSchema(fields, nil)
+	return &rowsReader{
+		refs:      1,
+		rows:      rows,
+		closeConn: closeConn,
+		schema:    schema,
+		appenders: appenders,
+		builder:   array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		values:    make([]any, len(types)),
+	}, nil
+}
+
+func (r *rowsReader) Retain() {
+	atomic.AddInt64(&r.refs, 1)
+}
+
+func (r *rowsReader) Release() {
+	if atomic.AddInt64(&r.refs, -1) != 0 {
+		return
+	}
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	r.builder.Release()
+	r.rows.Close()
+	r.closeConn()
+}
+
+func (r *rowsReader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+func (r *rowsReader) Record() arrow.Record {
+	return r.rec
+}
+
+func (r *rowsReader) Err() error {
+	return r.err
+}
+
+func (r *rowsReader) Next() bool {
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	if r.err != nil {
+		return false
+	}
+	pointers := make([]any, len(r.values))
+	for i := range r.values {
+		pointers[i] = &r.values[i]
+	}
+	n := 0
+	for n < recordRows && r.rows.Next() {
+		if r.err = r.rows.Scan(pointers...); r.err != nil {
+			return false
+		}
+		for i, v := range r.values {
+			b := r.builder.Field(i)
+			if v == nil {
+				b.AppendNull()
+				continue
+			}
+			if r.err = r.appenders[i](b, v); r.err != nil {
+				r.err = fmt.Errorf("column %s: %w", r.schema.Field(i).Name, r.err)
+				return false
+			}
+		}
+		n++
+	}
+	if r.err = r.rows.Err(); r.err != nil || n == 0 {
+		return false
+	}
+	r.rec = r.builder.NewRecord()
+	return true
+}
+
+var decimalTypeRe = regexp.MustCompile(`^DECIMAL\((\d+),\s*(\d+)\)$`)
+
+// arrowType returns the arrow type of the DuckDB column type and the appender of its values
+func arrowType(name string) (arrow.DataType, valueAppender) {
+	switch name {
+	case "BOOLEAN":
+		return arrow.FixedWidthTypes.Boolean, appendAs(func(b *array.BooleanBuilder, v bool) { b.Append(v) })
+	case "TINYINT":
+		return arrow.PrimitiveTypes.Int8, appendAs((*array.Int8Builder).Append)
+	case "SMALLINT":
+		return arrow.PrimitiveTypes.Int16, appendAs((*array.Int16Builder).Append)
+	case "INTEGER":
+		return arrow.PrimitiveTypes.Int32, appendAs((*array.Int32Builder).Append)
+	case "BIGINT":
+		return arrow.PrimitiveTypes.Int64, appendAs((*array.Int64Builder).Append)
+	case "UTINYINT":
+		return arrow.PrimitiveTypes.Uint8, appendAs((*array.Uint8Builder).Append)
+	case "USMALLINT":
+		return arrow.PrimitiveTypes.Uint16, appendAs((*array.Uint16Builder).Append)
+	case "UINTEGER":
+		return arrow.PrimitiveTypes.Uint32, appendAs((*array.Uint32Builder).Append)
+	case "UBIGINT":
+		return arrow.PrimitiveTypes.Uint64, appendAs((*array.Uint64Builder).Append)
+	case "FLOAT":
+		return arrow.PrimitiveTypes.Float32, appendAs((*array.Float32Builder).Append)
+	case "DOUBLE":
+		return arrow.PrimitiveTypes.Float64, appendAs((*array.Float64Builder).Append)
+	case "VARCHAR", "ENUM", "JSON":
+		return arrow.BinaryTypes.String, appendAs((*array.StringBuilder).Append)
+	case "BLOB":
+		return arrow.BinaryTypes.Binary, appendAs((*array.BinaryBuilder).Append)
+	case "UUID":
+		return arrow.BinaryTypes.String, appendAs(func(b *array.StringBuilder, v []byte) {
+			if u, err := uuid.FromBytes(v); err == nil {
+				b.Append(u.String())
+				return
+			}
+			b.Append(string(v))
+		})
+	case "DATE":
+		return arrow.FixedWidthTypes.Date32, appendAs(func(b *array.Date32Builder, v time.Time) {
+			b.Append(arrow.Date32FromTime(v))
+		})
+	case "TIME":
+		return arrow.FixedWidthTypes.Time64us, appendAs(func(b *array.Time64Builder, v time.Time) {
+			b.Append(arrow.Time64((v.Hour()*3600+v.Minute()*60+v.Second())*1e6 + v.Nanosecond()/1e3))
+		})
+	case "TIMESTAMP_S":
+		return timestampType(arrow.Second, "")
+	case "TIMESTAMP_MS":
+		return timestampType(arrow.Millisecond, "")
+	case "TIMESTAMP":
+		return timestampType(arrow.Microsecond, "")
+	case "TIMESTAMP_NS":
+		return timestampType(arrow.Nanosecond, "")
+	case "TIMESTAMPTZ":
+		return timestampType(arrow.Microsecond, "UTC")
+	}
+	if m := decimalTypeRe.FindStringSubmatch(name); m != nil {
+		precision, _ := strconv.Atoi(m[1])
+		scale, _ := strconv.Atoi(m[2])
+		return &arrow.Decimal128Type{Precision: int32(precision), Scale: int32(scale)},
+			appendAs(func(b *array.Decimal128Builder, v duckdb.Decimal) {
+				b.Append(decimal128.FromBigInt(v.Value))
+			})
+	}
+	return arrow.BinaryTypes.String, func(b array.Builder, v any) error {
+		if i, ok := v.(*big.Int); ok {
+			b.(*array.StringBuilder).Append(i.String())
+			return nil
+		}
+		text, err := json.Marshal(fromDuckDBValue(v))
+		if err != nil {
+			return err
+		}
+		b.(*array.StringBuilder).Append(string(text))
+		return nil
+	}
+}
+
+func timestampType(unit arrow.TimeUnit, tz string) (arrow.DataType, valueAppender) {
+	return &arrow.TimestampType{Unit: unit, TimeZone: tz},
+		appendAs(func(b *array.TimestampBuilder, v time.Time) {
+			b.Append(arrow.Timestamp(v.UnixNano() / int64(unit.Multiplier())))
+		})
+}
+
+// appendAs returns the appender of the values of type V to the builders of type B
+func appendAs[B array.Builder, V any](fn func(b B, v V)) valueAppender {
+	return func(b array.Builder, v any) error {
+		_v, ok := v.(V)
+		if !ok {
+			return fmt.Errorf("unexpected value %v of type %T", v, v)
+		}
+		fn(b.(B), _v)
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveWriter stores the files of an exported snapshot
+type ArchiveWriter interface {
+	WriteFile(name string, size int64, r io.Reader) error
+	Close() error
+}
+
+// ArchiveReader returns the files of an exported snapshot one by one
+type ArchiveReader interface {
+	// Next returns the next file of the archive or io.EOF
+	Next() (name string, r io.Reader, err error)
+	Close() error
+}
+
+// NewArchiveWriter creates the writer of the local directory or the S3 prefix (s3://...) target
+func NewArchiveWriter(ctx context.Context, target string) (ArchiveWriter, error) {
+	if strings.HasPrefix(target, "s3://") {
+		return &s3ArchiveWriter{ctx: ctx, url: target}, nil
+	}
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &dirArchiveWriter{dir: target}, nil
+}
+
+// NewArchiveReader creates the reader of the local directory or the S3 prefix (s3://...) source
+func NewArchiveReader(ctx context.Context, source string) (ArchiveReader, error) {
+	if strings.HasPrefix(source, "s3://") {
+		names, err := service.ListS3(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return &s3ArchiveReader{ctx: ctx, url: source, names: names}, nil
+	}
+	var names []string
+	err := filepath.WalkDir(source, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(source, p)
+		names = append(names, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return &dirArchiveReader{dir: source, names: names}, nil
+}
+
+type dirArchiveWriter struct {
+	dir string
+}
+
+func (d *dirArchiveWriter) WriteFile(name string, size int64, r io.Reader) error {
+	fileName := filepath.Join(d.dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(fileName), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (d *dirArchiveWriter) Close() error {
+	return nil
+}
+
+type dirArchiveReader struct {
+	dir   string
+	names []string
+	cur   *os.File
+}
+
+func (d *dirArchiveReader) Next() (string, io.Reader, error) {
+	if d.cur != nil {
+		d.cur.Close()
+		d.cur = nil
+	}
+	if len(d.names) == 0 {
+		return "", nil, io.EOF
+	}
+	name := d.names[0]
+	d.names = d.names[1:]
+	f, err := os.Open(filepath.Join(d.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return "", nil, err
+	}
+	d.cur = f
+	return name, f, nil
+}
+
+func (d *dirArchiveReader) Close() error {
+	if d.cur != nil {
+		return d.cur.Close()
+	}
+	return nil
+}
+
+type s3ArchiveWriter struct {
+	ctx context.Context
+	url string
+}
+
+func (s *s3ArchiveWriter) WriteFile(name string, size int64, r io.Reader) error {
+	return service.UploadToS3(s.ctx, s.url, name, r, size)
+}
+
+func (s *s3ArchiveWriter) Close() error {
+	return nil
+}
+
+type s3ArchiveReader struct {
+	ctx   context.Context
+	url   string
+	names []string
+	cur   io.ReadCloser
+}
+
+func (s *s3ArchiveReader) Next() (string, io.Reader, error) {
+	if s.cur != nil {
+		s.cur.Close()
+		s.cur = nil
+	}
+	if len(s.names) == 0 {
+		return "", nil, io.EOF
+	}
+	name := s.names[0]
+	s.names = s.names[1:]
+	obj, err := service.GetS3Object(s.ctx, s.url, name)
+	if err != nil {
+		return "", nil, err
+	}
+	s.cur = obj
+	return name, obj, nil
+}
+
+func (s *s3ArchiveReader) Close() error {
+	if s.cur != nil {
+		return s.cur.Close()
+	}
+	return nil
+}
+
+// TarArchiveWriter streams the snapshot as a tar archive
+type TarArchiveWriter struct {
+	w *tar.Writer
+}
+
+func NewTarArchiveWriter(w io.Writer) *TarArchiveWriter {
+	return &TarArchiveWriter{w: tar.NewWriter(w)}
+}
+
+func (t *TarArchiveWriter) WriteFile(name string, size int64, r io.Reader) error {
+	err := t.w.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(t.w, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("file %s: %d bytes written of %d", name, n, size)
+	}
+	return err
+}
+
+func (t *TarArchiveWriter) Close() error {
+	return t.w.Close()
+}
+
+// TarArchiveReader reads a tar archive stream
+type TarArchiveReader struct {
+	r *tar.Reader
+}
+
+func NewTarArchiveReader(r io.Reader) *TarArchiveReader {
+	return &TarArchiveReader{r: tar.NewReader(r)}
+}
+
+func (t *TarArchiveReader) Next() (string, io.Reader, error) {
+	for {
+		hdr, err := t.r.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return path.Clean(hdr.Name), t.r, nil
+		}
+	}
+}
+
+func (t *TarArchiveReader) Close() error {
+	return nil
+}
@@ -0,0 +1,391 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/index"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"github.com/google/uuid"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultExportTTL returns the time the files of an export are protected from the cleanup
+// if the export process dies before releasing them
+func DefaultExportTTL() time.Duration {
+	return config.Get().Gigapi.Retention.ExportPin()
+}
+
+// BackupStats describes the data of an exported or restored snapshot
+type BackupStats struct {
+	Tables []string `json:"tables"`
+	Files  int64    `json:"files"`
+	Bytes  int64    `json:"bytes"`
+	Rows   int64    `json:"rows"`
+}
+
+// Export writes a consistent snapshot of the tables of the database into the archive.
+// All the tables of the database are exported if no table is provided.
+//
+// The layout of the archive is
+//
+//	<db>/<table>/manifest.json
+//	<db>/<table>/<partition>/metadata.json
+//	<db>/<table>/<partition>/<file>.parquet
+//
+// The files of the snapshot are pinned for the time of the export,
+// so the merges running meanwhile don't remove them.
+func Export(ctx context.Context, db string, tables []string, w ArchiveWriter, ttl time.Duration) (*BackupStats, error) {
+	if db == "" {
+		db = "default"
+	}
+	if !tableNameCheck.MatchString(db) {
+		return nil, fmt.Errorf("invalid database name: %q", db)
+	}
+	if ttl <= 0 {
+		ttl = DefaultExportTTL()
+	}
+	if len(tables) == 0 {
+		manifests, err := ListTableManifests(db)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range manifests {
+			tables = append(tables, m.Table)
+		}
+	}
+	res := &BackupStats{Tables: []string{}}
+	for _, name := range tables {
+		if !tableNameCheck.MatchString(name) {
+			return nil, fmt.Errorf("invalid table name: %q", name)
+		}
+		err := exportTable(ctx, db, name, w, ttl, res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export table %s.%s: %w", db, name, err)
+		}
+		res.Tables = append(res.Tables, name)
+	}
+	return res, nil
+}
+
+// pinSnapshot lists and pins the live files of the table.
+// A file removed between the listing and the pin makes the snapshot retried.
+func pinSnapshot(db, name, tablePath, id string, ttl time.Duration) ([]PartitionFiles, error) {
+	for i := 0; i < 3; i++ {
+		partitions, err := ListFiles(db, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, part := range partitions {
+			for _, f := range part.Files {
+				files = append(files, f.Path)
+			}
+		}
+		err = service.PinFiles(tablePath, id, files, ttl)
+		if err != nil {
+			return nil, err
+		}
+		missing := false
+		for _, f := range files {
+			if _, err := os.Stat(f); err != nil {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			return partitions, nil
+		}
+	}
+	return nil, errors.New("the files of the table are changing too fast, try again later")
+}
+
+func exportTable(ctx context.Context, db, name string, w ArchiveWriter, ttl time.Duration, stats *BackupStats) error {
+	tablePath := filepath.Join(config.Get().Gigapi.Root, db, name)
+	id := "export-" + uuid.New().String()
+	partitions, err := pinSnapshot(db, name, tablePath, id, ttl)
+	defer service.UnpinFiles(tablePath, id)
+	if err != nil {
+		return err
+	}
+	manifest, err := GetTableManifest(db, name)
+	if err != nil {
+		return err
+	}
+	table := &shared.Table{Database: db, Name: name, Path: tablePath, Engine: manifest.Engine, OrderBy: manifest.OrderBy}
+	if manifest.PartitionBy != "" {
+		table.Partitioning, err = shared.ParsePartitionScheme(manifest.PartitionBy)
+		if err != nil {
+			return err
+		}
+	}
+
+	var summaries []shared.PartitionSummary
+	for _, part := range partitions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(tablePath, part.Path)
+		if err != nil {
+			return err
+		}
+		prefix := path.Join(db, name, filepath.ToSlash(rel))
+		entries := make([]*shared.IndexEntry, len(part.Files))
+		summary := shared.PartitionSummary{Path: filepath.ToSlash(rel), Files: int64(len(part.Files))}
+		hasTime := false
+		for i, e := range part.Files {
+			err = exportFile(w, path.Join(prefix, filepath.Base(e.Path)), e.Path)
+			if err != nil {
+				return err
+			}
+			_e := *e
+			_e.Path = filepath.Base(e.Path)
+			entries[i] = &_e
+
+			// the files without __timestamp, e.g. the foreign ones, don't extend the time range
+			minTime, okMin := e.Min["__timestamp"].(int64)
+			maxTime, okMax := e.Max["__timestamp"].(int64)
+			if okMin && okMax {
+				if !hasTime {
+					summary.MinTime, summary.MaxTime, hasTime = minTime, maxTime, true
+				}
+				summary.MinTime = min(summary.MinTime, minTime)
+				summary.MaxTime = max(summary.MaxTime, maxTime)
+			}
+			summary.ParquetSizeBytes += e.SizeBytes
+			summary.RowCount += e.RowCount
+			stats.Files++
+			stats.Bytes += e.SizeBytes
+			stats.Rows += e.RowCount
+		}
+		// the index is written after the files to be restored only if all of them are
+		metadata, err := index.MarshalPartitionFiles(table, entries)
+		if err != nil {
+			return err
+		}
+		err = w.WriteFile(path.Join(prefix, "metadata.json"), int64(len(metadata)), bytes.NewReader(metadata))
+		if err != nil {
+			return err
+		}
+		summaries = append(summaries, summary)
+	}
+
+	snapshot := index.NewTableManifest(table, summaries, manifest.Schema, time.Now().UnixNano())
+	snapshot.Engine, snapshot.PartitionBy = manifest.Engine, manifest.PartitionBy
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return w.WriteFile(path.Join(db, name, index.ManifestFileName), int64(len(data)), bytes.NewReader(data))
+}
+
+func exportFile(w ArchiveWriter, name string, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return w.WriteFile(name, stat.Size(), io.LimitReader(f, stat.Size()))
+}
+
+type restoredPartition struct {
+	values  [][2]string
+	entries []*shared.IndexEntry
+}
+
+type restoredTable struct {
+	db, name   string
+	manifest   *shared.TableManifest
+	partitions map[string]*restoredPartition
+}
+
+// Restore imports the tables of an archive written by Export and registers them.
+// The tables are restored into the db database if it's not empty,
+// or into the databases they were exported from.
+// The restored files are added to the existing data of the tables.
+func Restore(ctx context.Context, r ArchiveReader, db string) (*BackupStats, error) {
+	if db != "" && !tableNameCheck.MatchString(db) {
+		return nil, fmt.Errorf("invalid database name: %q", db)
+	}
+	tables := make(map[[2]string]*restoredTable)
+	getTable := func(_db, name string) *restoredTable {
+		t, ok := tables[[2]string{_db, name}]
+		if !ok {
+			t = &restoredTable{db: _db, name: name, partitions: make(map[string]*restoredPartition)}
+			tables[[2]string{_db, name}] = t
+		}
+		return t
+	}
+	res := &BackupStats{Tables: []string{}}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name, rdr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(path.Clean(name), "/")
+		if len(parts) < 3 || !tableNameCheck.MatchString(parts[0]) || !tableNameCheck.MatchString(parts[1]) {
+			return nil, fmt.Errorf("unexpected file in the archive: %q", name)
+		}
+		_db, tableName, fileName := parts[0], parts[1], parts[len(parts)-1]
+		if db != "" {
+			_db = db
+		}
+		table := getTable(_db, tableName)
+		if len(parts) == 3 {
+			if fileName != index.ManifestFileName {
+				return nil, fmt.Errorf("unexpected file in the archive: %q", name)
+			}
+			table.manifest = &shared.TableManifest{}
+			err = json.NewDecoder(rdr).Decode(table.manifest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid manifest %q: %w", name, err)
+			}
+			continue
+		}
+		partPath := path.Join(parts[2 : len(parts)-1]...)
+		values, err := shared.ParsePartitionPath(partPath)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected file in the archive: %q: %w", name, err)
+		}
+		dir := filepath.Join(config.Get().Gigapi.Root, _db, tableName, filepath.FromSlash(partPath))
+		switch {
+		case fileName == "metadata.json":
+			data, err := io.ReadAll(rdr)
+			if err != nil {
+				return nil, err
+			}
+			entries, err := index.UnmarshalPartitionFiles(data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q: %w", name, err)
+			}
+			for _, e := range entries {
+				e.Path = filepath.Join(dir, filepath.Base(e.Path))
+			}
+			table.partitions[partPath] = &restoredPartition{values: values, entries: entries}
+		case strings.HasSuffix(fileName, ".parquet"):
+			size, err := restoreFile(filepath.Join(config.Get().Gigapi.Root, _db, tableName, "tmp"),
+				dir, fileName, rdr)
+			if err != nil {
+				return nil, err
+			}
+			res.Files++
+			res.Bytes += size
+		default:
+			return nil, fmt.Errorf("unexpected file in the archive: %q", name)
+		}
+	}
+
+	keys := make([][2]string, 0, len(tables))
+	for k := range tables {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		rows, err := registerRestoredTable(tables[k])
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore table %s.%s: %w", k[0], k[1], err)
+		}
+		res.Rows += rows
+		res.Tables = append(res.Tables, k[0]+"."+k[1])
+	}
+	return res, nil
+}
+
+// restoreFile writes the file into the partition folder via the tmp folder of the table,
+// so a partially restored file is never seen by the merges
+func restoreFile(tmpPath, dir, fileName string, r io.Reader) (int64, error) {
+	target := filepath.Join(dir, fileName)
+	if _, err := os.Stat(target); err == nil {
+		return 0, fmt.Errorf("file %s already exists", target)
+	}
+	for _, p := range []string{tmpPath, dir} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return 0, err
+		}
+	}
+	f, err := os.CreateTemp(tmpPath, "restore-*.parquet")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(f, r)
+	f.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), target)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+func registerRestoredTable(t *restoredTable) (int64, error) {
+	var (
+		scheme  *shared.PartitionScheme
+		orderBy []string
+		schema  map[string]string
+		err     error
+	)
+	if t.manifest != nil {
+		if t.manifest.PartitionBy != "" {
+			scheme, err = shared.ParsePartitionScheme(t.manifest.PartitionBy)
+			if err != nil {
+				return 0, err
+			}
+		}
+		orderBy, schema = t.manifest.OrderBy, t.manifest.Schema
+	}
+	err = CreateHiveTable(t.db, t.name, scheme, orderBy, schema)
+	if err != nil {
+		return 0, err
+	}
+	table := getRegisteredTable(t.db, t.name)
+	if table == nil || table.IndexCreator == nil {
+		return 0, fmt.Errorf("table %s.%s is not registered", t.db, t.name)
+	}
+	var rows int64
+	for _, part := range t.partitions {
+		// the files missing in the archive are not indexed
+		entries := make([]*shared.IndexEntry, 0, len(part.entries))
+		for _, e := range part.entries {
+			if _, err := os.Stat(e.Path); err == nil {
+				entries = append(entries, e)
+				rows += e.RowCount
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		idx, err := table.IndexCreator(part.values)
+		if err != nil {
+			return 0, err
+		}
+		_, err = idx.Batch(entries, nil).Get()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// initTestConfig points the configuration to a temp root with short save and cleanup delays
+func initTestConfig(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Root:          t.TempDir(),
+			MergeTimeoutS: 10,
+			SaveTimeoutS:  0.1,
+			PartitionBy:   "hour",
+			FlushRows:     1000000,
+			Retention:     config.RetentionConfiguration{MergedFilesS: 0.2},
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+}
+
+// uniqueName returns a name not registered by the previous tests, the registry outlives them
+func uniqueName(name string) string {
+	return fmt.Sprintf("%s_%d", name, time.Now().UnixNano())
+}
+
+// storeRows saves the rows at the timestamps as a single .1 file of the table
+func storeRows(t *testing.T, db, name string, ts ...int64) {
+	values := make([]float64, len(ts))
+	for i := range values {
+		values[i] = float64(i)
+	}
+	_, err := Store(db, name, map[string]any{"__timestamp": ts, "value": values}).Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countRows returns the number of the files and the rows of the table
+func countRows(t *testing.T, db, name string) (int, int64) {
+	parts, err := ListFiles(db, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, rows := 0, int64(0)
+	for _, p := range parts {
+		for _, f := range p.Files {
+			files++
+			rows += f.RowCount
+		}
+	}
+	return files, rows
+}
+
+func TestExportRestore(t *testing.T) {
+	initTestConfig(t)
+	src, dst := uniqueName("backup_src"), uniqueName("backup_dst")
+	ts := time.Now().UnixNano()
+	storeRows(t, src, "weather", ts, ts+1, ts+2)
+	storeRows(t, src, "weather", ts+3)
+
+	dir := t.TempDir()
+	archive, err := NewArchiveWriter(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := Export(context.Background(), src, nil, archive, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Tables) != 1 || stats.Files != 2 || stats.Rows != 4 {
+		t.Fatalf("unexpected export: %+v", stats)
+	}
+	if _, err = os.Stat(filepath.Join(dir, src, "weather", "manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+	// the pins are released once the export is done
+	pins, _ := os.ReadDir(filepath.Join(config.Get().Gigapi.Root, src, "weather", "pins"))
+	if len(pins) != 0 {
+		t.Fatalf("unexpected pins: %v", pins)
+	}
+
+	rdr, err := NewArchiveReader(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Close()
+	stats, err = Restore(context.Background(), rdr, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Tables) != 1 || stats.Tables[0] != dst+".weather" || stats.Files != 2 || stats.Rows != 4 {
+		t.Fatalf("unexpected restore: %+v", stats)
+	}
+	if files, rows := countRows(t, dst, "weather"); files != 2 || rows != 4 {
+		t.Fatalf("unexpected restored table: %d files, %d rows", files, rows)
+	}
+
+	// restoring the same files again fails
+	rdr, err = NewArchiveReader(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Close()
+	if _, err = Restore(context.Background(), rdr, dst); err == nil {
+		t.Fatal("the existing files were restored again")
+	}
+}
+
+// hookedArchiveWriter runs the hook before writing the first file
+type hookedArchiveWriter struct {
+	ArchiveWriter
+	hook func()
+}
+
+func (h *hookedArchiveWriter) WriteFile(name string, size int64, r io.Reader) error {
+	if h.hook != nil {
+		h.hook()
+		h.hook = nil
+	}
+	return h.ArchiveWriter.WriteFile(name, size, r)
+}
+
+func TestExportPinsMergedFiles(t *testing.T) {
+	initTestConfig(t)
+	src, dst := uniqueName("backup_pins"), uniqueName("backup_pins_dst")
+	ts := time.Now().UnixNano()
+	storeRows(t, src, "weather", ts, ts+1)
+	storeRows(t, src, "weather", ts+2)
+	parts, err := ListFiles(src, "weather", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, f := range parts[0].Files {
+		sources = append(sources, f.Path)
+	}
+
+	var buf bytes.Buffer
+	archive := &hookedArchiveWriter{ArchiveWriter: NewTarArchiveWriter(&buf), hook: func() {
+		// the snapshot is pinned: the merged sources outlive the retention of the merged files
+		if err := CompactTable(src, "weather"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(config.Get().Gigapi.Retention.MergedFiles() * 5)
+		for _, f := range sources {
+			if _, err := os.Stat(f); err != nil {
+				t.Fatalf("pinned file removed by the merge cleanup: %v", err)
+			}
+		}
+	}}
+	stats, err := Export(context.Background(), src, nil, archive, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Rows != 3 {
+		t.Fatalf("unexpected export: %+v", stats)
+	}
+	if files, rows := countRows(t, src, "weather"); files != 1 || rows != 3 {
+		t.Fatalf("unexpected merged table: %d files, %d rows", files, rows)
+	}
+
+	// the sources are removed once unpinned
+	deadline := time.Now().Add(time.Second * 5)
+	for _, f := range sources {
+		for _, err = os.Stat(f); err == nil && time.Now().Before(deadline); _, err = os.Stat(f) {
+			time.Sleep(time.Millisecond * 100)
+		}
+		if err == nil {
+			t.Fatalf("unpinned file %s not removed", f)
+		}
+	}
+
+	stats, err = Restore(context.Background(), NewTarArchiveReader(&buf), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, rows := countRows(t, dst, "weather"); files != 2 || rows != 3 {
+		t.Fatalf("unexpected restored table: %d files, %d rows", files, rows)
+	}
+}
+
+func TestRestoreRejectsUnexpectedFiles(t *testing.T) {
+	initTestConfig(t)
+	for _, name := range []string{
+		"db/t/x.parquet",
+		"db/x.parquet",
+		"../db/t/p=1/x.parquet",
+		"db/t/date=2025-04-24/x.txt",
+		"db/t/invalid/x.parquet",
+	} {
+		var buf bytes.Buffer
+		w := NewTarArchiveWriter(&buf)
+		if err := w.WriteFile(name, 4, strings.NewReader("PAR1")); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		_, err := Restore(context.Background(), NewTarArchiveReader(&buf), "")
+		if err == nil || !strings.Contains(err.Error(), "unexpected file") {
+			t.Fatalf("%s: unexpected result: %v", name, err)
+		}
+	}
+	entries, err := os.ReadDir(config.Get().Gigapi.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("files restored from the invalid archives: %v", entries)
+	}
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"os"
+	"path/filepath"
+)
+
+// discoverTables registers the tables created by the writer nodes sharing the data root
+// and picks up the new partitions of the registered ones
+func discoverTables() error {
+	dbs, err := os.ReadDir(config.Get().Gigapi.Root)
+	if err != nil {
+		return err
+	}
+	for _, db := range dbs {
+		if !db.IsDir() || !tableNameCheck.MatchString(db.Name()) {
+			continue
+		}
+		tables, err := os.ReadDir(filepath.Join(config.Get().Gigapi.Root, db.Name()))
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if !table.IsDir() || !tableNameCheck.MatchString(table.Name()) {
+				continue
+			}
+			err = discoverTable(db.Name(), table.Name())
+			if err != nil {
+				fmt.Printf("failed to discover table %s.%s: %v\n", db.Name(), table.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func discoverTable(db, name string) error {
+	m.Lock()
+	svc := lookupTable(db, name)
+	if svc == nil {
+		err := RegisterSimpleTable(db, name)
+		m.Unlock()
+		// the partitions of a new table are discovered on registration
+		return err
+	}
+	m.Unlock()
+	if discoverer, ok := svc.(service.Discoverer); ok {
+		return discoverer.Discover()
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/index"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// PartitionFiles is the list of files of a single partition selected by an index query
+type PartitionFiles struct {
+	Values [][2]string
+	Path   string
+	Files  []*shared.IndexEntry
+}
+
+// ListFiles returns the live parquet files of all the partitions of the table matching the query.
+// The partitions out of the query time range are skipped without reading their indexes.
+func ListFiles(db string, name string, q *shared.IndexQuery) ([]PartitionFiles, error) {
+	if db == "" {
+		db = "default"
+	}
+	if q == nil {
+		q = shared.NewIndexQuery()
+	}
+	tablePath := filepath.Join(config.Get().Gigapi.Root, db, name)
+	if _, err := os.Stat(tablePath); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("table %q not found", name)
+	}
+	table := &shared.Table{Database: db, Name: name, Path: tablePath}
+	var res []PartitionFiles
+	err := filepath.WalkDir(tablePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == tablePath {
+			return nil
+		}
+		rel, err := filepath.Rel(tablePath, p)
+		if err != nil {
+			return err
+		}
+		values, err := shared.ParsePartitionPath(rel)
+		if err != nil {
+			// tmp, data and other service folders
+			return filepath.SkipDir
+		}
+		if from, to, ok := shared.PartitionTimeRange(values); ok && (to < q.MinTime || from > q.MaxTime) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(p, "metadata.json")); err != nil {
+			return nil
+		}
+		idx, err := index.NewJSONIndexForPartition(table, values)
+		if err != nil {
+			return err
+		}
+		files := idx.Query(q)
+		if len(files) > 0 {
+			res = append(res, PartitionFiles{Values: values, Path: p, Files: files})
+		}
+		return nil
+	})
+	return res, err
+}
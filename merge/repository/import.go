@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/parsers"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/gigapi/gigapi/v2/utils"
+	"io"
+	"reflect"
+	"time"
+)
+
+// importRetryInterval is the pause before a batch rejected by the full buffer is stored again
+const importRetryInterval = 100 * time.Millisecond
+
+// ParseError is returned by Import for the invalid input, as opposed to the storage errors
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ImportError is returned by Import if it fails after a part of the rows is saved.
+// Rows is the number of the leading rows of the file which are saved, the rest should be imported again.
+type ImportError struct {
+	Rows int64
+	Err  error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%v (%d rows imported)", e.Err, e.Rows)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// Import stores all the rows parsed from the reader into the database.
+// It returns the number of the rows once they are saved and indexed.
+// The file is parsed completely before any row is stored, so an invalid file stores nothing,
+// and the batches wait for the buffer to drain instead of failing on backpressure.
+func Import(ctx context.Context, db string, parser parsers.IParser, r io.ReadSeeker) (int64, error) {
+	rows, err := parseAll(ctx, parser, r, nil)
+	if err != nil {
+		return 0, &ParseError{Err: err}
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var (
+		promises  []utils.Promise[int32]
+		batchRows []int64
+	)
+	_, storeErr := parseAll(ctx, parser, r, func(res *parsers.ParserResponse, n int64) error {
+		p, err := storeBatch(ctx, db, res)
+		if err != nil {
+			return err
+		}
+		promises = append(promises, p)
+		batchRows = append(batchRows, n)
+		return nil
+	})
+	// the rows are counted up to the first failed batch
+	var saved int64
+	for i, p := range promises {
+		if _, _err := p.Get(); _err != nil && err == nil {
+			err = _err
+		}
+		if err == nil {
+			saved += batchRows[i]
+		}
+	}
+	if err == nil {
+		err = storeErr
+	}
+	if err != nil {
+		return saved, &ImportError{Rows: saved, Err: err}
+	}
+	return rows, nil
+}
+
+// parseAll reads all the batches of the parser and returns the number of the rows.
+// The batches are passed to fn if it's set.
+func parseAll(ctx context.Context, parser parsers.IParser, r io.Reader,
+	fn func(res *parsers.ParserResponse, rows int64) error) (int64, error) {
+	res, err := parser.ParseReader(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		go func() {
+			for range res {
+			}
+		}()
+	}()
+	var rows int64
+	for _res := range res {
+		if _res.Error != nil {
+			return 0, _res.Error
+		}
+		var n int64
+		for _, col := range _res.Data {
+			n = dataRows(col)
+			break
+		}
+		rows += n
+		if fn == nil {
+			continue
+		}
+		if err = fn(_res, n); err != nil {
+			return 0, err
+		}
+	}
+	return rows, nil
+}
+
+// storeBatch stores the parsed batch. If the buffer is full it waits for the buffer to drain
+// and stores the batch again, a rejected batch is not buffered.
+func storeBatch(ctx context.Context, db string, res *parsers.ParserResponse) (utils.Promise[int32], error) {
+	for {
+		p := Store(db, res.Table, res.Data)
+		var bufErr *service.BufferFullError
+		if _, _, err := p.Peek(); !errors.As(err, &bufErr) {
+			return p, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(importRetryInterval):
+		}
+	}
+}
+
+// dataRows returns the number of the rows of the column data of a parser
+func dataRows(data any) int64 {
+	if nullable, ok := data.(data_types.Nullable); ok {
+		data = nullable.Data
+	}
+	if typed, ok := data.(data_types.TypedData); ok {
+		data = typed.Data
+	}
+	if dict, ok := data.(data_types.DictStrings); ok {
+		return int64(len(dict.Keys))
+	}
+	return int64(reflect.ValueOf(data).Len())
+}
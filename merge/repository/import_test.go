@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/parsers"
+	"io"
+	"testing"
+	"time"
+)
+
+// batchParser returns the prepared batches followed by the error if it's set
+type batchParser struct {
+	batches []map[string]any
+	err     error
+}
+
+func (p *batchParser) Parse(data []byte) (chan *parsers.ParserResponse, error) {
+	return p.ParseReader(context.Background(), bytes.NewReader(data))
+}
+
+func (p *batchParser) ParseReader(ctx context.Context, r io.Reader) (chan *parsers.ParserResponse, error) {
+	res := make(chan *parsers.ParserResponse)
+	go func() {
+		defer close(res)
+		for _, batch := range p.batches {
+			res <- &parsers.ParserResponse{Table: "weather", Data: batch}
+		}
+		if p.err != nil {
+			res <- &parsers.ParserResponse{Error: p.err}
+		}
+	}()
+	return res, nil
+}
+
+// weatherBatch returns the columns of the rows with the values at the consecutive timestamps
+func weatherBatch(ts int64, values ...float64) map[string]any {
+	timestamps := make([]int64, len(values))
+	for i := range timestamps {
+		timestamps[i] = ts + int64(i)
+	}
+	return map[string]any{"__timestamp": timestamps, "value": values}
+}
+
+func TestImportParseErrorStoresNothing(t *testing.T) {
+	initTestConfig(t)
+	db := uniqueName("import")
+	parser := &batchParser{
+		batches: []map[string]any{weatherBatch(time.Now().UnixNano(), 1, 2)},
+		err:     errors.New("corrupted page"),
+	}
+	_, err := Import(context.Background(), db, parser, bytes.NewReader(nil))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+	if getRegisteredTable(db, "weather") != nil {
+		t.Fatal("the rows before the invalid batch are stored")
+	}
+}
+
+func TestImportWaitsForBuffer(t *testing.T) {
+	initTestConfig(t)
+	conf := *config.Get()
+	conf.Gigapi.MaxTableBufferRows = 2
+	config.Set(&conf)
+	db := uniqueName("import")
+	ts := time.Now().UnixNano()
+	parser := &batchParser{batches: []map[string]any{
+		weatherBatch(ts, 1, 2),
+		weatherBatch(ts+10, 3, 4),
+		weatherBatch(ts+20, 5, 6),
+	}}
+	rows, err := Import(context.Background(), db, parser, bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, saved := countRows(t, db, "weather"); rows != 6 || saved != 6 {
+		t.Fatalf("expected 6 imported rows, got %d, %d saved", rows, saved)
+	}
+}
+
+func TestImportReportsSavedRows(t *testing.T) {
+	initTestConfig(t)
+	db := uniqueName("import")
+	ts := time.Now().UnixNano()
+	parser := &batchParser{batches: []map[string]any{
+		weatherBatch(ts, 1, 2),
+		// the type of the column differs from the stored one
+		{"__timestamp": []int64{ts + 10}, "value": []string{"3"}},
+	}}
+	_, err := Import(context.Background(), db, parser, bytes.NewReader(nil))
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || importErr.Rows != 2 {
+		t.Fatalf("expected the import error after 2 rows, got %v", err)
+	}
+	if _, saved := countRows(t, db, "weather"); saved != 2 {
+		t.Fatalf("expected 2 saved rows, got %d", saved)
+	}
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/index"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// openTable returns the service of the existing table registering it if needed
+func openTable(db, name string) (service.MergeService, error) {
+	if !tableNameCheck.MatchString(db) || !tableNameCheck.MatchString(name) {
+		return nil, fmt.Errorf("invalid table name: %s.%s", db, name)
+	}
+	if _, err := os.Stat(filepath.Join(config.Get().Gigapi.Root, db, name)); err != nil {
+		return nil, fmt.Errorf("table %s.%s not found", db, name)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if svc := lookupTable(db, name); svc != nil {
+		return svc, nil
+	}
+	err := RegisterSimpleTable(db, name)
+	if err != nil {
+		return nil, err
+	}
+	return lookupTable(db, name), nil
+}
+
+// CompactTable runs all the merge iterations of all the partitions of the table
+func CompactTable(db, name string) error {
+	svc, err := openTable(db, name)
+	if err != nil {
+		return err
+	}
+	compactor, ok := svc.(service.Compactor)
+	if !ok {
+		return fmt.Errorf("table %s.%s doesn't support compaction", db, name)
+	}
+	return compactor.Compact()
+}
+
+// RebuildIndex regenerates the metadata.json of every partition of the table
+// from the footers of its parquet files. It returns the files with an unreadable footer.
+func RebuildIndex(db, name string) ([]string, error) {
+	if !tableNameCheck.MatchString(db) || !tableNameCheck.MatchString(name) {
+		return nil, fmt.Errorf("invalid table name: %s.%s", db, name)
+	}
+	tablePath := filepath.Join(config.Get().Gigapi.Root, db, name)
+	if _, err := os.Stat(tablePath); err != nil {
+		return nil, fmt.Errorf("table %s.%s not found", db, name)
+	}
+	registered := getRegisteredTable(db, name)
+	table := registered
+	if table == nil {
+		var err error
+		table, err = detachedTable(db, name, tablePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var skipped []string
+	err := filepath.WalkDir(tablePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == tablePath {
+			return nil
+		}
+		rel, err := filepath.Rel(tablePath, p)
+		if err != nil {
+			return err
+		}
+		values, err := shared.ParsePartitionPath(rel)
+		if err != nil {
+			// tmp, data and other service folders
+			return filepath.SkipDir
+		}
+		if !hasParquetFiles(p) {
+			if _, err := os.Stat(filepath.Join(p, "metadata.json")); err != nil {
+				return nil
+			}
+		}
+		lock, err := mergeUtils.LockFile(filepath.Join(p, "merge.lock"))
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		_skipped, err := index.RebuildPartitionIndex(table, values)
+		if err != nil {
+			return fmt.Errorf("partition %s: %w", rel, err)
+		}
+		skipped = append(skipped, _skipped...)
+		if registered != nil && registered.IndexCreator != nil {
+			idx, err := registered.IndexCreator(values)
+			if err != nil {
+				return err
+			}
+			return idx.Refresh()
+		}
+		return nil
+	})
+	if table.Manifest != nil {
+		table.Manifest.Flush()
+	}
+	return skipped, err
+}
+
+func hasParquetFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".parquet") {
+			return true
+		}
+	}
+	return false
+}
+
+// FlushManifests writes the pending updates of the manifests of the registered tables
+func FlushManifests() {
+	tablesMtx.Lock()
+	_tables := make([]*shared.Table, 0, len(tables))
+	for _, t := range tables {
+		_tables = append(_tables, t)
+	}
+	tablesMtx.Unlock()
+	for _, t := range _tables {
+		if t.Manifest != nil {
+			t.Manifest.Flush()
+		}
+	}
+}
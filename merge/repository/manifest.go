@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/index"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// tables are the HiveMerge tables registered by this process
+var tables = make(map[[2]string]*shared.Table)
+var tablesMtx sync.Mutex
+
+func registerTable(table *shared.Table) {
+	tablesMtx.Lock()
+	defer tablesMtx.Unlock()
+	tables[[2]string{table.Database, table.Name}] = table
+}
+
+func getRegisteredTable(db, name string) *shared.Table {
+	tablesMtx.Lock()
+	defer tablesMtx.Unlock()
+	return tables[[2]string{db, name}]
+}
+
+// GetTableManifest returns the manifest of the table.
+// The manifests of the tables not served by this process are read from the table root.
+func GetTableManifest(db, name string) (*shared.TableManifest, error) {
+	if db == "" {
+		db = "default"
+	}
+	if table := getRegisteredTable(db, name); table != nil && table.Manifest != nil {
+		return table.Manifest.Get(), nil
+	}
+	if !tableNameCheck.MatchString(name) {
+		return nil, fmt.Errorf("invalid table name: %q", name)
+	}
+	tablePath := filepath.Join(config.Get().Gigapi.Root, db, name)
+	res, err := index.ReadTableManifest(tablePath)
+	if !errors.Is(err, os.ErrNotExist) {
+		return res, err
+	}
+	if _, err := os.Stat(tablePath); err != nil {
+		return nil, fmt.Errorf("table %q not found", name)
+	}
+	return index.RebuildTableManifest(&shared.Table{
+		Database: db,
+		Name:     name,
+		Path:     tablePath,
+		Engine:   "HiveMerge",
+		OrderBy:  []string{"__timestamp"},
+	})
+}
+
+// ListDatabases returns the names of the databases having tables, sorted
+func ListDatabases() ([]string, error) {
+	entries, err := os.ReadDir(config.Get().Gigapi.Root)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, entry := range entries {
+		if entry.IsDir() && tableNameCheck.MatchString(entry.Name()) {
+			res = append(res, entry.Name())
+		}
+	}
+	return res, nil
+}
+
+// ListTableManifests returns the manifests of all the tables of the database
+func ListTableManifests(db string) ([]*shared.TableManifest, error) {
+	if db == "" {
+		db = "default"
+	}
+	entries, err := os.ReadDir(filepath.Join(config.Get().Gigapi.Root, db))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("database %q not found", db)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*shared.TableManifest, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || !tableNameCheck.MatchString(entry.Name()) {
+			continue
+		}
+		manifest, err := GetTableManifest(db, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, manifest)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Table < res[j].Table
+	})
+	return res, nil
+}
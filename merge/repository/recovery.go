@@ -0,0 +1,435 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/index"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultCheckMinAge returns the age of the files not referenced by the indexes
+// after which they are considered left by a crashed save or merge
+func DefaultCheckMinAge() time.Duration {
+	return config.Get().Gigapi.Retention.TmpFiles()
+}
+
+// CheckOptions configures the consistency check of the tables
+type CheckOptions struct {
+	// Repair fixes the found problems, otherwise they are only reported
+	Repair bool
+	// MinAge protects the files being written by the running processes
+	MinAge time.Duration
+	// CleanDropQueue removes the merged files waiting in the drop queues.
+	// Only safe on start, when no query can read them.
+	CleanDropQueue bool
+	// dropQueueOnly limits the check to the drop queues, the other problems are not looked for
+	dropQueueOnly bool
+}
+
+// CheckReport lists the problems found in a table
+type CheckReport struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Repaired bool   `json:"repaired"`
+	// the files of crashed saves and merges in the tmp folder
+	TmpFiles []string `json:"tmp_files,omitempty"`
+	// the saved files missing in the index, added to the index
+	OrphansRegistered []string `json:"orphans_registered,omitempty"`
+	// the merge results and unreadable files missing in the index, renamed to *.orphaned
+	OrphansQuarantined []string `json:"orphans_quarantined,omitempty"`
+	// the index entries of missing files, purged
+	DanglingEntries []string `json:"dangling_entries,omitempty"`
+	// the indexed files with an invalid footer, purged from the index and renamed to *.corrupted
+	CorruptedFiles []string `json:"corrupted_files,omitempty"`
+	// the drop queue entries removed with their files
+	DropQueue []string `json:"drop_queue,omitempty"`
+	// the partitions merged by another process during the check
+	SkippedPartitions []string `json:"skipped_partitions,omitempty"`
+	Errors            []string `json:"errors,omitempty"`
+}
+
+// Fixes returns the number of the problems found
+func (r *CheckReport) Fixes() int {
+	return len(r.TmpFiles) + len(r.OrphansRegistered) + len(r.OrphansQuarantined) + len(r.DanglingEntries) +
+		len(r.CorruptedFiles) + len(r.DropQueue)
+}
+
+func (r *CheckReport) addError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// CheckTables reconciles the files of the tables with their indexes.
+// All the databases of the data root are checked if db is empty,
+// and all the tables of the database if no table is provided.
+func CheckTables(ctx context.Context, db string, tables []string, opts CheckOptions) ([]*CheckReport, error) {
+	dbs := []string{db}
+	if db == "" {
+		var err error
+		dbs, err = listFolders(config.Get().Gigapi.Root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := []*CheckReport{}
+	for _, _db := range dbs {
+		_tables := tables
+		if len(_tables) == 0 {
+			var err error
+			_tables, err = listFolders(filepath.Join(config.Get().Gigapi.Root, _db))
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("database %q not found", _db)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range _tables {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			report, err := checkTable(ctx, _db, name, opts)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, report)
+		}
+	}
+	return res, nil
+}
+
+// CleanDropQueue removes the merged files waiting in the drop queues of the table.
+// Only safe when no query can read them. It returns the removed files.
+func CleanDropQueue(ctx context.Context, db, name string) ([]string, error) {
+	report, err := checkTable(ctx, db, name, CheckOptions{Repair: true, CleanDropQueue: true, dropQueueOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(report.Errors) > 0 {
+		return report.DropQueue, errors.New(strings.Join(report.Errors, "; "))
+	}
+	return report.DropQueue, nil
+}
+
+func listFolders(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, entry := range entries {
+		if entry.IsDir() && tableNameCheck.MatchString(entry.Name()) {
+			res = append(res, entry.Name())
+		}
+	}
+	return res, nil
+}
+
+// checkTable checks the table through the indexes of the process if the table is registered,
+// so the served indexes stay in sync with the fixes
+func checkTable(ctx context.Context, db, name string, opts CheckOptions) (*CheckReport, error) {
+	if !tableNameCheck.MatchString(db) || !tableNameCheck.MatchString(name) {
+		return nil, fmt.Errorf("invalid table name: %s.%s", db, name)
+	}
+	tablePath := filepath.Join(config.Get().Gigapi.Root, db, name)
+	if _, err := os.Stat(tablePath); err != nil {
+		return nil, fmt.Errorf("table %s.%s not found", db, name)
+	}
+	report := &CheckReport{Database: db, Table: name, Repaired: opts.Repair}
+	table := getRegisteredTable(db, name)
+	if table == nil || table.IndexCreator == nil {
+		var err error
+		table, err = detachedTable(db, name, tablePath)
+		if err != nil {
+			return nil, err
+		}
+		if manifest, ok := table.Manifest.(*index.JSONTableManifest); ok && opts.Repair {
+			defer manifest.Flush()
+		}
+	}
+
+	if !opts.dropQueueOnly {
+		report.TmpFiles = staleFiles(filepath.Join(tablePath, "tmp"), opts, func(string) bool { return true })
+		report.TmpFiles = append(report.TmpFiles, staleFiles(tablePath, opts, isBackupFile)...)
+	}
+
+	err := filepath.WalkDir(tablePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == tablePath {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(tablePath, p)
+		if err != nil {
+			return err
+		}
+		values, err := shared.ParsePartitionPath(rel)
+		if err != nil {
+			// tmp, data and other service folders
+			return filepath.SkipDir
+		}
+		checkPartition(table, values, p, filepath.ToSlash(rel), opts, report)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// detachedTable describes the table not served by the process
+func detachedTable(db, name, tablePath string) (*shared.Table, error) {
+	table := &shared.Table{
+		Database: db,
+		Name:     name,
+		Path:     tablePath,
+		Engine:   "HiveMerge",
+		OrderBy:  []string{"__timestamp"},
+	}
+	manifest, err := index.ReadTableManifest(tablePath)
+	if err == nil && manifest.PartitionBy != "" {
+		table.Partitioning, err = shared.ParsePartitionScheme(manifest.PartitionBy)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	table.Manifest, err = index.NewJSONTableManifest(table)
+	if err != nil {
+		return nil, err
+	}
+	table.IndexCreator = func(values [][2]string) (shared.Index, error) {
+		return index.NewJSONIndexForPartition(table, values)
+	}
+	return table, nil
+}
+
+func isBackupFile(name string) bool {
+	return strings.HasSuffix(name, ".json.bak")
+}
+
+// staleFiles returns (and removes on repair) the files of the folder matching the filter
+// not modified for opts.MinAge
+func staleFiles(dir string, opts CheckOptions, filter func(name string) bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var res []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !filter(entry.Name()) || time.Since(info.ModTime()) < opts.MinAge {
+			continue
+		}
+		name := filepath.Join(dir, entry.Name())
+		if opts.Repair && os.RemoveAll(name) != nil {
+			continue
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+var fileIterationCheck = regexp.MustCompile(`\.(\d+)\.parquet$`)
+
+// checkPartition reconciles the partition folder with its index holding the merge lock,
+// so no merge changes the partition meanwhile
+func checkPartition(table *shared.Table, values [][2]string, dir string, rel string,
+	opts CheckOptions, report *CheckReport) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		report.addError(err)
+		return
+	}
+	var parquetFiles []fs.DirEntry
+	hasIndex := false
+	for _, f := range files {
+		switch {
+		case f.IsDir():
+		case f.Name() == "metadata.json":
+			hasIndex = true
+		case isBackupFile(f.Name()) && !opts.dropQueueOnly:
+			report.TmpFiles = append(report.TmpFiles, staleFiles(dir, opts, func(name string) bool {
+				return name == f.Name()
+			})...)
+		case strings.HasSuffix(f.Name(), ".parquet"):
+			parquetFiles = append(parquetFiles, f)
+		}
+	}
+	if !hasIndex && len(parquetFiles) == 0 {
+		return
+	}
+
+	if opts.Repair {
+		lock, ok, err := mergeUtils.TryLockFile(filepath.Join(dir, "merge.lock"))
+		if err != nil {
+			report.addError(err)
+			return
+		}
+		if !ok {
+			report.SkippedPartitions = append(report.SkippedPartitions, rel)
+			return
+		}
+		defer lock.Unlock()
+	}
+
+	idx, err := table.IndexCreator(values)
+	if err != nil {
+		report.addError(fmt.Errorf("partition %s: %w", rel, err))
+		return
+	}
+	if getRegisteredTable(table.Database, table.Name) != table {
+		idx.Run()
+		defer idx.Stop()
+	} else if err = idx.Refresh(); err != nil {
+		report.addError(fmt.Errorf("partition %s: %w", rel, err))
+		return
+	}
+
+	dropped := make(map[string]bool)
+	var dropQueue []string
+	for _, file := range idx.GetDropQueue() {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		dropped[abs] = true
+		if _, err := os.Stat(abs); err == nil && !opts.CleanDropQueue {
+			continue
+		}
+		if service.IsPinned(table.Path, abs) {
+			continue
+		}
+		dropQueue = append(dropQueue, file)
+	}
+
+	var add []*shared.IndexEntry
+	var rm []string
+	if !opts.dropQueueOnly {
+		add, rm = checkFiles(idx, dir, parquetFiles, dropped, table, opts, report)
+	}
+
+	if !opts.Repair {
+		report.DropQueue = append(report.DropQueue, dropQueue...)
+		return
+	}
+	var removed []string
+	for _, file := range dropQueue {
+		err = os.Remove(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			report.addError(err)
+			continue
+		}
+		removed = append(removed, file)
+	}
+	report.DropQueue = append(report.DropQueue, removed...)
+	var proms []func() error
+	if len(add) > 0 || len(rm) > 0 {
+		prom := idx.Batch(add, rm)
+		proms = append(proms, func() error { _, err := prom.Get(); return err })
+	}
+	if len(removed) > 0 {
+		prom := idx.RmFromDropQueue(removed)
+		proms = append(proms, func() error { _, err := prom.Get(); return err })
+	}
+	for _, p := range proms {
+		if err := p(); err != nil {
+			report.addError(fmt.Errorf("partition %s: %w", rel, err))
+		}
+	}
+}
+
+// checkFiles compares the parquet files of the partition folder with the index entries.
+// It returns the index entries to add and to remove.
+func checkFiles(idx shared.Index, dir string, parquetFiles []fs.DirEntry, dropped map[string]bool,
+	table *shared.Table, opts CheckOptions, report *CheckReport) ([]*shared.IndexEntry, []string) {
+	var (
+		add []*shared.IndexEntry
+		rm  []string
+	)
+	indexed := make(map[string]bool)
+	for _, e := range idx.Query(shared.NewIndexQuery()) {
+		indexed[e.Path] = true
+		if _, err := os.Stat(e.Path); errors.Is(err, os.ErrNotExist) {
+			report.DanglingEntries = append(report.DanglingEntries, e.Path)
+			rm = append(rm, e.Path)
+			continue
+		}
+		if err := index.ValidateParquetFile(e.Path); err != nil {
+			report.CorruptedFiles = append(report.CorruptedFiles, e.Path)
+			rm = append(rm, e.Path)
+			if opts.Repair {
+				err = os.Rename(e.Path, e.Path+".corrupted")
+				if err != nil {
+					report.addError(err)
+				}
+			}
+		}
+	}
+
+	for _, f := range parquetFiles {
+		abs, err := filepath.Abs(filepath.Join(dir, f.Name()))
+		if err != nil {
+			report.addError(err)
+			continue
+		}
+		if indexed[abs] || dropped[abs] {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil || time.Since(info.ModTime()) < opts.MinAge || service.IsPinned(table.Path, abs) {
+			continue
+		}
+		// the merge result, the removal of its sources and their drop queue entries are
+		// committed to the index at once, so only the drop queue lists merged sources.
+		// The other level-1 files are saved data, the files of the next levels are merge
+		// results never committed, whose sources are still indexed.
+		iteration := fileIterationCheck.FindStringSubmatch(f.Name())
+		if iteration != nil && iteration[1] == "1" {
+			if entry, err := index.ReadParquetEntry(abs); err == nil {
+				report.OrphansRegistered = append(report.OrphansRegistered, abs)
+				add = append(add, entry)
+				continue
+			}
+		}
+		report.OrphansQuarantined = append(report.OrphansQuarantined, abs)
+		if opts.Repair {
+			if err = os.Rename(abs, abs+".orphaned"); err != nil {
+				report.addError(err)
+			}
+		}
+	}
+	return add, rm
+}
+
+// CheckOnStart repairs the leftovers of the crashed saves and merges of all the tables
+// before the tables are served
+func CheckOnStart() error {
+	reports, err := CheckTables(context.Background(), "", nil, CheckOptions{
+		Repair:         true,
+		MinAge:         DefaultCheckMinAge(),
+		CleanDropQueue: config.Get().Gigapi.RunsMerges(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range reports {
+		if r.Fixes() > 0 || len(r.Errors) > 0 {
+			fmt.Printf("table %s.%s: %d problems fixed, %d errors: %+v\n",
+				r.Database, r.Table, r.Fixes(), len(r.Errors), *r)
+		}
+	}
+	return nil
+}
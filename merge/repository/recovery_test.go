@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/service"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkFixture is a table of a single partition with two indexed level-1 files of 2 and 1 rows
+type checkFixture struct {
+	db    string
+	dir   string
+	rel   string
+	files []string
+}
+
+func newCheckFixture(t *testing.T, db string) *checkFixture {
+	ts := time.Now().UnixNano()
+	storeRows(t, db, "t", ts, ts+1)
+	storeRows(t, db, "t", ts+2)
+	parts, err := ListFiles(db, "t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 || len(parts[0].Files) != 2 {
+		t.Fatalf("unexpected partitions: %+v", parts)
+	}
+	res := &checkFixture{db: db, dir: parts[0].Path}
+	res.rel, _ = filepath.Rel(filepath.Join(config.Get().Gigapi.Root, db, "t"), res.dir)
+	// the file of 2 rows first
+	files := slices.Clone(parts[0].Files)
+	slices.SortFunc(files, func(a, b *shared.IndexEntry) int { return int(b.RowCount - a.RowCount) })
+	for _, f := range files {
+		res.files = append(res.files, f.Path)
+	}
+	return res
+}
+
+func (f *checkFixture) index(t *testing.T) shared.Index {
+	values, err := shared.ParsePartitionPath(f.rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := getRegisteredTable(f.db, "t").IndexCreator(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+// copyOld copies the file and makes the copy older than the min age of the check
+func copyOld(t *testing.T, from, to string) string {
+	data, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(to, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(to, old, old); err != nil {
+		t.Fatal(err)
+	}
+	return to
+}
+
+func TestCheckTables(t *testing.T) {
+	initTestConfig(t)
+	for _, c := range []struct {
+		name string
+		// setup breaks the fixture and returns the paths expected in the report
+		setup  func(t *testing.T, f *checkFixture) []string
+		report func(r *CheckReport) []string
+		// the rows of the table after the repair
+		rows int64
+		// verify checks the files after the repair
+		verify func(t *testing.T, f *checkFixture, paths []string)
+	}{
+		{
+			name: "stale tmp file",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				return []string{copyOld(t, f.files[0],
+					filepath.Join(config.Get().Gigapi.Root, f.db, "t", "tmp", "crashed.2.parquet"))}
+			},
+			report: func(r *CheckReport) []string { return r.TmpFiles },
+			rows:   3,
+			verify: assertRemoved,
+		},
+		{
+			name: "unindexed level-1 file",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				return []string{copyOld(t, f.files[0], filepath.Join(f.dir, "orphan.1.parquet"))}
+			},
+			report: func(r *CheckReport) []string { return r.OrphansRegistered },
+			rows:   5,
+			verify: assertExists,
+		},
+		{
+			name: "unindexed level-2 file",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				return []string{copyOld(t, f.files[0], filepath.Join(f.dir, "orphan.2.parquet"))}
+			},
+			report: func(r *CheckReport) []string { return r.OrphansQuarantined },
+			rows:   3,
+			verify: assertQuarantined,
+		},
+		{
+			name: "dangling index entry",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				if err := os.Remove(f.files[1]); err != nil {
+					t.Fatal(err)
+				}
+				return f.files[1:]
+			},
+			report: func(r *CheckReport) []string { return r.DanglingEntries },
+			rows:   2,
+		},
+		{
+			name: "truncated footer",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				stat, err := os.Stat(f.files[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = os.Truncate(f.files[1], stat.Size()-8); err != nil {
+					t.Fatal(err)
+				}
+				return f.files[1:]
+			},
+			report: func(r *CheckReport) []string { return r.CorruptedFiles },
+			rows:   2,
+			verify: func(t *testing.T, f *checkFixture, paths []string) {
+				assertRemoved(t, f, paths)
+				assertExists(t, f, []string{paths[0] + ".corrupted"})
+			},
+		},
+		{
+			name: "drop queue file",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				file := copyOld(t, f.files[0], filepath.Join(f.dir, "merged.2.parquet"))
+				if _, err := f.index(t).AddToDropQueue([]string{file}).Get(); err != nil {
+					t.Fatal(err)
+				}
+				return []string{file}
+			},
+			report: func(r *CheckReport) []string { return r.DropQueue },
+			rows:   3,
+			verify: func(t *testing.T, f *checkFixture, paths []string) {
+				assertRemoved(t, f, paths)
+				if q := f.index(t).GetDropQueue(); len(q) != 0 {
+					t.Fatalf("unexpected drop queue: %v", q)
+				}
+			},
+		},
+		{
+			name: "pinned drop queue file",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				file := copyOld(t, f.files[0], filepath.Join(f.dir, "merged.2.parquet"))
+				if _, err := f.index(t).AddToDropQueue([]string{file}).Get(); err != nil {
+					t.Fatal(err)
+				}
+				err := service.PinFiles(filepath.Join(config.Get().Gigapi.Root, f.db, "t"), "export",
+					[]string{file}, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return nil
+			},
+			report: func(r *CheckReport) []string { return r.DropQueue },
+			rows:   3,
+			verify: func(t *testing.T, f *checkFixture, paths []string) {
+				file := filepath.Join(f.dir, "merged.2.parquet")
+				assertExists(t, f, []string{file})
+				if q := f.index(t).GetDropQueue(); !slices.Equal(q, []string{file}) {
+					t.Fatalf("unexpected drop queue: %v", q)
+				}
+			},
+		},
+		{
+			name: "unindexed level-1 file covered by a merge result",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				saved := copyOld(t, f.files[1], filepath.Join(t.TempDir(), "orphan.1.parquet"))
+				if err := CompactTable(f.db, "t"); err != nil {
+					t.Fatal(err)
+				}
+				// the cleanup of the merge removes the sources and empties the drop queue
+				deadline := time.Now().Add(time.Second * 5)
+				for len(f.index(t).GetDropQueue()) > 0 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond * 100)
+				}
+				// saved before the merge and never indexed, its rows are not part of the merge result
+				return []string{copyOld(t, saved, filepath.Join(f.dir, "orphan.1.parquet"))}
+			},
+			report: func(r *CheckReport) []string { return r.OrphansRegistered },
+			rows:   4,
+			verify: assertExists,
+		},
+		{
+			name: "locked partition",
+			setup: func(t *testing.T, f *checkFixture) []string {
+				copyOld(t, f.files[0], filepath.Join(f.dir, "orphan.2.parquet"))
+				lock, err := mergeUtils.LockFile(filepath.Join(f.dir, "merge.lock"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { lock.Unlock() })
+				return []string{f.rel}
+			},
+			report: func(r *CheckReport) []string { return r.SkippedPartitions },
+			rows:   3,
+			verify: func(t *testing.T, f *checkFixture, paths []string) {
+				assertExists(t, f, []string{filepath.Join(f.dir, "orphan.2.parquet")})
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			db := uniqueName("check_" + strings.NewReplacer(" ", "_", "-", "_").Replace(c.name))
+			f := newCheckFixture(t, db)
+			paths := c.setup(t, f)
+			reports, err := CheckTables(context.Background(), db, nil, CheckOptions{
+				Repair:         true,
+				MinAge:         time.Minute,
+				CleanDropQueue: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reports) != 1 || len(reports[0].Errors) != 0 {
+				t.Fatalf("unexpected reports: %+v", reports)
+			}
+			r := reports[0]
+			if got := c.report(r); !sameFiles(got, paths) {
+				t.Fatalf("expected %v, got %+v", paths, *r)
+			}
+			if r.Fixes() != len(paths) && len(r.SkippedPartitions) == 0 {
+				t.Fatalf("unexpected fixes: %+v", *r)
+			}
+			if c.verify != nil {
+				c.verify(t, f, paths)
+			}
+			if _, rows := countRows(t, db, "t"); rows != c.rows {
+				t.Fatalf("expected %d rows, got %d", c.rows, rows)
+			}
+		})
+	}
+}
+
+func sameFiles(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+func assertRemoved(t *testing.T, f *checkFixture, paths []string) {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			t.Fatalf("%s is not removed", p)
+		}
+	}
+}
+
+func assertExists(t *testing.T, f *checkFixture, paths []string) {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCleanDropQueueOnly(t *testing.T) {
+	initTestConfig(t)
+	db := uniqueName("clean_drop_queue")
+	f := newCheckFixture(t, db)
+	if _, err := f.index(t).AddToDropQueue(f.files[1:]).Get(); err != nil {
+		t.Fatal(err)
+	}
+	orphan := copyOld(t, f.files[0], filepath.Join(f.dir, "orphan.2.parquet"))
+	tmp := copyOld(t, f.files[0], filepath.Join(config.Get().Gigapi.Root, db, "t", "tmp", "crashed.2.parquet"))
+
+	removed, err := CleanDropQueue(context.Background(), db, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameFiles(removed, f.files[1:]) {
+		t.Fatalf("expected %v removed, got %v", f.files[1:], removed)
+	}
+	assertRemoved(t, f, f.files[1:])
+	// the other problems are left to the repair
+	assertExists(t, f, []string{orphan, tmp})
+}
+
+func assertQuarantined(t *testing.T, f *checkFixture, paths []string) {
+	assertRemoved(t, f, paths)
+	for _, p := range paths {
+		assertExists(t, f, []string{p + ".orphaned"})
+	}
+}
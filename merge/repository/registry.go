@@ -2,9 +2,9 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/gigapi/gigapi/v2/config"
-	"github.com/gigapi/gigapi/v2/merge/data_types"
 	"github.com/gigapi/gigapi/v2/merge/index"
 	"github.com/gigapi/gigapi/v2/merge/service"
 	"github.com/gigapi/gigapi/v2/merge/shared"
@@ -25,27 +25,47 @@ var mergeTicker *time.Ticker
 var registryMtx sync.Mutex
 
 func InitRegistry(_conn *sql.DB) error {
-	if !config.Config.Gigapi.NoMerges {
+	// no_merges can be switched off by a config reload, so only the writers skip the merge loop
+	if config.Get().Gigapi.Role != config.RoleWriter {
 		go RunMerge()
 	}
 	return nil
 }
 
+func mergeInterval() time.Duration {
+	return time.Duration(config.Get().Gigapi.Merges.IntervalS * float64(time.Second))
+}
+
 func GetTable(db string, name string) (service.MergeService, error) {
-	table, ok := registry[[2]string{db, name}]
-	if !ok {
+	table := lookupTable(db, name)
+	if table == nil {
 		return nil, fmt.Errorf("table %q not found", name)
 	}
 	return table, nil
 }
 
 func RunMerge() {
-	mergeTicker = time.NewTicker(time.Second * 10)
+	mergeTicker = time.NewTicker(mergeInterval())
+	config.OnReload(func(old *config.Configuration) {
+		if old.Gigapi.Merges.IntervalS != config.Get().Gigapi.Merges.IntervalS {
+			mergeTicker.Reset(mergeInterval())
+		}
+	})
 	for range mergeTicker.C {
-		_registry := make(map[[2]string]service.MergeService, len(registry))
+		if !config.Get().Gigapi.RunsMerges() {
+			continue
+		}
+		if config.Get().Gigapi.Role == config.RoleCompactor {
+			err := discoverTables()
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		var _registry map[[2]string]service.MergeService
 		func() {
 			registryMtx.Lock()
 			defer registryMtx.Unlock()
+			_registry = make(map[[2]string]service.MergeService, len(registry))
 			for k, v := range registry {
 				_registry[k] = v
 			}
@@ -61,6 +81,13 @@ func RunMerge() {
 	}
 }
 
+// lookupTable returns the registered service of the table, nil if it isn't registered
+func lookupTable(db, name string) service.MergeService {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	return registry[[2]string{db, name}]
+}
+
 var tableNameCheck = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
 var m sync.Mutex
 
@@ -69,70 +96,141 @@ func Store(db string, name string, columns map[string]any) utils.Promise[int32]
 		db = "default"
 	}
 	//TODO: add the thread id to the table name
-	//TODO: introduce Redis to synchronize several writers
 	m.Lock()
-	table := registry[[2]string{db, name}]
+	table := lookupTable(db, name)
 	if table == nil {
 		err := RegisterSimpleTable(db, name)
 		if err != nil {
 			m.Unlock()
 			return utils.Fulfilled(err, int32(0))
 		}
-		table = registry[[2]string{db, name}]
+		table = lookupTable(db, name)
 	}
 	m.Unlock()
 	return table.Store(columns)
 }
 
+// getPartitionScheme returns the partition scheme configured for the table
+func getPartitionScheme(db, name string) (*shared.PartitionScheme, error) {
+	partitionBy := config.Get().Gigapi.PartitionBy
+	for _, t := range config.Get().Gigapi.Tables {
+		if t.Name == name && (t.Database == db || t.Database == "") && t.PartitionBy != "" {
+			partitionBy = t.PartitionBy
+		}
+	}
+	return shared.ParsePartitionScheme(partitionBy)
+}
+
+// ErrTableConflict is returned when a table is created with a layout different from the existing one
+var ErrTableConflict = errors.New("table already exists with a different layout")
+
+// readTableLayout returns the partition scheme and the order of the rows recorded in the manifest
+// of an existing table. The scheme is nil if the table has no manifest yet.
+func readTableLayout(db, name string) (*shared.PartitionScheme, []string, error) {
+	manifest, err := index.ReadTableManifest(path.Join(config.Get().Gigapi.Root, db, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil || manifest.PartitionBy == "" {
+		return nil, nil, err
+	}
+	scheme, err := shared.ParsePartitionScheme(manifest.PartitionBy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scheme, manifest.OrderBy, nil
+}
+
+// checkTableLayout returns ErrTableConflict if the requested scheme or order differ from the existing ones
+func checkTableLayout(db, name string, scheme, existingScheme *shared.PartitionScheme,
+	orderBy, existingOrderBy []string) error {
+	if scheme != nil && scheme.String() != existingScheme.String() {
+		return fmt.Errorf("%w: %s.%s is partitioned by %s", ErrTableConflict, db, name, existingScheme)
+	}
+	if len(orderBy) > 0 && strings.Join(orderBy, ",") != strings.Join(existingOrderBy, ",") {
+		return fmt.Errorf("%w: %s.%s is ordered by %s", ErrTableConflict, db, name,
+			strings.Join(existingOrderBy, ","))
+	}
+	return nil
+}
+
+// RegisterSimpleTable registers the HiveMerge table with the layout recorded in its manifest,
+// or the configured one for a new table. Called with m locked.
 func RegisterSimpleTable(db, name string) error {
 	if db == "" {
 		db = "default"
 	}
-	table := &shared.Table{
-		Database: db,
-		Name:     name,
-		Engine:   "HiveMerge",
-		OrderBy:  []string{"__timestamp"},
-		Path:     path.Join(config.Config.Gigapi.Root, db, name),
-		PartitionBy: func(m map[string]data_types.IColumn) ([]shared.PartitionDesc, error) {
-			tsCol, ok := m["__timestamp"]
-			if !ok {
-				return nil, fmt.Errorf("table %q does not have a '__timestamp' column", name)
-			}
-			tsData, ok := tsCol.GetData().([]int64)
-			if !ok {
-				return nil, fmt.Errorf("column '__timestamp' has non-int64 data type")
-			}
+	return registerHiveTable(db, name, nil, nil, nil)
+}
 
-			parts := make(map[int64]*shared.PartitionDesc)
-			lastPartId := int64(0)
-			var lastPart *shared.PartitionDesc
-			for i, ts := range tsData {
-				id := int64(ts / 86400000000000)
-				if lastPart == nil || lastPartId != id {
-					lastPartId = id
-					if _, ok := parts[id]; !ok {
-						parts[id] = &shared.PartitionDesc{
-							Values: [][2]string{
-								{"date", time.Unix(0, ts).UTC().Format("2006-01-02")},
-								{"hour", time.Unix(0, ts).UTC().Format("15")},
-							},
-							IndexMap: make([]byte, (len(tsData)+7)/8),
-						}
-					}
-					lastPart = parts[id]
-				}
-				lastPart.IndexMap[i/8] |= 1 << (uint(i) % 8)
-			}
-			res := make([]shared.PartitionDesc, 0, len(parts))
-			for _, desc := range parts {
-				res = append(res, *desc)
-			}
-			return res, nil
+// RegisterHiveTable registers a HiveMerge table partitioned by the scheme. Called with m locked.
+func RegisterHiveTable(db, name string, scheme *shared.PartitionScheme) error {
+	return registerHiveTable(db, name, scheme, nil, nil)
+}
+
+// CreateHiveTable registers a HiveMerge table partitioned by the scheme which saved rows are
+// sorted by orderBy. A nil scheme and an empty orderBy keep the layout of an existing table, or
+// fall back to the configured scheme and `__timestamp`. The declared column types of schema are
+// recorded in the manifest. ErrTableConflict is returned if the table exists with another layout.
+func CreateHiveTable(db, name string, scheme *shared.PartitionScheme, orderBy []string,
+	schema map[string]string) error {
+	m.Lock()
+	defer m.Unlock()
+	return registerHiveTable(db, name, scheme, orderBy, schema)
+}
 
-		},
+// registerHiveTable implements CreateHiveTable, called with m locked
+func registerHiveTable(db, name string, scheme *shared.PartitionScheme, orderBy []string,
+	schema map[string]string) error {
+	if db == "" {
+		db = "default"
+	}
+	if !tableNameCheck.MatchString(db) {
+		return fmt.Errorf("invalid database name, only letters and _ are accepted: %q", db)
+	}
+	if !tableNameCheck.MatchString(name) {
+		return fmt.Errorf("invalid table name, only letters and _ are accepted: %q", name)
+	}
+	if registered := getRegisteredTable(db, name); registered != nil {
+		err := checkTableLayout(db, name, scheme, registered.Partitioning, orderBy, registered.OrderBy)
+		if err == nil && len(schema) > 0 && registered.Manifest != nil {
+			registered.Manifest.UpdateSchema(schema)
+		}
+		return err
+	}
+	existingScheme, existingOrderBy, err := readTableLayout(db, name)
+	if err != nil {
+		return err
+	}
+	if existingScheme != nil {
+		err = checkTableLayout(db, name, scheme, existingScheme, orderBy, existingOrderBy)
+		if err != nil {
+			return err
+		}
+		scheme, orderBy = existingScheme, existingOrderBy
+	}
+	if scheme == nil {
+		scheme, err = getPartitionScheme(db, name)
+		if err != nil {
+			return err
+		}
+	}
+	if len(orderBy) == 0 {
+		orderBy = []string{"__timestamp"}
+	}
+	table := &shared.Table{
+		Database:      db,
+		Name:          name,
+		Engine:        "HiveMerge",
+		OrderBy:       orderBy,
+		Path:          path.Join(config.Get().Gigapi.Root, db, name),
+		PartitionBy:   scheme.PartitionBy(name),
+		Partitioning:  scheme,
 		AutoTimestamp: true,
 	}
+	if lookupTable(db, name) != nil {
+		return fmt.Errorf("%w: %s.%s is not a HiveMerge table", ErrTableConflict, db, name)
+	}
 	m := sync.Mutex{}
 	parts := make(map[string]shared.Index)
 	table.IndexCreator = func(values [][2]string) (shared.Index, error) {
@@ -154,26 +252,61 @@ func RegisterSimpleTable(db, name string) error {
 		}
 		return idx, nil
 	}
-	return RegisterNewTable(table)
+	if !strings.HasPrefix(table.Path, "s3://") {
+		err = createTableFolders(table)
+		if err != nil {
+			return err
+		}
+		manifest, err := index.NewJSONTableManifest(table)
+		if err != nil {
+			return err
+		}
+		if len(schema) > 0 {
+			manifest.UpdateSchema(schema)
+		}
+		// the layout of a new table is persisted before any data is written
+		if existingScheme == nil || len(schema) > 0 {
+			manifest.Flush()
+		}
+		table.Manifest = manifest
+	}
+	registered, err := registerNewTable(table)
+	if err != nil || !registered {
+		if err == nil {
+			err = fmt.Errorf("%w: %s.%s is not a HiveMerge table", ErrTableConflict, db, name)
+		}
+		return err
+	}
+	if table.Manifest != nil {
+		table.Manifest.Run()
+	}
+	registerTable(table)
+	return nil
 }
 
 func RegisterNewTable(table *shared.Table) error {
+	_, err := registerNewTable(table)
+	return err
+}
+
+// registerNewTable registers the service of the table, it reports false if the table is already registered
+func registerNewTable(table *shared.Table) (bool, error) {
 	if !tableNameCheck.MatchString(table.Name) {
-		return fmt.Errorf("invalid table name, only letters and _ are accepted: %q", table.Name)
+		return false, fmt.Errorf("invalid table name, only letters and _ are accepted: %q", table.Name)
 	}
 	if table.Path == "" {
-		table.Path = filepath.Join(config.Config.Gigapi.Root, table.Database, table.Name)
+		table.Path = filepath.Join(config.Get().Gigapi.Root, table.Database, table.Name)
 	}
-	if _, ok := registry[[2]string{table.Database, table.Name}]; ok {
-		return nil
+	if lookupTable(table.Database, table.Name) != nil {
+		return false, nil
 	}
 	_table := *table
 	if strings.HasPrefix(table.Path, "s3://") {
-		_table.Path = path.Join(config.Config.Gigapi.Root, table.Database, table.Name)
+		_table.Path = path.Join(config.Get().Gigapi.Root, table.Database, table.Name)
 	}
 	err := createTableFolders(&_table)
 	if err != nil {
-		return err
+		return false, err
 	}
 	/*err = InsertTableMetadata(conn, table)
 	if err != nil {
@@ -181,6 +314,10 @@ func RegisterNewTable(table *shared.Table) error {
 	}*/
 	registryMtx.Lock()
 	defer registryMtx.Unlock()
+	// the table could be registered concurrently since the check above
+	if _, ok := registry[[2]string{table.Database, table.Name}]; ok {
+		return false, nil
+	}
 	switch table.Engine {
 	case "Merge":
 		registry[[2]string{table.Database, table.Name}], err = service.NewMergeTreeService(table)
@@ -189,10 +326,10 @@ func RegisterNewTable(table *shared.Table) error {
 			service.NewMultithreadHiveMergeTreeService(0, table)
 	}
 	if err != nil {
-		return err
+		return false, err
 	}
 	registry[[2]string{table.Database, table.Name}].Run()
-	return nil
+	return true, nil
 }
 
 func PopulateRegistry() error {
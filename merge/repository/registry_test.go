@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/index"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestManifest(tablePath string, manifest *shared.TableManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(tablePath, index.ManifestFileName), data, 0644)
+}
+
+func TestCreateHiveTableLayout(t *testing.T) {
+	initTestConfig(t)
+	db := uniqueName("layout")
+	scheme, err := shared.ParsePartitionScheme("day,region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CreateHiveTable(db, "weather", scheme, []string{"region", "__timestamp"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the layout is persisted before any data is written
+	manifest, err := index.ReadTableManifest(filepath.Join(config.Get().Gigapi.Root, db, "weather"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.PartitionBy != "day,region" || strings.Join(manifest.OrderBy, ",") != "region,__timestamp" {
+		t.Fatalf("unexpected layout in the manifest: %s, %v", manifest.PartitionBy, manifest.OrderBy)
+	}
+
+	if err = CreateHiveTable(db, "weather", nil, nil, nil); err != nil {
+		t.Fatalf("the existing layout is rejected: %v", err)
+	}
+	if err = CreateHiveTable(db, "weather", scheme, []string{"region", "__timestamp"}, nil); err != nil {
+		t.Fatalf("the same layout is rejected: %v", err)
+	}
+	hour, _ := shared.ParsePartitionScheme("hour")
+	if err = CreateHiveTable(db, "weather", hour, nil, nil); !errors.Is(err, ErrTableConflict) {
+		t.Fatalf("expected a conflict for another scheme, got %v", err)
+	}
+	if err = CreateHiveTable(db, "weather", nil, []string{"__timestamp"}, nil); !errors.Is(err, ErrTableConflict) {
+		t.Fatalf("expected a conflict for another order, got %v", err)
+	}
+}
+
+func TestRegisterSimpleTableReadsManifestLayout(t *testing.T) {
+	initTestConfig(t)
+	db := uniqueName("layout")
+	tablePath := filepath.Join(config.Get().Gigapi.Root, db, "weather")
+	scheme, _ := shared.ParsePartitionScheme("day,region")
+	// the table is created by another process, or before a restart
+	err := createTableFolders(&shared.Table{Name: "weather", Path: tablePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writeTestManifest(tablePath, &shared.TableManifest{
+		Database:    db,
+		Table:       "weather",
+		Engine:      "HiveMerge",
+		PartitionBy: scheme.String(),
+		OrderBy:     []string{"region", "__timestamp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Date(2025, 4, 24, 14, 0, 0, 0, time.UTC).UnixNano()
+	_, err = Store(db, "weather", map[string]any{
+		"__timestamp": []int64{ts},
+		"region":      []string{"eu"},
+		"value":       []float64{1},
+	}).Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := getRegisteredTable(db, "weather")
+	if table == nil || table.Partitioning.String() != "day,region" ||
+		strings.Join(table.OrderBy, ",") != "region,__timestamp" {
+		t.Fatalf("the layout of the manifest is not used: %+v", table)
+	}
+	parts, err := ListFiles(db, "weather", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 || !strings.HasSuffix(parts[0].Path, "/date=2025-04-24/region=eu") {
+		t.Fatalf("unexpected partitions: %+v", parts)
+	}
+}
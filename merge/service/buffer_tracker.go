@@ -0,0 +1,246 @@
+package service
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+type BufferUsage struct {
+	Rows  int64 `json:"rows"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (u BufferUsage) add(o BufferUsage) BufferUsage {
+	return BufferUsage{Rows: u.Rows + o.Rows, Bytes: u.Bytes + o.Bytes}
+}
+
+func (u BufferUsage) sub(o BufferUsage) BufferUsage {
+	return BufferUsage{Rows: u.Rows - o.Rows, Bytes: u.Bytes - o.Bytes}
+}
+
+// exceeds reports if the usage is over the limit. Zero limits are unlimited.
+func (u BufferUsage) exceeds(rows, bytes int, ratio float64) bool {
+	return (rows > 0 && float64(u.Rows) > float64(rows)*ratio) ||
+		(bytes > 0 && float64(u.Bytes) > float64(bytes)*ratio)
+}
+
+type TableBufferUsage struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	BufferUsage
+}
+
+type BufferLimits struct {
+	MaxRows       int     `json:"max_rows"`
+	MaxBytes      int     `json:"max_bytes"`
+	MaxTableRows  int     `json:"max_table_rows"`
+	MaxTableBytes int     `json:"max_table_bytes"`
+	MaxWaitS      float64 `json:"max_wait_s"`
+}
+
+type BufferStats struct {
+	Total  BufferUsage        `json:"total"`
+	Limits BufferLimits       `json:"limits"`
+	Tables []TableBufferUsage `json:"tables"`
+}
+
+// BufferFullError is returned by Store when the data doesn't fit the configured buffer limits
+type BufferFullError struct {
+	Database   string
+	Table      string
+	Global     bool
+	RetryAfter time.Duration
+}
+
+func (e *BufferFullError) Error() string {
+	if e.Global {
+		return "ingestion buffer is full, retry later"
+	}
+	return fmt.Sprintf("ingestion buffer of table %s.%s is full, retry later", e.Database, e.Table)
+}
+
+type bufferTracker struct {
+	mtx      sync.Mutex
+	total    BufferUsage
+	tables   map[[2]string]*BufferUsage
+	flushers map[[2]string][]func()
+	released chan struct{}
+}
+
+var buffers = &bufferTracker{
+	tables:   make(map[[2]string]*BufferUsage),
+	flushers: make(map[[2]string][]func()),
+	released: make(chan struct{}),
+}
+
+func init() {
+	// the flush timers are restarted with the new save timeout
+	config.OnReload(func(old *config.Configuration) {
+		if old.Gigapi.SaveTimeoutS != config.Get().Gigapi.SaveTimeoutS {
+			buffers.flushAll()
+		}
+	})
+}
+
+func bufferKey(t *shared.Table) [2]string {
+	return [2]string{t.Database, t.Name}
+}
+
+func (b *bufferTracker) registerFlusher(t *shared.Table, flush func()) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.flushers[bufferKey(t)] = append(b.flushers[bufferKey(t)], flush)
+}
+
+// flushAll calls the flush callbacks of all the tables
+func (b *bufferTracker) flushAll() {
+	b.mtx.Lock()
+	var flushers []func()
+	for _, f := range b.flushers {
+		flushers = append(flushers, f...)
+	}
+	b.mtx.Unlock()
+	for _, f := range flushers {
+		f()
+	}
+}
+
+// tryReserve adds the usage to the counters if it fits the limits.
+// A request is always accepted into an empty buffer so oversized batches don't fail forever.
+func (b *bufferTracker) tryReserve(key [2]string, u BufferUsage) error {
+	conf := config.Get().Gigapi
+	tableUsage, ok := b.tables[key]
+	if !ok {
+		tableUsage = &BufferUsage{}
+		b.tables[key] = tableUsage
+	}
+	retryAfter := time.Duration(math.Ceil(conf.SaveTimeoutS)) * time.Second
+	if tableUsage.Rows > 0 &&
+		tableUsage.add(u).exceeds(conf.MaxTableBufferRows, conf.MaxTableBufferBytes, 1) {
+		return &BufferFullError{Database: key[0], Table: key[1], RetryAfter: retryAfter}
+	}
+	if b.total.Rows > 0 && b.total.add(u).exceeds(conf.MaxBufferRows, conf.MaxBufferBytes, 1) {
+		return &BufferFullError{Database: key[0], Table: key[1], Global: true, RetryAfter: retryAfter}
+	}
+	*tableUsage = tableUsage.add(u)
+	b.total = b.total.add(u)
+	return nil
+}
+
+// pressuredFlushers returns the flush callbacks of the tables which should be flushed early
+func (b *bufferTracker) pressuredFlushers(key [2]string) []func() {
+	conf := config.Get().Gigapi
+	if b.total.exceeds(conf.MaxBufferRows, conf.MaxBufferBytes, conf.BufferPressureRatio) {
+		var res []func()
+		for k, usage := range b.tables {
+			if usage.Rows > 0 {
+				res = append(res, b.flushers[k]...)
+			}
+		}
+		return res
+	}
+	if b.tables[key].exceeds(conf.MaxTableBufferRows, conf.MaxTableBufferBytes, conf.BufferPressureRatio) {
+		return b.flushers[key]
+	}
+	return nil
+}
+
+// reserve accounts the data to be buffered for the table.
+// If the limits are hit it flushes the buffers and waits up to MaxBufferWaitS for them to drain.
+func (b *bufferTracker) reserve(t *shared.Table, u BufferUsage) error {
+	key := bufferKey(t)
+	deadline := time.Now().Add(time.Duration(config.Get().Gigapi.MaxBufferWaitS * float64(time.Second)))
+	for {
+		b.mtx.Lock()
+		err := b.tryReserve(key, u)
+		flushers := b.pressuredFlushers(key)
+		released := b.released
+		b.mtx.Unlock()
+
+		for _, flush := range flushers {
+			go flush()
+		}
+		if err == nil {
+			return nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-released:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (b *bufferTracker) release(t *shared.Table, u BufferUsage) {
+	if u.Rows == 0 && u.Bytes == 0 {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if usage, ok := b.tables[bufferKey(t)]; ok {
+		*usage = usage.sub(u)
+	}
+	b.total = b.total.sub(u)
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// GetBufferStats returns the amount of not yet saved data per table
+func GetBufferStats() BufferStats {
+	conf := config.Get().Gigapi
+	buffers.mtx.Lock()
+	defer buffers.mtx.Unlock()
+	res := BufferStats{
+		Total: buffers.total,
+		Limits: BufferLimits{
+			MaxRows:       conf.MaxBufferRows,
+			MaxBytes:      conf.MaxBufferBytes,
+			MaxTableRows:  conf.MaxTableBufferRows,
+			MaxTableBytes: conf.MaxTableBufferBytes,
+			MaxWaitS:      conf.MaxBufferWaitS,
+		},
+		Tables: make([]TableBufferUsage, 0, len(buffers.tables)),
+	}
+	for k, usage := range buffers.tables {
+		res.Tables = append(res.Tables, TableBufferUsage{Database: k[0], Table: k[1], BufferUsage: *usage})
+	}
+	sort.Slice(res.Tables, func(i, j int) bool {
+		return res.Tables[i].Database < res.Tables[j].Database ||
+			(res.Tables[i].Database == res.Tables[j].Database && res.Tables[i].Table < res.Tables[j].Table)
+	})
+	return res
+}
+
+// columnsUsage estimates the memory required to buffer the columns
+func columnsUsage(columns map[string]data_types.IColumn) BufferUsage {
+	var res BufferUsage
+	for _, col := range columns {
+		res.Rows = col.GetLength()
+		res.Bytes += col.GetSizeBytes()
+	}
+	return res
+}
+
+// maskUsage estimates the share of the usage selected by the partition mask
+func maskUsage(total BufferUsage, mask []byte) BufferUsage {
+	if total.Rows == 0 {
+		return BufferUsage{}
+	}
+	var rows int64
+	for _, b := range mask {
+		rows += int64(bits.OnesCount8(b))
+	}
+	return BufferUsage{Rows: rows, Bytes: total.Bytes * rows / total.Rows}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"testing"
+)
+
+func TestBufferTrackerLimits(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			SaveTimeoutS:       1,
+			MaxTableBufferRows: 10,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	table := &shared.Table{Database: "db", Name: "buffer_limits"}
+	flushed := make(chan struct{}, 10)
+	buffers.registerFlusher(table, func() { flushed <- struct{}{} })
+
+	if err := buffers.reserve(table, BufferUsage{Rows: 9, Bytes: 90}); err != nil {
+		t.Fatal(err)
+	}
+	<-flushed
+
+	var bufErr *BufferFullError
+	err := buffers.reserve(table, BufferUsage{Rows: 2, Bytes: 20})
+	if !errors.As(err, &bufErr) || bufErr.Global {
+		t.Fatalf("expected table buffer full error, got %v", err)
+	}
+
+	buffers.release(table, BufferUsage{Rows: 9, Bytes: 90})
+	if err := buffers.reserve(table, BufferUsage{Rows: 2, Bytes: 20}); err != nil {
+		t.Fatal(err)
+	}
+	buffers.release(table, BufferUsage{Rows: 2, Bytes: 20})
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/apache/arrow/go/v14/arrow"
 	"github.com/apache/arrow/go/v14/arrow/array"
 	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"maps"
+	"slices"
 	"sync"
 )
 
@@ -15,6 +17,7 @@ type dataStore interface {
 	StoreToArrow(schema *arrow.Schema, builder *array.RecordBuilder) error
 	AppendByMask(data map[string]data_types.IColumn, mask []byte) error
 	GetSchema() map[string]string
+	Sort(orderBy []string)
 }
 type unorderedDataStore struct {
 	store map[string]data_types.IColumn
@@ -52,6 +55,10 @@ func (uds *unorderedDataStore) AppendByMask(data map[string]data_types.IColumn,
 	if err != nil {
 		return err
 	}
+	data, err = uds.castToStore(data)
+	if err != nil {
+		return err
+	}
 	var nullFields []string
 	sizeBefore := uds.getSize()
 	var sizeAfter int64
@@ -92,13 +99,16 @@ func (uds *unorderedDataStore) MergeColumns(data map[string]data_types.IColumn)
 }
 
 func (uds *unorderedDataStore) normalizeSchema(data map[string]data_types.IColumn) error {
-	var err error
 	for k, field := range data {
 		_, ok := uds.store[k]
 		if ok {
 			continue
 		}
-		uds.store[k], err = data_types.DataTypes[field.GetTypeName()](k, nil, uds.getSize(), uds.getSize()*2+100000)
+		builder, err := data_types.GetColumnBuilder(field.GetTypeName())
+		if err != nil {
+			return err
+		}
+		uds.store[k], err = builder(k, nil, uds.getSize(), uds.getSize()*2+100000)
 		if err != nil {
 			return err
 		}
@@ -106,23 +116,53 @@ func (uds *unorderedDataStore) normalizeSchema(data map[string]data_types.IColum
 	return nil
 }
 
+// castToStore converts the columns of the types other than the buffered ones.
+// The data is shared between the partitions, so a copy is returned.
+func (uds *unorderedDataStore) castToStore(data map[string]data_types.IColumn) (map[string]data_types.IColumn, error) {
+	var res map[string]data_types.IColumn
+	for k, col := range data {
+		field, ok := uds.store[k]
+		if !ok || field.GetTypeName() == col.GetTypeName() {
+			continue
+		}
+		cast, err := data_types.CastColumn(col, field.GetTypeName())
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			res = maps.Clone(data)
+		}
+		res[k] = cast
+	}
+	if res == nil {
+		return data, nil
+	}
+	return res, nil
+}
+
 func (uds *unorderedDataStore) AppendData(data map[string]data_types.IColumn) error {
 	//TODO: remove the logic of dynamic schema and flush parquet immediately when schema changes
 	uds.mtx.Lock()
 	defer uds.mtx.Unlock()
+	data, err := uds.castToStore(data)
+	if err != nil {
+		return err
+	}
 	var sz int64
 	for _, c := range data {
 		sz = c.GetLength()
 		break
 	}
 	storeSize := int64(uds.getSize())
-	var err error
 	cols := uds.MergeColumns(data)
 	for _, k := range cols {
 		_, ok := uds.store[k]
 		if !ok {
-			uds.store[k], err = data_types.DataTypes[data[k].GetTypeName()](k, nil,
-				storeSize, storeSize+sz)
+			builder, err := data_types.GetColumnBuilder(data[k].GetTypeName())
+			if err != nil {
+				return err
+			}
+			uds.store[k], err = builder(k, nil, storeSize, storeSize+sz)
 			if err != nil {
 				return err
 			}
@@ -179,3 +219,61 @@ func (uds *unorderedDataStore) storeToArrow(schema *arrow.Schema, builder *array
 func (uds *unorderedDataStore) StoreToArrow(schema *arrow.Schema, builder *array.RecordBuilder) error {
 	return uds.storeToArrow(schema, builder)
 }
+
+// Sort reorders the buffered rows by the orderBy columns.
+// Columns absent from the store are skipped.
+func (uds *unorderedDataStore) Sort(orderBy []string) {
+	uds.mtx.Lock()
+	defer uds.mtx.Unlock()
+	var cols []data_types.IColumn
+	for _, name := range orderBy {
+		if col, ok := uds.store[name]; ok {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 || uds.size < 2 {
+		return
+	}
+	// IColumn.Less is "less or equal", so two checks are needed to tell the order from equality
+	cmp := func(i, j int32) int {
+		for _, col := range cols {
+			le, ge := col.Less(i, j), col.Less(j, i)
+			if le && !ge {
+				return -1
+			}
+			if ge && !le {
+				return 1
+			}
+		}
+		return 0
+	}
+	sorted := true
+	for i := int32(1); i < int32(uds.size); i++ {
+		if cmp(i-1, i) > 0 {
+			sorted = false
+			break
+		}
+	}
+	if sorted {
+		return
+	}
+	idx := make(data_types.IndexType, uds.size)
+	for i := range idx {
+		idx[i] = int32(i)
+	}
+	slices.SortStableFunc(idx, cmp)
+	for _, col := range uds.store {
+		col.Reorder(idx)
+	}
+}
+
+// Snapshot returns a copy of the buffered columns
+func (uds *unorderedDataStore) Snapshot() map[string]data_types.IColumn {
+	uds.mtx.Lock()
+	defer uds.mtx.Unlock()
+	res := make(map[string]data_types.IColumn, len(uds.store))
+	for k, col := range uds.store {
+		res[k] = col.Copy()
+	}
+	return res
+}
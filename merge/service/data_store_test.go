@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"slices"
+	"testing"
+)
+
+func TestUnorderedDataStoreSort(t *testing.T) {
+	uds := newUnorderedDataStore()
+	ts, _ := data_types.WrapToColumn("__timestamp", []int64{3, 1, 2, 1})
+	val, _ := data_types.WrapToColumn("val", []string{"c", "b", "a", "a"})
+	err := uds.AppendData(map[string]data_types.IColumn{"__timestamp": ts, "val": val})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uds.Sort([]string{"__timestamp", "val"})
+
+	if !slices.Equal(uds.store["__timestamp"].GetData().([]int64), []int64{1, 1, 2, 3}) {
+		t.Fatalf("unexpected timestamps: %v", uds.store["__timestamp"].GetData())
+	}
+	if !slices.Equal(uds.store["val"].GetData().([]string), []string{"a", "b", "a", "c"}) {
+		t.Fatalf("unexpected values: %v", uds.store["val"].GetData())
+	}
+	_min, _max := uds.store["__timestamp"].GetMinMax()
+	if _min != int64(1) || _max != int64(3) {
+		t.Fatalf("unexpected min/max: %v %v", _min, _max)
+	}
+}
+
+func TestUnorderedDataStoreLowCardinality(t *testing.T) {
+	conf := &config.Configuration{}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	uds := newUnorderedDataStore()
+	ts, _ := data_types.WrapToColumn("__timestamp", []int64{1, 2, 3, 4})
+	host, _ := data_types.WrapToColumn("host", data_types.TypedData{
+		Type: data_types.DATA_TYPE_NAME_LOW_CARDINALITY,
+		Data: []string{"a", "b", "a", "c"},
+	})
+	// the row of "b" isn't selected, so it isn't in the dictionary
+	err := uds.AppendByMask(map[string]data_types.IColumn{"__timestamp": ts, "host": host}, []byte{0b1101})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, _ = data_types.WrapToColumn("__timestamp", []int64{5, 6})
+	plain, _ := data_types.WrapToColumn("host", []string{"b", "d"})
+	if err = uds.AppendData(map[string]data_types.IColumn{"__timestamp": ts, "host": plain}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(uds.store["__timestamp"].GetData().([]int64), []int64{1, 3, 4, 5, 6}) {
+		t.Fatalf("unexpected timestamps: %v", uds.store["__timestamp"].GetData())
+	}
+	data := uds.store["host"].GetData().(data_types.DictStrings)
+	if !slices.Equal(data.Dict, []string{"a", "c", "b", "d"}) || !slices.Equal(data.Keys, []int32{0, 0, 1, 2, 3}) {
+		t.Fatalf("unexpected data: %v", data)
+	}
+	if _min, _max := uds.store["host"].GetMinMax(); _min != "a" || _max != "d" {
+		t.Fatalf("unexpected min/max: %v %v", _min, _max)
+	}
+
+	dir := t.TempDir()
+	fs := &fsSaveService{dataPath: dir, tmpPath: dir}
+	// the dictionary of the previous record isn't written again
+	for i := 0; i < 2; i++ {
+		fName, err := fs.Save(mergeColumns(uds), uds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rdr, err := file.OpenParquetFile(fName, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx := rdr.MetaData().Schema.ColumnIndexByName("host")
+		chunk, err := rdr.MetaData().RowGroup(0).ColumnChunk(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !chunk.HasDictionaryPage() {
+			t.Fatal("host isn't dictionary encoded")
+		}
+		fr, err := pqarrow.NewFileReader(rdr, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl, err := fr.ReadTable(context.Background())
+		rdr.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		col, _ := data_types.FromArrowArray(tbl.Column(tbl.Schema().FieldIndices("host")[0]).Data().Chunk(0))
+		tbl.Release()
+		if !slices.Equal(col.([]string), []string{"a", "a", "c", "b", "d"}) {
+			t.Fatalf("unexpected values: %v", col)
+		}
+	}
+}
+
+func TestSaveLowCardinalityRowGroups(t *testing.T) {
+	conf := &config.Configuration{}
+	conf.ApplyDefaults()
+	// the rows span several write batches and row groups
+	conf.Gigapi.Parquet.RowGroupSize = 2500
+	config.Set(conf)
+	n := 6000
+	tsv := make([]int64, n)
+	hosts := make([]string, n)
+	for i := range tsv {
+		tsv[i] = int64(i)
+		hosts[i] = []string{"a", "b", "c"}[i%3]
+	}
+	ts, _ := data_types.WrapToColumn("__timestamp", tsv)
+	host, _ := data_types.WrapToColumn("host", data_types.TypedData{
+		Type: data_types.DATA_TYPE_NAME_LOW_CARDINALITY,
+		Data: hosts,
+	})
+	uds := newUnorderedDataStore()
+	if err := uds.AppendData(map[string]data_types.IColumn{"__timestamp": ts, "host": host}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	fs := &fsSaveService{dataPath: dir, tmpPath: dir}
+	fName, err := fs.Save(mergeColumns(uds), uds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := file.OpenParquetFile(fName, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Close()
+	if rdr.NumRowGroups() != 3 {
+		t.Fatalf("unexpected row groups: %d", rdr.NumRowGroups())
+	}
+	fr, err := pqarrow.NewFileReader(rdr, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl, err := fr.ReadTable(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Release()
+	i := 0
+	for _, chunk := range tbl.Column(tbl.Schema().FieldIndices("host")[0]).Data().Chunks() {
+		col := chunk.(*array.String)
+		for j := 0; j < col.Len(); j, i = j+1, i+1 {
+			if col.Value(j) != hosts[i] {
+				t.Fatalf("unexpected value of row %d: %q", i, col.Value(j))
+			}
+		}
+	}
+	if i != n {
+		t.Fatalf("unexpected rows: %d", i)
+	}
+}
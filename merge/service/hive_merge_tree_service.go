@@ -153,7 +153,12 @@ func NewHiveMergeTreeService(t *shared.Table) (*HiveMergeTreeService, error) {
 		},
 		partitions: make(map[uint64]*Partition),
 	}
-	res.flushCtx, res.doFlush = context.WithTimeout(context.Background(), time.Second)
+	res.flushCtx, res.doFlush = context.WithTimeout(context.Background(), saveTimeout())
+	buffers.registerFlusher(t, func() {
+		res.mtx.Lock()
+		defer res.mtx.Unlock()
+		res.doFlush()
+	})
 	err := res.discoverPartitions()
 	if err != nil {
 		return nil, err
@@ -162,9 +167,19 @@ func NewHiveMergeTreeService(t *shared.Table) (*HiveMergeTreeService, error) {
 	return res, nil
 }
 
+// Discover registers the partitions created by the other processes since the last discovery
+func (h *HiveMergeTreeService) Discover() error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.discoverPartitions()
+}
+
 func (h *HiveMergeTreeService) discoverPartitions() error {
 	lastSuffix := fmt.Sprintf(".%d.parquet", MERGE_ITERATIONS+1)
 	err := filepath.Walk(h.Table.Path, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if !info.IsDir() {
 			return nil
 		}
@@ -269,8 +284,9 @@ func (h *HiveMergeTreeService) Run() {
 		for {
 			select {
 			case <-h.flushCtx.Done():
-				h.flushCtx, h.doFlush = context.WithTimeout(context.Background(),
-					time.Duration(config.Config.Gigapi.SaveTimeoutS)*time.Second)
+				h.mtx.Lock()
+				h.flushCtx, h.doFlush = context.WithTimeout(context.Background(), saveTimeout())
+				h.mtx.Unlock()
 				h.flush()
 			}
 		}
@@ -278,8 +294,14 @@ func (h *HiveMergeTreeService) Run() {
 }
 
 func (h *HiveMergeTreeService) flush() {
-	wg := sync.WaitGroup{}
+	h.mtx.Lock()
+	partitions := make([]*Partition, 0, len(h.partitions))
 	for _, part := range h.partitions {
+		partitions = append(partitions, part)
+	}
+	h.mtx.Unlock()
+	wg := sync.WaitGroup{}
+	for _, part := range partitions {
 		wg.Add(1)
 		go func(part *Partition) {
 			defer wg.Done()
@@ -366,6 +388,18 @@ func (h *HiveMergeTreeService) Store(columns map[string]any) utils.Promise[int32
 		return utils.Fulfilled[int32](err, 0)
 	}
 
+	total := columnsUsage(_columns)
+	usages := make([]BufferUsage, len(partsDesc))
+	var reserved BufferUsage
+	for i, part := range partsDesc {
+		usages[i] = maskUsage(total, part.IndexMap)
+		reserved = reserved.add(usages[i])
+	}
+	err = buffers.reserve(h.Table, reserved)
+	if err != nil {
+		return utils.Fulfilled[int32](err, 0)
+	}
+
 	var promises []utils.Promise[int32]
 	h.mtx.Lock()
 	for _, part := range partsDesc {
@@ -377,22 +411,22 @@ func (h *HiveMergeTreeService) Store(columns map[string]any) utils.Promise[int32
 				h.Table)
 			if err != nil {
 				h.mtx.Unlock()
+				buffers.release(h.Table, reserved)
 				return utils.Fulfilled[int32](err, 0)
 			}
 		}
 	}
 
-	for _, part := range partsDesc {
+	for i, part := range partsDesc {
 		id := h.calculatePartitionHash(part.Values)
-		promises = append(promises, h.partitions[id].StoreByMask(_columns, part.IndexMap))
+		promises = append(promises, h.partitions[id].StoreByMask(_columns, part.IndexMap, usages[i]))
 	}
 
 	s := int64(0)
 	for _, p := range h.partitions {
 		s += p.Size()
 	}
-	//TODO: add the configuration for max row limit before flush
-	if s > 1000000 {
+	if s > int64(config.Get().Gigapi.FlushRows) {
 		h.doFlush()
 	}
 	h.mtx.Unlock()
@@ -400,46 +434,66 @@ func (h *HiveMergeTreeService) Store(columns map[string]any) utils.Promise[int32
 	return utils.NewWaitForAll(promises)
 }
 
-func (h *HiveMergeTreeService) PlanMerge() (map[uint64][]PlanMerge, error) {
-	mergeByPartition := make(map[uint64][]PlanMerge)
-	for id, part := range h.partitions {
-		plan, err := part.PlanMerge()
-		if err != nil {
-			return nil, err
-		}
-		mergeByPartition[id] = append(mergeByPartition[id], plan...)
+func (h *HiveMergeTreeService) Snapshot() *BufferSnapshot {
+	h.mtx.Lock()
+	partitions := make([]*Partition, 0, len(h.partitions))
+	for _, part := range h.partitions {
+		partitions = append(partitions, part)
+	}
+	h.mtx.Unlock()
+	res := &BufferSnapshot{}
+	for _, part := range partitions {
+		res.merge(part.Snapshot())
 	}
-	return mergeByPartition, nil
+	return res
 }
 
-func (h *HiveMergeTreeService) Merge(plan map[uint64][]PlanMerge) error {
+// mergePartitions merges the partitions concurrently.
+// The partitions compacted by another process at the moment are skipped.
+func mergePartitions(partitions map[uint64]*Partition) error {
 	errGroup := errgroup.Group{}
 	fmt.Println("Starting merges...")
 	start := time.Now()
-	for id, merges := range plan {
-		_id := id
-		_merges := merges
-		errGroup.Go(func() error {
-			if part, ok := h.partitions[_id]; ok {
-				err := part.DoMerge(_merges)
-				if err != nil {
-					return err
-				}
-			}
-			return nil
-		})
+	for _, part := range partitions {
+		_part := part
+		errGroup.Go(_part.Merge)
 	}
 	err := errGroup.Wait()
 	fmt.Printf("Merge time: %v\n", time.Since(start))
 	return err
 }
 
+func compactPartitions(partitions map[uint64]*Partition) error {
+	errGroup := errgroup.Group{}
+	for _, part := range partitions {
+		errGroup.Go(part.Compact)
+	}
+	return errGroup.Wait()
+}
+
 func (h *HiveMergeTreeService) DoMerge() error {
-	plan, err := h.PlanMerge()
+	h.mtx.Lock()
+	partitions := make(map[uint64]*Partition, len(h.partitions))
+	for id, part := range h.partitions {
+		partitions[id] = part
+	}
+	h.mtx.Unlock()
+	return mergePartitions(partitions)
+}
+
+// Compact discovers the partitions of the table and runs all their merge iterations
+func (h *HiveMergeTreeService) Compact() error {
+	err := h.Discover()
 	if err != nil {
 		return err
 	}
-	return h.Merge(plan)
+	h.mtx.Lock()
+	partitions := make(map[uint64]*Partition, len(h.partitions))
+	for id, part := range h.partitions {
+		partitions[id] = part
+	}
+	h.mtx.Unlock()
+	return compactPartitions(partitions)
 }
 
 type mtHiveStoreReq struct {
@@ -495,29 +549,46 @@ func (m *MultithreadHiveMergeTreeService) Store(columns map[string]any) utils.Pr
 	return <-req.res
 }
 
-func (m *MultithreadHiveMergeTreeService) DoMerge() error {
+func (m *MultithreadHiveMergeTreeService) Snapshot() *BufferSnapshot {
+	res := &BufferSnapshot{}
+	for _, _m := range m.svcs {
+		res.merge(_m.Snapshot())
+	}
+	return res
+}
+
+func (m *MultithreadHiveMergeTreeService) Discover() error {
+	return m.svcs[0].Discover()
+}
+
+func (m *MultithreadHiveMergeTreeService) Compact() error {
+	err := m.svcs[0].Discover()
+	if err != nil {
+		return err
+	}
 	partitions := map[uint64]*Partition{}
 	for _, _m := range m.svcs {
+		_m.mtx.Lock()
 		for id, part := range _m.partitions {
 			partitions[id] = part
 		}
+		_m.mtx.Unlock()
 	}
+	return compactPartitions(partitions)
+}
 
-	mergeByPartition := make(map[uint64][]PlanMerge)
-	for id, part := range partitions {
-		plan, err := part.PlanMerge()
-		if err != nil {
-			return err
+func (m *MultithreadHiveMergeTreeService) DoMerge() error {
+	partitions := map[uint64]*Partition{}
+	for _, _m := range m.svcs {
+		_m.mtx.Lock()
+		for id, part := range _m.partitions {
+			partitions[id] = part
 		}
-		mergeByPartition[id] = append(mergeByPartition[id], plan...)
-	}
-	wg := errgroup.Group{}
-	for k, p := range mergeByPartition {
-		_k := k
-		_p := p
-		wg.Go(func() error {
-			return partitions[_k].DoMerge(_p)
-		})
+		_m.mtx.Unlock()
 	}
-	return wg.Wait()
+	return mergePartitions(partitions)
+}
+
+func saveTimeout() time.Duration {
+	return time.Duration(config.Get().Gigapi.SaveTimeoutS * float64(time.Second))
 }
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"github.com/gigapi/gigapi/v2/config"
 	"github.com/gigapi/gigapi/v2/merge/data_types"
 	"github.com/gigapi/gigapi/v2/merge/shared"
+	mergeUtils "github.com/gigapi/gigapi/v2/merge/utils"
 	"github.com/gigapi/gigapi/v2/utils"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 )
@@ -23,6 +26,8 @@ type Partition struct {
 	lastSave          time.Time
 	lastIterationTime [MERGE_ITERATIONS]time.Time
 	dataPath          string
+	buffered          BufferUsage
+	saving            []*pendingSave
 }
 
 func NewPartition(values [][2]string, tmpPath, dataPath string, t *shared.Table) (*Partition, error) {
@@ -42,10 +47,19 @@ func NewPartition(values [][2]string, tmpPath, dataPath string, t *shared.Table)
 			return nil, err
 		}
 		dropQueue := res.index.GetDropQueue()
+		// the drop queue is cleaned up by the node merging the partition
+		if config.Get().Gigapi.Role == config.RoleWriter {
+			dropQueue = nil
+		}
 		go func() {
-			time.Sleep(time.Second * 10)
+			time.Sleep(config.Get().Gigapi.Retention.MergedFiles())
+			// the pinned files stay in the drop queue until the next start
+			dropQueue := slices.DeleteFunc(slices.Clone(dropQueue), func(file string) bool {
+				return IsPinned(t.Path, file)
+			})
+			// the entries are the absolute paths of the merged files
 			for _, file := range dropQueue {
-				os.Remove(filepath.Join(res.dataPath, file))
+				os.Remove(file)
 			}
 			res.index.RmFromDropQueue(dropQueue)
 		}()
@@ -82,27 +96,33 @@ func (p *Partition) GetSchema() map[string]string {
 	return nil
 }
 
-func (p *Partition) StoreByMask(data map[string]data_types.IColumn, mask []byte) utils.Promise[int32] {
-	p.m.Lock()
-	defer p.m.Unlock()
-	err := p.unordered.AppendByMask(data, mask)
-	if err != nil {
+// StoreByMask buffers the rows selected by the mask. usage is the amount of the buffer
+// reserved for the rows, it is released when the partition is saved.
+func (p *Partition) StoreByMask(data map[string]data_types.IColumn, mask []byte,
+	usage BufferUsage) utils.Promise[int32] {
+	return p.store(func() error { return p.unordered.AppendByMask(data, mask) }, usage)
+}
+
+// Store buffers all the rows of data. Their buffer usage is reserved as the table writes do,
+// so the limits and the backpressure apply to them as well.
+func (p *Partition) Store(data map[string]data_types.IColumn) utils.Promise[int32] {
+	usage := columnsUsage(data)
+	if err := buffers.reserve(p.table, usage); err != nil {
 		return utils.Fulfilled(err, int32(0))
 	}
-	res := utils.New[int32]()
-	p.promises = append(p.promises, res)
-	p.lastStore = time.Now()
-	return res
+	return p.store(func() error { return p.unordered.AppendData(data) }, usage)
 }
 
-func (p *Partition) Store(data map[string]data_types.IColumn) utils.Promise[int32] {
+// store appends the rows with the reserved usage, which is released on failure
+func (p *Partition) store(appendData func() error, usage BufferUsage) utils.Promise[int32] {
 	p.m.Lock()
 	defer p.m.Unlock()
-	var err error
-	err = p.unordered.AppendData(data)
+	err := appendData()
 	if err != nil {
+		buffers.release(p.table, usage)
 		return utils.Fulfilled(err, int32(0))
 	}
+	p.buffered = p.buffered.add(usage)
 	res := utils.New[int32]()
 	p.promises = append(p.promises, res)
 	p.lastStore = time.Now()
@@ -110,6 +130,8 @@ func (p *Partition) Store(data map[string]data_types.IColumn) utils.Promise[int3
 }
 
 func (p *Partition) Size() int64 {
+	p.m.Lock()
+	defer p.m.Unlock()
 	return p.unordered.GetSize()
 }
 
@@ -119,8 +141,16 @@ func (p *Partition) Save() {
 	p.promises = nil
 	unordered := p.unordered
 	p.unordered = newUnorderedDataStore()
+	buffered := p.buffered
+	p.buffered = BufferUsage{}
 	p.lastSave = time.Now()
+	pending := &pendingSave{store: unordered}
+	if len(promises) > 0 {
+		p.saving = append(p.saving, pending)
+	}
 	p.m.Unlock()
+	defer buffers.release(p.table, buffered)
+	defer p.rmPendingSave(pending)
 
 	onErr := func(err error) {
 		for _, p := range promises {
@@ -131,6 +161,9 @@ func (p *Partition) Save() {
 	if len(promises) == 0 {
 		return
 	}
+	if !config.Get().Gigapi.NoSortOnSave {
+		unordered.Sort(p.table.OrderBy)
+	}
 	//TODO: remove the logic of dynamic schema
 	fName, err := p.saveService.Save(mergeColumns(unordered), unordered)
 	if err != nil {
@@ -141,8 +174,16 @@ func (p *Partition) Save() {
 	_min := make(map[string]any)
 	_max := make(map[string]any)
 
-	if col, ok := unordered.store[p.table.OrderBy[0]]; ok {
-		_min[p.table.OrderBy[0]], _max[p.table.OrderBy[0]] = col.GetMinMax()
+	for name, col := range unordered.store {
+		colMin, colMax := col.GetMinMax()
+		if colMin == nil {
+			continue
+		}
+		_min[name], _max[name] = colMin, colMax
+	}
+
+	if p.table.Manifest != nil {
+		p.table.Manifest.UpdateSchema(unordered.GetSchema())
 	}
 
 	if p.index != nil {
@@ -151,6 +192,7 @@ func (p *Partition) Save() {
 			onErr(err)
 			return
 		}
+		pending.setFile(absDataPath)
 		stat, err := os.Stat(absDataPath)
 		if err != nil {
 			onErr(err)
@@ -160,12 +202,13 @@ func (p *Partition) Save() {
 		size := unordered.GetSize()
 
 		prom := p.index.Batch([]*shared.IndexEntry{{
-			Path:      absDataPath,
-			SizeBytes: stat.Size(),
-			RowCount:  size,
-			ChunkTime: time.Now().UnixNano(),
-			Min:       _min,
-			Max:       _max,
+			Path:        absDataPath,
+			SizeBytes:   stat.Size(),
+			RowCount:    size,
+			ChunkTime:   time.Now().UnixNano(),
+			Min:         _min,
+			Max:         _max,
+			ColumnStats: true,
 		}}, nil)
 		_, err = prom.Get()
 		if err != nil {
@@ -176,6 +219,31 @@ func (p *Partition) Save() {
 	onErr(nil)
 }
 
+func (p *Partition) rmPendingSave(pending *pendingSave) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	for i, ps := range p.saving {
+		if ps == pending {
+			p.saving = append(p.saving[:i], p.saving[i+1:]...)
+			return
+		}
+	}
+}
+
+// Snapshot copies the buffered rows and the rows being saved but not yet indexed
+func (p *Partition) Snapshot() *BufferSnapshot {
+	p.m.Lock()
+	defer p.m.Unlock()
+	res := &BufferSnapshot{pending: append([]*pendingSave{}, p.saving...)}
+	for _, ps := range p.saving {
+		res.Stores = append(res.Stores, ps.store.Snapshot())
+	}
+	if p.unordered.GetSize() > 0 {
+		res.Stores = append(res.Stores, p.unordered.Snapshot())
+	}
+	return res
+}
+
 func (p *Partition) PlanMerge() ([]PlanMerge, error) {
 	var res []PlanMerge
 
@@ -194,6 +262,57 @@ func (p *Partition) PlanMerge() ([]PlanMerge, error) {
 	return res, nil
 }
 
+// Compact runs all the merge iterations of the partition one after another regardless
+// of their timeouts. It waits for the merge lock if another process compacts the partition.
+func (p *Partition) Compact() error {
+	lock, err := mergeUtils.LockFile(filepath.Join(p.dataPath, "merge.lock"))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if p.index != nil {
+		err = p.index.Refresh()
+		if err != nil {
+			return err
+		}
+	}
+	for _, conf := range getMergeConfigurations() {
+		files, err := p.mergeService.GetFilesToMerge(int(conf[2]))
+		if err != nil {
+			return err
+		}
+		err = p.DoMerge(p.mergeService.PlanMerge(files, conf[1], int(conf[2])))
+		if err != nil {
+			return err
+		}
+		p.lastIterationTime[conf[2]-1] = time.Now()
+	}
+	return nil
+}
+
 func (p *Partition) DoMerge(plan []PlanMerge) error {
 	return p.mergeService.DoMerge(plan)
 }
+
+// Merge plans and runs the merges of the partition holding its merge lock,
+// so only one process compacts the partition at a time.
+// The partition is skipped if the lock is held by another process.
+func (p *Partition) Merge() error {
+	lock, ok, err := mergeUtils.TryLockFile(filepath.Join(p.dataPath, "merge.lock"))
+	if err != nil || !ok {
+		return err
+	}
+	defer lock.Unlock()
+	if p.index != nil {
+		// the other processes could save or merge files since the last merge
+		err = p.index.Refresh()
+		if err != nil {
+			return err
+		}
+	}
+	plan, err := p.PlanMerge()
+	if err != nil || len(plan) == 0 {
+		return err
+	}
+	return p.DoMerge(plan)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"github.com/gigapi/gigapi/v2/config"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"github.com/gigapi/gigapi/v2/merge/index"
+	"github.com/gigapi/gigapi/v2/merge/shared"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPartitionCleansDropQueue(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			Retention: config.RetentionConfiguration{MergedFilesS: 0.1},
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	table := &shared.Table{Database: "db", Name: "t", Path: t.TempDir()}
+	values := [][2]string{{"date", "2025-04-24"}, {"hour", "10"}}
+	idx, err := index.NewJSONIndexForPartition(table, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Run()
+	defer idx.Stop()
+	table.IndexCreator = func(values [][2]string) (shared.Index, error) {
+		return idx, nil
+	}
+
+	dataPath := filepath.Join(table.Path, "date=2025-04-24", "hour=10")
+	if err = os.MkdirAll(dataPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dropped, pinned := filepath.Join(dataPath, "dropped.1.parquet"), filepath.Join(dataPath, "pinned.1.parquet")
+	for _, f := range []string{dropped, pinned} {
+		if err = os.WriteFile(f, []byte("PAR1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = idx.AddToDropQueue([]string{dropped, pinned}).Get(); err != nil {
+		t.Fatal(err)
+	}
+	if err = PinFiles(table.Path, "export", []string{pinned}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewPartition(values, filepath.Join(table.Path, "tmp"), dataPath, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(config.Get().Gigapi.Retention.MergedFiles() * 5)
+	if _, err = os.Stat(dropped); err == nil {
+		t.Fatal("the dropped file is not removed")
+	}
+	if _, err = os.Stat(pinned); err != nil {
+		t.Fatalf("the pinned file is removed: %v", err)
+	}
+	if q := idx.GetDropQueue(); !slices.Equal(q, []string{pinned}) {
+		t.Fatalf("unexpected drop queue: %v", q)
+	}
+}
+
+func TestPartitionStoreReservesBuffer(t *testing.T) {
+	conf := &config.Configuration{
+		Gigapi: config.GigapiConfiguration{
+			SaveTimeoutS:        3600,
+			MaxTableBufferRows:  3,
+			MaxBufferWaitS:      0.1,
+			BufferPressureRatio: 1,
+		},
+	}
+	conf.ApplyDefaults()
+	config.Set(conf)
+	table := &shared.Table{Database: "db", Name: "partition_store", Path: t.TempDir()}
+	values := [][2]string{{"date", "2025-04-24"}, {"hour", "10"}}
+	p, err := NewPartition(values, filepath.Join(table.Path, "tmp"),
+		filepath.Join(table.Path, "date=2025-04-24", "hour=10"), table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := func() int64 {
+		for _, u := range GetBufferStats().Tables {
+			if u.Database == table.Database && u.Table == table.Name {
+				return u.Rows
+			}
+		}
+		return 0
+	}
+	ts, _ := data_types.WrapToColumn("__timestamp", []int64{1, 2})
+	if _, _, err = p.Store(map[string]data_types.IColumn{"__timestamp": ts}).Peek(); err != nil {
+		t.Fatal(err)
+	}
+	if rows := usage(); rows != 2 {
+		t.Fatalf("expected 2 reserved rows, got %d", rows)
+	}
+	var bufErr *BufferFullError
+	_, _, err = p.Store(map[string]data_types.IColumn{"__timestamp": ts}).Peek()
+	if !errors.As(err, &bufErr) {
+		t.Fatalf("expected buffer full error, got %v", err)
+	}
+	if rows := usage(); rows != 2 {
+		t.Fatalf("the rejected rows are reserved: %d", rows)
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/schema"
+	"github.com/gigapi/gigapi/v2/config"
 	"github.com/gigapi/gigapi/v2/merge/shared"
 	"github.com/gigapi/gigapi/v2/merge/utils"
 	"github.com/google/uuid"
@@ -16,8 +20,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -198,12 +204,28 @@ func installChSql(db *sql.DB) error {
 	return err
 }
 
-// TODO: ADD configuration for this
-var firstIterationSemaphore = semaphore.NewWeighted(1)
+var (
+	firstIterationSemaphore     *semaphore.Weighted
+	firstIterationSemaphoreOnce sync.Once
+)
+
+func getFirstIterationSemaphore() *semaphore.Weighted {
+	firstIterationSemaphoreOnce.Do(func() {
+		firstIterationSemaphore = semaphore.NewWeighted(int64(config.Get().Gigapi.Merges.FirstTierConcurrency))
+	})
+	return firstIterationSemaphore
+}
+
+// parquetCopyOptions returns the options of the COPY TO statements writing the merged files
+func parquetCopyOptions() string {
+	return fmt.Sprintf("FORMAT 'parquet', COMPRESSION '%s', ROW_GROUP_SIZE %d",
+		config.Get().Gigapi.Parquet.Compression, config.Get().Gigapi.Parquet.MergeRowGroupSize)
+}
 
 func (f *fsMergeService) mergeFirstIteration(p PlanMerge) error {
-	firstIterationSemaphore.Acquire(context.Background(), 1)
-	defer firstIterationSemaphore.Release(1)
+	sem := getFirstIterationSemaphore()
+	sem.Acquire(context.Background(), 1)
+	defer sem.Release(1)
 	tmpFilePath := filepath.Join(f.tmpPath, p.To)
 	finalFilePath := filepath.Join(f.dataPath, p.To)
 	conn, cancel, err := utils.ConnectDuckDB("?allow_unsigned_extensions=1")
@@ -211,10 +233,15 @@ func (f *fsMergeService) mergeFirstIteration(p PlanMerge) error {
 		return err
 	}
 	defer cancel()
+	from, cleanupCopies, err := f.upgradeLegacyFiles(conn, p.From)
+	if err != nil {
+		return err
+	}
+	defer cleanupCopies()
 	createTableSQL := fmt.Sprintf(
-		`COPY(FROM read_parquet(ARRAY['%s'], hive_partitioning = false, union_by_name = true) ORDER BY %s)TO '%s' (FORMAT 'parquet')`,
-		strings.Join(p.From, "','"),
-		strings.Join(f.table.OrderBy, " ASC,")+" ASC", tmpFilePath)
+		`COPY(FROM read_parquet(ARRAY['%s'], hive_partitioning = false, union_by_name = true) ORDER BY %s)TO '%s' (%s)`,
+		strings.Join(from, "','"),
+		strings.Join(f.table.OrderBy, " ASC,")+" ASC", tmpFilePath, parquetCopyOptions())
 	_, err = conn.Exec(createTableSQL)
 	if err != nil {
 		fmt.Println("Error read_parquet_mergetree: ", err)
@@ -238,11 +265,104 @@ func (f *fsMergeService) mergeFirstIteration(p PlanMerge) error {
 	return nil
 }
 
+// maxLegacyCacheSize bounds the cache of the checked files, it's reset once full
+const maxLegacyCacheSize = 100000
+
+// legacyCache holds the results of IsLegacyTimestampFile, the saved files are never modified
+var legacyCache = struct {
+	sync.Mutex
+	files map[string]bool
+}{files: map[string]bool{}}
+
+// IsLegacyTimestampFile reports if the __timestamp of the file is a plain INT64,
+// as written before it became a parquet timestamp. The results are cached per path.
+func IsLegacyTimestampFile(fileName string) (bool, error) {
+	legacyCache.Lock()
+	res, ok := legacyCache.files[fileName]
+	legacyCache.Unlock()
+	if ok {
+		return res, nil
+	}
+	res, err := isLegacyTimestampFile(fileName)
+	if err != nil {
+		return false, err
+	}
+	legacyCache.Lock()
+	defer legacyCache.Unlock()
+	if len(legacyCache.files) >= maxLegacyCacheSize {
+		legacyCache.files = map[string]bool{}
+	}
+	legacyCache.files[fileName] = res
+	return res, nil
+}
+
+func isLegacyTimestampFile(fileName string) (bool, error) {
+	rdr, err := file.OpenParquetFile(fileName, false)
+	if err != nil {
+		return false, err
+	}
+	defer rdr.Close()
+	idx := rdr.MetaData().Schema.ColumnIndexByName("__timestamp")
+	if idx < 0 {
+		return false, nil
+	}
+	col := rdr.MetaData().Schema.Column(idx)
+	_, isTimestamp := col.LogicalType().(*schema.TimestampLogicalType)
+	return col.PhysicalType() == parquet.Types.Int64 && !isTimestamp, nil
+}
+
+// LegacyTimestampProjection selects the columns of a legacy file with the __timestamp converted
+// to TIMESTAMP_NS
+const LegacyTimestampProjection = "* REPLACE (make_timestamp_ns(__timestamp) AS __timestamp)"
+
+// upgradeLegacyFiles copies the files with an INT64 __timestamp to tmp files with a TIMESTAMP_NS one
+// if they are merged with the newer files, as DuckDB can't read both types as a single column.
+// It returns the files to merge and the function removing the copies.
+func (f *fsMergeService) upgradeLegacyFiles(conn *sql.DB, files []string) ([]string, func(), error) {
+	var legacy []int
+	for i, fileName := range files {
+		isLegacy, err := IsLegacyTimestampFile(fileName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isLegacy {
+			legacy = append(legacy, i)
+		}
+	}
+	if len(legacy) == 0 || len(legacy) == len(files) {
+		return files, func() {}, nil
+	}
+	res := slices.Clone(files)
+	var copies []string
+	cleanup := func() {
+		for _, c := range copies {
+			os.Remove(c)
+		}
+	}
+	for _, i := range legacy {
+		copyPath := filepath.Join(f.tmpPath, uuid.NewString()+".legacy.parquet")
+		_, err := conn.Exec(fmt.Sprintf(
+			`COPY(SELECT %s FROM read_parquet('%s'))TO '%s' (%s)`,
+			LegacyTimestampProjection, files[i], copyPath, parquetCopyOptions()))
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("%s: converting __timestamp: %w", files[i], err)
+		}
+		copies = append(copies, copyPath)
+		res[i] = copyPath
+	}
+	return res, cleanup, nil
+}
+
 func (f *fsMergeService) cleanup(p PlanMerge) {
 	for _, file := range p.From {
 		_file := file
 		go func() {
-			<-time.After(time.Second * 30)
+			delay := config.Get().Gigapi.Retention.MergedFiles()
+			<-time.After(delay)
+			for IsPinned(f.table.Path, _file) {
+				<-time.After(max(delay, time.Second))
+			}
 			os.Remove(_file)
 			if f.index != nil {
 				f.index.RmFromDropQueue([]string{_file})
@@ -261,11 +381,16 @@ func (f *fsMergeService) mergeMany(p PlanMerge, tmpFilePath, finalFilePath strin
 	if err != nil {
 		return err
 	}
+	from, cleanupCopies, err := f.upgradeLegacyFiles(conn, p.From)
+	if err != nil {
+		return err
+	}
+	defer cleanupCopies()
 
 	createTableSQL := fmt.Sprintf(
-		`COPY(SELECT * FROM read_parquet_mergetree(ARRAY['%s'], '%s'))TO '%s' (FORMAT 'parquet')`,
-		strings.Join(p.From, "','"),
-		strings.Join(f.table.OrderBy, ","), tmpFilePath)
+		`COPY(SELECT * FROM read_parquet_mergetree(ARRAY['%s'], '%s'))TO '%s' (%s)`,
+		strings.Join(from, "','"),
+		strings.Join(f.table.OrderBy, ","), tmpFilePath, parquetCopyOptions())
 	_, err = conn.Exec(createTableSQL)
 
 	if err != nil {
@@ -296,7 +421,12 @@ func (f *fsMergeService) merge(p PlanMerge) error {
 	var err error
 
 	if len(p.From) == 1 {
-		err = os.Rename(p.From[0], finalFilePath)
+		// the source is linked, not renamed, as it may be pinned by an export.
+		// It's removed by the cleanup.
+		err = os.Link(p.From[0], finalFilePath)
+		if err != nil {
+			err = os.Rename(p.From[0], finalFilePath)
+		}
 	} else {
 		err = f.mergeMany(p, tmpFilePath, finalFilePath)
 	}
@@ -316,26 +446,19 @@ func (f *fsMergeService) merge(p PlanMerge) error {
 }
 
 func (f *fsMergeService) updateIndex(merge PlanMerge) error {
-	_min := make(map[string]any)
-	_max := make(map[string]any)
 	var rowCount int64
 	toDelete := make([]string, len(merge.From))
+	fromEntries := make([]*shared.IndexEntry, len(merge.From))
 	for i, file := range merge.From {
 		path, err := filepath.Abs(file)
 		if err != nil {
 			return err
 		}
 		toDelete[i] = path
-		fromIdx := f.index.Get(path)
-		if i == 0 {
-			_min["__timestamp"] = fromIdx.Min["__timestamp"]
-			_max["__timestamp"] = fromIdx.Max["__timestamp"]
-		} else {
-			_min["__timestamp"] = min(_min["__timestamp"].(int64), fromIdx.Min["__timestamp"].(int64))
-			_max["__timestamp"] = max(_max["__timestamp"].(int64), fromIdx.Max["__timestamp"].(int64))
-		}
-		rowCount += fromIdx.RowCount
+		fromEntries[i] = f.index.Get(path)
+		rowCount += fromEntries[i].RowCount
 	}
+	_min, _max, columnStats := shared.MergeStats(fromEntries)
 	path, err := filepath.Abs(path.Join(f.dataPath, merge.To))
 	if err != nil {
 		return err
@@ -345,22 +468,21 @@ func (f *fsMergeService) updateIndex(merge PlanMerge) error {
 		return err
 	}
 	newIdx := &shared.IndexEntry{
-		Path:      path,
-		SizeBytes: stat.Size(),
-		RowCount:  rowCount,
-		ChunkTime: time.Now().UnixNano(),
-		Min:       _min,
-		Max:       _max,
-	}
-	prom := f.index.Batch([]*shared.IndexEntry{newIdx}, toDelete)
-	f.index.AddToDropQueue(merge.From)
-	_, err = prom.Get()
+		Path:        path,
+		SizeBytes:   stat.Size(),
+		RowCount:    rowCount,
+		ChunkTime:   time.Now().UnixNano(),
+		Min:         _min,
+		Max:         _max,
+		ColumnStats: columnStats,
+	}
+	_, err = f.index.CommitMerge(newIdx, toDelete, merge.From).Get()
 	return err
 }
 
 func (f *fsMergeService) doMerge(merges []PlanMerge, merge func(p PlanMerge) error) error {
 	errGroup := errgroup.Group{}
-	sem := semaphore.NewWeighted(10)
+	sem := semaphore.NewWeighted(int64(config.Get().Gigapi.Merges.Concurrency))
 	for _, m := range merges {
 
 		_m := m
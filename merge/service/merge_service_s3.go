@@ -111,9 +111,9 @@ func (s *s3MergeService) merge(p PlanMerge) error {
 		return err
 	}
 	createTableSQL := fmt.Sprintf(
-		`COPY(SELECT * FROM read_parquet_mergetree(ARRAY['%s'], '%s'))TO '%s' (FORMAT 'parquet')`,
+		`COPY(SELECT * FROM read_parquet_mergetree(ARRAY['%s'], '%s'))TO '%s' (%s)`,
 		strings.Join(from, "','"),
-		strings.Join(s.table.OrderBy, ","), tmpFilePath)
+		strings.Join(s.table.OrderBy, ","), tmpFilePath, parquetCopyOptions())
 	fmt.Println(createTableSQL)
 	_, err = conn.Exec(createTableSQL)
 	if err != nil {
@@ -34,6 +34,7 @@ type MergeTreeService struct {
 	merge              mergeService
 	lastIterationTime  [MERGE_ITERATIONS]time.Time
 	unorderedDataStore *unorderedDataStore
+	buffered           BufferUsage
 
 	less func(store any, i int32, j int32) bool
 }
@@ -48,13 +49,14 @@ func NewMergeTreeService(t *shared.Table) (*MergeTreeService, error) {
 	var err error
 	tablePath := t.Path
 	if tablePath == "" {
-		tablePath = filepath.Join(config.Config.Gigapi.Root, t.Name)
+		tablePath = filepath.Join(config.Get().Gigapi.Root, t.Name)
 	}
 	res.save, err = res.newSaveService(path.Join(tablePath, "data"), path.Join(tablePath, "tmp"))
 	if err != nil {
 		return nil, err
 	}
 	res.merge, err = res.newMergeService()
+	buffers.registerFlusher(t, res.flush)
 	for i := range res.lastIterationTime {
 		res.lastIterationTime[i] = time.Now()
 	}
@@ -83,7 +85,7 @@ func (s *MergeTreeService) newS3MergeService() (mergeService, error) {
 	}
 	return &s3MergeService{
 		fsMergeService: fsMergeService{
-			tmpPath: path.Join(config.Config.Gigapi.Root, s.Table.Name, "tmp"),
+			tmpPath: path.Join(config.Get().Gigapi.Root, s.Table.Name, "tmp"),
 			table:   s.Table,
 		},
 		s3Config: s3Conf,
@@ -112,7 +114,7 @@ func (s *MergeTreeService) newS3SaveService(dataPath string) (saveService, error
 	res := &s3SaveService{
 		fsSaveService: fsSaveService{
 			dataPath: "",
-			tmpPath:  path.Join(config.Config.Gigapi.Root, s.Table.Name, "tmp"),
+			tmpPath:  path.Join(config.Get().Gigapi.Root, s.Table.Name, "tmp"),
 		},
 		s3Config: s3Conf,
 	}
@@ -120,6 +122,12 @@ func (s *MergeTreeService) newS3SaveService(dataPath string) (saveService, error
 }
 
 func (s *MergeTreeService) getS3Config(path string) (s3Config, error) {
+	return parseS3URL(path)
+}
+
+// parseS3URL parses the s3://key:secret@host/bucket/path?secure=false&region=... URL.
+// The missing endpoint, credentials, region and security fall back to the gigapi.s3 configuration.
+func parseS3URL(path string) (s3Config, error) {
 	url, err := url2.Parse(path)
 	if err != nil {
 		return s3Config{}, err
@@ -127,16 +135,31 @@ func (s *MergeTreeService) getS3Config(path string) (s3Config, error) {
 	if url.Scheme != "s3" {
 		return s3Config{}, errors.New("invalid S3 URL")
 	}
-	pass, _ := url.User.Password()
+	defaults := config.Get().Gigapi.S3
+	key, pass := defaults.AccessKey, defaults.SecretKey
+	if url.User != nil {
+		key = url.User.Username()
+		pass, _ = url.User.Password()
+	}
+	host := url.Host
+	if host == "" {
+		host = defaults.Endpoint
+	}
 	bucketPath := strings.SplitN(strings.TrimPrefix(url.Path, "/"), "/", 2)
-	secure := !(url.Query().Get("secure") == "false")
-	region := ""
+	if len(bucketPath) < 2 {
+		return s3Config{}, errors.New("S3 URL should contain a bucket and a path")
+	}
+	secure := !defaults.Insecure
+	if url.Query().Get("secure") != "" {
+		secure = url.Query().Get("secure") != "false"
+	}
+	region := defaults.Region
 	if url.Query().Get("region") != "" {
 		region = url.Query().Get("region")
 	}
 	return s3Config{
-		url:    url.Host,
-		key:    url.User.Username(),
+		url:    host,
+		key:    key,
 		secret: pass,
 		bucket: bucketPath[0],
 		region: region,
@@ -182,6 +205,8 @@ func (s *MergeTreeService) flush() {
 	s.unorderedDataStore = newUnorderedDataStore()
 	promises := s.promises
 	s.promises = nil
+	buffered := s.buffered
+	s.buffered = BufferUsage{}
 	s.mtx.Unlock()
 	onError := func(err error) {
 		for _, p := range promises {
@@ -189,10 +214,15 @@ func (s *MergeTreeService) flush() {
 		}
 	}
 	if unorderedDataStore.GetSize() == 0 {
+		buffers.release(s.Table, buffered)
 		onError(nil)
 		return
 	}
 	go func() {
+		defer buffers.release(s.Table, buffered)
+		if !config.Get().Gigapi.NoSortOnSave {
+			unorderedDataStore.Sort(s.Table.OrderBy)
+		}
 		_, err := s.save.Save(mergeColumns(unorderedDataStore), unorderedDataStore)
 		onError(err)
 	}()
@@ -205,9 +235,10 @@ func (s *MergeTreeService) Run() {
 		return
 	}
 	go func() {
-		s.ticker = time.NewTicker(time.Millisecond * time.Duration(config.Config.Gigapi.SaveTimeoutS*1000))
+		s.ticker = time.NewTicker(saveTimeout())
 		for range s.ticker.C {
 			s.flush()
+			s.ticker.Reset(saveTimeout())
 		}
 	}()
 }
@@ -256,6 +287,10 @@ func (s *MergeTreeService) wrapColumns(columns map[string]any) (map[string]data_
 	_columns := make(map[string]data_types.IColumn, len(columns)+1)
 	var err error
 	for k, v := range columns {
+		if ts, ok := v.([]int64); ok && k == "__timestamp" {
+			// the nanoseconds of __timestamp are written as a parquet timestamp
+			v = data_types.TypedData{Type: data_types.DATA_TYPE_NAME_TIMESTAMP_NS, Data: ts}
+		}
 		_columns[k], err = data_types.WrapToColumn(k, v)
 		if err != nil {
 			return nil, err
@@ -269,6 +304,10 @@ func (s *MergeTreeService) AutoTimestamp(columns map[string]data_types.IColumn)
 	if !s.Table.AutoTimestamp {
 		return columns, nil
 	}
+	if ts, ok := columns["__timestamp"]; ok && data_types.IsTimestampType(ts.GetTypeName()) {
+		// the timestamp is provided by the client, e.g. historic data import
+		return columns, nil
+	}
 
 	var sz int64
 	for _, col := range columns {
@@ -281,7 +320,8 @@ func (s *MergeTreeService) AutoTimestamp(columns map[string]data_types.IColumn)
 		tsData[i] = time.Now().UnixNano()
 	}
 
-	tsCol, err := data_types.WrapToColumn("__timestamp", tsData)
+	tsCol, err := data_types.WrapToColumn("__timestamp",
+		data_types.TypedData{Type: data_types.DATA_TYPE_NAME_TIMESTAMP_NS, Data: tsData})
 	if err != nil {
 		return nil, err
 	}
@@ -305,14 +345,22 @@ func (s *MergeTreeService) Store(columns map[string]any) utils.Promise[int32] {
 		return utils.Fulfilled(err, int32(0))
 	}
 
+	usage := columnsUsage(_columns)
+	err = buffers.reserve(s.Table, usage)
+	if err != nil {
+		return utils.Fulfilled(err, int32(0))
+	}
+
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
 	var ds dataStore = s.unorderedDataStore
 	err = ds.AppendData(_columns)
 	if err != nil {
+		buffers.release(s.Table, usage)
 		return utils.Fulfilled(err, int32(0))
 	}
+	s.buffered = s.buffered.add(usage)
 	p := utils.New[int32]()
 	s.promises = append(s.promises, p)
 	return p
@@ -329,18 +377,16 @@ type FileDesc struct {
 	size int64
 }
 
-const MERGE_ITERATIONS = 4
+const MERGE_ITERATIONS = config.MergeTierCount
 
 // get merge configurations from the overall configuration
 // Each merge configuration is [3]int64 array {timeout in seconds, max result bytes, iteration id}
 func getMergeConfigurations() [][3]int64 {
-	timeoutS := int64(config.Config.Gigapi.MergeTimeoutS)
-	return [][3]int64{
-		{timeoutS, 100 * 1024 * 1024, 1},
-		{timeoutS * 10, 400 * 1024 * 1024, 2},
-		{timeoutS * 100, 4000 * 1024 * 1024, 3},
-		{timeoutS * 420, 4000 * 1024 * 1024, 4},
+	res := make([][3]int64, len(config.Get().Gigapi.Merges.Tiers))
+	for i, tier := range config.Get().Gigapi.Merges.Tiers {
+		res[i] = [3]int64{int64(tier.TimeoutS), tier.MaxSizeMB * 1024 * 1024, int64(i + 1)}
 	}
+	return res
 }
 
 func (s *MergeTreeService) PlanMerge() ([]PlanMerge, error) {
@@ -374,6 +420,17 @@ func (s *MergeTreeService) DoMerge() error {
 	return s.Merge(plan)
 }
 
+// Discoverer is implemented by the services which can pick up the partitions
+// written by the other processes sharing the data root
+type Discoverer interface {
+	Discover() error
+}
+
+// Compactor is implemented by the services which can run all the merge iterations on demand
+type Compactor interface {
+	Compact() error
+}
+
 type MergeService interface {
 	Run()
 	Stop()
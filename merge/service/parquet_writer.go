@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/apache/arrow/go/v14/parquet/schema"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"io"
+)
+
+// writeParquet writes the record as pqarrow.FileWriter does, except that the JSON and UUID columns
+// are marked with the JSON and UUID logical types, which pqarrow can't write.
+func writeParquet(w io.Writer, record arrow.Record, props *parquet.WriterProperties) error {
+	arrprops := pqarrow.NewArrowWriterProperties()
+	pqSchema, err := pqarrow.ToParquet(record.Schema(), props, arrprops)
+	if err != nil {
+		return err
+	}
+	root := pqSchema.Root()
+	fields := make(schema.FieldList, root.NumFields())
+	for i := range fields {
+		fields[i], err = withLogicalTypes(root.Field(i), record.Schema().Field(i).Type)
+		if err != nil {
+			return err
+		}
+	}
+	rootNode, err := schema.NewGroupNode(root.Name(), root.RepetitionType(), fields, root.FieldID())
+	if err != nil {
+		return err
+	}
+	manifest, err := pqarrow.NewSchemaManifest(schema.NewSchema(rootNode), nil, &pqarrow.ArrowReadProperties{})
+	if err != nil {
+		return err
+	}
+
+	writer := file.NewParquetWriter(w, rootNode, file.WithWriterProps(props))
+	ctx := pqarrow.NewArrowWriteContext(context.Background(), &arrprops)
+	rowGroupSize := props.MaxRowGroupLength()
+	for offset := int64(0); offset < record.NumRows(); offset += rowGroupSize {
+		rec := record.NewSlice(offset, min(offset+rowGroupSize, record.NumRows()))
+		err = writeRowGroup(ctx, writer.AppendRowGroup(), rec, manifest, props.WriteBatchSize())
+		rec.Release()
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func writeRowGroup(ctx context.Context, rgw file.SerialRowGroupWriter, rec arrow.Record,
+	manifest *pqarrow.SchemaManifest, batchSize int64) error {
+	leafIdx := 0
+	for _, col := range rec.Columns() {
+		chunked := arrow.NewChunked(col.DataType(), []arrow.Array{col})
+		if col.DataType().ID() == arrow.DICTIONARY {
+			chunks, err := dictionaryChunks(col, batchSize)
+			chunked.Release()
+			if err != nil {
+				return err
+			}
+			chunked = arrow.NewChunked(col.DataType(), chunks)
+			releaseAll(chunks)
+		}
+		acw, err := pqarrow.NewArrowColumnWriter(chunked, 0, int64(col.Len()), manifest, rgw, leafIdx)
+		if err == nil {
+			err = acw.Write(ctx)
+		}
+		chunked.Release()
+		if err != nil {
+			return err
+		}
+		leafIdx += countLeaves(col.DataType())
+	}
+	return rgw.Close()
+}
+
+// dictionaryChunks copies the dictionary array into the chunks of at most batchSize rows and without offset.
+// The parquet writer of arrow v14 misreads the indices of the dictionary arrays having an offset,
+// the ones of a row group past the first one or of a write batch past the first one.
+func dictionaryChunks(col arrow.Array, batchSize int64) ([]arrow.Array, error) {
+	var res []arrow.Array
+	for offset := int64(0); offset < int64(col.Len()); offset += batchSize {
+		slice := array.NewSlice(col, offset, min(offset+batchSize, int64(col.Len())))
+		chunk, err := array.Concatenate([]arrow.Array{slice}, memory.DefaultAllocator)
+		slice.Release()
+		if err != nil {
+			releaseAll(res)
+			return nil, err
+		}
+		res = append(res, chunk)
+	}
+	return res, nil
+}
+
+func releaseAll(arrs []arrow.Array) {
+	for _, arr := range arrs {
+		arr.Release()
+	}
+}
+
+// countLeaves returns the number of the parquet columns of the arrow type
+func countLeaves(dt arrow.DataType) int {
+	switch _dt := dt.(type) {
+	case *arrow.StructType:
+		res := 0
+		for _, f := range _dt.Fields() {
+			res += countLeaves(f.Type)
+		}
+		return res
+	case *arrow.MapType:
+		return countLeaves(_dt.KeyType()) + countLeaves(_dt.ItemType())
+	case *arrow.ListType:
+		return countLeaves(_dt.Elem())
+	}
+	return 1
+}
+
+// withLogicalTypes returns the parquet node of the arrow type with the JSON strings
+// and the UUID bytes annotated with the JSON and UUID logical types
+func withLogicalTypes(node schema.Node, dt arrow.DataType) (schema.Node, error) {
+	if data_types.IsJSONType(dt) {
+		return schema.NewPrimitiveNodeLogical(node.Name(), node.RepetitionType(), schema.JSONLogicalType{},
+			parquet.Types.ByteArray, -1, node.FieldID())
+	}
+	if data_types.IsUUIDType(dt) {
+		return schema.NewPrimitiveNodeLogical(node.Name(), node.RepetitionType(), schema.UUIDLogicalType{},
+			parquet.Types.FixedLenByteArray, 16, node.FieldID())
+	}
+	group, ok := node.(*schema.GroupNode)
+	if !ok {
+		return node, nil
+	}
+	var childTypes []arrow.DataType
+	switch _dt := dt.(type) {
+	case *arrow.StructType:
+		for _, f := range _dt.Fields() {
+			childTypes = append(childTypes, f.Type)
+		}
+	case *arrow.ListType:
+		// list -> repeated group -> element
+		return withRepeatedChild(group, _dt.Elem(), false)
+	case *arrow.MapType:
+		// map -> repeated key_value -> key, value
+		return withRepeatedChild(group, arrow.StructOf(
+			arrow.Field{Name: "key", Type: _dt.KeyType()},
+			arrow.Field{Name: "value", Type: _dt.ItemType()}), true)
+	}
+	if len(childTypes) != group.NumFields() {
+		return node, nil
+	}
+	fields := make(schema.FieldList, group.NumFields())
+	for i := range fields {
+		var err error
+		fields[i], err = withLogicalTypes(group.Field(i), childTypes[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newGroupNode(group, fields)
+}
+
+// newGroupNode returns the copy of the group node with the fields
+func newGroupNode(group *schema.GroupNode, fields schema.FieldList) (schema.Node, error) {
+	if lt := group.LogicalType(); lt != nil && !lt.IsNone() {
+		return schema.NewGroupNodeLogical(group.Name(), group.RepetitionType(), fields, lt, group.FieldID())
+	}
+	return schema.NewGroupNode(group.Name(), group.RepetitionType(), fields, group.FieldID())
+}
+
+// withRepeatedChild rebuilds the list or map group which single repeated child holds
+// the elements of dt, or is the key_value group of dt if isMap
+func withRepeatedChild(group *schema.GroupNode, dt arrow.DataType, isMap bool) (schema.Node, error) {
+	if group.NumFields() != 1 {
+		return group, nil
+	}
+	repeated, ok := group.Field(0).(*schema.GroupNode)
+	if !ok || (!isMap && repeated.NumFields() != 1) {
+		return group, nil
+	}
+	var (
+		child schema.Node
+		err   error
+	)
+	if isMap {
+		child, err = withLogicalTypes(repeated, dt)
+	} else {
+		var elem schema.Node
+		elem, err = withLogicalTypes(repeated.Field(0), dt)
+		if err == nil {
+			child, err = newGroupNode(repeated, schema.FieldList{elem})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newGroupNode(group, schema.FieldList{child})
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PinsFolder keeps the lists of the files protected from the cleanup of the merged files,
+// e.g. while a snapshot of the table is exported
+const PinsFolder = "pins"
+
+type pinFile struct {
+	Files   []string `json:"files"`
+	Expires int64    `json:"expires"`
+}
+
+// PinFiles protects the files of the table from the cleanup until UnpinFiles is called
+// or the ttl expires. The pins are stored in the table folder to be respected by all the processes.
+func PinFiles(tablePath string, id string, files []string, ttl time.Duration) error {
+	err := os.MkdirAll(path.Join(tablePath, PinsFolder), 0755)
+	if err != nil {
+		return err
+	}
+	pin := pinFile{Expires: time.Now().Add(ttl).UnixNano()}
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		pin.Files = append(pin.Files, abs)
+	}
+	data, err := json.Marshal(pin)
+	if err != nil {
+		return err
+	}
+	fileName := path.Join(tablePath, PinsFolder, id+".json")
+	err = os.WriteFile(fileName+".bak", data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fileName+".bak", fileName)
+}
+
+func UnpinFiles(tablePath string, id string) error {
+	err := os.Remove(path.Join(tablePath, PinsFolder, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// IsPinned reports if the file is protected by a live pin
+func IsPinned(tablePath string, file string) bool {
+	entries, err := os.ReadDir(path.Join(tablePath, PinsFolder))
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(path.Join(tablePath, PinsFolder, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var pin pinFile
+		if json.Unmarshal(data, &pin) != nil || pin.Expires < time.Now().UnixNano() {
+			continue
+		}
+		for _, f := range pin.Files {
+			if f == abs {
+				return true
+			}
+		}
+	}
+	return false
+}
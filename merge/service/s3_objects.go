@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"path"
+	"strings"
+)
+
+func newMinioClient(conf s3Config) (*minio.Client, error) {
+	return minio.New(conf.url, &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.key, conf.secret, ""),
+		Secure: conf.secure,
+		Region: conf.region,
+	})
+}
+
+// DownloadFromS3 downloads the object of the s3://key:secret@host/bucket/path URL to the local file
+func DownloadFromS3(ctx context.Context, s3URL string, fileName string) error {
+	conf, err := parseS3URL(s3URL)
+	if err != nil {
+		return err
+	}
+	minioClient, err := newMinioClient(conf)
+	if err != nil {
+		return err
+	}
+	return minioClient.FGetObject(ctx, conf.bucket, conf.path, fileName, minio.GetObjectOptions{})
+}
+
+// UploadToS3 uploads the object with the name relative to the prefix of the S3 URL
+func UploadToS3(ctx context.Context, s3URL string, name string, r io.Reader, size int64) error {
+	conf, err := parseS3URL(s3URL)
+	if err != nil {
+		return err
+	}
+	minioClient, err := newMinioClient(conf)
+	if err != nil {
+		return err
+	}
+	_, err = minioClient.PutObject(ctx, conf.bucket, path.Join(conf.path, name), r, size,
+		minio.PutObjectOptions{})
+	return err
+}
+
+// ListS3 returns the names of all the objects under the prefix of the S3 URL relative to it
+func ListS3(ctx context.Context, s3URL string) ([]string, error) {
+	conf, err := parseS3URL(s3URL)
+	if err != nil {
+		return nil, err
+	}
+	minioClient, err := newMinioClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(conf.path, "/") + "/"
+	var res []string
+	for obj := range minioClient.ListObjects(ctx, conf.bucket,
+		minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		res = append(res, strings.TrimPrefix(obj.Key, prefix))
+	}
+	return res, nil
+}
+
+// GetS3Object opens the object with the name relative to the prefix of the S3 URL
+func GetS3Object(ctx context.Context, s3URL string, name string) (io.ReadCloser, error) {
+	conf, err := parseS3URL(s3URL)
+	if err != nil {
+		return nil, err
+	}
+	minioClient, err := newMinioClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return minioClient.GetObject(ctx, conf.bucket, path.Join(conf.path, name), minio.GetObjectOptions{})
+}
@@ -5,7 +5,8 @@ import (
 	"github.com/apache/arrow/go/v14/arrow/array"
 	"github.com/apache/arrow/go/v14/arrow/memory"
 	"github.com/apache/arrow/go/v14/parquet"
-	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/apache/arrow/go/v14/parquet/compress"
+	"github.com/gigapi/gigapi/v2/config"
 	"github.com/gigapi/gigapi/v2/merge/data_types"
 	"github.com/google/uuid"
 	"os"
@@ -27,6 +28,8 @@ type fsSaveService struct {
 	tmpPath     string
 	recordBatch *array.RecordBuilder
 	schema      *arrow.Schema
+	// the column types of the schema
+	types map[string]string
 }
 
 func (fs *fsSaveService) shouldRecreateSchema(fields []fieldDesc) bool {
@@ -34,13 +37,7 @@ func (fs *fsSaveService) shouldRecreateSchema(fields []fieldDesc) bool {
 		return true
 	}
 	for _, f := range fields {
-		found := false
-		for _, _f := range fs.schema.Fields() {
-			if _f.Name == f.GetName() {
-				found = true
-			}
-		}
-		if !found {
+		if tp, ok := fs.types[f.GetName()]; !ok || tp != f.GetType() {
 			return true
 		}
 	}
@@ -48,23 +45,36 @@ func (fs *fsSaveService) shouldRecreateSchema(fields []fieldDesc) bool {
 }
 
 // @param: filename []fieldDesc: [data type - fields name]
-func (fs *fsSaveService) maybeRecreateSchema(fields []fieldDesc) {
+func (fs *fsSaveService) maybeRecreateSchema(fields []fieldDesc) error {
 	if !fs.shouldRecreateSchema(fields) {
-		return
+		return nil
 	}
 	arrowFields := make([]arrow.Field, len(fields))
+	fs.types = make(map[string]string, len(fields))
 	for i, field := range fields {
-		var fieldType, _ = data_types.DataTypes[field.GetType()](field.GetName(), nil, 0, 0)
+		fs.types[field.GetName()] = field.GetType()
+		builder, err := data_types.GetColumnBuilder(field.GetType())
+		if err != nil {
+			return err
+		}
+		fieldType, err := builder(field.GetName(), nil, 0, 0)
+		if err != nil {
+			return err
+		}
 		arrowFields[i] = arrow.Field{Name: field.GetName(), Type: fieldType.ArrowDataType(), Nullable: true}
 	}
 
 	fs.schema = arrow.NewSchema(arrowFields, nil)
 	fs.recordBatch = array.NewRecordBuilder(memory.DefaultAllocator, fs.schema)
+	return nil
 }
 
 func (fs *fsSaveService) saveTmpFile(filename string, fields []fieldDesc, unorderedData dataStore) error {
-	fs.maybeRecreateSchema(fields)
-	err := unorderedData.StoreToArrow(fs.schema, fs.recordBatch)
+	err := fs.maybeRecreateSchema(fields)
+	if err != nil {
+		return err
+	}
+	err = unorderedData.StoreToArrow(fs.schema, fs.recordBatch)
 	if err != nil {
 		return err
 	}
@@ -80,17 +90,12 @@ func (fs *fsSaveService) saveTmpFile(filename string, fields []fieldDesc, unorde
 	defer file.Close()
 	// Set up Parquet writer properties
 	writerProps := parquet.NewWriterProperties(
-		parquet.WithMaxRowGroupLength(8124),
+		parquet.WithMaxRowGroupLength(int64(config.Get().Gigapi.Parquet.RowGroupSize)),
+		parquet.WithCompression(parquetCompression()),
+		// the DECIMAL columns are written as integers like DuckDB does
+		parquet.WithStoreDecimalAsInteger(true),
 	)
-	arrprops := pqarrow.NewArrowWriterProperties()
-
-	// Create Parquet file writer
-	writer, err := pqarrow.NewFileWriter(fs.schema, file, writerProps, arrprops)
-	if err != nil {
-		return err
-	}
-	defer writer.Close()
-	return writer.Write(record)
+	return writeParquet(file, record, writerProps)
 }
 
 func (fs *fsSaveService) Save(fields []fieldDesc, unorderedData dataStore) (string, error) {
@@ -111,3 +116,17 @@ func (fs *fsSaveService) Save(fields []fieldDesc, unorderedData dataStore) (stri
 	}
 	return fileName, os.Rename(tmpFileName, fileName)
 }
+
+func parquetCompression() compress.Compression {
+	switch config.Get().Gigapi.Parquet.Compression {
+	case "snappy":
+		return compress.Codecs.Snappy
+	case "gzip":
+		return compress.Codecs.Gzip
+	case "zstd":
+		return compress.Codecs.Zstd
+	case "brotli":
+		return compress.Codecs.Brotli
+	}
+	return compress.Codecs.Uncompressed
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"sync"
+)
+
+// pendingSave is a buffer detached from a partition and being saved to a parquet file
+type pendingSave struct {
+	store *unorderedDataStore
+	file  string
+	m     sync.Mutex
+}
+
+func (p *pendingSave) setFile(file string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.file = file
+}
+
+func (p *pendingSave) getFile() string {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.file
+}
+
+// BufferSnapshot is a copy of the rows of a table which are not yet visible in the index
+type BufferSnapshot struct {
+	Stores  []map[string]data_types.IColumn
+	pending []*pendingSave
+}
+
+// SavedFiles returns the absolute paths of the parquet files written after the snapshot
+// was taken from the rows included into the snapshot.
+// These files should be skipped to not read the rows twice.
+func (s *BufferSnapshot) SavedFiles() map[string]bool {
+	res := make(map[string]bool)
+	for _, p := range s.pending {
+		if file := p.getFile(); file != "" {
+			res[file] = true
+		}
+	}
+	return res
+}
+
+// Schema returns the union of the column types of all the stores
+func (s *BufferSnapshot) Schema() map[string]string {
+	res := make(map[string]string)
+	for _, store := range s.Stores {
+		for k, col := range store {
+			res[k] = col.GetTypeName()
+		}
+	}
+	return res
+}
+
+func (s *BufferSnapshot) merge(other *BufferSnapshot) {
+	s.Stores = append(s.Stores, other.Stores...)
+	s.pending = append(s.pending, other.pending...)
+}
+
+// Snapshotter is implemented by the services able to expose their not saved rows
+type Snapshotter interface {
+	Snapshot() *BufferSnapshot
+}
@@ -0,0 +1,262 @@
+package shared
+
+import (
+	"fmt"
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Partition granularities of the time part of a hive partition path
+const (
+	GranularityDay    = "day"
+	GranularityHour   = "hour"
+	GranularityMinute = "minute"
+)
+
+// Partition value used for rows without a value of the partition column (same as in Hive)
+const DefaultPartitionValue = "__HIVE_DEFAULT_PARTITION__"
+
+var partitionColumnCheck = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// timePartitionKeys are the keys of the time part of the partition paths, no tag can use them
+var timePartitionKeys = map[string]bool{"date": true, "hour": true, "minute": true}
+
+type granularity struct {
+	step   int64
+	rng    string
+	labels [][2]string // partition key - time layout
+}
+
+var granularities = map[string]granularity{
+	GranularityDay: {
+		step:   int64(24 * time.Hour),
+		rng:    "1d",
+		labels: [][2]string{{"date", "2006-01-02"}},
+	},
+	GranularityHour: {
+		step:   int64(time.Hour),
+		rng:    "1h",
+		labels: [][2]string{{"date", "2006-01-02"}, {"hour", "15"}},
+	},
+	GranularityMinute: {
+		step:   int64(time.Minute),
+		rng:    "1m",
+		labels: [][2]string{{"date", "2006-01-02"}, {"hour", "15"}, {"minute", "04"}},
+	},
+}
+
+// PartitionScheme describes the hive partitioning of a table:
+// date=YYYY-MM-DD[/hour=HH[/minute=MM]][/tag1=value1[/tag2=value2...]]
+type PartitionScheme struct {
+	Granularity string
+	Tags        []string
+}
+
+// ParsePartitionScheme parses a comma separated list of a granularity (day, hour or minute)
+// and tag columns, e.g. "day,region". The granularity defaults to hour.
+func ParsePartitionScheme(s string) (*PartitionScheme, error) {
+	res := &PartitionScheme{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if _, ok := granularities[part]; ok {
+			if res.Granularity != "" {
+				return nil, fmt.Errorf("partition scheme %q has more than one time granularity", s)
+			}
+			res.Granularity = part
+			continue
+		}
+		if !partitionColumnCheck.MatchString(part) {
+			return nil, fmt.Errorf("invalid partition column %q in partition scheme %q", part, s)
+		}
+		if timePartitionKeys[part] {
+			return nil, fmt.Errorf("partition column %q of partition scheme %q is reserved for the time partitions", part, s)
+		}
+		if slices.Contains(res.Tags, part) {
+			return nil, fmt.Errorf("partition scheme %q has the partition column %q more than once", s, part)
+		}
+		res.Tags = append(res.Tags, part)
+	}
+	if res.Granularity == "" {
+		res.Granularity = GranularityHour
+	}
+	return res, nil
+}
+
+// Range returns the time span of a single partition as it's written to the index
+func (s *PartitionScheme) Range() string {
+	return granularities[s.Granularity].rng
+}
+
+func (s *PartitionScheme) String() string {
+	return strings.Join(append([]string{s.Granularity}, s.Tags...), ",")
+}
+
+// EscapePartitionValue percent-encodes the characters unsafe for a partition folder name
+func EscapePartitionValue(v string) string {
+	if v == "" {
+		return DefaultPartitionValue
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '_' || c == '-' || c == '.' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func floorDiv(a, b int64) int64 {
+	res := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		res--
+	}
+	return res
+}
+
+// PartitionBy returns the partitioning function of a table following the scheme
+func (s *PartitionScheme) PartitionBy(tableName string) func(map[string]data_types.IColumn) ([]PartitionDesc, error) {
+	gran := granularities[s.Granularity]
+	return func(m map[string]data_types.IColumn) ([]PartitionDesc, error) {
+		tsCol, ok := m["__timestamp"]
+		if !ok {
+			return nil, fmt.Errorf("table %q does not have a '__timestamp' column", tableName)
+		}
+		data := tsCol.GetData()
+		if _, ok := data.(data_types.Nullable); ok {
+			return nil, fmt.Errorf("table %q: column '__timestamp' has null values, every row needs a timestamp", tableName)
+		}
+		tsData, ok := data.([]int64)
+		if !ok {
+			return nil, fmt.Errorf("column '__timestamp' has non-int64 data type")
+		}
+		tagCols := make([]data_types.IColumn, len(s.Tags))
+		for i, tag := range s.Tags {
+			tagCols[i] = m[tag]
+		}
+		tagValue := func(col data_types.IColumn, i int) string {
+			if col == nil || col.IsNull(int64(i)) {
+				return DefaultPartitionValue
+			}
+			if strs, ok := col.GetData().([]string); ok {
+				return EscapePartitionValue(strs[i])
+			}
+			if strs, ok := col.GetData().(data_types.DictStrings); ok {
+				return EscapePartitionValue(strs.Dict[strs.Keys[i]])
+			}
+			return EscapePartitionValue(fmt.Sprint(col.GetVal(int64(i))))
+		}
+
+		parts := make(map[string]*PartitionDesc)
+		var order []string
+		var (
+			lastBucket int64
+			lastTags   = make([]string, len(s.Tags))
+			lastPart   *PartitionDesc
+		)
+		for i, ts := range tsData {
+			bucket := floorDiv(ts, gran.step)
+			same := lastPart != nil && bucket == lastBucket
+			for j, col := range tagCols {
+				v := tagValue(col, i)
+				if v != lastTags[j] {
+					same = false
+					lastTags[j] = v
+				}
+			}
+			if !same {
+				lastBucket = bucket
+				values := make([][2]string, 0, len(gran.labels)+len(s.Tags))
+				bucketStart := time.Unix(0, bucket*gran.step).UTC()
+				for _, label := range gran.labels {
+					values = append(values, [2]string{label[0], bucketStart.Format(label[1])})
+				}
+				for j, tag := range s.Tags {
+					values = append(values, [2]string{tag, lastTags[j]})
+				}
+				key := partitionKey(values)
+				if _, ok := parts[key]; !ok {
+					parts[key] = &PartitionDesc{
+						Values:   values,
+						IndexMap: make([]byte, (len(tsData)+7)/8),
+					}
+					order = append(order, key)
+				}
+				lastPart = parts[key]
+			}
+			lastPart.IndexMap[i/8] |= 1 << (uint(i) % 8)
+		}
+		res := make([]PartitionDesc, 0, len(parts))
+		for _, key := range order {
+			res = append(res, *parts[key])
+		}
+		return res, nil
+	}
+}
+
+func partitionKey(values [][2]string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = v[0] + "=" + v[1]
+	}
+	return strings.Join(parts, "/")
+}
+
+// PartitionTimeRange returns the time range [from, to] in nanoseconds covered by a partition
+// from its date=, hour= and minute= values. ok is false if the partition has no date.
+func PartitionTimeRange(values [][2]string) (from int64, to int64, ok bool) {
+	var (
+		date, hour, minute string
+		step               = 24 * time.Hour
+	)
+	for _, v := range values {
+		switch v[0] {
+		case "date":
+			date = v[1]
+		case "hour":
+			hour = v[1]
+			step = time.Hour
+		case "minute":
+			minute = v[1]
+			step = time.Minute
+		}
+	}
+	if date == "" {
+		return 0, 0, false
+	}
+	layout, value := "2006-01-02", date
+	if hour != "" {
+		layout, value = layout+" 15", value+" "+hour
+	}
+	if minute != "" {
+		layout, value = layout+":04", value+":"+minute
+	}
+	start, err := time.Parse(layout, value)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start.UnixNano(), start.Add(step).UnixNano() - 1, true
+}
+
+// ParsePartitionPath parses a relative partition path like `date=2025-04-10/hour=14`
+func ParsePartitionPath(p string) ([][2]string, error) {
+	var res [][2]string
+	for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) < 2 {
+			return nil, fmt.Errorf("invalid partition path: %s", p)
+		}
+		res = append(res, [2]string{kv[0], kv[1]})
+	}
+	return res, nil
+}
@@ -0,0 +1,80 @@
+package shared
+
+import (
+	"github.com/gigapi/gigapi/v2/merge/data_types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPartitionByHourSplitsDay(t *testing.T) {
+	scheme, err := ParsePartitionScheme("hour,region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC)
+	ts, _ := data_types.WrapToColumn("__timestamp", []int64{
+		day.Add(time.Hour).UnixNano(),
+		day.Add(2 * time.Hour).UnixNano(),
+		day.Add(time.Hour + time.Minute).UnixNano(),
+		day.Add(time.Hour).UnixNano(),
+	})
+	region, _ := data_types.WrapToColumn("region", []string{"us", "us", "us", "eu/west"})
+	parts, err := scheme.PartitionBy("test")(map[string]data_types.IColumn{
+		"__timestamp": ts,
+		"region":      region,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]byte{
+		"date=2025-04-10/hour=01/region=us":        0b0101,
+		"date=2025-04-10/hour=02/region=us":        0b0010,
+		"date=2025-04-10/hour=01/region=eu%2Fwest": 0b1000,
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("expected %d partitions, got %d", len(expected), len(parts))
+	}
+	for _, part := range parts {
+		mask, ok := expected[partitionKey(part.Values)]
+		if !ok {
+			t.Fatalf("unexpected partition %s", partitionKey(part.Values))
+		}
+		if part.IndexMap[0] != mask {
+			t.Fatalf("partition %s: expected mask %b, got %b", partitionKey(part.Values), mask, part.IndexMap[0])
+		}
+	}
+}
+
+func TestParsePartitionScheme(t *testing.T) {
+	if _, err := ParsePartitionScheme("day,hour"); err == nil {
+		t.Fatal("expected error for two granularities")
+	}
+	for _, scheme := range []string{"day,date", "minute,date", "hour,region,region"} {
+		if _, err := ParsePartitionScheme(scheme); err == nil {
+			t.Fatalf("%s: expected error", scheme)
+		}
+	}
+	scheme, err := ParsePartitionScheme("region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scheme.Granularity != GranularityHour || scheme.Range() != "1h" {
+		t.Fatalf("unexpected default granularity %s", scheme.Granularity)
+	}
+}
+
+func TestPartitionByRejectsNullTimestamps(t *testing.T) {
+	scheme, err := ParsePartitionScheme("hour")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := data_types.WrapToColumn("__timestamp", data_types.Nullable{Data: []int64{1, 0}, Valid: []byte{0b01}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = scheme.PartitionBy("test")(map[string]data_types.IColumn{"__timestamp": ts})
+	if err == nil || !strings.Contains(err.Error(), "null values") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package shared
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Predicate operators supported by the index pruning
+const (
+	OpEq = "="
+	OpNe = "!="
+	OpLt = "<"
+	OpLe = "<="
+	OpGt = ">"
+	OpGe = ">="
+)
+
+// Predicate is a `Column Op Value` condition used to skip files by their min/max statistics
+type Predicate struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	Value  any    `json:"value"`
+}
+
+var predicateRe = regexp.MustCompile(`^\s*([a-zA-Z0-9_]+)\s*(<=|>=|!=|=|<|>)\s*(.*?)\s*$`)
+
+// ParsePredicate parses a condition like `region=us` or `temperature>=10`.
+// Numeric values are parsed as numbers, everything else is a string.
+func ParsePredicate(s string) (Predicate, error) {
+	m := predicateRe.FindStringSubmatch(s)
+	if m == nil {
+		return Predicate{}, fmt.Errorf("invalid predicate %q", s)
+	}
+	var val any = m[3]
+	if i, err := strconv.ParseInt(m[3], 10, 64); err == nil {
+		val = i
+	} else if f, err := strconv.ParseFloat(m[3], 64); err == nil {
+		val = f
+	}
+	return Predicate{Column: m[1], Op: m[2], Value: val}, nil
+}
+
+// MayMatch reports if a file with the min/max statistics of the column may have matching rows
+func (p Predicate) MayMatch(_min, _max any) bool {
+	if _min == nil || _max == nil {
+		// no values of the column in the file
+		return false
+	}
+	cMin, ok := CompareStats(_min, p.Value)
+	if !ok {
+		return true
+	}
+	cMax, ok := CompareStats(_max, p.Value)
+	if !ok {
+		return true
+	}
+	switch p.Op {
+	case OpEq:
+		return cMin <= 0 && cMax >= 0
+	case OpNe:
+		return !(cMin == 0 && cMax == 0)
+	case OpLt:
+		return cMin < 0
+	case OpLe:
+		return cMin <= 0
+	case OpGt:
+		return cMax > 0
+	case OpGe:
+		return cMax >= 0
+	}
+	return true
+}
+
+// IndexQuery selects the files of a table overlapping the time range [MinTime, MaxTime]
+// and possibly matching all the predicates
+type IndexQuery struct {
+	MinTime    int64
+	MaxTime    int64
+	Predicates []Predicate
+}
+
+func NewIndexQuery() *IndexQuery {
+	return &IndexQuery{MinTime: math.MinInt64, MaxTime: math.MaxInt64}
+}
+
+// ParseIndexQuery returns the query of the time range (from, to) and of the `where` predicates.
+// The empty bounds are unlimited.
+func ParseIndexQuery(from, to string, where []string) (*IndexQuery, error) {
+	q := NewIndexQuery()
+	var err error
+	if from != "" {
+		if q.MinTime, err = parseTime(from); err != nil {
+			return nil, err
+		}
+	}
+	if to != "" {
+		if q.MaxTime, err = parseTime(to); err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range where {
+		p, err := ParsePredicate(w)
+		if err != nil {
+			return nil, err
+		}
+		q.Predicates = append(q.Predicates, p)
+	}
+	return q, nil
+}
+
+// parseTime parses a timestamp either in nanoseconds or in the RFC3339 format
+func parseTime(s string) (int64, error) {
+	if ns, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ns, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected nanoseconds or RFC3339", s)
+	}
+	return t.UnixNano(), nil
+}
+
+func (q *IndexQuery) Matches(e *IndexEntry) bool {
+	if q == nil {
+		return true
+	}
+	minTime, ok1 := e.Min["__timestamp"].(int64)
+	maxTime, ok2 := e.Max["__timestamp"].(int64)
+	if ok1 && ok2 && (maxTime < q.MinTime || minTime > q.MaxTime) {
+		return false
+	}
+	if !e.ColumnStats {
+		return true
+	}
+	for _, p := range q.Predicates {
+		if !p.MayMatch(e.Min[p.Column], e.Max[p.Column]) {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareStats compares two statistic values of the same kind.
+// The second result is false if the values are not comparable.
+func CompareStats(a, b any) (int, bool) {
+	switch _a := a.(type) {
+	case string:
+		if _b, ok := b.(string); ok {
+			return cmp.Compare(_a, _b), true
+		}
+		return 0, false
+	case int64:
+		if _b, ok := b.(int64); ok {
+			return cmp.Compare(_a, _b), true
+		}
+	case uint64:
+		if _b, ok := b.(uint64); ok {
+			return cmp.Compare(_a, _b), true
+		}
+	}
+	fa, ok := toFloat64(a)
+	if !ok {
+		return 0, false
+	}
+	fb, ok := toFloat64(b)
+	if !ok {
+		return 0, false
+	}
+	return cmp.Compare(fa, fb), true
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch _v := v.(type) {
+	case int64:
+		return float64(_v), true
+	case uint64:
+		return float64(_v), true
+	case float64:
+		return _v, true
+	}
+	return 0, false
+}
+
+// MergeStats combines the min/max statistics of several files
+func MergeStats(entries []*IndexEntry) (map[string]any, map[string]any, bool) {
+	_min := make(map[string]any)
+	_max := make(map[string]any)
+	columnStats := true
+	for _, e := range entries {
+		columnStats = columnStats && e.ColumnStats
+	}
+	// sign is -1 to keep the least value and 1 to keep the greatest one
+	mergeInto := func(res map[string]any, stats map[string]any, sign int) {
+		for k, v := range stats {
+			if !columnStats && k != "__timestamp" {
+				continue
+			}
+			cur, ok := res[k]
+			if !ok {
+				res[k] = v
+				continue
+			}
+			c, ok := CompareStats(v, cur)
+			if !ok {
+				// the column type differs between the files, the statistics can't be trusted
+				columnStats = false
+				continue
+			}
+			if c*sign > 0 {
+				res[k] = v
+			}
+		}
+	}
+	for _, e := range entries {
+		mergeInto(_min, e.Min, -1)
+		mergeInto(_max, e.Max, 1)
+	}
+	if !columnStats {
+		_min = map[string]any{"__timestamp": _min["__timestamp"]}
+		_max = map[string]any{"__timestamp": _max["__timestamp"]}
+	}
+	return _min, _max, columnStats
+}
@@ -0,0 +1,56 @@
+package shared
+
+import "testing"
+
+func TestIndexQueryMatches(t *testing.T) {
+	entry := &IndexEntry{
+		Min:         map[string]any{"__timestamp": int64(100), "region": "eu", "temp": float64(1)},
+		Max:         map[string]any{"__timestamp": int64(200), "region": "us", "temp": float64(30)},
+		ColumnStats: true,
+	}
+	for _, c := range []struct {
+		minTime, maxTime int64
+		where            string
+		expected         bool
+	}{
+		{0, 99, "", false},
+		{150, 250, "", true},
+		{0, 1000, "region=fr", true},
+		{0, 1000, "region=zz", false},
+		{0, 1000, "temp>30", false},
+		{0, 1000, "temp>=30", true},
+		{0, 1000, "host=a", false},
+	} {
+		q := NewIndexQuery()
+		q.MinTime, q.MaxTime = c.minTime, c.maxTime
+		if c.where != "" {
+			p, err := ParsePredicate(c.where)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q.Predicates = append(q.Predicates, p)
+		}
+		if q.Matches(entry) != c.expected {
+			t.Fatalf("[%d, %d] %s: expected %v", c.minTime, c.maxTime, c.where, c.expected)
+		}
+	}
+}
+
+func TestMergeStats(t *testing.T) {
+	_min, _max, columnStats := MergeStats([]*IndexEntry{
+		{
+			Min:         map[string]any{"__timestamp": int64(100), "temp": int64(5)},
+			Max:         map[string]any{"__timestamp": int64(200), "temp": int64(7)},
+			ColumnStats: true,
+		},
+		{
+			Min:         map[string]any{"__timestamp": int64(50), "temp": float64(6.5)},
+			Max:         map[string]any{"__timestamp": int64(150), "temp": float64(9.5)},
+			ColumnStats: true,
+		},
+	})
+	if !columnStats || _min["__timestamp"] != int64(50) || _max["__timestamp"] != int64(200) ||
+		_min["temp"] != int64(5) || _max["temp"] != float64(9.5) {
+		t.Fatalf("unexpected stats: %v %v %v", _min, _max, columnStats)
+	}
+}
@@ -17,16 +17,62 @@ type IndexEntry struct {
 	ChunkTime int64
 	Min       map[string]any
 	Max       map[string]any
+	// Min and Max hold the statistics of all the columns, not only of __timestamp
+	ColumnStats bool
 }
 
 type Index interface {
 	Batch(add []*IndexEntry, rm []string) utils.Promise[int32]
+	// CommitMerge adds the merge result, removes its sources and adds the dropped files
+	// to the drop queue as a single change, so they are never flushed apart
+	CommitMerge(merged *IndexEntry, sources []string, dropped []string) utils.Promise[int32]
 	Get(path string) *IndexEntry
 	Run()
 	Stop()
 	AddToDropQueue(files []string) utils.Promise[int32]
 	RmFromDropQueue(files []string) utils.Promise[int32]
 	GetDropQueue() []string
+	// Refresh reloads the changes made by the other processes sharing the index
+	Refresh() error
+	// Query returns the live files matching the query
+	Query(q *IndexQuery) []*IndexEntry
+}
+
+// PartitionSummary is the aggregated index of a single partition
+type PartitionSummary struct {
+	Path             string `json:"path"`
+	ParquetSizeBytes int64  `json:"parquet_size_bytes"`
+	RowCount         int64  `json:"row_count"`
+	MinTime          int64  `json:"min_time"`
+	MaxTime          int64  `json:"max_time"`
+	Files            int64  `json:"files"`
+}
+
+// TableManifest describes the whole table without walking its partitions
+type TableManifest struct {
+	Database         string             `json:"database"`
+	Table            string             `json:"table"`
+	Engine           string             `json:"engine"`
+	PartitionBy      string             `json:"partition_by,omitempty"`
+	OrderBy          []string           `json:"order_by"`
+	ParquetSizeBytes int64              `json:"parquet_size_bytes"`
+	RowCount         int64              `json:"row_count"`
+	MinTime          int64              `json:"min_time"`
+	MaxTime          int64              `json:"max_time"`
+	Schema           map[string]string  `json:"schema"`
+	Partitions       []PartitionSummary `json:"partitions"`
+	UpdatedAt        int64              `json:"updated_at"`
+}
+
+// Manifest keeps the TableManifest up to date with the partition indexes
+type Manifest interface {
+	UpdatePartition(summary PartitionSummary)
+	UpdateSchema(schema map[string]string)
+	Get() *TableManifest
+	// Flush writes the pending updates
+	Flush()
+	Run()
+	Stop()
 }
 
 type Table struct {
@@ -36,6 +82,8 @@ type Table struct {
 	Engine        string
 	OrderBy       []string
 	PartitionBy   func(map[string]data_types.IColumn) ([]PartitionDesc, error)
+	Partitioning  *PartitionScheme
 	AutoTimestamp bool
 	IndexCreator  func(values [][2]string) (Index, error)
+	Manifest      Manifest
 }
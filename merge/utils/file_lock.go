@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"os"
+	"time"
+)
+
+// FileLock is an exclusive advisory lock shared by all the processes using the same data root
+type FileLock struct {
+	f    *os.File
+	name string
+}
+
+// LockFile waits for the exclusive lock of the file and creates the file if it's missing
+func LockFile(name string) (*FileLock, error) {
+	for {
+		l, ok, err := TryLockFile(name)
+		if err != nil || ok {
+			return l, err
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// TryLockFile takes the exclusive lock of the file if it's free. ok is false if the file is locked.
+func TryLockFile(name string) (l *FileLock, ok bool, err error) {
+	return tryLockFile(name)
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+// Without flock the lock is the existence of the file. The lock file of a crashed process
+// has to be removed manually.
+func tryLockFile(name string) (*FileLock, bool, error) {
+	f, err := os.OpenFile(name+".excl", os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &FileLock{f: f, name: name + ".excl"}, true, nil
+}
+
+func (l *FileLock) Unlock() error {
+	l.f.Close()
+	return os.Remove(l.name)
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// The flock locks are released by the OS when the process dies, so a crashed writer never
+// leaves a partition locked
+func tryLockFile(name string) (*FileLock, bool, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		f.Close()
+		return nil, false, nil
+	}
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	return &FileLock{f: f, name: name}, true, nil
+}
+
+func (l *FileLock) Unlock() error {
+	defer l.f.Close()
+	return syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+}
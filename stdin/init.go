@@ -12,10 +12,16 @@ import (
 // Module to get a request from stdin ane execute it.
 // Currently used to initialize docker build
 
-func Init() {
-	var useStdin bool
+var useStdin bool
+
+func init() {
 	flag.BoolVar(&useStdin, "stdin", false, "Use stdin as input")
-	flag.Parse()
+}
+
+func Init() {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
 
 	if !useStdin {
 		return
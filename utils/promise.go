@@ -39,17 +39,22 @@ func (p *SinglePromise[T]) Get() (T, error) {
 	return p.res, p.err
 }
 
+// Peek returns the result without waiting, the result is only set once nothing is pending
 func (p *SinglePromise[T]) Peek() (int32, T, error) {
-	return atomic.LoadInt32(&p.pending), p.res, p.err
+	if pending := atomic.LoadInt32(&p.pending); pending != 0 {
+		var res T
+		return pending, res, nil
+	}
+	return 0, p.res, p.err
 }
 
 func (p *SinglePromise[T]) Done(res T, err error) {
 	if atomic.LoadInt32(&p.pending) == 0 {
 		return
 	}
-	p.pending = 0
 	p.res = res
 	p.err = err
+	atomic.StoreInt32(&p.pending, 0)
 	p.lock.Unlock()
 }
 